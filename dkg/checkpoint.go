@@ -0,0 +1,585 @@
+package dkg
+
+// Crash-resumable participants
+//
+// A DKG among operators in different places can take hours, and a
+// participant that restarts must not start over: dealing again with fresh
+// polynomials is equivocation (see transcript.go), and losing the received
+// shares loses the key. A Checkpoint holds the complete Participant state
+// (its polynomials, the commitments and shares received, complaints, QUAL and
+// the current step) and the signed messages of the current round, sealed
+// with XChaCha20-Poly1305 under
+//
+//	k = HKDF-SHA256(checkpoint key, salt = session, info = checkpointContext)
+//
+// where the checkpoint key is a long-term secret of the participant. The
+// header [version][session][sequence] is authenticated as additional data.
+//
+// A checkpoint can therefore not be opened in another session. Against
+// rollback, every checkpoint has a sequence number, and the caller keeps the
+// sequence of the last checkpoint it wrote in storage that cannot be rolled
+// back (a monotonic counter, a remote service); OpenCheckpoint rejects older
+// checkpoints. Otherwise an attacker with access to the disk could restore
+// the state before a Deal, making the participant deal twice.
+//
+// The participant writes a checkpoint after each step, before sending the
+// step's messages. After a restart it opens the latest checkpoint, sends the
+// messages of its Outbox again and continues with the next step, with the
+// messages of the round it receives from the others.
+//
+// Run does this itself when RunConfig has a Checkpoint function: it writes a
+// checkpoint after dealing and after each round, which also holds the state
+// of the run (transcript, received messages and every message it sent), and
+// continues from RunConfig.Resume (see run.go).
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// CheckpointKeyBytes is the size of a checkpoint key
+	CheckpointKeyBytes = chacha20poly1305.KeySize
+
+	// CheckpointVersion is the version byte of the checkpoint encoding. It
+	// is 2 since participant indexes in the state are 16-bit.
+	CheckpointVersion = 2
+
+	// checkpointHeaderBytes is the size of the authenticated header
+	checkpointHeaderBytes = 1 + SessionIDBytes + 8
+
+	// checkpointContext is the HKDF info of checkpoint keys
+	checkpointContext = "go-oprf DKG checkpoint v1"
+)
+
+// Checkpoint is the resumable state of one participant in one session.
+type Checkpoint struct {
+	Session     SessionID
+	Sequence    uint64
+	Participant *Participant
+	// Outbox holds the signed messages of the participant's current round,
+	// to send again after a restart. In checkpoints of Run it holds every
+	// message the participant sent.
+	Outbox []*Message
+
+	// run is the encoded state of a Run, if the checkpoint was written by one
+	run []byte
+}
+
+// Seal encrypts the checkpoint for storage.
+//
+// Parameters:
+//   - key: The participant's long-term checkpoint key
+//
+// Returns:
+//   - The sealed checkpoint: [version:1][session:32][sequence:8][nonce:24][ciphertext]
+//   - Error if the state cannot be encoded or the outbox holds messages of
+//     another session or participant
+func (c *Checkpoint) Seal(key [CheckpointKeyBytes]byte) ([]byte, error) {
+	if c.Participant == nil {
+		return nil, errors.New("dkg: checkpoint has no participant")
+	}
+	state, err := c.Participant.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(state)
+
+	for _, m := range c.Outbox {
+		if m.Session != c.Session || m.Sender != c.Participant.self {
+			return nil, errors.New("dkg: outbox message of another session or participant")
+		}
+	}
+	plaintext := binary.BigEndian.AppendUint32(nil, uint32(len(state)))
+	plaintext = append(plaintext, state...)
+	plaintext, err = appendMessages(plaintext, c.Outbox)
+	if err != nil {
+		return nil, err
+	}
+	plaintext = binary.BigEndian.AppendUint32(plaintext, uint32(len(c.run)))
+	plaintext = append(plaintext, c.run...)
+	defer clear(plaintext)
+
+	aead, err := checkpointAEAD(key, c.Session)
+	if err != nil {
+		return nil, err
+	}
+	header := checkpointHeader(c.Session, c.Sequence)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	data := append(header, nonce...)
+	return aead.Seal(data, nonce, plaintext, header), nil
+}
+
+// OpenCheckpoint decrypts a sealed checkpoint.
+//
+// Parameters:
+//   - key: The participant's long-term checkpoint key
+//   - session: The session being resumed
+//   - latest: The sequence of the last checkpoint written, from
+//     rollback-protected storage
+//   - data: The sealed checkpoint
+//
+// Returns:
+//   - The checkpoint
+//   - Error if it belongs to another session, is older than latest, or does
+//     not decrypt or decode
+func OpenCheckpoint(key [CheckpointKeyBytes]byte, session SessionID, latest uint64, data []byte) (*Checkpoint, error) {
+	if len(data) < checkpointHeaderBytes+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return nil, errors.New("dkg: invalid checkpoint length")
+	}
+	if data[0] != CheckpointVersion {
+		return nil, errors.New("dkg: unsupported checkpoint version")
+	}
+	if SessionID(data[1:1+SessionIDBytes]) != session {
+		return nil, errors.New("dkg: checkpoint belongs to another session")
+	}
+	sequence := binary.BigEndian.Uint64(data[1+SessionIDBytes : checkpointHeaderBytes])
+	if sequence < latest {
+		return nil, errors.New("dkg: checkpoint is older than the latest one")
+	}
+
+	aead, err := checkpointAEAD(key, session)
+	if err != nil {
+		return nil, err
+	}
+	header, nonce := data[:checkpointHeaderBytes], data[checkpointHeaderBytes:checkpointHeaderBytes+chacha20poly1305.NonceSizeX]
+	plaintext, err := aead.Open(nil, nonce, data[checkpointHeaderBytes+chacha20poly1305.NonceSizeX:], header)
+	if err != nil {
+		return nil, errors.New("dkg: checkpoint decryption failed")
+	}
+	defer clear(plaintext)
+
+	r := &stateReader{data: plaintext}
+	p := new(Participant)
+	if err := p.UnmarshalBinary(r.take(int(r.uint32()))); err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{Session: session, Sequence: sequence, Participant: p}
+	c.Outbox = r.messages()
+	for _, m := range c.Outbox {
+		if m.Session != session || m.Sender != p.self {
+			return nil, errors.New("dkg: outbox message of another session or participant")
+		}
+	}
+	if run := r.take(int(r.uint32())); len(run) > 0 {
+		c.run = append([]byte(nil), run...)
+	}
+	if err := r.done(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// MarshalBinary encodes the participant's complete state, including its
+// secret polynomials. Store it only sealed in a Checkpoint.
+func (p *Participant) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint16(nil, p.n)
+	data = binary.BigEndian.AppendUint16(data, p.threshold)
+	data = binary.BigEndian.AppendUint16(data, p.self)
+	data = append(data, uint8(p.step))
+	data = appendScalars(data, p.a)
+	data = appendScalars(data, p.b)
+
+	var err error
+	for i := range p.n {
+		if data, err = appendElements(data, p.commitments[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range p.n {
+		if data, err = appendElements(data, p.extractions[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range p.n {
+		pair := p.shares[i]
+		if pair[0].Value == nil || pair[1].Value == nil {
+			data = append(data, 0)
+			continue
+		}
+		encoded, err := marshalSharePair(0, 0, pair)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, 1), encoded[4:]...)
+	}
+	for i := range p.n {
+		data = appendIndexes(data, p.accusers[i])
+	}
+	data = appendIndexes(data, p.qual)
+	for i := range p.n {
+		data = append(data, boolByte(p.disqualified[i]), boolByte(p.reconstructing[i]))
+	}
+
+	complaints, err := marshalList(p.complaints)
+	if err != nil {
+		return nil, err
+	}
+	evidence, err := marshalList(p.ownEvidence)
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, complaints...)
+	return append(data, evidence...), nil
+}
+
+// UnmarshalBinary restores a participant's state encoded by MarshalBinary.
+func (p *Participant) UnmarshalBinary(data []byte) error {
+	r := &stateReader{data: data}
+	header := r.take(7)
+	if r.err != nil {
+		return r.err
+	}
+	restored, err := NewParticipant(binary.BigEndian.Uint16(header), binary.BigEndian.Uint16(header[2:]), binary.BigEndian.Uint16(header[4:]))
+	if err != nil {
+		return err
+	}
+	n, threshold := restored.n, restored.threshold
+	if header[6] > uint8(stepDone) {
+		return errors.New("dkg: invalid participant step")
+	}
+	restored.step = step(header[6])
+
+	restored.a, restored.b = r.scalars(), r.scalars()
+	if restored.step > stepDeal && (len(restored.a) != int(threshold) || len(restored.b) != int(threshold)) {
+		return errors.New("dkg: invalid participant polynomials")
+	}
+	for i := range n {
+		restored.commitments[i] = r.elements(threshold)
+	}
+	for i := range n {
+		restored.extractions[i] = r.elements(threshold)
+	}
+	for i := range n {
+		if r.uint8() == 1 {
+			_, _, restored.shares[i], err = unmarshalSharePair(append([]byte{0, 0, 0, 0}, r.take(sharePairBytes)...))
+			if r.err == nil && err != nil {
+				return err
+			}
+			if r.err == nil && (restored.shares[i][0].Index != restored.self || restored.shares[i][1].Index != restored.self) {
+				return errors.New("dkg: participant share of another index")
+			}
+		}
+	}
+	for i := range n {
+		restored.accusers[i] = r.indexes(n)
+	}
+	restored.qual = r.indexes(n)
+	for i := range n {
+		flags := r.take(2)
+		if r.err == nil {
+			restored.disqualified[i], restored.reconstructing[i] = flags[0] == 1, flags[1] == 1
+		}
+	}
+	restored.complaints = readList[Complaint](r, 4)
+	restored.ownEvidence = readList[ExtractionComplaint](r, 4+sharePairBytes)
+	if err := r.done(); err != nil {
+		return err
+	}
+
+	*p = *restored
+	return nil
+}
+
+// checkpointAEAD derives the AEAD of a session's checkpoints
+func checkpointAEAD(key [CheckpointKeyBytes]byte, session SessionID) (cipher.AEAD, error) {
+	derived, err := hkdf.Key(sha256.New, key[:], session[:], checkpointContext, CheckpointKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(derived)
+	return chacha20poly1305.NewX(derived)
+}
+
+// checkpointHeader returns the authenticated header of a checkpoint
+func checkpointHeader(session SessionID, sequence uint64) []byte {
+	header := append([]byte{CheckpointVersion}, session[:]...)
+	return binary.BigEndian.AppendUint64(header, sequence)
+}
+
+// appendScalars appends [count:2 bytes][scalars]
+func appendScalars(data []byte, scalars []*ristretto255.Scalar) []byte {
+	data = binary.BigEndian.AppendUint16(data, uint16(len(scalars)))
+	for _, s := range scalars {
+		data = s.Encode(data)
+	}
+	return data
+}
+
+// appendElements appends [count:2 bytes][elements]
+func appendElements(data []byte, elements []*ristretto255.Element) ([]byte, error) {
+	encoded, err := marshalCommitments(0, elements)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, encoded[2:]...), nil
+}
+
+// appendIndexes appends [count:2 bytes][indexes:2 bytes each]
+func appendIndexes(data []byte, indexes []uint16) []byte {
+	data = binary.BigEndian.AppendUint16(data, uint16(len(indexes)))
+	for _, i := range indexes {
+		data = binary.BigEndian.AppendUint16(data, i)
+	}
+	return data
+}
+
+// boolByte encodes a flag
+func boolByte(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// stateReader decodes a participant state. The first error sticks and
+// later reads return zero values.
+type stateReader struct {
+	data []byte
+	err  error
+}
+
+// take returns the next size bytes
+func (r *stateReader) take(size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if size < 0 || len(r.data) < size {
+		r.err = errors.New("dkg: invalid participant state length")
+		return nil
+	}
+	b := r.data[:size]
+	r.data = r.data[size:]
+	return b
+}
+
+// uint8 returns the next byte
+func (r *stateReader) uint8() uint8 {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+// uint16 returns the next big-endian uint16
+func (r *stateReader) uint16() uint16 {
+	b := r.take(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+// uint32 returns the next big-endian uint32
+func (r *stateReader) uint32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// scalars reads [count:2 bytes][scalars]
+func (r *stateReader) scalars() []*ristretto255.Scalar {
+	count := int(r.uint16())
+	if count == 0 {
+		return nil
+	}
+	data := r.take(count * ScalarBytes)
+	scalars := make([]*ristretto255.Scalar, count)
+	for k := range scalars {
+		if r.err != nil {
+			return nil
+		}
+		scalars[k] = ristretto255.NewScalar()
+		if err := scalars[k].Decode(data[k*ScalarBytes : (k+1)*ScalarBytes]); err != nil {
+			r.err = err
+		}
+	}
+	return scalars
+}
+
+// elements reads [count:2 bytes][elements] of either 0 or threshold elements
+func (r *stateReader) elements(threshold uint16) []*ristretto255.Element {
+	count := r.uint16()
+	if count == 0 {
+		return nil
+	}
+	if count != threshold {
+		if r.err == nil {
+			r.err = errors.New("dkg: invalid participant commitments")
+		}
+		return nil
+	}
+	header := binary.BigEndian.AppendUint16([]byte{0, 0}, count)
+	_, elements, err := unmarshalCommitments(append(header, r.take(int(count)*ElementBytes)...))
+	if r.err == nil && err != nil {
+		r.err = err
+	}
+	return elements
+}
+
+// indexes reads [count:2 bytes][indexes:2 bytes each] of participants 1 to n
+func (r *stateReader) indexes(n uint16) []uint16 {
+	count := int(r.uint16())
+	data := r.take(2 * count)
+	if r.err != nil || count == 0 {
+		return nil
+	}
+	indexes := make([]uint16, count)
+	for k := range indexes {
+		indexes[k] = binary.BigEndian.Uint16(data[2*k:])
+		if indexes[k] < 1 || indexes[k] > n {
+			r.err = errors.New("dkg: invalid participant index")
+			return nil
+		}
+	}
+	return indexes
+}
+
+// readList reads a list encoded with marshalList
+func readList[T any, P interface {
+	*T
+	UnmarshalBinary([]byte) error
+}](r *stateReader, size int) []T {
+	count := r.uint16()
+	data := r.take(int(count) * size)
+	if r.err != nil || count == 0 {
+		return nil
+	}
+	items, err := unmarshalList[T, P](append(binary.BigEndian.AppendUint16(nil, count), data...), size)
+	if err != nil {
+		r.err = err
+	}
+	return items
+}
+
+// done checks that the whole state was read
+func (r *stateReader) done() error {
+	if r.err == nil && len(r.data) != 0 {
+		r.err = errors.New("dkg: invalid participant state length")
+	}
+	return r.err
+}
+
+// marshalState encodes the state of a Run besides the Participant and the
+// messages it sent:
+// [phase:1][dropped][closed inboxes][echoed rounds][copied rounds]
+// [transcript messages][pending messages][sealed shares]
+func (r *runner) marshalState() ([]byte, error) {
+	data := appendIndexes([]byte{r.phase}, r.dropped)
+
+	data = append(data, uint8(len(r.closed)))
+	for key := range r.closed {
+		data = append(data, uint8(key.round), uint8(key.sub))
+	}
+	for _, rounds := range []map[Round]bool{r.echoed, r.copied} {
+		data = append(data, uint8(len(rounds)))
+		for round := range rounds {
+			data = append(data, uint8(round))
+		}
+	}
+
+	var pending, sealed []*Message
+	for _, inbox := range r.pending {
+		for _, messages := range inbox {
+			pending = append(pending, messages...)
+		}
+	}
+	for _, messages := range r.sealed {
+		sealed = append(sealed, messages...)
+	}
+
+	var err error
+	for _, messages := range [][]*Message{r.transcript.records(), pending, sealed} {
+		if data, err = appendMessages(data, messages); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// restore continues a Run from a checkpoint written by it
+func (r *runner) restore(c *Checkpoint) error {
+	if c.run == nil || c.Participant == nil {
+		return errors.New("dkg: checkpoint was not written by Run")
+	}
+	p := c.Participant
+	if c.Session != r.config.Session || p.n != r.n || p.threshold != r.config.Threshold || p.self != r.config.Self {
+		return errors.New("dkg: checkpoint belongs to another run")
+	}
+	r.participant, r.sent, r.sequence = p, c.Outbox, c.Sequence
+
+	s := &stateReader{data: c.run}
+	r.phase = s.uint8()
+	r.dropped = s.indexes(r.n)
+	closed := s.take(2 * int(s.uint8()))
+	for k := 0; k+1 < len(closed); k += 2 {
+		r.closed[inboxKey{round: Round(closed[k]), sub: Round(closed[k+1])}] = true
+	}
+	for _, rounds := range []map[Round]bool{r.echoed, r.copied} {
+		for _, round := range s.take(int(s.uint8())) {
+			rounds[Round(round)] = true
+		}
+	}
+
+	for _, m := range s.messages() {
+		if _, err := r.transcript.Add(m); err != nil {
+			return err
+		}
+	}
+	for _, m := range s.messages() {
+		if key, ok := messageKey(m); ok {
+			r.file(key, m)
+		}
+	}
+	r.sealed = make(map[uint16][]*Message)
+	for _, m := range s.messages() {
+		r.sealed[m.Sender] = append(r.sealed[m.Sender], m)
+	}
+	return s.done()
+}
+
+// appendMessages appends [count:4 bytes]([length:4 bytes][message])*
+func appendMessages(data []byte, messages []*Message) ([]byte, error) {
+	data = binary.BigEndian.AppendUint32(data, uint32(len(messages)))
+	for _, m := range messages {
+		encoded, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = binary.BigEndian.AppendUint32(data, uint32(len(encoded)))
+		data = append(data, encoded...)
+	}
+	return data, nil
+}
+
+// messages reads messages encoded with appendMessages
+func (r *stateReader) messages() []*Message {
+	var messages []*Message
+	for range r.uint32() {
+		encoded := r.take(int(r.uint32()))
+		if r.err != nil {
+			return nil
+		}
+		m := new(Message)
+		if err := m.UnmarshalBinary(encoded); err != nil {
+			r.err = err
+			return nil
+		}
+		messages = append(messages, m)
+	}
+	return messages
+}
@@ -0,0 +1,216 @@
+package dkg
+
+import (
+	"crypto/rand"
+	"slices"
+	"testing"
+
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// restart seals a participant in a checkpoint and restores it, as after a
+// crash
+func restart(t *testing.T, key [CheckpointKeyBytes]byte, session SessionID, sequence uint64, p *Participant) *Participant {
+	t.Helper()
+
+	sealed, err := (&Checkpoint{Session: session, Sequence: sequence, Participant: p}).Seal(key)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	c, err := OpenCheckpoint(key, session, sequence, sealed)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint failed: %v", err)
+	}
+	return c.Participant
+}
+
+// TestCheckpointResume tests a GJKR run in which every participant restarts
+// from a checkpoint after every step, with a complaint to carry through
+func TestCheckpointResume(t *testing.T) {
+	const n, threshold = 3, 2
+	var key [CheckpointKeyBytes]byte
+	rand.Read(key[:])
+	session, _ := NewSessionID()
+
+	participants := make([]*Participant, n)
+	deals := make([]*Deal, n)
+	var shares []*PrivateShare
+	for i := range participants {
+		participants[i], _ = NewParticipant(n, threshold, uint16(i+1))
+		var private []PrivateShare
+		deals[i], private, _ = participants[i].Deal()
+		for k := range private {
+			// Dealer 1 sends participant 2 a bad share
+			if private[k].Dealer == 1 && private[k].Recipient == 2 {
+				private[k].Share[0] = private[k].Share[1]
+			}
+			shares = append(shares, &private[k])
+		}
+	}
+
+	sequence := uint64(0)
+	checkpoint := func() {
+		sequence++
+		for i, p := range participants {
+			participants[i] = restart(t, key, session, sequence, p)
+		}
+	}
+
+	checkpoint()
+	var complaints []Complaint
+	for _, p := range participants {
+		c, err := p.Verify(deals, shares)
+		if err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		complaints = append(complaints, c...)
+	}
+
+	checkpoint()
+	var justifications []Justification
+	for _, p := range participants {
+		j, err := p.Justify(complaints)
+		if err != nil {
+			t.Fatalf("Justify failed: %v", err)
+		}
+		justifications = append(justifications, j...)
+	}
+
+	checkpoint()
+	var extractions []*Extraction
+	for _, p := range participants {
+		e, err := p.Qualify(justifications)
+		if err != nil {
+			t.Fatalf("Qualify failed: %v", err)
+		}
+		extractions = append(extractions, e)
+	}
+
+	checkpoint()
+	for _, p := range participants {
+		if evidence, err := p.VerifyExtractions(extractions); err != nil || len(evidence) != 0 {
+			t.Fatalf("VerifyExtractions = %v, %v", evidence, err)
+		}
+	}
+
+	checkpoint()
+	for _, p := range participants {
+		if _, err := p.Reveal(nil); err != nil {
+			t.Fatalf("Reveal failed: %v", err)
+		}
+	}
+
+	checkpoint()
+	var final []toprf.Share16
+	var results []*Result
+	for _, p := range participants {
+		share, result, err := p.Finish(nil)
+		if err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		final = append(final, share)
+		results = append(results, result)
+	}
+
+	for _, result := range results {
+		if !slices.Equal(result.Qual, []uint16{1, 2, 3}) || result.PublicKey.Equal(results[0].PublicKey) != 1 {
+			t.Errorf("Results differ after resuming: QUAL %v", result.Qual)
+		}
+	}
+	if _, err := Reconstruct16(final); err != nil {
+		t.Errorf("Reconstruct failed: %v", err)
+	}
+
+	// A finished participant can be checkpointed too
+	restart(t, key, session, sequence+1, participants[0])
+}
+
+// TestCheckpointProtection tests that checkpoints cannot be rolled back,
+// moved to another session or modified
+func TestCheckpointProtection(t *testing.T) {
+	keys, _, _ := newTestRoster(t, 3)
+	var key [CheckpointKeyBytes]byte
+	rand.Read(key[:])
+	session, _ := NewSessionID()
+	other, _ := NewSessionID()
+
+	p, _ := NewParticipant(3, 2, 1)
+	before, _ := (&Checkpoint{Session: session, Sequence: 1, Participant: p}).Seal(key)
+
+	deal, _, _ := p.Deal()
+	signer, _ := NewSigner(session, 1, keys[0])
+	m, _ := signer.SignDeal(deal)
+	after, err := (&Checkpoint{Session: session, Sequence: 2, Participant: p, Outbox: []*Message{m}}).Seal(key)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+
+	// Step 1: The latest checkpoint restores the deal and the outbox
+	c, err := OpenCheckpoint(key, session, 2, after)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint failed: %v", err)
+	}
+	if len(c.Outbox) != 1 || c.Outbox[0].Round != RoundDeal || c.Sequence != 2 {
+		t.Errorf("Outbox = %v, sequence %d", c.Outbox, c.Sequence)
+	}
+	if _, _, err := c.Participant.Deal(); err == nil {
+		t.Error("Restored participant dealt again")
+	}
+
+	// Step 2: The checkpoint before the deal is rejected
+	if _, err := OpenCheckpoint(key, session, 2, before); err == nil {
+		t.Error("OpenCheckpoint accepted a rolled back checkpoint")
+	}
+
+	// Step 3: Checkpoints are bound to the session, the key and their header
+	if _, err := OpenCheckpoint(key, other, 0, after); err == nil {
+		t.Error("OpenCheckpoint accepted a checkpoint of another session")
+	}
+	var wrong [CheckpointKeyBytes]byte
+	if _, err := OpenCheckpoint(wrong, session, 0, after); err == nil {
+		t.Error("OpenCheckpoint accepted the wrong key")
+	}
+	for _, k := range []int{1 + SessionIDBytes + 7, len(after) - 1} {
+		tampered := slices.Clone(after)
+		tampered[k] ^= 1
+		if _, err := OpenCheckpoint(key, session, 0, tampered); err == nil {
+			t.Errorf("OpenCheckpoint accepted a change at byte %d", k)
+		}
+	}
+
+	// Step 4: The outbox only holds the participant's messages of the session
+	foreign, _ := NewSigner(other, 1, keys[0])
+	m, _ = foreign.SignComplaints(nil)
+	if _, err := (&Checkpoint{Session: session, Participant: p, Outbox: []*Message{m}}).Seal(key); err == nil {
+		t.Error("Seal accepted a message of another session")
+	}
+
+	// Step 5: The outbox is not limited to 255 messages, since Run keeps
+	// every message it sent there
+	outbox := make([]*Message, 300)
+	for k := range outbox {
+		outbox[k], _ = signer.SignComplaints(nil)
+	}
+	large, err := (&Checkpoint{Session: session, Sequence: 3, Participant: p, Outbox: outbox}).Seal(key)
+	if err != nil {
+		t.Fatalf("Seal failed with %d outbox messages: %v", len(outbox), err)
+	}
+	c, err = OpenCheckpoint(key, session, 3, large)
+	if err != nil {
+		t.Fatalf("OpenCheckpoint failed: %v", err)
+	}
+	if len(c.Outbox) != len(outbox) {
+		t.Errorf("Restored %d outbox messages, want %d", len(c.Outbox), len(outbox))
+	}
+
+	// Step 6: Participant states are validated
+	state, _ := p.MarshalBinary()
+	var restored Participant
+	if err := restored.UnmarshalBinary(state[:len(state)-1]); err == nil {
+		t.Error("UnmarshalBinary accepted a truncated state")
+	}
+	state[3] = 42
+	if err := restored.UnmarshalBinary(state); err == nil {
+		t.Error("UnmarshalBinary accepted an invalid step")
+	}
+}
@@ -50,6 +50,42 @@
 //	// Now participant 1 has their share of the distributed secret
 //	// Any threshold participants can collaborate to use the secret
 //
+// FinishWithResult can be used instead of Finish to also obtain the public
+// Result of the DKG: the group public key, the verification key of every
+// participant and the set of qualified dealers. Result.Dealing feeds it to
+// the toprf package, e.g. to verify part proofs. See result.go.
+//
+// StartWithProof and VerifyConstantTerms add a proof of knowledge of each
+// dealer's constant term, so that no dealer can choose its commitment after
+// seeing the others' to bias the key. See pok.go.
+//
+// Start16, VerifyCommitment16, VerifyCommitments16, Finish16 and Reconstruct16
+// run the same protocol with toprf.Share16 for more than 255 participants,
+// and Share16, VerifyShareCommitment16, CombineShares16 and
+// ReconstructSecret16 do the same for the Pedersen VSS functions. The
+// networked protocol (Participant, Message, Roster, Run) has 16-bit indexes
+// throughout. See index16.go.
+//
+// StartWeighted, VerifyWeightedCommitments and FinishWeighted generate a key
+// for a toprf.WeightedScheme. See weighted.go.
+//
+// These functions leave it to the caller what to do about a dealer whose
+// shares do not verify. Participant runs the complete GJKR protocol instead:
+// complaints, justifications and disqualification of misbehaving dealers, and
+// reconstruction of dealers that publish inconsistent commitments. See
+// participant.go. Its messages are encoded and signed with the participants'
+// long-term Ed25519 keys by a Signer and authenticated against a Roster on
+// receipt. See message.go. Private shares are sealed to the recipient's
+// X25519 key, and a share that does not open becomes a complaint others can
+// check. See seal.go. A Transcript of the broadcasts and an echo round
+// detect participants that send different messages to different peers, with
+// signed evidence. See transcript.go. Run puts all of this together and runs
+// a Participant over any Transport, with round deadlines that drop
+// participants who do not respond. See run.go. A Participant's state can be
+// sealed in an encrypted Checkpoint, so that it resumes after a restart
+// instead of dealing again; Run writes checkpoints after every round and
+// resumes from them. See checkpoint.go.
+//
 // # Security Properties
 //
 // - Secret never exists in one location
@@ -66,13 +102,29 @@
 //
 // See the vss.go file for VSS-specific functions.
 //
+// # Key Maintenance
+//
+// Existing keys can be maintained without reconstructing the secret:
+//   - RefreshStart, VerifyRefreshCommitments and FinishRefresh re-randomize
+//     the shares by adding verified sharings of zero, so shares stolen before
+//     a refresh become useless. See refresh.go.
+//   - ReshareStart, VerifyReshareCommitments, FinishReshare and
+//     ReshareGroupCommitments move the key to a new committee with a
+//     different size or threshold. See reshare.go.
+//   - RepairStart, RepairAggregate and RepairFinish rebuild a participant's
+//     lost share with the help of threshold others. See repair.go.
+//   - EnrollStart and EnrollFinish issue a share at index n+1 to a new
+//     participant and update the Group metadata. See enroll.go.
+//   - UpdateStart, OpenUpdateToken and FinishUpdate rotate the key and
+//     publish a toprf.UpdateToken that upgrades stored OPRF results, like
+//     liboprf's toprf-update. See update.go.
+//
 // # Compatibility
 //
 // Ported from liboprf's dkg.c and fully compatible with the C implementation.
 package dkg
 
 import (
-	"crypto/subtle"
 	"errors"
 
 	"github.com/gtank/ristretto255"
@@ -96,29 +148,14 @@ func Start(n, threshold uint8) (
 	shares []toprf.Share,
 	err error,
 ) {
-	if threshold < 2 || threshold > n {
-		return nil, nil, errors.New("dkg: threshold must be > 1 and <= n")
-	}
-
-	// Generate random polynomial coefficients
-	a := make([]*ristretto255.Scalar, threshold)
-	for k := uint8(0); k < threshold; k++ {
-		a[k], err = randomScalar()
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-
-	// Compute commitments to coefficients: C_k = g^a_k
-	commitments = make([]*ristretto255.Element, threshold)
-	for k := uint8(0); k < threshold; k++ {
-		commitments[k] = ristretto255.NewElement().ScalarBaseMult(a[k])
+	commitments, wide, err := Start16(uint16(n), uint16(threshold))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Create shares for each participant: s_j = f(j)
 	shares = make([]toprf.Share, n)
-	for j := uint8(1); j <= n; j++ {
-		shares[j-1] = polynom(j, threshold, a)
+	for j := range wide {
+		shares[j] = toprf.Share{Index: uint8(wide[j].Index), Value: wide[j].Value}
 	}
 
 	return commitments, shares, nil
@@ -139,45 +176,7 @@ func Start(n, threshold uint8) (
 //
 // Corresponds to dkg_verify_commitment() in dkg.c:104-149
 func VerifyCommitment(n, threshold, self, i uint8, commitments []*ristretto255.Element, share toprf.Share) error {
-	if i == self {
-		return nil // Don't verify our own share
-	}
-
-	// v0 = g^(share.value)
-	v0 := ristretto255.NewElement().ScalarBaseMult(share.Value)
-
-	// v1 = C[0] * C[1]^j * C[2]^j^2 * ... * C[threshold-1]^j^(threshold-1)
-	// where j = self
-	j := scalarFromUint8(self)
-
-	// Start with v1 = C[0]
-	v1 := ristretto255.NewElement()
-	v1.Decode(commitments[0].Encode(nil))
-
-	// Add terms C[k]^j^k for k=1..threshold-1
-	for k := uint8(1); k < threshold; k++ {
-		// Compute j^k
-		jPowK := scalarFromUint8(1)
-		for exp := uint8(0); exp < k; exp++ {
-			jPowK.Multiply(jPowK, j)
-		}
-
-		// tmP = C[k]^j^k
-		tmP := ristretto255.NewElement()
-		tmP.ScalarMult(jPowK, commitments[k])
-
-		// v1 = v1 + tmP
-		v1.Add(v1, tmP)
-	}
-
-	// Check v0 == v1
-	v0Bytes := v0.Encode(nil)
-	v1Bytes := v1.Encode(nil)
-	if subtle.ConstantTimeCompare(v0Bytes, v1Bytes) != 1 {
-		return errors.New("dkg: commitment verification failed")
-	}
-
-	return nil
+	return VerifyCommitment16(uint16(n), uint16(threshold), uint16(self), uint16(i), commitments, share.Wide())
 }
 
 // VerifyCommitments verifies shares from all peers.
@@ -220,20 +219,14 @@ func VerifyCommitments(n, threshold, self uint8, commitments [][]*ristretto255.E
 //
 // Corresponds to dkg_finish() in dkg.c:171-186
 func Finish(shares []toprf.Share, self uint8) (toprf.Share, error) {
-	result := ristretto255.NewScalar()
-	result.Decode([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}) // = 0
-
-	for i := range shares {
-		if shares[i].Index != self {
-			return toprf.Share{}, errors.New("dkg: share has incorrect index")
-		}
-		result.Add(result, shares[i].Value)
+	result, err := Finish16(widenShares(shares), uint16(self))
+	if err != nil {
+		return toprf.Share{}, err
 	}
 
 	return toprf.Share{
 		Index: self,
-		Value: result,
+		Value: result.Value,
 	}, nil
 }
 
@@ -247,25 +240,47 @@ func Finish(shares []toprf.Share, self uint8) (toprf.Share, error) {
 //
 // Corresponds to dkg_reconstruct() in dkg.c:188-204
 func Reconstruct(shares []toprf.Share) (*ristretto255.Scalar, error) {
-	if len(shares) == 0 {
-		return nil, errors.New("dkg: no shares provided")
+	return Reconstruct16(widenShares(shares))
+}
+
+// SumCommitments adds the coefficient commitments of several dealers
+// component-wise. The result commits to the sum of their polynomials, so for
+// the commitments broadcast in Start it is the group's Feldman commitment: the
+// first element is the group public key and evaluating it at index j yields
+// participant j's verification key.
+func SumCommitments(commitments [][]*ristretto255.Element) ([]*ristretto255.Element, error) {
+	if len(commitments) == 0 {
+		return nil, errors.New("dkg: no commitments provided")
 	}
 
-	// Interpolate at x=0 to get the secret (constant term)
-	secret, err := toprf.InterpolateScalar(0, shares)
-	if err != nil {
-		return nil, err
+	threshold := len(commitments[0])
+	sum := make([]*ristretto255.Element, threshold)
+	for k := range sum {
+		sum[k] = ristretto255.NewElement()
+	}
+
+	for _, c := range commitments {
+		if len(c) != threshold {
+			return nil, errors.New("dkg: commitments have different lengths")
+		}
+		for k := range c {
+			sum[k].Add(sum[k], c[k])
+		}
 	}
 
-	return secret, nil
+	return sum, nil
+}
+
+// evalCommitments evaluates committed polynomial coefficients "in the
+// exponent" at point j, returning g^f(j) = C[0] * C[1]^j * ... * C[t-1]^j^(t-1).
+// This is the verification key for index j when the commitments are Feldman
+// commitments to the sharing polynomial.
+func evalCommitments(j uint8, commitments []*ristretto255.Element) *ristretto255.Element {
+	return toprf.EvaluateCommitments(commitments, j)
 }
 
 // scalarFromUint8 creates a ristretto255 scalar from a uint8 value.
 // Used for index arithmetic in commitment verification.
 func scalarFromUint8(v uint8) *ristretto255.Scalar {
-	var buf [32]byte
-	buf[0] = v
-	s := ristretto255.NewScalar()
-	s.Decode(buf[:])
-	return s
+	return scalarFromUint16(uint16(v))
 }
@@ -0,0 +1,109 @@
+package dkg
+
+// Adding a participant to a running group
+//
+// Enrollment issues a share at the new index n+1 to a participant joining an
+// existing group, without resharing anyone else's key. The new share is the
+// group polynomial evaluated at n+1, which threshold existing participants
+// compute with the repair protocol from repair.go: each helper contributes
+// its Lagrange term for index n+1, split into random additive parts, so
+// neither the secret nor the new share is revealed to any helper. The result
+// is checked against the verification key for index n+1 that everybody can
+// derive from the group commitments, and the group metadata is updated to
+// n+1 participants. The threshold and the group public key do not change.
+
+import (
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// EnrollStart computes one helper's contribution to the share of a new
+// participant at index group.N+1.
+//
+// Parameters:
+//   - group: the current group metadata
+//   - share: the helper's share of the group secret
+//   - helpers: indexes of all helping participants (at least group.Threshold)
+//
+// Returns the commitments to broadcast and the parts to send to each helper,
+// as described in RepairStart.
+func EnrollStart(group *Group, share toprf.Share, helpers []uint8) (
+	commitments []*ristretto255.Element,
+	parts []toprf.Share,
+	err error,
+) {
+	if err := checkEnrollHelpers(group, helpers); err != nil {
+		return nil, nil, err
+	}
+
+	return RepairStart(share, group.N+1, helpers)
+}
+
+// VerifyEnrollCommitments checks that the parts committed to by helper dealer
+// add up to its correct contribution to the new share. See
+// VerifyRepairCommitments.
+func VerifyEnrollCommitments(group *Group, helpers []uint8, dealer uint8, commitments []*ristretto255.Element) error {
+	if err := checkEnrollHelpers(group, helpers); err != nil {
+		return err
+	}
+
+	return VerifyRepairCommitments(group.Commitments, group.N+1, helpers, dealer, commitments)
+}
+
+// EnrollFinish recovers the new participant's share from the helpers'
+// aggregates (see RepairAggregate) and updates the group metadata.
+//
+// Parameters:
+//   - group: the current group metadata
+//   - sigmas: the aggregates received from every helper
+//
+// Returns:
+//   - share: the new participant's share, at index group.N+1
+//   - vk: the verification key of the new share
+//   - updated: the group metadata including the new participant
+func EnrollFinish(group *Group, sigmas []toprf.Share) (
+	share toprf.Share,
+	vk *ristretto255.Element,
+	updated *Group,
+	err error,
+) {
+	if group.N == 255 {
+		return toprf.Share{}, nil, nil, errors.New("dkg: group is full")
+	}
+
+	share, err = RepairFinish(group.Commitments, group.N+1, sigmas)
+	if err != nil {
+		return toprf.Share{}, nil, nil, err
+	}
+
+	updated = &Group{
+		N:           group.N + 1,
+		Threshold:   group.Threshold,
+		Commitments: group.Commitments,
+	}
+
+	vk, err = updated.VerificationKey(share.Index)
+	if err != nil {
+		return toprf.Share{}, nil, nil, err
+	}
+
+	return share, vk, updated, nil
+}
+
+// checkEnrollHelpers validates the helper set for enrolling a participant.
+func checkEnrollHelpers(group *Group, helpers []uint8) error {
+	if group.N == 255 {
+		return errors.New("dkg: group is full")
+	}
+	if len(helpers) < int(group.Threshold) {
+		return errors.New("dkg: not enough helpers to enroll participant")
+	}
+	for _, h := range helpers {
+		if h < 1 || h > group.N {
+			return errors.New("dkg: helper is not a member of the group")
+		}
+	}
+	return nil
+}
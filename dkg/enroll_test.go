@@ -0,0 +1,126 @@
+package dkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// TestGroup tests the group metadata derived from DKG commitments
+func TestGroup(t *testing.T) {
+	const n = 4
+	const threshold = 3
+
+	commitments, shares := dealDKG(t, n, threshold)
+	group, err := NewGroup(n, threshold, commitments)
+	if err != nil {
+		t.Fatalf("NewGroup failed: %v", err)
+	}
+
+	secret, _ := Reconstruct(shares[:threshold])
+	if group.PublicKey().Equal(ristretto255.NewElement().ScalarBaseMult(secret)) != 1 {
+		t.Error("Group public key does not match the secret")
+	}
+
+	for _, share := range shares {
+		if err := group.VerifyShare(share); err != nil {
+			t.Errorf("Share %d: VerifyShare failed: %v", share.Index, err)
+		}
+		vk, err := group.VerificationKey(share.Index)
+		if err != nil {
+			t.Fatalf("VerificationKey failed: %v", err)
+		}
+		if vk.Equal(ristretto255.NewElement().ScalarBaseMult(share.Value)) != 1 {
+			t.Errorf("Share %d: verification key mismatch", share.Index)
+		}
+	}
+
+	wrong := toprf.Share{Index: 1, Value: shares[1].Value}
+	if err := group.VerifyShare(wrong); err == nil {
+		t.Error("VerifyShare accepted a share for the wrong index")
+	}
+	if _, err := group.VerificationKey(n + 1); err == nil {
+		t.Error("VerificationKey accepted an index outside the group")
+	}
+}
+
+// TestEnroll adds a fourth participant to a 2-of-3 group
+func TestEnroll(t *testing.T) {
+	const n = 3
+	const threshold = 2
+
+	commitments, shares := dealDKG(t, n, threshold)
+	group, err := NewGroup(n, threshold, commitments)
+	if err != nil {
+		t.Fatalf("NewGroup failed: %v", err)
+	}
+
+	helpers := []uint8{1, 3}
+	enrollCommitments := make([][]*ristretto255.Element, len(helpers))
+	parts := make([][]toprf.Share, len(helpers))
+	for k, helper := range helpers {
+		enrollCommitments[k], parts[k], err = EnrollStart(group, shares[helper-1], helpers)
+		if err != nil {
+			t.Fatalf("Helper %d: EnrollStart failed: %v", helper, err)
+		}
+		if err := VerifyEnrollCommitments(group, helpers, helper, enrollCommitments[k]); err != nil {
+			t.Errorf("Helper %d: VerifyEnrollCommitments failed: %v", helper, err)
+		}
+	}
+
+	sigmas := make([]toprf.Share, len(helpers))
+	for j, helper := range helpers {
+		received := []toprf.Share{parts[0][j], parts[1][j]}
+		sigmas[j], err = RepairAggregate(helper, received)
+		if err != nil {
+			t.Fatalf("Helper %d: RepairAggregate failed: %v", helper, err)
+		}
+	}
+
+	share, vk, updated, err := EnrollFinish(group, sigmas)
+	if err != nil {
+		t.Fatalf("EnrollFinish failed: %v", err)
+	}
+	if share.Index != n+1 || updated.N != n+1 || updated.Threshold != threshold {
+		t.Errorf("Unexpected enrollment result: index %d, n %d, threshold %d",
+			share.Index, updated.N, updated.Threshold)
+	}
+	if vk.Equal(ristretto255.NewElement().ScalarBaseMult(share.Value)) != 1 {
+		t.Error("Verification key does not match the new share")
+	}
+	if err := updated.VerifyShare(share); err != nil {
+		t.Errorf("New share does not verify against the updated group: %v", err)
+	}
+
+	// The new share lies on the existing polynomial
+	expected, err := toprf.InterpolateScalar(n+1, shares[:threshold])
+	if err != nil {
+		t.Fatalf("InterpolateScalar failed: %v", err)
+	}
+	if !bytes.Equal(expected.Encode(nil), share.Value.Encode(nil)) {
+		t.Error("New share is not on the group polynomial")
+	}
+
+	// The new participant can take part in threshold evaluation
+	input := []byte("enroll input")
+	before := thresholdOPRF(t, input, shares[:threshold])
+	after := thresholdOPRF(t, input, []toprf.Share{shares[1], share})
+	if !bytes.Equal(before, after) {
+		t.Error("New participant produced a different OPRF output")
+	}
+}
+
+// TestEnrollInvalidHelpers tests that invalid helper sets are rejected
+func TestEnrollInvalidHelpers(t *testing.T) {
+	commitments, shares := dealDKG(t, 4, 3)
+	group, _ := NewGroup(4, 3, commitments)
+
+	if _, _, err := EnrollStart(group, shares[0], []uint8{1, 2}); err == nil {
+		t.Error("EnrollStart accepted fewer helpers than the threshold")
+	}
+	if _, _, err := EnrollStart(group, shares[0], []uint8{1, 2, 6}); err == nil {
+		t.Error("EnrollStart accepted a helper outside the group")
+	}
+}
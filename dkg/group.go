@@ -0,0 +1,76 @@
+package dkg
+
+// Public metadata of a threshold group
+//
+// A Group holds everything about a shared key that is public: the number of
+// participants, the threshold, and the Feldman commitments to the group's
+// sharing polynomial. From the commitments anyone can derive the group public
+// key and the verification key g^s_j of every participant j, and check a
+// share against them.
+
+import (
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// Group is the public description of a threshold key.
+//
+// Commitments are the Feldman commitments to the group's sharing polynomial,
+// as returned by SumCommitments over the commitments of all dealers. There are
+// Threshold of them and the first one is the group public key.
+type Group struct {
+	N           uint8
+	Threshold   uint8
+	Commitments []*ristretto255.Element
+}
+
+// NewGroup builds the group metadata from the commitments broadcast by the
+// dealers of a DKG.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold parameter
+//   - commitments: the threshold commitments from every dealer
+func NewGroup(n, threshold uint8, commitments [][]*ristretto255.Element) (*Group, error) {
+	if threshold < 2 || threshold > n {
+		return nil, errors.New("dkg: threshold must be > 1 and <= n")
+	}
+
+	sum, err := SumCommitments(commitments)
+	if err != nil {
+		return nil, err
+	}
+	if len(sum) != int(threshold) {
+		return nil, errors.New("dkg: wrong number of commitments")
+	}
+
+	return &Group{N: n, Threshold: threshold, Commitments: sum}, nil
+}
+
+// PublicKey returns the group public key g^s, where s is the shared secret.
+func (g *Group) PublicKey() *ristretto255.Element {
+	return ristretto255.NewElement().Set(g.Commitments[0])
+}
+
+// VerificationKey returns g^s_index, the public counterpart of the share of
+// participant index.
+func (g *Group) VerificationKey(index uint8) (*ristretto255.Element, error) {
+	if index < 1 || index > g.N {
+		return nil, errors.New("dkg: index out of range")
+	}
+	return evalCommitments(index, g.Commitments), nil
+}
+
+// VerifyShare checks that share is the correct share of the group secret for
+// its index.
+func (g *Group) VerifyShare(share toprf.Share) error {
+	if share.Value == nil {
+		return errors.New("dkg: share value is nil")
+	}
+	if share.Index < 1 || share.Index > g.N {
+		return errors.New("dkg: index out of range")
+	}
+	return VerifyCommitment(g.N, g.Threshold, share.Index, 0, g.Commitments, share)
+}
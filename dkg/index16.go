@@ -0,0 +1,384 @@
+package dkg
+
+// 16-bit participant indexes
+//
+// Start, VerifyCommitment(s), Finish and Reconstruct, and the VSS functions
+// Share, VerifyShareCommitment, CombineShares and ReconstructSecret use uint8
+// indexes and therefore support at most 255 participants. The functions in
+// this file are their counterparts for up to 65535 participants, operating
+// on toprf.Share16. The uint8 functions delegate to them, so a DKG run with
+// either variant produces the same shares for the same polynomials.
+//
+// The networked protocol is 16-bit throughout: Participant, Message, Roster,
+// Run and Result carry 16-bit indexes, and Participant.Finish and Run return
+// a toprf.Share16. The tpdkg and stpdkg ceremonies also carry 16-bit peer
+// indexes and toprf.Share16 shares.
+
+import (
+	"crypto/subtle"
+	"errors"
+	"sort"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// Start16 is Start for up to 65535 participants.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: minimum shares needed to use the key (must be 1 < threshold <= n)
+//
+// Returns:
+//   - commitments: threshold commitments to polynomial coefficients (broadcast to all)
+//   - shares: n shares, one for each participant (send privately)
+func Start16(n, threshold uint16) (
+	commitments []*ristretto255.Element,
+	shares []toprf.Share16,
+	err error,
+) {
+	if threshold < 2 || threshold > n {
+		return nil, nil, errors.New("dkg: threshold must be > 1 and <= n")
+	}
+
+	// Generate random polynomial coefficients
+	a := make([]*ristretto255.Scalar, threshold)
+	for k := range a {
+		a[k], err = randomScalar()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Compute commitments to coefficients: C_k = g^a_k
+	commitments = commitPolynomial(a)
+
+	// Create shares for each participant: s_j = f(j)
+	shares = make([]toprf.Share16, n)
+	for j := 1; j <= int(n); j++ {
+		shares[j-1] = polynom16(uint16(j), a)
+	}
+
+	return commitments, shares, nil
+}
+
+// VerifyCommitment16 is VerifyCommitment for 16-bit indexes.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold parameter
+//   - self: index of current participant (1-based)
+//   - i: index of peer being verified (1-based)
+//   - commitments: the threshold commitments from peer i
+//   - share: the share received from peer i
+func VerifyCommitment16(n, threshold, self, i uint16, commitments []*ristretto255.Element, share toprf.Share16) error {
+	if i == self {
+		return nil // Don't verify our own share
+	}
+	if len(commitments) < int(threshold) || threshold == 0 {
+		return errors.New("dkg: not enough commitments")
+	}
+
+	// g^(share.value) must equal the commitments evaluated at self
+	if err := toprf.VerifyShare16(toprf.Share16{Index: self, Value: share.Value}, commitments[:threshold]); err != nil {
+		return errors.New("dkg: commitment verification failed")
+	}
+
+	return nil
+}
+
+// VerifyCommitments16 is VerifyCommitments for 16-bit indexes.
+//
+// Returns list of peer indices that failed verification.
+func VerifyCommitments16(n, threshold, self uint16, commitments [][]*ristretto255.Element, shares []toprf.Share16) ([]uint16, error) {
+	var fails []uint16
+	for i := 1; i <= int(n); i++ {
+		if uint16(i) == self {
+			continue
+		}
+
+		err := VerifyCommitment16(n, threshold, self, uint16(i), commitments[i-1], shares[i-1])
+		if err != nil {
+			fails = append(fails, uint16(i))
+		}
+	}
+
+	return fails, nil
+}
+
+// Finish16 is Finish for 16-bit indexes.
+func Finish16(shares []toprf.Share16, self uint16) (toprf.Share16, error) {
+	result := ristretto255.NewScalar()
+	for i := range shares {
+		if shares[i].Index != self {
+			return toprf.Share16{}, errors.New("dkg: share has incorrect index")
+		}
+		result.Add(result, shares[i].Value)
+	}
+
+	return toprf.Share16{
+		Index: self,
+		Value: result,
+	}, nil
+}
+
+// Reconstruct16 is Reconstruct for 16-bit indexes.
+func Reconstruct16(shares []toprf.Share16) (*ristretto255.Scalar, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("dkg: no shares provided")
+	}
+
+	// Interpolate at x=0 to get the secret (constant term)
+	return toprf.InterpolateScalar16(0, shares)
+}
+
+// Share16 is Share for up to 65535 participants.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: minimum shares needed to reconstruct (must be > 0)
+//   - secret: the secret to share (if nil, a random secret is generated)
+//
+// Returns:
+//   - commitments: array of n commitments, one per share
+//   - shares: array of n share pairs [secret_share, blinding_share]
+//   - blind: the blinding factor b[0] used in commitments
+func Share16(n, threshold uint16, secret *ristretto255.Scalar) (
+	commitments []*ristretto255.Element,
+	shares [][2]toprf.Share16,
+	blind *ristretto255.Scalar,
+	err error,
+) {
+	if threshold == 0 {
+		return nil, nil, nil, errors.New("threshold must be > 0")
+	}
+
+	// a[0] is the secret (or random if secret is nil)
+	constant := secret
+	if constant == nil {
+		if constant, err = randomScalar(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// Random polynomials for the secret and the blinding
+	a := make([]*ristretto255.Scalar, threshold)
+	a[0] = ristretto255.NewScalar().Set(constant)
+	for k := 1; k < int(threshold); k++ {
+		if a[k], err = randomScalar(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	b := make([]*ristretto255.Scalar, threshold)
+	for k := range b {
+		if b[k], err = randomScalar(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	blind = ristretto255.NewScalar().Set(b[0])
+
+	// Create shares and commitments for each participant
+	commitments = make([]*ristretto255.Element, n)
+	shares = make([][2]toprf.Share16, n)
+	for j := 1; j <= int(n); j++ {
+		shares[j-1] = [2]toprf.Share16{polynom16(uint16(j), a), polynom16(uint16(j), b)}
+		if commitments[j-1], err = Commit(shares[j-1][0].Value, shares[j-1][1].Value); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return commitments, shares, blind, nil
+}
+
+// VerifyShareCommitment16 is VerifyShareCommitment for 16-bit indexes.
+func VerifyShareCommitment16(commitment *ristretto255.Element, share [2]toprf.Share16) error {
+	// Recompute commitment from share
+	c, err := Commit(share[0].Value, share[1].Value)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(c.Encode(nil), commitment.Encode(nil)) != 1 {
+		return errors.New("commitment verification failed")
+	}
+	return nil
+}
+
+// CombineShares16 is CombineShares for 16-bit indexes.
+//
+// Parameters:
+//   - qual: indices of qualified participants (0-terminated)
+//   - shares: all shares received from participants
+//   - self: index of current participant
+//
+// Returns:
+//   - finalShare: combined share pair [secret, blinding]
+//   - commitment: commitment to the final share
+func CombineShares16(qual []uint16, shares [][2]toprf.Share16, self uint16) (
+	finalShare [2]toprf.Share16,
+	commitment *ristretto255.Element,
+	err error,
+) {
+	share0 := ristretto255.NewScalar()
+	share1 := ristretto255.NewScalar()
+
+	// Sum shares from qualified participants
+	for _, qualIndex := range qual {
+		if qualIndex == 0 {
+			break // 0-terminated list
+		}
+		if int(qualIndex) > len(shares) {
+			return finalShare, nil, errors.New("invalid qualified index")
+		}
+
+		idx := qualIndex - 1
+		if shares[idx][0].Index != self {
+			return finalShare, nil, errors.New("share has incorrect index")
+		}
+
+		share0.Add(share0, shares[idx][0].Value)
+		share1.Add(share1, shares[idx][1].Value)
+	}
+
+	finalShare[0] = toprf.Share16{Index: self, Value: share0}
+	finalShare[1] = toprf.Share16{Index: self, Value: share1}
+
+	commitment, err = Commit(share0, share1)
+	if err != nil {
+		return finalShare, nil, err
+	}
+	return finalShare, commitment, nil
+}
+
+// ReconstructSecret16 is ReconstructSecret for 16-bit indexes.
+//
+// Parameters:
+//   - t: threshold (minimum shares needed)
+//   - x: point to evaluate at (typically 0 for the secret)
+//   - shares: array of share pairs [secret, blinding]
+//   - commitments: optional commitments to verify shares (nil to skip verification)
+//
+// Returns:
+//   - result: the reconstructed value at x
+//   - blind: the reconstructed blinding value (if commitments were verified)
+func ReconstructSecret16(t, x uint16, shares [][2]toprf.Share16, commitments []*ristretto255.Element) (
+	result, blind *ristretto255.Scalar,
+	err error,
+) {
+	if len(shares) > 65535 {
+		return nil, nil, errors.New("too many shares")
+	}
+
+	// Collect the first t shares that match their commitments
+	var valid [][2]toprf.Share16
+	for i, share := range shares {
+		if commitments != nil && i < len(commitments) {
+			if err := VerifyShareCommitment16(commitments[i], share); err != nil {
+				continue // Skip invalid shares
+			}
+		}
+		valid = append(valid, share)
+		if len(valid) >= int(t) {
+			break
+		}
+	}
+
+	if t == 0 || len(valid) < int(t) {
+		return nil, nil, errors.New("insufficient valid shares")
+	}
+
+	sort.Slice(valid, func(i, j int) bool {
+		return valid[i][0].Index < valid[j][0].Index
+	})
+
+	secretShares := make([]toprf.Share16, t)
+	blindingShares := make([]toprf.Share16, t)
+	for i := range secretShares {
+		secretShares[i] = valid[i][0]
+		blindingShares[i] = valid[i][1]
+	}
+
+	// Interpolate to recover value at x
+	result, err = toprf.InterpolateScalar16(x, secretShares)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Also interpolate blinding if needed
+	if commitments != nil {
+		blind, err = toprf.InterpolateScalar16(x, blindingShares)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return result, blind, nil
+}
+
+// widenPair converts a VSS share pair to 16-bit indexes.
+func widenPair(pair [2]toprf.Share) [2]toprf.Share16 {
+	return [2]toprf.Share16{pair[0].Wide(), pair[1].Wide()}
+}
+
+// narrowPair converts a VSS share pair with indexes below 256 to 8-bit
+// indexes.
+func narrowPair(pair [2]toprf.Share16) [2]toprf.Share {
+	return [2]toprf.Share{
+		{Index: uint8(pair[0].Index), Value: pair[0].Value},
+		{Index: uint8(pair[1].Index), Value: pair[1].Value},
+	}
+}
+
+// polynom16 evaluates the polynomial with coefficients a at point j using
+// Horner's rule.
+func polynom16(j uint16, a []*ristretto255.Scalar) toprf.Share16 {
+	z := scalarFromUint16(j)
+
+	value := ristretto255.NewScalar().Set(a[len(a)-1])
+	for k := len(a) - 2; k >= 0; k-- {
+		value.Multiply(value, z)
+		value.Add(value, a[k])
+	}
+
+	return toprf.Share16{
+		Index: j,
+		Value: value,
+	}
+}
+
+// scalarFromUint16 creates a ristretto255 scalar from a uint16 value.
+func scalarFromUint16(v uint16) *ristretto255.Scalar {
+	var buf [32]byte
+	buf[0] = byte(v)
+	buf[1] = byte(v >> 8)
+	s := ristretto255.NewScalar()
+	s.Decode(buf[:])
+	return s
+}
+
+// widenShares converts shares with 8-bit indexes to shares with 16-bit indexes.
+func widenShares(shares []toprf.Share) []toprf.Share16 {
+	wide := make([]toprf.Share16, len(shares))
+	for i, share := range shares {
+		wide[i] = share.Wide()
+	}
+	return wide
+}
+
+// widenIndexes converts 8-bit indexes to 16-bit indexes.
+func widenIndexes(indexes []uint8) []uint16 {
+	wide := make([]uint16, len(indexes))
+	for i, index := range indexes {
+		wide[i] = uint16(index)
+	}
+	return wide
+}
+
+// indexRange returns the indexes 1..n.
+func indexRange(n uint16) []uint16 {
+	indexes := make([]uint16, n)
+	for k := range indexes {
+		indexes[k] = uint16(k + 1)
+	}
+	return indexes
+}
@@ -0,0 +1,143 @@
+package dkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// TestDKG16 runs a DKG with more than 255 participants
+func TestDKG16(t *testing.T) {
+	n, threshold := uint16(300), uint16(3)
+
+	// Only a few participants deal, to keep the test fast; the others only
+	// receive shares
+	dealers := 3
+	commitments := make([][]*ristretto255.Element, dealers)
+	allShares := make([][]toprf.Share16, dealers)
+	for i := 0; i < dealers; i++ {
+		var err error
+		commitments[i], allShares[i], err = Start16(n, threshold)
+		if err != nil {
+			t.Fatalf("Dealer %d: Start16 failed: %v", i+1, err)
+		}
+		if len(allShares[i]) != int(n) {
+			t.Fatalf("Dealer %d: expected %d shares, got %d", i+1, n, len(allShares[i]))
+		}
+	}
+
+	// Participants with indexes above 255 verify and combine their shares
+	finalShares := make([]toprf.Share16, 0, threshold)
+	for _, self := range []uint16{256, 299, 300} {
+		received := make([]toprf.Share16, dealers)
+		for i := 0; i < dealers; i++ {
+			received[i] = allShares[i][self-1]
+			if err := VerifyCommitment16(n, threshold, self, 0, commitments[i], received[i]); err != nil {
+				t.Fatalf("Participant %d: share from dealer %d does not verify: %v", self, i+1, err)
+			}
+		}
+
+		share, err := Finish16(received, self)
+		if err != nil {
+			t.Fatalf("Participant %d: Finish16 failed: %v", self, err)
+		}
+		finalShares = append(finalShares, share)
+	}
+
+	group, _ := SumCommitments(commitments)
+	secret, err := Reconstruct16(finalShares)
+	if err != nil {
+		t.Fatalf("Reconstruct16 failed: %v", err)
+	}
+	if group[0].Equal(ristretto255.NewElement().ScalarBaseMult(secret)) != 1 {
+		t.Error("Reconstructed secret does not match the group public key")
+	}
+
+	// A share sent to the wrong participant fails verification
+	if err := VerifyCommitment16(n, threshold, 300, 0, commitments[0], allShares[0][43]); err == nil {
+		t.Error("VerifyCommitment16 accepted a share for another participant")
+	}
+}
+
+// TestStartMatchesStart16 tests that the uint8 API evaluates the same
+// polynomial as the 16-bit core
+func TestStartMatchesStart16(t *testing.T) {
+	a := []*ristretto255.Scalar{scalarFromUint8(9), scalarFromUint8(4), scalarFromUint8(7)}
+
+	for j := uint8(1); j <= 5; j++ {
+		narrow := polynom(j, 3, a)
+		wide := polynom16(uint16(j), a)
+
+		// 9 + 4j + 7j^2
+		expected := scalarFromUint16(9 + 4*uint16(j) + 7*uint16(j)*uint16(j))
+		if !bytes.Equal(narrow.Value.Encode(nil), expected.Encode(nil)) {
+			t.Errorf("polynom(%d) is wrong", j)
+		}
+		if !bytes.Equal(wide.Value.Encode(nil), expected.Encode(nil)) {
+			t.Errorf("polynom16(%d) is wrong", j)
+		}
+	}
+
+	if s := scalarFromUint16(0x1234); !bytes.Equal(s.Encode(nil)[:3], []byte{0x34, 0x12, 0}) {
+		t.Error("scalarFromUint16 is not little-endian")
+	}
+}
+
+// TestVSS16 runs the Pedersen VSS functions with more than 255 participants
+func TestVSS16(t *testing.T) {
+	n, threshold := uint16(300), uint16(3)
+	secret := scalarFromUint16(4242)
+
+	// Two dealers share to all participants
+	commitments := make([][]*ristretto255.Element, 2)
+	dealt := make([][][2]toprf.Share16, 2)
+	for i := range dealt {
+		var err error
+		commitments[i], dealt[i], _, err = Share16(n, threshold, secret)
+		if err != nil {
+			t.Fatalf("Share16 failed: %v", err)
+		}
+	}
+
+	// Participants above 255 check and combine their shares
+	var final [][2]toprf.Share16
+	var finalCommitments []*ristretto255.Element
+	for _, self := range []uint16{256, 280, 300} {
+		received := [][2]toprf.Share16{dealt[0][self-1], dealt[1][self-1]}
+		for i := range received {
+			if err := VerifyShareCommitment16(commitments[i][self-1], received[i]); err != nil {
+				t.Fatalf("Participant %d: VerifyShareCommitment16 failed: %v", self, err)
+			}
+		}
+		pair, commitment, err := CombineShares16([]uint16{1, 2}, received, self)
+		if err != nil {
+			t.Fatalf("Participant %d: CombineShares16 failed: %v", self, err)
+		}
+		final = append(final, pair)
+		finalCommitments = append(finalCommitments, commitment)
+	}
+
+	// The combined secret is the sum of both dealers' secrets
+	result, blind, err := ReconstructSecret16(threshold, 0, final, finalCommitments)
+	if err != nil {
+		t.Fatalf("ReconstructSecret16 failed: %v", err)
+	}
+	sum := ristretto255.NewScalar().Add(secret, secret)
+	if result.Equal(sum) != 1 || blind == nil {
+		t.Error("ReconstructSecret16 recovered the wrong secret")
+	}
+
+	// A share with a wrong blinding does not verify and is skipped
+	final[0][1] = final[1][1]
+	if err := VerifyShareCommitment16(finalCommitments[0], final[0]); err == nil {
+		t.Error("VerifyShareCommitment16 accepted a wrong share")
+	}
+	if _, _, err := ReconstructSecret16(threshold, 0, final, finalCommitments); err == nil {
+		t.Error("ReconstructSecret16 used a share that does not match its commitment")
+	}
+	if _, _, err := CombineShares16([]uint16{1, 2}, [][2]toprf.Share16{dealt[0][0], dealt[1][1]}, 1); err == nil {
+		t.Error("CombineShares16 accepted a share for another participant")
+	}
+}
@@ -0,0 +1,799 @@
+package dkg
+
+// Authenticated DKG messages
+//
+// A Participant exchanges Go values; this file gives every one of them a
+// binary encoding and wraps it in a signed Message for the network:
+//
+//	[version:1][session:32][round:1][sender:2][recipient:2][payload length:4][payload][signature:64]
+//
+// The signature is an Ed25519 signature by the sender's long-term key over
+// messageContext and everything before it, so a message cannot be replayed
+// into another session or round, attributed to another sender, or redirected
+// to another recipient. Recipient is 0 for broadcasts; only private shares
+// have one. Private shares are sealed to their recipient (see seal.go).
+//
+// Each participant knows the long-term public keys of all participants,
+// indexed like the DKG, from a Roster: an Ed25519 key for signing and an
+// X25519 key for share encryption. Roster.Open decodes and authenticates
+// a received message, and the Message accessors (Deal, SealedShare,
+// Complaints, ...) decode its payload and check that it is bound to the
+// sender: a participant can only deal, complain, justify or reveal in its own
+// name.
+//
+// The session ID must be unique per DKG run and agreed on by all
+// participants beforehand, e.g. chosen by a coordinator with NewSessionID.
+//
+// Participant indexes are 16-bit, in the header and in the payloads, and
+// shares are encoded as toprf.Share16, so a DKG can have up to 65535
+// participants. Version 1 of the encoding had 8-bit indexes; its messages
+// are rejected, so all participants of a session must use version 2.
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+const (
+	// MessageVersion is the version byte of the message encoding
+	MessageVersion = 2
+
+	// SessionIDBytes is the size of a session ID
+	SessionIDBytes = 32
+
+	// messageHeaderBytes is the size of the message header before the payload
+	messageHeaderBytes = 1 + SessionIDBytes + 1 + 2 + 2 + 4
+
+	// sharePairBytes is the size of an encoded [f(j), f'(j)] share pair
+	sharePairBytes = 2 * toprf.Share16Bytes
+
+	// messageContext is prepended to the signed message bytes
+	messageContext = "go-oprf DKG message v2"
+)
+
+// SessionID identifies one run of the DKG.
+type SessionID [SessionIDBytes]byte
+
+// NewSessionID returns a random session ID.
+func NewSessionID() (SessionID, error) {
+	var id SessionID
+	if _, err := rand.Read(id[:]); err != nil {
+		return id, err
+	}
+	return id, nil
+}
+
+// Round identifies the kind of a DKG message.
+type Round uint8
+
+const (
+	// RoundDeal carries a Deal (broadcast)
+	RoundDeal Round = iota + 1
+	// RoundShare carries a SealedShare (to one recipient)
+	RoundShare
+	// RoundComplaint carries the sender's Complaints (broadcast)
+	RoundComplaint
+	// RoundJustification carries the sender's Justifications (broadcast)
+	RoundJustification
+	// RoundExtraction carries an Extraction (broadcast)
+	RoundExtraction
+	// RoundExtractionComplaint carries the sender's ExtractionComplaints (broadcast)
+	RoundExtractionComplaint
+	// RoundReveal carries the sender's Reveals (broadcast)
+	RoundReveal
+	// RoundShareComplaint carries the sender's ShareComplaints (broadcast
+	// with its Complaints)
+	RoundShareComplaint
+	// RoundEcho carries the sender's transcript digest (broadcast)
+	RoundEcho
+	// RoundTranscript carries the sender's copy of one round's broadcasts
+	// (broadcast)
+	RoundTranscript
+	// RoundResume asks the others to send everything again, after the
+	// sender resumed from a checkpoint (broadcast, no payload)
+	RoundResume
+
+	// lastRound is the highest known round
+	lastRound = RoundResume
+)
+
+// Message is an authenticated DKG message.
+type Message struct {
+	Session   SessionID
+	Round     Round
+	Sender    uint16
+	Recipient uint16
+	Payload   []byte
+	Signature []byte
+}
+
+// Roster holds the long-term public keys of the participants of a DKG. The
+// keys of participant i are at index i-1.
+type Roster struct {
+	keys           []ed25519.PublicKey
+	encryptionKeys []*ecdh.PublicKey
+}
+
+// Signer signs the messages of one participant in one session.
+type Signer struct {
+	session SessionID
+	self    uint16
+	key     ed25519.PrivateKey
+}
+
+// NewRoster creates a roster from the participants' signing and encryption
+// public keys, in participant order.
+func NewRoster(keys []ed25519.PublicKey, encryptionKeys []*ecdh.PublicKey) (*Roster, error) {
+	if len(keys) < 2 || len(keys) > 0xffff {
+		return nil, errors.New("dkg: roster must have 2 to 65535 participants")
+	}
+	if len(encryptionKeys) != len(keys) {
+		return nil, errors.New("dkg: wrong number of encryption keys")
+	}
+
+	r := &Roster{
+		keys:           make([]ed25519.PublicKey, len(keys)),
+		encryptionKeys: make([]*ecdh.PublicKey, len(keys)),
+	}
+	for i, key := range keys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("dkg: invalid participant public key")
+		}
+		if encryptionKeys[i] == nil || encryptionKeys[i].Curve() != ecdh.X25519() {
+			return nil, errors.New("dkg: invalid participant encryption key")
+		}
+		r.keys[i] = append(ed25519.PublicKey(nil), key...)
+		r.encryptionKeys[i] = encryptionKeys[i]
+	}
+	return r, nil
+}
+
+// N returns the number of participants.
+func (r *Roster) N() uint16 {
+	return uint16(len(r.keys))
+}
+
+// PublicKey returns the public key of participant i.
+func (r *Roster) PublicKey(i uint16) ed25519.PublicKey {
+	if i < 1 || int(i) > len(r.keys) {
+		return nil
+	}
+	return r.keys[i-1]
+}
+
+// EncryptionKey returns the X25519 public key of participant i.
+func (r *Roster) EncryptionKey(i uint16) *ecdh.PublicKey {
+	if i < 1 || int(i) > len(r.keys) {
+		return nil
+	}
+	return r.encryptionKeys[i-1]
+}
+
+// Open decodes a message received by participant self and authenticates it.
+//
+// Parameters:
+//   - session: The session ID of the DKG
+//   - self: The receiving participant's index (1-based)
+//   - data: The encoded message
+//
+// Returns:
+//   - The message, if it belongs to the session, is signed by its sender and
+//     is either a broadcast or addressed to self
+//   - Error if decoding or any check fails
+func (r *Roster) Open(session SessionID, self uint16, data []byte) (*Message, error) {
+	m := new(Message)
+	if err := m.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if err := r.Verify(session, m); err != nil {
+		return nil, err
+	}
+	if m.Recipient != 0 && m.Recipient != self {
+		return nil, errors.New("dkg: message is addressed to another participant")
+	}
+	return m, nil
+}
+
+// Verify checks that a message belongs to the session, comes from a
+// participant of the roster and carries a valid signature by that
+// participant.
+func (r *Roster) Verify(session SessionID, m *Message) error {
+	if m.Session != session {
+		return errors.New("dkg: message belongs to another session")
+	}
+	if m.Round < RoundDeal || m.Round > lastRound {
+		return errors.New("dkg: unknown message round")
+	}
+	if m.Sender < 1 || m.Sender > r.N() {
+		return errors.New("dkg: unknown message sender")
+	}
+	if (m.Round == RoundShare) != (m.Recipient != 0) || m.Recipient > r.N() || m.Recipient == m.Sender {
+		return errors.New("dkg: invalid message recipient")
+	}
+
+	signed, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(r.keys[m.Sender-1], signed, m.Signature) {
+		return errors.New("dkg: invalid message signature")
+	}
+	return nil
+}
+
+// NewSigner creates a signer for participant self in a session.
+func NewSigner(session SessionID, self uint16, key ed25519.PrivateKey) (*Signer, error) {
+	if self < 1 {
+		return nil, errors.New("dkg: participant index must be >= 1")
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("dkg: invalid signing key")
+	}
+	return &Signer{session: session, self: self, key: key}, nil
+}
+
+// Sign creates a signed message with an encoded payload. Recipient is 0
+// for broadcasts.
+func (s *Signer) Sign(round Round, recipient uint16, payload []byte) (*Message, error) {
+	m := &Message{
+		Session:   s.session,
+		Round:     round,
+		Sender:    s.self,
+		Recipient: recipient,
+		Payload:   append([]byte(nil), payload...),
+	}
+
+	signed, err := m.signedBytes()
+	if err != nil {
+		return nil, err
+	}
+	m.Signature = ed25519.Sign(s.key, signed)
+	return m, nil
+}
+
+// SignDeal signs the participant's Deal.
+func (s *Signer) SignDeal(d *Deal) (*Message, error) {
+	if d.Dealer != s.self {
+		return nil, errors.New("dkg: deal of another participant")
+	}
+	payload, err := d.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(RoundDeal, 0, payload)
+}
+
+// SignSealedShare signs a sealed share for its recipient.
+func (s *Signer) SignSealedShare(sealed *SealedShare) (*Message, error) {
+	if sealed.Dealer != s.self {
+		return nil, errors.New("dkg: share of another participant")
+	}
+	payload, err := sealed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(RoundShare, sealed.Recipient, payload)
+}
+
+// SignComplaints signs the participant's complaints. An empty list is
+// valid and tells the others that the participant has no complaints.
+func (s *Signer) SignComplaints(complaints []Complaint) (*Message, error) {
+	for _, c := range complaints {
+		if c.Accuser != s.self {
+			return nil, errors.New("dkg: complaint of another participant")
+		}
+	}
+	payload, err := marshalList(complaints)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(RoundComplaint, 0, payload)
+}
+
+// SignShareComplaints signs the participant's complaints about sealed
+// shares that did not open, with their evidence. An empty list is valid and
+// tells the others that the participant has no such complaints.
+func (s *Signer) SignShareComplaints(complaints []ShareComplaint) (*Message, error) {
+	for _, c := range complaints {
+		if c.Accuser != s.self {
+			return nil, errors.New("dkg: complaint of another participant")
+		}
+		if c.Share == nil || c.Share.Round != RoundShare {
+			return nil, errors.New("dkg: complaint evidence is not a sealed share")
+		}
+	}
+	payload, err := marshalList(complaints)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != 2+len(complaints)*shareComplaintBytes {
+		return nil, errors.New("dkg: invalid complaint evidence")
+	}
+	return s.Sign(RoundShareComplaint, 0, payload)
+}
+
+// SignJustifications signs the participant's justifications.
+func (s *Signer) SignJustifications(justifications []Justification) (*Message, error) {
+	for _, j := range justifications {
+		if j.Dealer != s.self {
+			return nil, errors.New("dkg: justification of another participant")
+		}
+	}
+	payload, err := marshalList(justifications)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(RoundJustification, 0, payload)
+}
+
+// SignExtraction signs the participant's Extraction.
+func (s *Signer) SignExtraction(e *Extraction) (*Message, error) {
+	if e.Dealer != s.self {
+		return nil, errors.New("dkg: extraction of another participant")
+	}
+	payload, err := e.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(RoundExtraction, 0, payload)
+}
+
+// SignExtractionComplaints signs the participant's extraction complaints.
+func (s *Signer) SignExtractionComplaints(complaints []ExtractionComplaint) (*Message, error) {
+	for _, c := range complaints {
+		if c.Accuser != s.self {
+			return nil, errors.New("dkg: complaint of another participant")
+		}
+	}
+	payload, err := marshalList(complaints)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(RoundExtractionComplaint, 0, payload)
+}
+
+// SignReveals signs the participant's reveals.
+func (s *Signer) SignReveals(reveals []Reveal) (*Message, error) {
+	for _, r := range reveals {
+		if r.Sender != s.self {
+			return nil, errors.New("dkg: reveal of another participant")
+		}
+	}
+	payload, err := marshalList(reveals)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(RoundReveal, 0, payload)
+}
+
+// Deal decodes the Deal carried by a RoundDeal message.
+func (m *Message) Deal() (*Deal, error) {
+	if err := m.expect(RoundDeal); err != nil {
+		return nil, err
+	}
+	d := new(Deal)
+	if err := d.UnmarshalBinary(m.Payload); err != nil {
+		return nil, err
+	}
+	if d.Dealer != m.Sender {
+		return nil, errors.New("dkg: deal does not match sender")
+	}
+	return d, nil
+}
+
+// SealedShare decodes the SealedShare carried by a RoundShare message. Use
+// OpenShare to decrypt it.
+func (m *Message) SealedShare() (*SealedShare, error) {
+	if err := m.expect(RoundShare); err != nil {
+		return nil, err
+	}
+	sealed := new(SealedShare)
+	if err := sealed.UnmarshalBinary(m.Payload); err != nil {
+		return nil, err
+	}
+	if sealed.Dealer != m.Sender || sealed.Recipient != m.Recipient {
+		return nil, errors.New("dkg: share does not match sender or recipient")
+	}
+	return sealed, nil
+}
+
+// Complaints decodes the complaints carried by a RoundComplaint message.
+func (m *Message) Complaints() ([]Complaint, error) {
+	if err := m.expect(RoundComplaint); err != nil {
+		return nil, err
+	}
+	complaints, err := unmarshalList[Complaint](m.Payload, 4)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range complaints {
+		if c.Accuser != m.Sender {
+			return nil, errors.New("dkg: complaint does not match sender")
+		}
+	}
+	return complaints, nil
+}
+
+// ShareComplaints decodes the ShareComplaints carried by a
+// RoundShareComplaint message. Check them with VerifyShareComplaint.
+func (m *Message) ShareComplaints() ([]ShareComplaint, error) {
+	if err := m.expect(RoundShareComplaint); err != nil {
+		return nil, err
+	}
+	complaints, err := unmarshalList[ShareComplaint](m.Payload, shareComplaintBytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range complaints {
+		if c.Accuser != m.Sender {
+			return nil, errors.New("dkg: complaint does not match sender")
+		}
+	}
+	return complaints, nil
+}
+
+// Justifications decodes the justifications carried by a
+// RoundJustification message.
+func (m *Message) Justifications() ([]Justification, error) {
+	if err := m.expect(RoundJustification); err != nil {
+		return nil, err
+	}
+	justifications, err := unmarshalList[Justification](m.Payload, 4+sharePairBytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range justifications {
+		if j.Dealer != m.Sender {
+			return nil, errors.New("dkg: justification does not match sender")
+		}
+	}
+	return justifications, nil
+}
+
+// Extraction decodes the Extraction carried by a RoundExtraction message.
+func (m *Message) Extraction() (*Extraction, error) {
+	if err := m.expect(RoundExtraction); err != nil {
+		return nil, err
+	}
+	e := new(Extraction)
+	if err := e.UnmarshalBinary(m.Payload); err != nil {
+		return nil, err
+	}
+	if e.Dealer != m.Sender {
+		return nil, errors.New("dkg: extraction does not match sender")
+	}
+	return e, nil
+}
+
+// ExtractionComplaints decodes the extraction complaints carried by a
+// RoundExtractionComplaint message.
+func (m *Message) ExtractionComplaints() ([]ExtractionComplaint, error) {
+	if err := m.expect(RoundExtractionComplaint); err != nil {
+		return nil, err
+	}
+	complaints, err := unmarshalList[ExtractionComplaint](m.Payload, 4+sharePairBytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range complaints {
+		if c.Accuser != m.Sender {
+			return nil, errors.New("dkg: complaint does not match sender")
+		}
+	}
+	return complaints, nil
+}
+
+// Reveals decodes the reveals carried by a RoundReveal message.
+func (m *Message) Reveals() ([]Reveal, error) {
+	if err := m.expect(RoundReveal); err != nil {
+		return nil, err
+	}
+	reveals, err := unmarshalList[Reveal](m.Payload, 4+sharePairBytes)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range reveals {
+		if r.Sender != m.Sender {
+			return nil, errors.New("dkg: reveal does not match sender")
+		}
+	}
+	return reveals, nil
+}
+
+// MarshalBinary encodes a signed message for transmission.
+func (m *Message) MarshalBinary() ([]byte, error) {
+	if len(m.Signature) != ed25519.SignatureSize {
+		return nil, errors.New("dkg: message is not signed")
+	}
+	data, err := m.header()
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, m.Payload...)
+	return append(data, m.Signature...), nil
+}
+
+// UnmarshalBinary decodes a message. It does not authenticate it; use
+// Roster.Open or Roster.Verify.
+func (m *Message) UnmarshalBinary(data []byte) error {
+	if len(data) < messageHeaderBytes+ed25519.SignatureSize {
+		return errors.New("dkg: invalid message length")
+	}
+	if data[0] != MessageVersion {
+		return errors.New("dkg: unsupported message version")
+	}
+
+	length := binary.BigEndian.Uint32(data[messageHeaderBytes-4:])
+	if uint64(len(data)) != uint64(messageHeaderBytes)+uint64(length)+ed25519.SignatureSize {
+		return errors.New("dkg: invalid message length")
+	}
+
+	copy(m.Session[:], data[1:])
+	m.Round = Round(data[1+SessionIDBytes])
+	m.Sender = binary.BigEndian.Uint16(data[2+SessionIDBytes:])
+	m.Recipient = binary.BigEndian.Uint16(data[4+SessionIDBytes:])
+	data = data[messageHeaderBytes:]
+	m.Payload = append([]byte(nil), data[:length]...)
+	m.Signature = append([]byte(nil), data[length:]...)
+	return nil
+}
+
+// header encodes the message header.
+func (m *Message) header() ([]byte, error) {
+	if uint64(len(m.Payload)) > 0xffffffff {
+		return nil, errors.New("dkg: message payload too long")
+	}
+
+	data := make([]byte, 0, messageHeaderBytes+len(m.Payload)+ed25519.SignatureSize)
+	data = append(data, MessageVersion)
+	data = append(data, m.Session[:]...)
+	data = append(data, uint8(m.Round))
+	data = binary.BigEndian.AppendUint16(data, m.Sender)
+	data = binary.BigEndian.AppendUint16(data, m.Recipient)
+	return binary.BigEndian.AppendUint32(data, uint32(len(m.Payload))), nil
+}
+
+// signedBytes returns the bytes covered by the message signature.
+func (m *Message) signedBytes() ([]byte, error) {
+	header, err := m.header()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join([][]byte{[]byte(messageContext), header, m.Payload}, nil), nil
+}
+
+// expect checks the round of a message before decoding its payload.
+func (m *Message) expect(round Round) error {
+	if m.Round != round {
+		return errors.New("dkg: unexpected message round")
+	}
+	return nil
+}
+
+// MarshalBinary encodes a Deal.
+// Format: [dealer:2 bytes][count:2 bytes][commitments:count*32 bytes][proof:96 bytes]
+func (d *Deal) MarshalBinary() ([]byte, error) {
+	if d.Proof == nil {
+		return nil, errors.New("dkg: deal has no proof")
+	}
+	data, err := marshalCommitments(d.Dealer, d.Commitments)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := d.Proof.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(data, proof...), nil
+}
+
+// UnmarshalBinary decodes a Deal.
+func (d *Deal) UnmarshalBinary(data []byte) error {
+	if len(data) < OpeningProofBytes {
+		return errors.New("dkg: invalid deal length")
+	}
+	split := len(data) - OpeningProofBytes
+	dealer, commitments, err := unmarshalCommitments(data[:split])
+	if err != nil {
+		return err
+	}
+	proof := new(OpeningProof)
+	if err := proof.UnmarshalBinary(data[split:]); err != nil {
+		return err
+	}
+	d.Dealer, d.Commitments, d.Proof = dealer, commitments, proof
+	return nil
+}
+
+// MarshalBinary encodes a PrivateShare.
+// Format: [dealer:2 bytes][recipient:2 bytes][f(j):35 bytes][f'(j):35 bytes]
+func (ps *PrivateShare) MarshalBinary() ([]byte, error) {
+	return marshalSharePair(ps.Dealer, ps.Recipient, ps.Share)
+}
+
+// UnmarshalBinary decodes a PrivateShare.
+func (ps *PrivateShare) UnmarshalBinary(data []byte) error {
+	var err error
+	ps.Dealer, ps.Recipient, ps.Share, err = unmarshalSharePair(data)
+	return err
+}
+
+// MarshalBinary encodes a Complaint.
+// Format: [accuser:2 bytes][accused:2 bytes]
+func (c *Complaint) MarshalBinary() ([]byte, error) {
+	data := binary.BigEndian.AppendUint16(nil, c.Accuser)
+	return binary.BigEndian.AppendUint16(data, c.Accused), nil
+}
+
+// UnmarshalBinary decodes a Complaint.
+func (c *Complaint) UnmarshalBinary(data []byte) error {
+	if len(data) != 4 {
+		return errors.New("dkg: invalid complaint length")
+	}
+	c.Accuser, c.Accused = binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+	return nil
+}
+
+// MarshalBinary encodes a Justification.
+// Format: [dealer:2 bytes][accuser:2 bytes][f(j):35 bytes][f'(j):35 bytes]
+func (j *Justification) MarshalBinary() ([]byte, error) {
+	return marshalSharePair(j.Dealer, j.Accuser, j.Share)
+}
+
+// UnmarshalBinary decodes a Justification.
+func (j *Justification) UnmarshalBinary(data []byte) error {
+	var err error
+	j.Dealer, j.Accuser, j.Share, err = unmarshalSharePair(data)
+	return err
+}
+
+// MarshalBinary encodes an Extraction.
+// Format: [dealer:2 bytes][count:2 bytes][commitments:count*32 bytes]
+func (e *Extraction) MarshalBinary() ([]byte, error) {
+	return marshalCommitments(e.Dealer, e.Commitments)
+}
+
+// UnmarshalBinary decodes an Extraction.
+func (e *Extraction) UnmarshalBinary(data []byte) error {
+	dealer, commitments, err := unmarshalCommitments(data)
+	if err != nil {
+		return err
+	}
+	e.Dealer, e.Commitments = dealer, commitments
+	return nil
+}
+
+// MarshalBinary encodes an ExtractionComplaint.
+// Format: [accuser:2 bytes][accused:2 bytes][f(j):35 bytes][f'(j):35 bytes]
+func (c *ExtractionComplaint) MarshalBinary() ([]byte, error) {
+	return marshalSharePair(c.Accuser, c.Accused, c.Share)
+}
+
+// UnmarshalBinary decodes an ExtractionComplaint.
+func (c *ExtractionComplaint) UnmarshalBinary(data []byte) error {
+	var err error
+	c.Accuser, c.Accused, c.Share, err = unmarshalSharePair(data)
+	return err
+}
+
+// MarshalBinary encodes a Reveal.
+// Format: [sender:2 bytes][dealer:2 bytes][f(j):35 bytes][f'(j):35 bytes]
+func (r *Reveal) MarshalBinary() ([]byte, error) {
+	return marshalSharePair(r.Sender, r.Dealer, r.Share)
+}
+
+// UnmarshalBinary decodes a Reveal.
+func (r *Reveal) UnmarshalBinary(data []byte) error {
+	var err error
+	r.Sender, r.Dealer, r.Share, err = unmarshalSharePair(data)
+	return err
+}
+
+// marshalCommitments encodes a dealer index and its commitments
+func marshalCommitments(dealer uint16, commitments []*ristretto255.Element) ([]byte, error) {
+	if len(commitments) > 0xffff {
+		return nil, errors.New("dkg: too many commitments")
+	}
+
+	data := make([]byte, 0, 4+len(commitments)*ElementBytes)
+	data = binary.BigEndian.AppendUint16(data, dealer)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(commitments)))
+	for _, c := range commitments {
+		if c == nil {
+			return nil, errors.New("dkg: commitment is nil")
+		}
+		data = c.Encode(data)
+	}
+	return data, nil
+}
+
+// unmarshalCommitments decodes a dealer index and its commitments
+func unmarshalCommitments(data []byte) (uint16, []*ristretto255.Element, error) {
+	if len(data) < 4 || len(data) != 4+int(binary.BigEndian.Uint16(data[2:]))*ElementBytes {
+		return 0, nil, errors.New("dkg: invalid commitments length")
+	}
+
+	commitments := make([]*ristretto255.Element, binary.BigEndian.Uint16(data[2:]))
+	for k := range commitments {
+		commitments[k] = ristretto255.NewElement()
+		if err := commitments[k].Decode(data[4+k*ElementBytes : 4+(k+1)*ElementBytes]); err != nil {
+			return 0, nil, err
+		}
+	}
+	return binary.BigEndian.Uint16(data), commitments, nil
+}
+
+// marshalSharePair encodes two indexes and a share pair
+func marshalSharePair(a, b uint16, share [2]toprf.Share16) ([]byte, error) {
+	data := make([]byte, 0, 4+sharePairBytes)
+	data = binary.BigEndian.AppendUint16(data, a)
+	data = binary.BigEndian.AppendUint16(data, b)
+	for k := range share {
+		encoded, err := share[k].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, encoded...)
+	}
+	return data, nil
+}
+
+// unmarshalSharePair decodes two indexes and a share pair
+func unmarshalSharePair(data []byte) (uint16, uint16, [2]toprf.Share16, error) {
+	var share [2]toprf.Share16
+	if len(data) != 4+sharePairBytes {
+		return 0, 0, share, errors.New("dkg: invalid share pair length")
+	}
+
+	for k := range share {
+		if err := share[k].UnmarshalBinary(data[4+k*toprf.Share16Bytes : 4+(k+1)*toprf.Share16Bytes]); err != nil {
+			return 0, 0, share, err
+		}
+	}
+	return binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:]), share, nil
+}
+
+// marshalList encodes a list of values as [count:2 bytes][values]
+func marshalList[T any, P interface {
+	*T
+	MarshalBinary() ([]byte, error)
+}](items []T) ([]byte, error) {
+	if len(items) > 0xffff {
+		return nil, errors.New("dkg: too many list items")
+	}
+
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(items)))
+	for k := range items {
+		encoded, err := P(&items[k]).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, encoded...)
+	}
+	return data, nil
+}
+
+// unmarshalList decodes a list of values of a fixed size
+func unmarshalList[T any, P interface {
+	*T
+	UnmarshalBinary([]byte) error
+}](data []byte, size int) ([]T, error) {
+	if len(data) < 2 || len(data) != 2+int(binary.BigEndian.Uint16(data))*size {
+		return nil, errors.New("dkg: invalid list length")
+	}
+
+	items := make([]T, binary.BigEndian.Uint16(data))
+	for k := range items {
+		if err := P(&items[k]).UnmarshalBinary(data[2+k*size : 2+(k+1)*size]); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,371 @@
+package dkg
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// newTestRoster creates n long-term signing and encryption keys and their
+// roster
+func newTestRoster(t *testing.T, n uint16) ([]ed25519.PrivateKey, []*ecdh.PrivateKey, *Roster) {
+	t.Helper()
+
+	keys := make([]ed25519.PrivateKey, n)
+	public := make([]ed25519.PublicKey, n)
+	boxKeys := make([]*ecdh.PrivateKey, n)
+	boxPublic := make([]*ecdh.PublicKey, n)
+	for i := range keys {
+		var err error
+		public[i], keys[i], err = ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		boxKeys[i], err = ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		boxPublic[i] = boxKeys[i].PublicKey()
+	}
+	roster, err := NewRoster(public, boxPublic)
+	if err != nil {
+		t.Fatalf("NewRoster failed: %v", err)
+	}
+	return keys, boxKeys, roster
+}
+
+// transmit encodes a message and opens it at the recipient
+func transmit(t *testing.T, roster *Roster, session SessionID, self uint16, m *Message) *Message {
+	t.Helper()
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	received, err := roster.Open(session, self, data)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return received
+}
+
+// TestMessageRoundTrip tests that every round's payload survives signing,
+// encoding and authentication
+func TestMessageRoundTrip(t *testing.T) {
+	keys, boxKeys, roster := newTestRoster(t, 3)
+	session, _ := NewSessionID()
+	signer, _ := NewSigner(session, 1, keys[0])
+
+	p, _ := NewParticipant(3, 2, 1)
+	deal, shares, _ := p.Deal()
+
+	// Deal
+	m, err := signer.SignDeal(deal)
+	if err != nil {
+		t.Fatalf("SignDeal failed: %v", err)
+	}
+	got, err := transmit(t, roster, session, 2, m).Deal()
+	if err != nil {
+		t.Fatalf("Deal failed: %v", err)
+	}
+	if got.Dealer != 1 || len(got.Commitments) != 2 || got.Commitments[1].Equal(deal.Commitments[1]) != 1 {
+		t.Error("Deal did not round-trip")
+	}
+
+	// SealedShare
+	sealed, _ := SealShare(session, boxKeys[0], roster.EncryptionKey(3), &shares[1])
+	m, _ = signer.SignSealedShare(sealed)
+	ps, complaint, err := OpenShare(session, boxKeys[2], roster.EncryptionKey(1), deal.Commitments, transmit(t, roster, session, 3, m))
+	if err != nil || complaint != nil {
+		t.Fatalf("OpenShare failed: %v", err)
+	}
+	if ps.Recipient != 3 || ps.Share[1].Value.Equal(shares[1].Share[1].Value) != 1 {
+		t.Error("PrivateShare did not round-trip")
+	}
+
+	// Lists, including the empty list
+	m, _ = signer.SignComplaints(nil)
+	if complaints, err := transmit(t, roster, session, 2, m).Complaints(); err != nil || len(complaints) != 0 {
+		t.Errorf("Empty complaints did not round-trip: %v", err)
+	}
+	m, _ = signer.SignComplaints([]Complaint{{Accuser: 1, Accused: 3}})
+	if complaints, err := transmit(t, roster, session, 2, m).Complaints(); err != nil || complaints[0].Accused != 3 {
+		t.Errorf("Complaints did not round-trip: %v", err)
+	}
+	m, _ = signer.SignReveals([]Reveal{{Sender: 1, Dealer: 2, Share: shares[0].Share}})
+	reveals, err := transmit(t, roster, session, 2, m).Reveals()
+	if err != nil || reveals[0].Dealer != 2 || reveals[0].Share[0].Index != 2 {
+		t.Errorf("Reveals did not round-trip: %v", err)
+	}
+
+	// The accessors check the round
+	if _, err := m.Deal(); err == nil {
+		t.Error("Deal decoded a reveal message")
+	}
+}
+
+// TestMessageAuthentication tests that forged, replayed and misdirected
+// messages are rejected
+func TestMessageAuthentication(t *testing.T) {
+	keys, boxKeys, roster := newTestRoster(t, 3)
+	session, _ := NewSessionID()
+	signer, _ := NewSigner(session, 1, keys[0])
+
+	p, _ := NewParticipant(3, 2, 1)
+	deal, shares, _ := p.Deal()
+	m, _ := signer.SignDeal(deal)
+	data, _ := m.MarshalBinary()
+
+	// Another session
+	other, _ := NewSessionID()
+	if _, err := roster.Open(other, 2, data); err == nil {
+		t.Error("Open accepted a message from another session")
+	}
+
+	// Any modification breaks the signature
+	for _, offset := range []int{1 + SessionIDBytes, messageHeaderBytes + 5, len(data) - 1} {
+		tampered := bytes.Clone(data)
+		tampered[offset] ^= 1
+		if _, err := roster.Open(session, 2, tampered); err == nil {
+			t.Errorf("Open accepted a message modified at offset %d", offset)
+		}
+	}
+
+	// Signed by participant 2 in the name of participant 1
+	impostor, _ := NewSigner(session, 1, keys[1])
+	forged, _ := impostor.SignDeal(deal)
+	forgedData, _ := forged.MarshalBinary()
+	if _, err := roster.Open(session, 3, forgedData); err == nil {
+		t.Error("Open accepted a message signed by another participant")
+	}
+
+	// Participant 2 signs its own message with participant 1's deal
+	signer2, _ := NewSigner(session, 2, keys[1])
+	if _, err := signer2.SignDeal(deal); err == nil {
+		t.Error("SignDeal accepted the deal of another participant")
+	}
+	payload, _ := deal.MarshalBinary()
+	m2, _ := signer2.Sign(RoundDeal, 0, payload)
+	if _, err := transmit(t, roster, session, 3, m2).Deal(); err == nil {
+		t.Error("Deal accepted a deal that does not match the sender")
+	}
+
+	// A private share can only be opened by its recipient
+	sealed, _ := SealShare(session, boxKeys[0], roster.EncryptionKey(2), &shares[0])
+	m, _ = signer.SignSealedShare(sealed)
+	data, _ = m.MarshalBinary()
+	if _, err := roster.Open(session, 3, data); err == nil {
+		t.Error("Open accepted a share addressed to another participant")
+	}
+}
+
+// TestSignedGJKR runs the GJKR protocol with every message signed, encoded
+// and authenticated
+func TestSignedGJKR(t *testing.T) {
+	const n, threshold = 4, 3
+	keys, boxKeys, roster := newTestRoster(t, n)
+	session, _ := NewSessionID()
+
+	participants := make([]*Participant, n)
+	signers := make([]*Signer, n)
+	for i := range participants {
+		participants[i], _ = NewParticipant(n, threshold, uint16(i+1))
+		signers[i], _ = NewSigner(session, uint16(i+1), keys[i])
+	}
+
+	// Round 1
+	var broadcast []*Message
+	private := make([][]*Message, n)
+	for i, p := range participants {
+		deal, shares, _ := p.Deal()
+		m, _ := signers[i].SignDeal(deal)
+		broadcast = append(broadcast, m)
+		for k := range shares {
+			sealed, _ := SealShare(session, boxKeys[i], roster.EncryptionKey(shares[k].Recipient), &shares[k])
+			m, _ := signers[i].SignSealedShare(sealed)
+			private[shares[k].Recipient-1] = append(private[shares[k].Recipient-1], m)
+		}
+	}
+
+	var complaintMessages []*Message
+	for i, p := range participants {
+		var deals []*Deal
+		commitments := make(map[uint16][]*ristretto255.Element)
+		for _, m := range broadcast {
+			d, err := transmit(t, roster, session, p.Index(), m).Deal()
+			if err != nil {
+				t.Fatalf("Deal failed: %v", err)
+			}
+			deals = append(deals, d)
+			commitments[d.Dealer] = d.Commitments
+		}
+		var shares []*PrivateShare
+		for _, m := range private[i] {
+			m = transmit(t, roster, session, p.Index(), m)
+			ps, complaint, err := OpenShare(session, boxKeys[i], roster.EncryptionKey(m.Sender), commitments[m.Sender], m)
+			if err != nil || complaint != nil {
+				t.Fatalf("OpenShare failed: %v", err)
+			}
+			shares = append(shares, ps)
+		}
+
+		complaints, _ := p.Verify(deals, shares)
+		m, _ := signers[i].SignComplaints(complaints)
+		complaintMessages = append(complaintMessages, m)
+	}
+
+	// Rounds 2 to 6 are broadcasts of lists
+	var justificationMessages, extractionMessages, evidenceMessages, revealMessages []*Message
+	for i, p := range participants {
+		var complaints []Complaint
+		for _, m := range complaintMessages {
+			c, _ := transmit(t, roster, session, p.Index(), m).Complaints()
+			complaints = append(complaints, c...)
+		}
+		js, _ := p.Justify(complaints)
+		m, _ := signers[i].SignJustifications(js)
+		justificationMessages = append(justificationMessages, m)
+	}
+	for i, p := range participants {
+		var justifications []Justification
+		for _, m := range justificationMessages {
+			js, _ := transmit(t, roster, session, p.Index(), m).Justifications()
+			justifications = append(justifications, js...)
+		}
+		e, err := p.Qualify(justifications)
+		if err != nil {
+			t.Fatalf("Qualify failed: %v", err)
+		}
+		m, _ := signers[i].SignExtraction(e)
+		extractionMessages = append(extractionMessages, m)
+	}
+	for i, p := range participants {
+		var extractions []*Extraction
+		for _, m := range extractionMessages {
+			e, err := transmit(t, roster, session, p.Index(), m).Extraction()
+			if err != nil {
+				t.Fatalf("Extraction failed: %v", err)
+			}
+			extractions = append(extractions, e)
+		}
+		cs, _ := p.VerifyExtractions(extractions)
+		m, _ := signers[i].SignExtractionComplaints(cs)
+		evidenceMessages = append(evidenceMessages, m)
+	}
+	for i, p := range participants {
+		var evidence []ExtractionComplaint
+		for _, m := range evidenceMessages {
+			cs, _ := transmit(t, roster, session, p.Index(), m).ExtractionComplaints()
+			evidence = append(evidence, cs...)
+		}
+		rs, _ := p.Reveal(evidence)
+		m, _ := signers[i].SignReveals(rs)
+		revealMessages = append(revealMessages, m)
+	}
+
+	run := &gjkrRun{participants: participants}
+	for _, p := range participants {
+		var reveals []Reveal
+		for _, m := range revealMessages {
+			rs, _ := transmit(t, roster, session, p.Index(), m).Reveals()
+			reveals = append(reveals, rs...)
+		}
+		share, result, err := p.Finish(reveals)
+		if err != nil {
+			t.Fatalf("Finish failed: %v", err)
+		}
+		run.shares = append(run.shares, share)
+		run.results = append(run.results, result)
+	}
+	checkGJKR(t, run, []uint16{1, 2, 3, 4}, 0)
+}
+
+// TestMessages16 exchanges messages between participants whose indexes do
+// not fit in 8 bits
+func TestMessages16(t *testing.T) {
+	const n, threshold = 300, 2
+	keys, boxKeys, roster := newTestRoster(t, n)
+	session, _ := NewSessionID()
+	signer, _ := NewSigner(session, 300, keys[299])
+
+	p, err := NewParticipant(n, threshold, 300)
+	if err != nil {
+		t.Fatalf("NewParticipant failed: %v", err)
+	}
+	deal, shares, err := p.Deal()
+	if err != nil {
+		t.Fatalf("Deal failed: %v", err)
+	}
+
+	// Step 1: The deal reaches participant 299
+	m, _ := signer.SignDeal(deal)
+	received, err := transmit(t, roster, session, 299, m).Deal()
+	if err != nil {
+		t.Fatalf("Deal failed: %v", err)
+	}
+	if received.Dealer != 300 || received.Commitments[1].Equal(deal.Commitments[1]) != 1 {
+		t.Errorf("Deal of dealer %d differs after transmission", received.Dealer)
+	}
+
+	// Step 2: The share for participant 299 opens under its 16-bit indexes
+	share := shares[len(shares)-1]
+	if share.Recipient != 299 {
+		t.Fatalf("Last share is for participant %d", share.Recipient)
+	}
+	sealed, _ := SealShare(session, boxKeys[299], roster.EncryptionKey(299), &share)
+	m, _ = signer.SignSealedShare(sealed)
+	ps, complaint, err := OpenShare(session, boxKeys[298], roster.EncryptionKey(300), deal.Commitments, transmit(t, roster, session, 299, m))
+	if err != nil || complaint != nil {
+		t.Fatalf("OpenShare failed: %v", err)
+	}
+	if ps.Dealer != 300 || ps.Share[0].Index != 299 || ps.Share[0].Value.Equal(share.Share[0].Value) != 1 {
+		t.Errorf("Share of dealer %d for %d differs after transmission", ps.Dealer, ps.Share[0].Index)
+	}
+
+	// Step 3: Lists of complaints keep their indexes
+	m, _ = signer.SignComplaints([]Complaint{{Accuser: 300, Accused: 256}})
+	complaints, err := transmit(t, roster, session, 1, m).Complaints()
+	if err != nil || len(complaints) != 1 || complaints[0] != (Complaint{Accuser: 300, Accused: 256}) {
+		t.Errorf("Complaints = %v, %v", complaints, err)
+	}
+
+	// Step 4: The participant's state survives a checkpoint
+	var key [CheckpointKeyBytes]byte
+	rand.Read(key[:])
+	before, _ := p.MarshalBinary()
+	after, _ := restart(t, key, session, 1, p).MarshalBinary()
+	if !bytes.Equal(before, after) {
+		t.Error("Participant state differs after a checkpoint")
+	}
+}
+
+// TestMessageDecoding tests rejection of malformed encodings
+func TestMessageDecoding(t *testing.T) {
+	var m Message
+	if err := m.UnmarshalBinary(make([]byte, messageHeaderBytes)); err == nil {
+		t.Error("UnmarshalBinary accepted a truncated message")
+	}
+
+	var d Deal
+	if err := d.UnmarshalBinary([]byte{0, 1, 0, 2}); err == nil {
+		t.Error("UnmarshalBinary accepted a deal with missing commitments")
+	}
+
+	var ps PrivateShare
+	if err := ps.UnmarshalBinary(make([]byte, 4+toprf.Share16Bytes)); err == nil {
+		t.Error("UnmarshalBinary accepted a short share pair")
+	}
+
+	if _, err := unmarshalList[Complaint]([]byte{0, 2, 0, 1, 0, 2}, 4); err == nil {
+		t.Error("unmarshalList accepted a short list")
+	}
+
+	if _, err := NewRoster([]ed25519.PublicKey{make([]byte, ed25519.PublicKeySize)}, make([]*ecdh.PublicKey, 1)); err == nil {
+		t.Error("NewRoster accepted a single participant")
+	}
+}
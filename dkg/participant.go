@@ -0,0 +1,597 @@
+package dkg
+
+// Pedersen DKG protocol (GJKR)
+//
+// Start, VerifyCommitments and Finish are the building blocks of a DKG, but
+// leave it to the caller what happens when a share does not verify. A
+// Participant runs the complete protocol of Gennaro, Jarecki, Krawczyk and
+// Rabin ("Secure Distributed Key Generation for Discrete-Log Based
+// Cryptosystems", J. Cryptology 2007) for one party, so that a misbehaving
+// dealer is either forced to deal correctly or excluded, and cannot bias the
+// key:
+//
+//  1. Deal: every dealer commits to two random polynomials f and f' with
+//     Pedersen commitments C_k = g^a_k * h^b_k (broadcast) and sends
+//     (f(j), f'(j)) privately to every participant j.
+//  2. Complaints: every participant checks its shares against the
+//     commitments and broadcasts a complaint against every dealer whose
+//     shares are invalid or missing.
+//  3. Justifications: an accused dealer answers each complaint by
+//     broadcasting the disputed shares.
+//  4. Qualification: a dealer is disqualified if it did not deal, received
+//     threshold or more complaints (answering them would reveal its secret),
+//     or failed to justify one. The remaining dealers form QUAL, which is fixed
+//     before anything about the key is revealed. Each dealer in QUAL then
+//     publishes Feldman commitments A_k = g^a_k (extraction).
+//  5. Extraction complaints: participants check their shares against the
+//     Feldman commitments and, if the check fails, publish the shares as
+//     evidence. The evidence is checked against the dealer's Pedersen
+//     commitments, so false complaints are ignored.
+//  6. Reveals: for every dealer in QUAL with a valid extraction complaint or
+//     no extraction, all participants reveal their shares from that dealer.
+//     Any threshold of them reconstruct its polynomials, and with them its
+//     Feldman commitments.
+//
+// The final share is the sum of the shares from the dealers in QUAL, and the
+// public Result is derived from the sum of their Feldman commitments.
+//
+// Each method of Participant consumes the messages of one round, as received
+// from the other participants, and returns the messages to send in the next
+// one. Messages that did not arrive are simply left out, and the
+// participant's own messages may be included or not. The Participant does not
+// send anything itself: the caller broadcasts Deal, Complaint, Justification,
+// Extraction, ExtractionComplaint and Reveal messages to all participants, and
+// delivers each PrivateShare only to its recipient.
+
+import (
+	"errors"
+	"slices"
+	"sort"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// Deal is a dealer's broadcast in round 1: Pedersen commitments to the
+// coefficients of its polynomials, and a proof that the dealer knows the
+// opening of C_0 (see pok.go).
+type Deal struct {
+	Dealer      uint16
+	Commitments []*ristretto255.Element
+	Proof       *OpeningProof
+}
+
+// PrivateShare is sent by a dealer in round 1 to one recipient only: the
+// recipient's shares of the dealer's polynomials, [f(j), f'(j)].
+type PrivateShare struct {
+	Dealer    uint16
+	Recipient uint16
+	Share     [2]toprf.Share16
+}
+
+// Complaint is broadcast in round 2 by a participant whose shares from the
+// accused dealer are missing or invalid.
+type Complaint struct {
+	Accuser uint16
+	Accused uint16
+}
+
+// Justification is broadcast in round 3 by an accused dealer: the shares of
+// the accuser, for everyone to check against the dealer's commitments.
+type Justification struct {
+	Dealer  uint16
+	Accuser uint16
+	Share   [2]toprf.Share16
+}
+
+// Extraction is broadcast in round 4 by a dealer in QUAL: Feldman
+// commitments A_k = g^a_k to the coefficients of its secret polynomial.
+type Extraction struct {
+	Dealer      uint16
+	Commitments []*ristretto255.Element
+}
+
+// ExtractionComplaint is broadcast in round 5 by a participant whose share
+// from the accused dealer does not match the dealer's Extraction. The share
+// is the evidence.
+type ExtractionComplaint struct {
+	Accuser uint16
+	Accused uint16
+	Share   [2]toprf.Share16
+}
+
+// Reveal is broadcast in round 6: the sender's shares from a dealer whose
+// polynomials are reconstructed publicly.
+type Reveal struct {
+	Sender uint16
+	Dealer uint16
+	Share  [2]toprf.Share16
+}
+
+// step is the next method a Participant expects to be called.
+type step uint8
+
+const (
+	stepDeal step = iota
+	stepVerify
+	stepJustify
+	stepQualify
+	stepVerifyExtractions
+	stepReveal
+	stepFinish
+	stepDone
+)
+
+// Participant runs the GJKR DKG protocol for one party. Call its methods in
+// order: Deal, Verify, Justify, Qualify, VerifyExtractions, Reveal, Finish.
+type Participant struct {
+	n, threshold, self uint16
+	step               step
+
+	// The participant's own polynomials f and f'
+	a, b []*ristretto255.Scalar
+
+	// Per dealer (index dealer-1): Pedersen commitments, received shares,
+	// Feldman commitments
+	commitments [][]*ristretto255.Element
+	shares      [][2]toprf.Share16
+	extractions [][]*ristretto255.Element
+
+	complaints     []Complaint
+	accusers       [][]uint16
+	disqualified   []bool
+	qual           []uint16
+	ownEvidence    []ExtractionComplaint
+	reconstructing []bool
+}
+
+// NewParticipant creates the state of participant self in a DKG with n
+// participants and the given threshold.
+func NewParticipant(n, threshold, self uint16) (*Participant, error) {
+	if threshold < 2 || threshold > n {
+		return nil, errors.New("dkg: threshold must be > 1 and <= n")
+	}
+	if self < 1 || self > n {
+		return nil, errors.New("dkg: index out of range")
+	}
+
+	return &Participant{
+		n:              n,
+		threshold:      threshold,
+		self:           self,
+		commitments:    make([][]*ristretto255.Element, n),
+		shares:         make([][2]toprf.Share16, n),
+		extractions:    make([][]*ristretto255.Element, n),
+		accusers:       make([][]uint16, n),
+		disqualified:   make([]bool, n),
+		reconstructing: make([]bool, n),
+	}, nil
+}
+
+// Index returns the participant's index.
+func (p *Participant) Index() uint16 {
+	return p.self
+}
+
+// Deal starts the protocol: it returns the Deal to broadcast and the
+// PrivateShare for every other participant.
+func (p *Participant) Deal() (*Deal, []PrivateShare, error) {
+	if err := p.expect(stepDeal); err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := randomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+	blind, err := randomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.a, err = randomPolynomial(secret, p.threshold); err != nil {
+		return nil, nil, err
+	}
+	if p.b, err = randomPolynomial(blind, p.threshold); err != nil {
+		return nil, nil, err
+	}
+
+	// Pedersen commitments to the coefficients: C_k = g^a_k * h^b_k
+	commitments := make([]*ristretto255.Element, p.threshold)
+	for k := range commitments {
+		if commitments[k], err = Commit(p.a[k], p.b[k]); err != nil {
+			return nil, nil, err
+		}
+	}
+	proof, err := proveOpening(p.self, p.a[0], p.b[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	p.commitments[p.self-1] = commitments
+	p.shares[p.self-1] = p.shareFor(p.self)
+
+	shares := make([]PrivateShare, 0, p.n-1)
+	for _, j := range indexRange(p.n) {
+		if j != p.self {
+			shares = append(shares, PrivateShare{Dealer: p.self, Recipient: j, Share: p.shareFor(j)})
+		}
+	}
+
+	p.step = stepVerify
+	return &Deal{Dealer: p.self, Commitments: commitments, Proof: proof}, shares, nil
+}
+
+// Verify processes the Deals and the participant's PrivateShares from round
+// 1. Dealers without a Deal, or whose Deal does not prove knowledge of the
+// opening of C_0, are disqualified. Returns the complaints to
+// broadcast against dealers whose share is missing or invalid.
+func (p *Participant) Verify(deals []*Deal, shares []*PrivateShare) ([]Complaint, error) {
+	if err := p.expect(stepVerify); err != nil {
+		return nil, err
+	}
+
+	for _, d := range deals {
+		if d == nil || !p.peer(d.Dealer) || p.commitments[d.Dealer-1] != nil {
+			continue
+		}
+		if len(d.Commitments) != int(p.threshold) || verifyOpening(d.Dealer, d.Commitments[0], d.Proof) != nil {
+			continue
+		}
+		p.commitments[d.Dealer-1] = d.Commitments
+	}
+
+	for _, s := range shares {
+		if s == nil || !p.peer(s.Dealer) || s.Recipient != p.self || p.shares[s.Dealer-1][0].Value != nil {
+			continue
+		}
+		p.shares[s.Dealer-1] = s.Share
+	}
+
+	var complaints []Complaint
+	for _, i := range indexRange(p.n) {
+		if i == p.self {
+			continue
+		}
+		if p.commitments[i-1] == nil {
+			p.disqualified[i-1] = true
+			continue
+		}
+		if verifyPedersenShare(p.commitments[i-1], p.self, p.shares[i-1]) != nil {
+			p.shares[i-1] = [2]toprf.Share16{}
+			complaints = append(complaints, Complaint{Accuser: p.self, Accused: i})
+		}
+	}
+
+	p.complaints = complaints
+	p.step = stepJustify
+	return complaints, nil
+}
+
+// Justify processes the complaints from round 2. Returns the justifications
+// the participant must broadcast for complaints against itself.
+func (p *Participant) Justify(complaints []Complaint) ([]Justification, error) {
+	if err := p.expect(stepJustify); err != nil {
+		return nil, err
+	}
+
+	for _, c := range slices.Concat(complaints, p.complaints) {
+		if c.Accuser < 1 || c.Accuser > p.n || c.Accused < 1 || c.Accused > p.n || c.Accuser == c.Accused {
+			continue
+		}
+		if !containsIndex(p.accusers[c.Accused-1], c.Accuser) {
+			p.accusers[c.Accused-1] = append(p.accusers[c.Accused-1], c.Accuser)
+		}
+	}
+
+	var justifications []Justification
+	for _, accuser := range p.accusers[p.self-1] {
+		justifications = append(justifications, Justification{
+			Dealer:  p.self,
+			Accuser: accuser,
+			Share:   p.shareFor(accuser),
+		})
+	}
+
+	p.step = stepQualify
+	return justifications, nil
+}
+
+// Qualify processes the justifications from round 3 and fixes QUAL. If the
+// participant is in QUAL, it returns its Extraction to broadcast, otherwise
+// nil.
+func (p *Participant) Qualify(justifications []Justification) (*Extraction, error) {
+	if err := p.expect(stepQualify); err != nil {
+		return nil, err
+	}
+
+	for _, i := range indexRange(p.n) {
+		accusers := p.accusers[i-1]
+		if p.disqualified[i-1] || len(accusers) == 0 {
+			continue
+		}
+		if len(accusers) >= int(p.threshold) {
+			p.disqualified[i-1] = true
+			continue
+		}
+
+		for _, accuser := range accusers {
+			share, ok := findJustification(justifications, i, accuser)
+			if !ok || verifyPedersenShare(p.commitments[i-1], accuser, share) != nil {
+				p.disqualified[i-1] = true
+				break
+			}
+			if accuser == p.self {
+				p.shares[i-1] = share
+			}
+		}
+	}
+
+	p.qual = nil
+	for _, i := range indexRange(p.n) {
+		if !p.disqualified[i-1] {
+			p.qual = append(p.qual, i)
+		}
+	}
+	if len(p.qual) < int(p.threshold) {
+		return nil, errors.New("dkg: not enough qualified dealers")
+	}
+
+	p.step = stepVerifyExtractions
+	if p.disqualified[p.self-1] {
+		return nil, nil
+	}
+
+	p.extractions[p.self-1] = commitPolynomial(p.a)
+	return &Extraction{Dealer: p.self, Commitments: p.extractions[p.self-1]}, nil
+}
+
+// VerifyExtractions processes the Extractions from round 4. Returns the
+// complaints to broadcast, with evidence, against dealers whose Extraction
+// does not match the participant's share.
+func (p *Participant) VerifyExtractions(extractions []*Extraction) ([]ExtractionComplaint, error) {
+	if err := p.expect(stepVerifyExtractions); err != nil {
+		return nil, err
+	}
+
+	for _, e := range extractions {
+		if e == nil || !p.peer(e.Dealer) || p.disqualified[e.Dealer-1] || p.extractions[e.Dealer-1] != nil {
+			continue
+		}
+		if len(e.Commitments) != int(p.threshold) {
+			continue
+		}
+		p.extractions[e.Dealer-1] = e.Commitments
+	}
+
+	var complaints []ExtractionComplaint
+	for _, i := range p.qual {
+		if i == p.self {
+			continue
+		}
+		if p.extractions[i-1] == nil {
+			p.reconstructing[i-1] = true
+			continue
+		}
+		if toprf.VerifyShare16(p.shares[i-1][0], p.extractions[i-1]) != nil {
+			complaints = append(complaints, ExtractionComplaint{Accuser: p.self, Accused: i, Share: p.shares[i-1]})
+		}
+	}
+
+	p.ownEvidence = complaints
+	p.step = stepReveal
+	return complaints, nil
+}
+
+// Reveal processes the extraction complaints from round 5. Returns the
+// participant's shares from every dealer that must be reconstructed.
+func (p *Participant) Reveal(complaints []ExtractionComplaint) ([]Reveal, error) {
+	if err := p.expect(stepReveal); err != nil {
+		return nil, err
+	}
+
+	for _, c := range slices.Concat(complaints, p.ownEvidence) {
+		if c.Accuser < 1 || c.Accuser > p.n || !containsIndex(p.qual, c.Accused) || p.extractions[c.Accused-1] == nil {
+			continue
+		}
+		// Valid evidence matches the Pedersen commitments but not the
+		// Feldman commitments
+		if verifyPedersenShare(p.commitments[c.Accused-1], c.Accuser, c.Share) != nil {
+			continue
+		}
+		if toprf.VerifyShare16(c.Share[0], p.extractions[c.Accused-1]) != nil {
+			p.reconstructing[c.Accused-1] = true
+		}
+	}
+
+	var reveals []Reveal
+	for _, i := range p.qual {
+		if p.reconstructing[i-1] {
+			reveals = append(reveals, Reveal{Sender: p.self, Dealer: i, Share: p.shares[i-1]})
+		}
+	}
+
+	p.step = stepFinish
+	return reveals, nil
+}
+
+// Finish processes the reveals from round 6, reconstructs the Feldman
+// commitments of dealers that need it, and returns the participant's final
+// share and the public result of the DKG.
+func (p *Participant) Finish(reveals []Reveal) (toprf.Share16, *Result, error) {
+	if err := p.expect(stepFinish); err != nil {
+		return toprf.Share16{}, nil, err
+	}
+
+	for _, i := range p.qual {
+		if !p.reconstructing[i-1] {
+			continue
+		}
+
+		coefficients, err := p.reconstruct(i, reveals)
+		if err != nil {
+			return toprf.Share16{}, nil, err
+		}
+		p.extractions[i-1] = commitPolynomial(coefficients)
+	}
+
+	qualified := make([][]*ristretto255.Element, len(p.qual))
+	value := ristretto255.NewScalar()
+	for k, i := range p.qual {
+		qualified[k] = p.extractions[i-1]
+		value.Add(value, p.shares[i-1][0].Value)
+	}
+
+	group, err := SumCommitments(qualified)
+	if err != nil {
+		return toprf.Share16{}, nil, err
+	}
+	result := newResult(p.n, p.threshold, p.Qual(), group)
+
+	share := toprf.Share16{Index: p.self, Value: value}
+	if err := result.VerifyShare16(share); err != nil {
+		return toprf.Share16{}, nil, err
+	}
+
+	p.step = stepDone
+	return share, result, nil
+}
+
+// Qual returns the indexes of the qualified dealers, once known.
+func (p *Participant) Qual() []uint16 {
+	return append([]uint16(nil), p.qual...)
+}
+
+// Disqualified returns the indexes of the dealers disqualified so far.
+func (p *Participant) Disqualified() []uint16 {
+	var disqualified []uint16
+	for i, d := range p.disqualified {
+		if d {
+			disqualified = append(disqualified, uint16(i+1))
+		}
+	}
+	return disqualified
+}
+
+// Reconstructed returns the indexes of the qualified dealers whose
+// polynomials were reconstructed publicly, once known.
+func (p *Participant) Reconstructed() []uint16 {
+	var reconstructed []uint16
+	for _, i := range p.qual {
+		if p.reconstructing[i-1] {
+			reconstructed = append(reconstructed, i)
+		}
+	}
+	return reconstructed
+}
+
+// reconstruct recovers the secret polynomial of dealer from the valid
+// reveals.
+func (p *Participant) reconstruct(dealer uint16, reveals []Reveal) ([]*ristretto255.Scalar, error) {
+	shares := []toprf.Share16{p.shares[dealer-1][0]}
+	senders := []uint16{p.self}
+	for _, r := range reveals {
+		if len(shares) == int(p.threshold) {
+			break
+		}
+		if r.Dealer != dealer || r.Sender < 1 || r.Sender > p.n || containsIndex(senders, r.Sender) {
+			continue
+		}
+		if verifyPedersenShare(p.commitments[dealer-1], r.Sender, r.Share) != nil {
+			continue
+		}
+		shares = append(shares, r.Share[0])
+		senders = append(senders, r.Sender)
+	}
+
+	if len(shares) < int(p.threshold) {
+		return nil, errors.New("dkg: not enough shares to reconstruct dealer")
+	}
+	return interpolatePolynomial(shares), nil
+}
+
+// shareFor evaluates the participant's polynomials at j.
+func (p *Participant) shareFor(j uint16) [2]toprf.Share16 {
+	return [2]toprf.Share16{polynom16(j, p.a), polynom16(j, p.b)}
+}
+
+// peer reports whether i is the index of another participant.
+func (p *Participant) peer(i uint16) bool {
+	return i >= 1 && i <= p.n && i != p.self
+}
+
+// expect checks that the protocol is at step s.
+func (p *Participant) expect(s step) error {
+	if p.step != s {
+		return errors.New("dkg: protocol step out of order")
+	}
+	return nil
+}
+
+// verifyPedersenShare checks that a share pair for index j matches Pedersen
+// commitments to polynomial coefficients: g^f(j) * h^f'(j) must equal
+// C_0 * C_1^j * ... * C_{t-1}^(j^(t-1)).
+func verifyPedersenShare(commitments []*ristretto255.Element, j uint16, share [2]toprf.Share16) error {
+	if share[0].Value == nil || share[1].Value == nil {
+		return errors.New("dkg: share is missing")
+	}
+	if share[0].Index != j || share[1].Index != j {
+		return errors.New("dkg: share has incorrect index")
+	}
+
+	return VerifyShareCommitment16(toprf.EvaluateCommitments16(commitments, j), share)
+}
+
+// findJustification returns the shares that dealer revealed for accuser.
+func findJustification(justifications []Justification, dealer, accuser uint16) ([2]toprf.Share16, bool) {
+	for _, j := range justifications {
+		if j.Dealer == dealer && j.Accuser == accuser {
+			return j.Share, true
+		}
+	}
+	return [2]toprf.Share16{}, false
+}
+
+// interpolatePolynomial returns the coefficients of the polynomial of degree
+// len(shares)-1 through the given shares.
+func interpolatePolynomial(shares []toprf.Share16) []*ristretto255.Scalar {
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Index < shares[j].Index })
+
+	t := len(shares)
+	coefficients := make([]*ristretto255.Scalar, t)
+	for k := range coefficients {
+		coefficients[k] = ristretto255.NewScalar()
+	}
+
+	for i, si := range shares {
+		xi := scalarFromUint16(si.Index)
+
+		// basis = prod_{j != i} (x - x_j), denominator = prod_{j != i} (x_i - x_j)
+		basis := []*ristretto255.Scalar{scalarFromUint16(1)}
+		denominator := scalarFromUint16(1)
+		for j, sj := range shares {
+			if j == i {
+				continue
+			}
+			xj := scalarFromUint16(sj.Index)
+
+			next := make([]*ristretto255.Scalar, len(basis)+1)
+			next[len(basis)] = ristretto255.NewScalar().Set(basis[len(basis)-1])
+			for k := len(basis) - 1; k >= 1; k-- {
+				next[k] = ristretto255.NewScalar().Multiply(xj, basis[k])
+				next[k].Subtract(basis[k-1], next[k])
+			}
+			next[0] = ristretto255.NewScalar().Multiply(xj, basis[0])
+			next[0].Negate(next[0])
+			basis = next
+
+			denominator.Multiply(denominator, ristretto255.NewScalar().Subtract(xi, xj))
+		}
+
+		factor := ristretto255.NewScalar().Invert(denominator)
+		factor.Multiply(factor, si.Value)
+		for k := range basis {
+			coefficients[k].Add(coefficients[k], ristretto255.NewScalar().Multiply(factor, basis[k]))
+		}
+	}
+
+	return coefficients
+}
@@ -0,0 +1,336 @@
+package dkg
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// gjkrTamper lets a test modify or drop messages before delivery. Each
+// message hook returns false to drop the message; evidence replaces the
+// extraction complaints of round 5.
+type gjkrTamper struct {
+	deal          func(d *Deal) bool
+	share         func(s *PrivateShare) bool
+	justification func(j *Justification) bool
+	extraction    func(e *Extraction) bool
+	evidence      func(complaints []ExtractionComplaint) []ExtractionComplaint
+}
+
+// gjkrRun is the outcome of a GJKR run for all participants.
+type gjkrRun struct {
+	participants []*Participant
+	shares       []toprf.Share16
+	results      []*Result
+}
+
+// runGJKR runs the GJKR protocol between n participants over a reliable
+// broadcast channel, applying tamper to the messages in transit.
+func runGJKR(t *testing.T, n, threshold uint16, tamper gjkrTamper) *gjkrRun {
+	t.Helper()
+
+	participants := make([]*Participant, n)
+	for i := range participants {
+		var err error
+		participants[i], err = NewParticipant(n, threshold, uint16(i+1))
+		if err != nil {
+			t.Fatalf("NewParticipant failed: %v", err)
+		}
+	}
+
+	// Round 1: deals and private shares
+	var deals []*Deal
+	inbox := make([][]*PrivateShare, n)
+	for _, p := range participants {
+		deal, shares, err := p.Deal()
+		if err != nil {
+			t.Fatalf("Participant %d: Deal failed: %v", p.Index(), err)
+		}
+		if tamper.deal == nil || tamper.deal(deal) {
+			deals = append(deals, deal)
+		}
+		for k := range shares {
+			s := &shares[k]
+			if tamper.share == nil || tamper.share(s) {
+				inbox[s.Recipient-1] = append(inbox[s.Recipient-1], s)
+			}
+		}
+	}
+
+	// Round 2: complaints
+	var complaints []Complaint
+	for i, p := range participants {
+		c, err := p.Verify(deals, inbox[i])
+		if err != nil {
+			t.Fatalf("Participant %d: Verify failed: %v", p.Index(), err)
+		}
+		complaints = append(complaints, c...)
+	}
+
+	// Round 3: justifications
+	var justifications []Justification
+	for _, p := range participants {
+		js, err := p.Justify(complaints)
+		if err != nil {
+			t.Fatalf("Participant %d: Justify failed: %v", p.Index(), err)
+		}
+		for k := range js {
+			j := &js[k]
+			if tamper.justification == nil || tamper.justification(j) {
+				justifications = append(justifications, *j)
+			}
+		}
+	}
+
+	// Round 4: QUAL and extractions
+	var extractions []*Extraction
+	for _, p := range participants {
+		e, err := p.Qualify(justifications)
+		if err != nil {
+			t.Fatalf("Participant %d: Qualify failed: %v", p.Index(), err)
+		}
+		if e != nil && (tamper.extraction == nil || tamper.extraction(e)) {
+			extractions = append(extractions, e)
+		}
+	}
+
+	// Round 5: extraction complaints
+	var evidence []ExtractionComplaint
+	for _, p := range participants {
+		cs, err := p.VerifyExtractions(extractions)
+		if err != nil {
+			t.Fatalf("Participant %d: VerifyExtractions failed: %v", p.Index(), err)
+		}
+		evidence = append(evidence, cs...)
+	}
+	if tamper.evidence != nil {
+		evidence = tamper.evidence(evidence)
+	}
+
+	// Round 6: reveals
+	var reveals []Reveal
+	for _, p := range participants {
+		rs, err := p.Reveal(evidence)
+		if err != nil {
+			t.Fatalf("Participant %d: Reveal failed: %v", p.Index(), err)
+		}
+		reveals = append(reveals, rs...)
+	}
+
+	run := &gjkrRun{participants: participants}
+	for _, p := range participants {
+		share, result, err := p.Finish(reveals)
+		if err != nil {
+			t.Fatalf("Participant %d: Finish failed: %v", p.Index(), err)
+		}
+		run.shares = append(run.shares, share)
+		run.results = append(run.results, result)
+	}
+	return run
+}
+
+// checkGJKR checks that the honest participants agree on the result and that
+// their shares are a sharing of the public key's secret. The faulty
+// participant (0 for none) trusts its own messages, so its view is ignored.
+func checkGJKR(t *testing.T, run *gjkrRun, qual []uint16, faulty uint16) {
+	t.Helper()
+
+	var shares []toprf.Share16
+	var results []*Result
+	for i, p := range run.participants {
+		if p.Index() != faulty {
+			shares = append(shares, run.shares[i])
+			results = append(results, run.results[i])
+		}
+	}
+
+	encoded, _ := results[0].MarshalBinary()
+	for i, result := range results[1:] {
+		other, _ := result.MarshalBinary()
+		if !bytes.Equal(encoded, other) {
+			t.Errorf("Participant %d computed a different result", shares[i+1].Index)
+		}
+	}
+
+	if !slices.Equal(results[0].Qual, qual) {
+		t.Errorf("QUAL = %v, want %v", results[0].Qual, qual)
+	}
+
+	secret, _ := Reconstruct16(shares[len(shares)-int(results[0].Threshold):])
+	if results[0].PublicKey.Equal(ristretto255.NewElement().ScalarBaseMult(secret)) != 1 {
+		t.Error("Public key does not match the shared secret")
+	}
+}
+
+// TestGJKR tests an honest run
+func TestGJKR(t *testing.T) {
+	run := runGJKR(t, 5, 3, gjkrTamper{})
+	checkGJKR(t, run, []uint16{1, 2, 3, 4, 5}, 0)
+
+	for _, p := range run.participants {
+		if len(p.Disqualified()) != 0 || len(p.Reconstructed()) != 0 {
+			t.Errorf("Participant %d: unexpected disqualified %v or reconstructed %v",
+				p.Index(), p.Disqualified(), p.Reconstructed())
+		}
+	}
+}
+
+// TestGJKRJustifiedComplaint tests that a dealer stays qualified when it
+// answers a complaint with a valid share
+func TestGJKRJustifiedComplaint(t *testing.T) {
+	run := runGJKR(t, 5, 3, gjkrTamper{
+		share: func(s *PrivateShare) bool {
+			// The share from dealer 1 to participant 2 is lost
+			return !(s.Dealer == 1 && s.Recipient == 2)
+		},
+	})
+	checkGJKR(t, run, []uint16{1, 2, 3, 4, 5}, 0)
+}
+
+// TestGJKRDisqualification tests the reasons for disqualification
+func TestGJKRDisqualification(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tamper gjkrTamper
+		qual   []uint16
+		faulty uint16
+	}{
+		{
+			name: "missing deal",
+			tamper: gjkrTamper{
+				deal: func(d *Deal) bool { return d.Dealer != 4 },
+			},
+			qual:   []uint16{1, 2, 3, 5},
+			faulty: 4,
+		},
+		{
+			name: "invalid justification",
+			tamper: gjkrTamper{
+				share: func(s *PrivateShare) bool {
+					if s.Dealer == 2 && s.Recipient == 5 {
+						s.Share[0].Value = scalarFromUint8(1)
+					}
+					return true
+				},
+				justification: func(j *Justification) bool {
+					if j.Dealer == 2 {
+						j.Share[1].Value = scalarFromUint8(1)
+					}
+					return true
+				},
+			},
+			qual:   []uint16{1, 3, 4, 5},
+			faulty: 2,
+		},
+		{
+			name: "missing justification",
+			tamper: gjkrTamper{
+				share:         func(s *PrivateShare) bool { return !(s.Dealer == 3 && s.Recipient == 1) },
+				justification: func(j *Justification) bool { return j.Dealer != 3 },
+			},
+			qual:   []uint16{1, 2, 4, 5},
+			faulty: 3,
+		},
+		{
+			name: "threshold complaints",
+			tamper: gjkrTamper{
+				share: func(s *PrivateShare) bool { return !(s.Dealer == 1 && s.Recipient <= 4) },
+			},
+			qual:   []uint16{2, 3, 4, 5},
+			faulty: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run := runGJKR(t, 5, 3, tc.tamper)
+			checkGJKR(t, run, tc.qual, tc.faulty)
+		})
+	}
+}
+
+// TestGJKRBadExtraction tests that a dealer whose Feldman commitments do not
+// match its shares is reconstructed instead of breaking the result
+func TestGJKRBadExtraction(t *testing.T) {
+	for _, drop := range []bool{false, true} {
+		run := runGJKR(t, 5, 3, gjkrTamper{
+			extraction: func(e *Extraction) bool {
+				if e.Dealer != 2 {
+					return true
+				}
+				e.Commitments = commitPolynomial([]*ristretto255.Scalar{
+					scalarFromUint8(1), scalarFromUint8(2), scalarFromUint8(3),
+				})
+				return !drop
+			},
+		})
+		checkGJKR(t, run, []uint16{1, 2, 3, 4, 5}, 2)
+
+		for _, p := range run.participants {
+			if p.Index() == 2 {
+				continue
+			}
+			if got := p.Reconstructed(); len(got) != 1 || got[0] != 2 {
+				t.Errorf("drop=%v: participant %d reconstructed %v, want [2]", drop, p.Index(), got)
+			}
+		}
+	}
+}
+
+// TestGJKRFalseEvidence tests that fabricated extraction complaints are
+// ignored
+func TestGJKRFalseEvidence(t *testing.T) {
+	run := runGJKR(t, 4, 2, gjkrTamper{
+		evidence: func(complaints []ExtractionComplaint) []ExtractionComplaint {
+			// Participant 3 accuses dealer 2 with made-up shares
+			return append(complaints, ExtractionComplaint{Accuser: 3, Accused: 2, Share: [2]toprf.Share16{
+				{Index: 3, Value: scalarFromUint8(5)},
+				{Index: 3, Value: scalarFromUint8(6)},
+			}})
+		},
+	})
+	checkGJKR(t, run, []uint16{1, 2, 3, 4}, 3)
+
+	for _, p := range run.participants {
+		if got := p.Reconstructed(); len(got) != 0 {
+			t.Errorf("Participant %d reconstructed %v after false evidence", p.Index(), got)
+		}
+	}
+}
+
+// TestParticipantStepOrder tests that methods must be called in order
+func TestParticipantStepOrder(t *testing.T) {
+	p, err := NewParticipant(3, 2, 1)
+	if err != nil {
+		t.Fatalf("NewParticipant failed: %v", err)
+	}
+	if _, err := p.Verify(nil, nil); err == nil {
+		t.Error("Verify accepted before Deal")
+	}
+	if _, _, err := p.Deal(); err != nil {
+		t.Fatalf("Deal failed: %v", err)
+	}
+	if _, _, err := p.Deal(); err == nil {
+		t.Error("Deal accepted twice")
+	}
+
+	if _, err := NewParticipant(3, 2, 4); err == nil {
+		t.Error("NewParticipant accepted an index out of range")
+	}
+}
+
+// TestInterpolatePolynomial tests recovering coefficients from shares
+func TestInterpolatePolynomial(t *testing.T) {
+	a := []*ristretto255.Scalar{scalarFromUint8(7), scalarFromUint8(3), scalarFromUint8(11)}
+	shares := []toprf.Share16{polynom16(5, a), polynom16(2, a), polynom16(9, a)}
+
+	coefficients := interpolatePolynomial(shares)
+	for k := range a {
+		if !bytes.Equal(coefficients[k].Encode(nil), a[k].Encode(nil)) {
+			t.Errorf("Coefficient %d mismatch", k)
+		}
+	}
+}
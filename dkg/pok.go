@@ -0,0 +1,291 @@
+package dkg
+
+// Proof of knowledge of the constant term
+//
+// In Start, every dealer broadcasts C_0 = g^a_0, and the public key is the
+// sum of the C_0 of all dealers. A rogue dealer that waits for the others'
+// commitments can broadcast C_0 = g^x - (sum of the others' C_0) and control
+// the public key without knowing its own a_0. As in FROST's DKG, each dealer
+// therefore proves knowledge of a_0 with a Schnorr proof bound to its index
+// and a context string (e.g. a session ID):
+//
+//	R = g^k, c = H(DST || 0x00 || i || len(context) || context || C_0 || R), z = k + c*a_0
+//
+// and receivers check g^z == R + c*C_0 before accepting the dealer.
+// StartWithProof and VerifyConstantTerms do this for Start.
+//
+// A Participant broadcasts Pedersen commitments C_0 = g^a_0 * h^b_0 in its
+// Deal, so it proves knowledge of the opening (a_0, b_0) instead:
+//
+//	R = g^k * h^k', c = H(DST || 0x01 || i || 0 || C_0 || R), z = k + c*a_0, z' = k' + c*b_0
+//
+// checked as g^z * h^z' == R + c*C_0. Participant.Verify disqualifies a
+// dealer whose proof is missing or invalid. The Deal is not bound to a
+// session here; signed messages (see message.go) bind it.
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+const (
+	// ConstantTermProofBytes is the size of a serialized ConstantTermProof
+	ConstantTermProofBytes = ElementBytes + ScalarBytes
+
+	// OpeningProofBytes is the size of a serialized OpeningProof
+	OpeningProofBytes = ElementBytes + 2*ScalarBytes
+
+	// pokDST is the domain separation tag of the proof challenge
+	pokDST = "DKG-PoK-ristretto255-SHA512"
+)
+
+// ConstantTermProof is a Schnorr proof of knowledge of a_0 for C_0 = g^a_0.
+type ConstantTermProof struct {
+	R *ristretto255.Element
+	Z *ristretto255.Scalar
+}
+
+// OpeningProof is a proof of knowledge of the opening (a_0, b_0) of a
+// Pedersen commitment C_0 = g^a_0 * h^b_0.
+type OpeningProof struct {
+	R      *ristretto255.Element
+	Z      *ristretto255.Scalar
+	ZBlind *ristretto255.Scalar
+}
+
+// StartWithProof works like Start, and also proves knowledge of the
+// dealer's constant term.
+//
+// Parameters:
+//   - n: Total number of participants
+//   - threshold: Minimum number of participants needed
+//   - dealer: The dealer's index (1-based)
+//   - context: A string all participants agree on, e.g. a session ID
+//
+// Returns:
+//   - commitments, shares: As returned by Start
+//   - proof: The proof to broadcast with the commitments
+//   - err: Error if parameters are invalid
+func StartWithProof(n, threshold, dealer uint8, context []byte) (
+	commitments []*ristretto255.Element,
+	shares []toprf.Share,
+	proof *ConstantTermProof,
+	err error,
+) {
+	if threshold < 2 || threshold > n {
+		return nil, nil, nil, errors.New("dkg: threshold must be > 1 and <= n")
+	}
+	if dealer < 1 || dealer > n {
+		return nil, nil, nil, errors.New("dkg: dealer index out of range")
+	}
+
+	secret, err := randomScalar()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	a, err := randomPolynomial(secret, uint16(threshold))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	commitments = commitPolynomial(a)
+	shares = make([]toprf.Share, n)
+	for j := uint8(1); j <= n; j++ {
+		shares[j-1] = polynom(j, threshold, a)
+	}
+
+	proof, err = ProveConstantTerm(dealer, context, a[0])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return commitments, shares, proof, nil
+}
+
+// ProveConstantTerm proves knowledge of secret for C_0 = g^secret.
+func ProveConstantTerm(dealer uint8, context []byte, secret *ristretto255.Scalar) (*ConstantTermProof, error) {
+	if len(context) > 0xffff {
+		return nil, errors.New("dkg: proof context too long")
+	}
+
+	k, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	r := ristretto255.NewElement().ScalarBaseMult(k)
+	c := pokChallenge(0, uint16(dealer), context, ristretto255.NewElement().ScalarBaseMult(secret), r)
+
+	// z = k + c*a_0
+	z := ristretto255.NewScalar().Multiply(c, secret)
+	z.Add(z, k)
+	return &ConstantTermProof{R: r, Z: z}, nil
+}
+
+// VerifyConstantTerm checks a dealer's proof of knowledge of the constant
+// term behind its commitment C_0.
+func VerifyConstantTerm(dealer uint8, context []byte, commitment *ristretto255.Element, proof *ConstantTermProof) error {
+	if proof == nil || proof.R == nil || proof.Z == nil || commitment == nil {
+		return errors.New("dkg: missing proof of knowledge")
+	}
+	if len(context) > 0xffff {
+		return errors.New("dkg: proof context too long")
+	}
+
+	// g^z - c*C_0 == R
+	c := pokChallenge(0, uint16(dealer), context, commitment, proof.R)
+	negC := ristretto255.NewScalar().Negate(c)
+	expected := ristretto255.NewElement().VarTimeDoubleScalarBaseMult(negC, commitment, proof.Z)
+	if expected.Equal(proof.R) != 1 {
+		return errors.New("dkg: invalid proof of knowledge")
+	}
+	return nil
+}
+
+// VerifyConstantTerms checks the proofs of all dealers, like
+// VerifyCommitments checks their shares.
+//
+// Parameters:
+//   - context: The context the dealers used
+//   - commitments: The commitments of each dealer, in dealer order
+//   - proofs: The proof of each dealer, in dealer order
+//
+// Returns:
+//   - The indexes of dealers whose proof is missing or invalid
+//   - Error if the number of proofs does not match
+func VerifyConstantTerms(context []byte, commitments [][]*ristretto255.Element, proofs []*ConstantTermProof) ([]uint8, error) {
+	if len(proofs) != len(commitments) || len(commitments) > 255 {
+		return nil, errors.New("dkg: wrong number of proofs")
+	}
+
+	var fails []uint8
+	for i := range commitments {
+		dealer := uint8(i + 1)
+		if len(commitments[i]) == 0 || VerifyConstantTerm(dealer, context, commitments[i][0], proofs[i]) != nil {
+			fails = append(fails, dealer)
+		}
+	}
+	return fails, nil
+}
+
+// MarshalBinary encodes a ConstantTermProof.
+// Format: [R:32 bytes][z:32 bytes]
+func (p *ConstantTermProof) MarshalBinary() ([]byte, error) {
+	if p.R == nil || p.Z == nil {
+		return nil, errors.New("dkg: incomplete proof")
+	}
+	data := make([]byte, 0, ConstantTermProofBytes)
+	data = p.R.Encode(data)
+	return p.Z.Encode(data), nil
+}
+
+// UnmarshalBinary decodes a ConstantTermProof.
+func (p *ConstantTermProof) UnmarshalBinary(data []byte) error {
+	if len(data) != ConstantTermProofBytes {
+		return errors.New("dkg: invalid proof length")
+	}
+	r, z := ristretto255.NewElement(), ristretto255.NewScalar()
+	if err := r.Decode(data[:ElementBytes]); err != nil {
+		return err
+	}
+	if err := z.Decode(data[ElementBytes:]); err != nil {
+		return err
+	}
+	p.R, p.Z = r, z
+	return nil
+}
+
+// MarshalBinary encodes an OpeningProof.
+// Format: [R:32 bytes][z:32 bytes][z':32 bytes]
+func (p *OpeningProof) MarshalBinary() ([]byte, error) {
+	if p.R == nil || p.Z == nil || p.ZBlind == nil {
+		return nil, errors.New("dkg: incomplete proof")
+	}
+	data := make([]byte, 0, OpeningProofBytes)
+	data = p.R.Encode(data)
+	data = p.Z.Encode(data)
+	return p.ZBlind.Encode(data), nil
+}
+
+// UnmarshalBinary decodes an OpeningProof.
+func (p *OpeningProof) UnmarshalBinary(data []byte) error {
+	if len(data) != OpeningProofBytes {
+		return errors.New("dkg: invalid proof length")
+	}
+	r, z, zBlind := ristretto255.NewElement(), ristretto255.NewScalar(), ristretto255.NewScalar()
+	if err := r.Decode(data[:ElementBytes]); err != nil {
+		return err
+	}
+	if err := z.Decode(data[ElementBytes : ElementBytes+ScalarBytes]); err != nil {
+		return err
+	}
+	if err := zBlind.Decode(data[ElementBytes+ScalarBytes:]); err != nil {
+		return err
+	}
+	p.R, p.Z, p.ZBlind = r, z, zBlind
+	return nil
+}
+
+// proveOpening proves knowledge of (a, b) for C = g^a * h^b
+func proveOpening(dealer uint16, a, b *ristretto255.Scalar) (*OpeningProof, error) {
+	k, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+	kBlind, err := randomScalar()
+	if err != nil {
+		return nil, err
+	}
+
+	commitment, err := Commit(a, b)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Commit(k, kBlind)
+	if err != nil {
+		return nil, err
+	}
+	c := pokChallenge(1, dealer, nil, commitment, r)
+
+	// z = k + c*a, z' = k' + c*b
+	z := ristretto255.NewScalar().Multiply(c, a)
+	z.Add(z, k)
+	zBlind := ristretto255.NewScalar().Multiply(c, b)
+	zBlind.Add(zBlind, kBlind)
+	return &OpeningProof{R: r, Z: z, ZBlind: zBlind}, nil
+}
+
+// verifyOpening checks a proof of knowledge of the opening of commitment
+func verifyOpening(dealer uint16, commitment *ristretto255.Element, proof *OpeningProof) error {
+	if proof == nil || proof.R == nil || proof.Z == nil || proof.ZBlind == nil || commitment == nil {
+		return errors.New("dkg: missing proof of knowledge")
+	}
+
+	// g^z * h^z' == R + c*C_0
+	c := pokChallenge(1, dealer, nil, commitment, proof.R)
+	lhs, err := Commit(proof.Z, proof.ZBlind)
+	if err != nil {
+		return err
+	}
+	rhs := ristretto255.NewElement().ScalarMult(c, commitment)
+	rhs.Add(rhs, proof.R)
+	if lhs.Equal(rhs) != 1 {
+		return errors.New("dkg: invalid proof of knowledge")
+	}
+	return nil
+}
+
+// pokChallenge hashes the statement and commitment of a proof to a scalar
+func pokChallenge(kind uint8, dealer uint16, context []byte, commitment, r *ristretto255.Element) *ristretto255.Scalar {
+	h := sha512.New()
+	h.Write([]byte(pokDST))
+	h.Write([]byte{kind})
+	h.Write(binary.BigEndian.AppendUint16(nil, dealer))
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(context))))
+	h.Write(context)
+	h.Write(commitment.Encode(nil))
+	h.Write(r.Encode(nil))
+	return ristretto255.NewScalar().FromUniformBytes(h.Sum(nil))
+}
@@ -0,0 +1,112 @@
+package dkg
+
+import (
+	"testing"
+
+	"github.com/gtank/ristretto255"
+)
+
+// TestStartWithProof tests proofs of knowledge of the constant term
+func TestStartWithProof(t *testing.T) {
+	n, threshold := uint8(3), uint8(2)
+	context := []byte("session 1")
+
+	commitments := make([][]*ristretto255.Element, n)
+	proofs := make([]*ConstantTermProof, n)
+	for i := range commitments {
+		var err error
+		commitments[i], _, proofs[i], err = StartWithProof(n, threshold, uint8(i+1), context)
+		if err != nil {
+			t.Fatalf("StartWithProof failed: %v", err)
+		}
+	}
+
+	fails, err := VerifyConstantTerms(context, commitments, proofs)
+	if err != nil || len(fails) != 0 {
+		t.Fatalf("VerifyConstantTerms = %v, %v; want no failures", fails, err)
+	}
+
+	// The proof is bound to the dealer and the context
+	if err := VerifyConstantTerm(2, context, commitments[0][0], proofs[0]); err == nil {
+		t.Error("Proof verified for another dealer")
+	}
+	if err := VerifyConstantTerm(1, []byte("session 2"), commitments[0][0], proofs[0]); err == nil {
+		t.Error("Proof verified in another context")
+	}
+
+	// The proof survives encoding
+	data, _ := proofs[1].MarshalBinary()
+	var decoded ConstantTermProof
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if err := VerifyConstantTerm(2, context, commitments[1][0], &decoded); err != nil {
+		t.Errorf("Decoded proof rejected: %v", err)
+	}
+}
+
+// TestRogueConstantTerm tests that a dealer cannot cancel the others'
+// constant terms without being detected
+func TestRogueConstantTerm(t *testing.T) {
+	context := []byte("session")
+	honest, _, honestProof, _ := StartWithProof(2, 2, 1, context)
+
+	// Step 1: The rogue dealer picks C_0 = g^x - C_0(honest), so that the
+	// public key is g^x, and does not know its discrete log
+	x := scalarFromUint8(42)
+	rogue := ristretto255.NewElement().ScalarBaseMult(x)
+	rogue.Subtract(rogue, honest[0])
+
+	// Step 2: It cannot prove knowledge of the constant term, not even by
+	// reusing a proof for a constant term it knows
+	_, _, proof, _ := StartWithProof(2, 2, 2, context)
+	fails, err := VerifyConstantTerms(context,
+		[][]*ristretto255.Element{honest, {rogue, honest[1]}},
+		[]*ConstantTermProof{honestProof, proof})
+	if err != nil {
+		t.Fatalf("VerifyConstantTerms failed: %v", err)
+	}
+	if len(fails) != 1 || fails[0] != 2 {
+		t.Errorf("VerifyConstantTerms failures = %v, want [2]", fails)
+	}
+
+	if _, err := VerifyConstantTerms(context, [][]*ristretto255.Element{honest}, nil); err == nil {
+		t.Error("VerifyConstantTerms accepted a missing proof list")
+	}
+}
+
+// TestGJKRProofOfKnowledge tests that a Participant disqualifies dealers
+// without a valid proof of knowledge of the opening of C_0
+func TestGJKRProofOfKnowledge(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tamper func(d *Deal)
+	}{
+		{"rogue commitment", func(d *Deal) {
+			d.Commitments[0] = ristretto255.NewElement().ScalarBaseMult(scalarFromUint8(7))
+		}},
+		{"missing proof", func(d *Deal) { d.Proof = nil }},
+		{"invalid response", func(d *Deal) { d.Proof.ZBlind = scalarFromUint8(1) }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run := runGJKR(t, 4, 2, gjkrTamper{
+				deal: func(d *Deal) bool {
+					if d.Dealer == 3 {
+						tc.tamper(d)
+					}
+					return true
+				},
+			})
+			checkGJKR(t, run, []uint16{1, 2, 4}, 3)
+		})
+	}
+
+	// An honest proof verifies
+	p, _ := NewParticipant(3, 2, 2)
+	deal, _, _ := p.Deal()
+	if err := verifyOpening(2, deal.Commitments[0], deal.Proof); err != nil {
+		t.Errorf("verifyOpening rejected an honest proof: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package dkg
+
+// Proactive share refresh for threshold keys
+//
+// A refresh re-randomizes every participant's share without changing the
+// shared secret. Each participant deals a random sharing of zero (a
+// polynomial whose constant term is 0), broadcasts Feldman commitments to it
+// and sends the shares privately, exactly like Start. After verifying the
+// received shares, each participant adds them to its current share. The group
+// secret and public key are unchanged, but shares from before the refresh can
+// no longer be combined with shares from after it, so an attacker has to
+// compromise threshold participants within a single epoch.
+//
+// Every refresh is identified by an epoch number. Shares carry the epoch they
+// belong to, and shares dealt for any other epoch are rejected. So do the
+// parts a server computes with EpochShare.Evaluate: ThresholdCombineEpoch and
+// ThresholdMultEpoch reject parts of any epoch but the expected one, since a
+// part from an old share combined with current ones gives a wrong output
+// instead of an error.
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// EpochShareBytes is the size of a serialized EpochShare
+// (4 byte epoch + toprf.ShareBytes).
+const EpochShareBytes = 4 + toprf.ShareBytes
+
+// EpochPartBytes is the size of a part tagged with its epoch
+// (4 byte epoch + toprf.PartBytes).
+const EpochPartBytes = 4 + toprf.PartBytes
+
+// EpochShare is a toprf.Share tagged with the refresh epoch it belongs to.
+//
+// The shares returned by Finish belong to epoch 0. Each successful refresh
+// moves a participant's share to the next epoch.
+type EpochShare struct {
+	Epoch uint32
+	Share toprf.Share
+}
+
+// MarshalBinary encodes an EpochShare into bytes for transmission or storage.
+// Format: [epoch:4 bytes big-endian][share:33 bytes] = 37 bytes total
+func (e *EpochShare) MarshalBinary() ([]byte, error) {
+	share, err := e.Share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, EpochShareBytes)
+	binary.BigEndian.PutUint32(data[:4], e.Epoch)
+	copy(data[4:], share)
+	return data, nil
+}
+
+// UnmarshalBinary decodes an EpochShare from bytes.
+// Expects data to be exactly EpochShareBytes (37 bytes).
+func (e *EpochShare) UnmarshalBinary(data []byte) error {
+	if len(data) != EpochShareBytes {
+		return errors.New("dkg: invalid epoch share length")
+	}
+
+	e.Epoch = binary.BigEndian.Uint32(data[:4])
+	return e.Share.UnmarshalBinary(data[4:])
+}
+
+// RefreshStart deals a refresh for one participant.
+// Generates a random polynomial with constant term zero, commitments to its
+// coefficients, and shares of it for all participants.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold of the key being refreshed
+//   - epoch: the epoch the refreshed shares will belong to (current epoch + 1)
+//
+// Returns:
+//   - commitments: threshold commitments to polynomial coefficients (broadcast to all);
+//     the first commitment is always the identity element
+//   - shares: n shares of zero tagged with epoch, one for each participant (send privately)
+func RefreshStart(n, threshold uint8, epoch uint32) (
+	commitments []*ristretto255.Element,
+	shares []EpochShare,
+	err error,
+) {
+	if threshold < 2 || threshold > n {
+		return nil, nil, errors.New("dkg: threshold must be > 1 and <= n")
+	}
+
+	a, err := randomPolynomial(ristretto255.NewScalar(), uint16(threshold))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitments = commitPolynomial(a)
+
+	shares = make([]EpochShare, n)
+	for j := uint8(1); j <= n; j++ {
+		shares[j-1] = EpochShare{Epoch: epoch, Share: polynom(j, threshold, a)}
+	}
+
+	return commitments, shares, nil
+}
+
+// VerifyRefreshCommitment verifies that a refresh share from peer i is a
+// share of zero for the expected epoch.
+// In addition to the checks done by VerifyCommitment, this rejects shares
+// tagged with a different epoch and commitments whose constant term is not
+// the identity, since such a refresh would change the shared secret.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold parameter
+//   - self: index of current participant (1-based)
+//   - i: index of peer being verified (1-based)
+//   - epoch: the epoch being refreshed to
+//   - commitments: the threshold commitments from peer i
+//   - share: the refresh share received from peer i
+//
+// Returns error if verification fails.
+func VerifyRefreshCommitment(n, threshold, self, i uint8, epoch uint32, commitments []*ristretto255.Element, share EpochShare) error {
+	if share.Epoch != epoch {
+		return errors.New("dkg: refresh share is from the wrong epoch")
+	}
+	if share.Share.Index != self {
+		return errors.New("dkg: share has incorrect index")
+	}
+	if len(commitments) != int(threshold) {
+		return errors.New("dkg: wrong number of commitments")
+	}
+	if commitments[0].Equal(ristretto255.NewIdentityElement()) != 1 {
+		return errors.New("dkg: refresh does not share zero")
+	}
+
+	return VerifyCommitment(n, threshold, self, i, commitments, share.Share)
+}
+
+// VerifyRefreshCommitments verifies refresh shares from all peers.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold parameter
+//   - self: index of current participant (1-based)
+//   - epoch: the epoch being refreshed to
+//   - commitments: refresh commitments from all n peers
+//   - shares: refresh shares received from all n peers
+//
+// Returns list of peer indices that failed verification.
+func VerifyRefreshCommitments(n, threshold, self uint8, epoch uint32, commitments [][]*ristretto255.Element, shares []EpochShare) ([]uint8, error) {
+	if len(commitments) != int(n) || len(shares) != int(n) {
+		return nil, errors.New("dkg: expected commitments and shares from all participants")
+	}
+
+	var fails []uint8
+
+	for i := uint8(1); i <= n; i++ {
+		err := VerifyRefreshCommitment(n, threshold, self, i, epoch, commitments[i-1], shares[i-1])
+		if err != nil {
+			fails = append(fails, i)
+		}
+	}
+
+	return fails, nil
+}
+
+// FinishRefresh adds verified refresh shares to a participant's current share,
+// producing its share for the next epoch.
+// All refresh shares must belong to epoch current.Epoch+1 and be addressed to
+// current.Share.Index.
+//
+// The group's commitments for the new epoch are the sum of the old group
+// commitments and the refresh commitments of all dealers, see SumCommitments.
+// Their constant term, the group public key, does not change.
+func FinishRefresh(current EpochShare, shares []EpochShare) (EpochShare, error) {
+	if len(shares) == 0 {
+		return EpochShare{}, errors.New("dkg: no shares provided")
+	}
+	if current.Share.Value == nil {
+		return EpochShare{}, errors.New("dkg: share value is nil")
+	}
+
+	next := current.Epoch + 1
+	if next == 0 {
+		return EpochShare{}, errors.New("dkg: epoch overflow")
+	}
+
+	result := ristretto255.NewScalar().Set(current.Share.Value)
+	for i := range shares {
+		if shares[i].Epoch != next {
+			return EpochShare{}, errors.New("dkg: refresh share is from the wrong epoch")
+		}
+		if shares[i].Share.Index != current.Share.Index {
+			return EpochShare{}, errors.New("dkg: share has incorrect index")
+		}
+		result.Add(result, shares[i].Share.Value)
+	}
+
+	return EpochShare{
+		Epoch: next,
+		Share: toprf.Share{
+			Index: current.Share.Index,
+			Value: result,
+		},
+	}, nil
+}
+
+// Evaluate evaluates a blinded element with the share like toprf.Evaluate,
+// and tags the part with the share's epoch.
+// Format: [epoch:4 bytes big-endian][part:33 bytes] = 37 bytes total
+func (e *EpochShare) Evaluate(blinded []byte, indexes []uint8) ([]byte, error) {
+	part, err := toprf.Evaluate(e.Share, blinded, indexes)
+	if err != nil {
+		return nil, err
+	}
+	return append(binary.BigEndian.AppendUint32(nil, e.Epoch), part...), nil
+}
+
+// ThresholdCombineEpoch combines parts tagged by EpochShare.Evaluate like
+// toprf.ThresholdCombine, after checking that all of them belong to epoch.
+func ThresholdCombineEpoch(epoch uint32, responses [][]byte) ([]byte, error) {
+	parts, err := epochParts(epoch, responses)
+	if err != nil {
+		return nil, err
+	}
+	return toprf.ThresholdCombine(parts)
+}
+
+// ThresholdMultEpoch combines raw parts tagged by EpochShare.Evaluate like
+// toprf.ThresholdMult, after checking that all of them belong to epoch.
+func ThresholdMultEpoch(epoch uint32, responses [][]byte) ([]byte, error) {
+	parts, err := epochParts(epoch, responses)
+	if err != nil {
+		return nil, err
+	}
+	return toprf.ThresholdMult(parts)
+}
+
+// epochParts checks the epoch of tagged parts and returns the parts
+func epochParts(epoch uint32, responses [][]byte) ([][]byte, error) {
+	parts := make([][]byte, len(responses))
+	for i, resp := range responses {
+		if len(resp) != EpochPartBytes {
+			return nil, errors.New("dkg: invalid epoch part length")
+		}
+		if binary.BigEndian.Uint32(resp[:4]) != epoch {
+			return nil, errors.New("dkg: part is from the wrong epoch")
+		}
+		parts[i] = resp[4:]
+	}
+	return parts, nil
+}
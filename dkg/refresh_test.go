@@ -0,0 +1,307 @@
+package dkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// dealDKG runs a complete DKG among n participants and returns the
+// commitments broadcast by every dealer and each participant's final share.
+func dealDKG(t *testing.T, n, threshold uint8) ([][]*ristretto255.Element, []toprf.Share) {
+	t.Helper()
+
+	commitments := make([][]*ristretto255.Element, n)
+	allShares := make([][]toprf.Share, n)
+	for i := uint8(0); i < n; i++ {
+		var err error
+		commitments[i], allShares[i], err = Start(n, threshold)
+		if err != nil {
+			t.Fatalf("Participant %d: Start failed: %v", i+1, err)
+		}
+	}
+
+	finalShares := make([]toprf.Share, n)
+	for i := uint8(0); i < n; i++ {
+		received := make([]toprf.Share, n)
+		for j := uint8(0); j < n; j++ {
+			received[j] = allShares[j][i]
+		}
+
+		fails, _ := VerifyCommitments(n, threshold, i+1, commitments, received)
+		if len(fails) > 0 {
+			t.Fatalf("Participant %d: verification failed for %v", i+1, fails)
+		}
+
+		var err error
+		finalShares[i], err = Finish(received, i+1)
+		if err != nil {
+			t.Fatalf("Participant %d: Finish failed: %v", i+1, err)
+		}
+	}
+
+	return commitments, finalShares
+}
+
+// refreshAll runs one refresh round for every participant.
+func refreshAll(t *testing.T, threshold uint8, current []EpochShare) ([][]*ristretto255.Element, []EpochShare) {
+	t.Helper()
+
+	n := uint8(len(current))
+	epoch := current[0].Epoch + 1
+
+	commitments := make([][]*ristretto255.Element, n)
+	allShares := make([][]EpochShare, n)
+	for i := uint8(0); i < n; i++ {
+		var err error
+		commitments[i], allShares[i], err = RefreshStart(n, threshold, epoch)
+		if err != nil {
+			t.Fatalf("Participant %d: RefreshStart failed: %v", i+1, err)
+		}
+	}
+
+	next := make([]EpochShare, n)
+	for i := uint8(0); i < n; i++ {
+		received := make([]EpochShare, n)
+		for j := uint8(0); j < n; j++ {
+			received[j] = allShares[j][i]
+		}
+
+		fails, err := VerifyRefreshCommitments(n, threshold, i+1, epoch, commitments, received)
+		if err != nil {
+			t.Fatalf("Participant %d: VerifyRefreshCommitments failed: %v", i+1, err)
+		}
+		if len(fails) > 0 {
+			t.Fatalf("Participant %d: refresh verification failed for %v", i+1, fails)
+		}
+
+		next[i], err = FinishRefresh(current[i], received)
+		if err != nil {
+			t.Fatalf("Participant %d: FinishRefresh failed: %v", i+1, err)
+		}
+	}
+
+	return commitments, next
+}
+
+// TestRefresh verifies that a refresh keeps the secret and changes every share
+func TestRefresh(t *testing.T) {
+	const n = 5
+	const threshold = 3
+
+	commitments, finalShares := dealDKG(t, n, threshold)
+	secret, err := Reconstruct(finalShares[:threshold])
+	if err != nil {
+		t.Fatalf("Reconstruct failed: %v", err)
+	}
+
+	current := make([]EpochShare, n)
+	for i := range finalShares {
+		current[i] = EpochShare{Epoch: 0, Share: finalShares[i]}
+	}
+
+	refreshCommitments, next := refreshAll(t, threshold, current)
+
+	for i := range next {
+		if next[i].Epoch != 1 {
+			t.Errorf("Participant %d: expected epoch 1, got %d", i+1, next[i].Epoch)
+		}
+		if bytes.Equal(next[i].Share.Value.Encode(nil), current[i].Share.Value.Encode(nil)) {
+			t.Errorf("Participant %d: share did not change", i+1)
+		}
+	}
+
+	// Any threshold refreshed shares still reconstruct the same secret
+	refreshed := []toprf.Share{next[4].Share, next[1].Share, next[2].Share}
+	secret2, err := Reconstruct(refreshed)
+	if err != nil {
+		t.Fatalf("Reconstruct failed: %v", err)
+	}
+	if !bytes.Equal(secret.Encode(nil), secret2.Encode(nil)) {
+		t.Error("Refresh changed the shared secret")
+	}
+
+	// Mixing shares from different epochs no longer works
+	mixed := []toprf.Share{current[0].Share, next[1].Share, next[2].Share}
+	secret3, err := Reconstruct(mixed)
+	if err != nil {
+		t.Fatalf("Reconstruct failed: %v", err)
+	}
+	if bytes.Equal(secret.Encode(nil), secret3.Encode(nil)) {
+		t.Error("Shares from different epochs reconstructed the secret")
+	}
+
+	// Refreshed shares verify against the updated group commitments
+	group, err := SumCommitments(commitments)
+	if err != nil {
+		t.Fatalf("SumCommitments failed: %v", err)
+	}
+	updated, err := SumCommitments(append([][]*ristretto255.Element{group}, refreshCommitments...))
+	if err != nil {
+		t.Fatalf("SumCommitments failed: %v", err)
+	}
+	if updated[0].Equal(group[0]) != 1 {
+		t.Error("Refresh changed the group public key")
+	}
+	for i := range next {
+		if err := VerifyCommitment(n, threshold, uint8(i+1), 0, updated, next[i].Share); err != nil {
+			t.Errorf("Participant %d: refreshed share does not match group commitments: %v", i+1, err)
+		}
+	}
+}
+
+// TestRefreshRejectsWrongEpoch verifies that shares from other epochs are rejected
+func TestRefreshRejectsWrongEpoch(t *testing.T) {
+	const n = 3
+	const threshold = 2
+
+	_, finalShares := dealDKG(t, n, threshold)
+	current := EpochShare{Epoch: 4, Share: finalShares[0]}
+
+	commitments, shares, err := RefreshStart(n, threshold, 4)
+	if err != nil {
+		t.Fatalf("RefreshStart failed: %v", err)
+	}
+
+	// A replayed share from the current epoch fails verification...
+	if err := VerifyRefreshCommitment(n, threshold, 1, 2, 5, commitments, shares[0]); err == nil {
+		t.Error("VerifyRefreshCommitment accepted a share from an old epoch")
+	}
+
+	// ...and cannot be applied
+	if _, err := FinishRefresh(current, []EpochShare{shares[0]}); err == nil {
+		t.Error("FinishRefresh accepted a share from an old epoch")
+	}
+}
+
+// TestEpochParts verifies that parts are tagged with the epoch of their share
+// and that parts of another epoch are rejected when combining
+func TestEpochParts(t *testing.T) {
+	const n = 3
+	const threshold = 2
+
+	_, finalShares := dealDKG(t, n, threshold)
+	current := make([]EpochShare, n)
+	for i := range finalShares {
+		current[i] = EpochShare{Epoch: 0, Share: finalShares[i]}
+	}
+	_, next := refreshAll(t, threshold, current)
+
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	indexes := []uint8{1, 2}
+	evaluate := func(shares []EpochShare, indexes []uint8) [][]byte {
+		t.Helper()
+		var parts [][]byte
+		for _, s := range shares {
+			part, err := s.Evaluate(alpha, indexes)
+			if err != nil {
+				t.Fatalf("Evaluate failed: %v", err)
+			}
+			parts = append(parts, part)
+		}
+		return parts
+	}
+
+	// Step 1: Parts of one epoch combine to the same output in every epoch
+	before, err := ThresholdCombineEpoch(0, evaluate(current[:2], indexes))
+	if err != nil {
+		t.Fatalf("ThresholdCombineEpoch failed: %v", err)
+	}
+	after, err := ThresholdCombineEpoch(1, evaluate(next[:2], indexes))
+	if err != nil {
+		t.Fatalf("ThresholdCombineEpoch failed: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Refresh changed the evaluation")
+	}
+	raw, err := ThresholdMultEpoch(1, evaluate(next[1:], nil))
+	if err != nil {
+		t.Fatalf("ThresholdMultEpoch failed: %v", err)
+	}
+	if !bytes.Equal(raw, after) {
+		t.Error("ThresholdMultEpoch differs from ThresholdCombineEpoch")
+	}
+
+	// Step 2: A stale part among current ones is rejected
+	mixed := evaluate([]EpochShare{current[0], next[1]}, indexes)
+	if _, err := ThresholdCombineEpoch(1, mixed); err == nil {
+		t.Error("ThresholdCombineEpoch accepted a part from an old epoch")
+	}
+	if _, err := ThresholdMultEpoch(1, evaluate([]EpochShare{next[0], current[1]}, nil)); err == nil {
+		t.Error("ThresholdMultEpoch accepted a part from an old epoch")
+	}
+
+	// Step 3: So are old parts that agree among themselves, and untagged parts
+	if _, err := ThresholdCombineEpoch(1, evaluate(current[:2], indexes)); err == nil {
+		t.Error("ThresholdCombineEpoch accepted parts from an old epoch")
+	}
+	plain, _ := toprf.Evaluate(next[0].Share, alpha, indexes)
+	if _, err := ThresholdCombineEpoch(1, [][]byte{plain, mixed[1]}); err == nil {
+		t.Error("ThresholdCombineEpoch accepted an untagged part")
+	}
+}
+
+// TestRefreshRejectsNonZeroSharing verifies that a dealer cannot shift the secret
+func TestRefreshRejectsNonZeroSharing(t *testing.T) {
+	const n = 3
+	const threshold = 2
+
+	// A malicious dealer shares a non-zero value with valid Feldman commitments
+	commitments, shares, err := Start(n, threshold)
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	share := EpochShare{Epoch: 1, Share: shares[0]}
+	if err := VerifyRefreshCommitment(n, threshold, 1, 2, 1, commitments, share); err == nil {
+		t.Error("VerifyRefreshCommitment accepted a sharing of a non-zero value")
+	}
+
+	// A dealer whose share does not match its commitments is reported
+	zeroCommitments, zeroShares, err := RefreshStart(n, threshold, 1)
+	if err != nil {
+		t.Fatalf("RefreshStart failed: %v", err)
+	}
+	tampered := zeroShares[0]
+	tampered.Share.Value = ristretto255.NewScalar().Add(tampered.Share.Value, scalarFromUint8(1))
+
+	allCommitments := [][]*ristretto255.Element{zeroCommitments, zeroCommitments, zeroCommitments}
+	received := []EpochShare{zeroShares[0], tampered, zeroShares[0]}
+	fails, err := VerifyRefreshCommitments(n, threshold, 1, 1, allCommitments, received)
+	if err != nil {
+		t.Fatalf("VerifyRefreshCommitments failed: %v", err)
+	}
+	if len(fails) != 1 || fails[0] != 2 {
+		t.Errorf("Expected participant 2 to fail verification, got %v", fails)
+	}
+}
+
+// TestEpochShareMarshal tests EpochShare serialization/deserialization
+func TestEpochShareMarshal(t *testing.T) {
+	original := EpochShare{
+		Epoch: 0x01020304,
+		Share: toprf.Share{Index: 9, Value: scalarFromUint8(77)},
+	}
+
+	data, err := original.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if len(data) != EpochShareBytes {
+		t.Errorf("Marshaled share has wrong length: got %d, want %d", len(data), EpochShareBytes)
+	}
+
+	var decoded EpochShare
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.Epoch != original.Epoch || decoded.Share.Index != original.Share.Index {
+		t.Errorf("Header mismatch: got epoch %d index %d", decoded.Epoch, decoded.Share.Index)
+	}
+	if !bytes.Equal(decoded.Share.Value.Encode(nil), original.Share.Value.Encode(nil)) {
+		t.Error("Value mismatch after marshal/unmarshal")
+	}
+}
@@ -0,0 +1,243 @@
+package dkg
+
+// Enrollment repair of a lost share
+//
+// Repair rebuilds the share of a participant that lost it, with the help of
+// threshold other participants, without reconstructing the secret and without
+// revealing the repaired share to anybody but its owner.
+//
+// The repaired share is s_r = sum_i lambda_i(r) * s_i over the helper set.
+// Each helper i computes its term delta_i = lambda_i(r) * s_i, splits it into
+// random additive parts delta_ij (one for every helper j), and publishes
+// commitments g^delta_ij. Helper j sums the parts it received into
+// sigma_j = sum_i delta_ij and sends only sigma_j to the participant being
+// repaired, who adds them up to get s_r. A single helper only ever sees random
+// parts of other helpers' terms, so it learns neither the secret nor s_r.
+//
+// Everything is checked against the group's Feldman commitments: the parts of
+// helper i must sum "in the exponent" to lambda_i(r) times i's verification
+// key, each sigma_j must match the committed parts, and the repaired share
+// must match the verification key of index r.
+
+import (
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// RepairStart computes one helper's contribution to repairing the share at
+// index lost.
+//
+// Parameters:
+//   - share: the helper's share of the group secret
+//   - lost: index of the share being repaired (1-based)
+//   - helpers: indexes of all helping participants (at least threshold, including share.Index)
+//
+// Returns:
+//   - commitments: g^part for every part, in the order of helpers (broadcast to all)
+//   - parts: one random additive part for every helper, indexed by the
+//     receiving helper (send privately)
+func RepairStart(share toprf.Share, lost uint8, helpers []uint8) (
+	commitments []*ristretto255.Element,
+	parts []toprf.Share,
+	err error,
+) {
+	if share.Value == nil {
+		return nil, nil, errors.New("dkg: share value is nil")
+	}
+	if err := checkRepairHelpers(lost, helpers); err != nil {
+		return nil, nil, err
+	}
+	if !containsIndex(helpers, share.Index) {
+		return nil, nil, errors.New("dkg: share index is not among the helpers")
+	}
+
+	// delta = lambda_i(lost) * s_i
+	delta := toprf.LagrangeCoefficient(share.Index, lost, helpers)
+	delta.Multiply(delta, share.Value)
+
+	// Split delta into len(helpers) random parts that sum to delta
+	parts = make([]toprf.Share, len(helpers))
+	last := ristretto255.NewScalar().Set(delta)
+	for k := 0; k < len(helpers)-1; k++ {
+		r, err := randomScalar()
+		if err != nil {
+			return nil, nil, err
+		}
+		parts[k] = toprf.Share{Index: helpers[k], Value: r}
+		last.Subtract(last, r)
+	}
+	parts[len(helpers)-1] = toprf.Share{Index: helpers[len(helpers)-1], Value: last}
+
+	commitments = make([]*ristretto255.Element, len(parts))
+	for k := range parts {
+		commitments[k] = ristretto255.NewElement().ScalarBaseMult(parts[k].Value)
+	}
+
+	return commitments, parts, nil
+}
+
+// VerifyRepairCommitments checks that the parts committed to by helper dealer
+// add up to its correct term lambda_dealer(lost) * s_dealer, using the
+// dealer's verification key under the group commitments.
+//
+// Parameters:
+//   - groupCommitments: the Feldman commitments of the group (see SumCommitments)
+//   - lost: index of the share being repaired
+//   - helpers: indexes of all helping participants
+//   - dealer: index of the helper being verified
+//   - commitments: the commitments broadcast by dealer, in the order of helpers
+//
+// Returns error if verification fails.
+func VerifyRepairCommitments(groupCommitments []*ristretto255.Element, lost uint8, helpers []uint8, dealer uint8, commitments []*ristretto255.Element) error {
+	if len(groupCommitments) == 0 {
+		return errors.New("dkg: no group commitments provided")
+	}
+	if len(commitments) != len(helpers) {
+		return errors.New("dkg: expected one commitment per helper")
+	}
+	if !containsIndex(helpers, dealer) {
+		return errors.New("dkg: dealer is not among the helpers")
+	}
+
+	sum := ristretto255.NewElement()
+	for _, c := range commitments {
+		sum.Add(sum, c)
+	}
+
+	l := toprf.LagrangeCoefficient(dealer, lost, helpers)
+	expected := ristretto255.NewElement().ScalarMult(l, evalCommitments(dealer, groupCommitments))
+	if sum.Equal(expected) != 1 {
+		return errors.New("dkg: repair commitments do not match verification key")
+	}
+
+	return nil
+}
+
+// VerifyRepairPart checks that a part received from another helper matches
+// the commitment that helper broadcast for it.
+func VerifyRepairPart(commitment *ristretto255.Element, part toprf.Share) error {
+	if part.Value == nil {
+		return errors.New("dkg: share value is nil")
+	}
+	if ristretto255.NewElement().ScalarBaseMult(part.Value).Equal(commitment) != 1 {
+		return errors.New("dkg: repair part does not match commitment")
+	}
+	return nil
+}
+
+// RepairAggregate sums the parts a helper received from all helpers into the
+// single value it sends to the participant being repaired.
+//
+// Parameters:
+//   - self: index of this helper
+//   - parts: parts addressed to self, one from every helper
+//
+// Returns sigma_self, indexed by self.
+func RepairAggregate(self uint8, parts []toprf.Share) (toprf.Share, error) {
+	if len(parts) == 0 {
+		return toprf.Share{}, errors.New("dkg: no shares provided")
+	}
+
+	sigma := ristretto255.NewScalar()
+	for i := range parts {
+		if parts[i].Index != self {
+			return toprf.Share{}, errors.New("dkg: share has incorrect index")
+		}
+		sigma.Add(sigma, parts[i].Value)
+	}
+
+	return toprf.Share{Index: self, Value: sigma}, nil
+}
+
+// VerifyRepairAggregates checks every helper's aggregate against the parts
+// committed to it by all helpers.
+//
+// Parameters:
+//   - helpers: indexes of all helping participants
+//   - commitments: the commitments broadcast by each helper, in the order of helpers
+//   - sigmas: the aggregates received from each helper, in the order of helpers
+//
+// Returns list of helper indices whose aggregate failed verification.
+func VerifyRepairAggregates(helpers []uint8, commitments [][]*ristretto255.Element, sigmas []toprf.Share) ([]uint8, error) {
+	if len(commitments) != len(helpers) || len(sigmas) != len(helpers) {
+		return nil, errors.New("dkg: expected commitments and aggregates from every helper")
+	}
+
+	var fails []uint8
+
+	for j, helper := range helpers {
+		expected := ristretto255.NewElement()
+		for i := range commitments {
+			if len(commitments[i]) != len(helpers) {
+				return nil, errors.New("dkg: expected one commitment per helper")
+			}
+			expected.Add(expected, commitments[i][j])
+		}
+
+		if sigmas[j].Index != helper || sigmas[j].Value == nil ||
+			ristretto255.NewElement().ScalarBaseMult(sigmas[j].Value).Equal(expected) != 1 {
+			fails = append(fails, helper)
+		}
+	}
+
+	return fails, nil
+}
+
+// RepairFinish recovers the lost share from the helpers' aggregates and
+// checks it against the verification key of index lost.
+//
+// Parameters:
+//   - groupCommitments: the Feldman commitments of the group
+//   - lost: index of the share being repaired
+//   - sigmas: the aggregates received from every helper (at least threshold)
+//
+// Returns the repaired share.
+func RepairFinish(groupCommitments []*ristretto255.Element, lost uint8, sigmas []toprf.Share) (toprf.Share, error) {
+	if len(groupCommitments) == 0 {
+		return toprf.Share{}, errors.New("dkg: no group commitments provided")
+	}
+	if len(sigmas) < len(groupCommitments) {
+		return toprf.Share{}, errors.New("dkg: not enough helpers to repair share")
+	}
+
+	value := ristretto255.NewScalar()
+	for i := range sigmas {
+		if sigmas[i].Value == nil {
+			return toprf.Share{}, errors.New("dkg: share value is nil")
+		}
+		value.Add(value, sigmas[i].Value)
+	}
+
+	share := toprf.Share{Index: lost, Value: value}
+	if err := VerifyCommitment(0, uint8(len(groupCommitments)), lost, 0, groupCommitments, share); err != nil {
+		return toprf.Share{}, errors.New("dkg: repaired share does not match verification key")
+	}
+
+	return share, nil
+}
+
+// checkRepairHelpers validates the helper set for repairing index lost.
+func checkRepairHelpers(lost uint8, helpers []uint8) error {
+	if lost == 0 {
+		return errors.New("dkg: index must be > 0")
+	}
+	if len(helpers) < 2 {
+		return errors.New("dkg: at least two helpers are needed")
+	}
+	if containsIndex(helpers, lost) {
+		return errors.New("dkg: lost index cannot be a helper")
+	}
+	return checkDistinct(helpers)
+}
+
+// containsIndex reports whether index is in indexes.
+func containsIndex[T uint8 | uint16](indexes []T, index T) bool {
+	for _, i := range indexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
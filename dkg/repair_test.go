@@ -0,0 +1,154 @@
+package dkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// repairShare runs the repair protocol for index lost with the given helpers
+// and returns the helpers' commitments and aggregates.
+func repairShare(t *testing.T, shares []toprf.Share, lost uint8, helpers []uint8) ([][]*ristretto255.Element, []toprf.Share) {
+	t.Helper()
+
+	commitments := make([][]*ristretto255.Element, len(helpers))
+	parts := make([][]toprf.Share, len(helpers))
+	for k, helper := range helpers {
+		var err error
+		commitments[k], parts[k], err = RepairStart(shares[helper-1], lost, helpers)
+		if err != nil {
+			t.Fatalf("Helper %d: RepairStart failed: %v", helper, err)
+		}
+	}
+
+	sigmas := make([]toprf.Share, len(helpers))
+	for j, helper := range helpers {
+		received := make([]toprf.Share, len(helpers))
+		for i := range helpers {
+			if err := VerifyRepairPart(commitments[i][j], parts[i][j]); err != nil {
+				t.Fatalf("Helper %d: part from %d rejected: %v", helper, helpers[i], err)
+			}
+			received[i] = parts[i][j]
+		}
+
+		var err error
+		sigmas[j], err = RepairAggregate(helper, received)
+		if err != nil {
+			t.Fatalf("Helper %d: RepairAggregate failed: %v", helper, err)
+		}
+	}
+
+	return commitments, sigmas
+}
+
+// TestRepair rebuilds a lost share from three helpers
+func TestRepair(t *testing.T) {
+	const n = 5
+	const threshold = 3
+
+	commitments, shares := dealDKG(t, n, threshold)
+	group, err := SumCommitments(commitments)
+	if err != nil {
+		t.Fatalf("SumCommitments failed: %v", err)
+	}
+
+	const lost = 2
+	helpers := []uint8{1, 4, 5}
+	repairCommitments, sigmas := repairShare(t, shares, lost, helpers)
+
+	for k, helper := range helpers {
+		if err := VerifyRepairCommitments(group, lost, helpers, helper, repairCommitments[k]); err != nil {
+			t.Errorf("Helper %d: VerifyRepairCommitments failed: %v", helper, err)
+		}
+	}
+
+	fails, err := VerifyRepairAggregates(helpers, repairCommitments, sigmas)
+	if err != nil {
+		t.Fatalf("VerifyRepairAggregates failed: %v", err)
+	}
+	if len(fails) > 0 {
+		t.Errorf("Aggregates failed verification for helpers %v", fails)
+	}
+
+	// No single aggregate equals the lost share
+	for _, sigma := range sigmas {
+		if bytes.Equal(sigma.Value.Encode(nil), shares[lost-1].Value.Encode(nil)) {
+			t.Errorf("Helper %d learned the repaired share", sigma.Index)
+		}
+	}
+
+	repaired, err := RepairFinish(group, lost, sigmas)
+	if err != nil {
+		t.Fatalf("RepairFinish failed: %v", err)
+	}
+	if repaired.Index != lost {
+		t.Errorf("Expected index %d, got %d", lost, repaired.Index)
+	}
+	if !bytes.Equal(repaired.Value.Encode(nil), shares[lost-1].Value.Encode(nil)) {
+		t.Error("Repaired share differs from the lost share")
+	}
+}
+
+// TestRepairDetectsCheatingHelper verifies that a wrong contribution is caught
+func TestRepairDetectsCheatingHelper(t *testing.T) {
+	const n = 4
+	const threshold = 3
+
+	commitments, shares := dealDKG(t, n, threshold)
+	group, _ := SumCommitments(commitments)
+
+	const lost = 4
+	helpers := []uint8{1, 2, 3}
+
+	// Helper 2 uses a wrong share
+	cheating := make([]toprf.Share, n)
+	copy(cheating, shares)
+	cheating[1] = toprf.Share{Index: 2, Value: scalarFromUint8(1)}
+
+	repairCommitments, sigmas := repairShare(t, cheating, lost, helpers)
+
+	if err := VerifyRepairCommitments(group, lost, helpers, 2, repairCommitments[1]); err == nil {
+		t.Error("VerifyRepairCommitments accepted a cheating helper")
+	}
+	if _, err := RepairFinish(group, lost, sigmas); err == nil {
+		t.Error("RepairFinish accepted a wrong share")
+	}
+
+	// Helper 3 sends a wrong aggregate
+	repairCommitments, sigmas = repairShare(t, shares, lost, helpers)
+	sigmas[2].Value = ristretto255.NewScalar().Add(sigmas[2].Value, scalarFromUint8(1))
+	fails, err := VerifyRepairAggregates(helpers, repairCommitments, sigmas)
+	if err != nil {
+		t.Fatalf("VerifyRepairAggregates failed: %v", err)
+	}
+	if len(fails) != 1 || fails[0] != 3 {
+		t.Errorf("Expected helper 3 to fail verification, got %v", fails)
+	}
+}
+
+// TestRepairInvalidHelpers tests that invalid helper sets are rejected
+func TestRepairInvalidHelpers(t *testing.T) {
+	_, shares := dealDKG(t, 3, 2)
+
+	testCases := []struct {
+		name    string
+		lost    uint8
+		helpers []uint8
+	}{
+		{"lost index zero", 0, []uint8{1, 2}},
+		{"lost index among helpers", 2, []uint8{1, 2}},
+		{"duplicate helper", 3, []uint8{1, 1}},
+		{"single helper", 3, []uint8{1}},
+		{"share not among helpers", 1, []uint8{2, 3}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, err := RepairStart(shares[0], tc.lost, tc.helpers); err == nil {
+				t.Error("RepairStart should fail")
+			}
+		})
+	}
+}
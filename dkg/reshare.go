@@ -0,0 +1,229 @@
+package dkg
+
+// Verifiable secret redistribution
+//
+// Resharing moves a threshold key from one committee to another, possibly
+// with a different size and threshold, without ever reconstructing the key.
+// Every participating old shareholder i deals its share s_i to the new
+// committee as the constant term of a fresh random polynomial of degree
+// newThreshold-1 and broadcasts Feldman commitments to it. Since C'_i[0] =
+// g^s_i must equal the old verification key of i, a dealer cannot change what
+// it contributes. New member j combines the sub-shares it received with the
+// Lagrange coefficients of the dealer set:
+//
+//	s'_j = sum_i lambda_i * s_ij
+//
+// which is a share of the same secret on a new polynomial. The new group
+// commitments are the same Lagrange combination of the dealers' commitments,
+// and their constant term must equal the old group public key, so every OPRF
+// output stays the same.
+//
+// At least the old threshold of dealers must take part, and all new members
+// must use the same dealer set.
+
+import (
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// ReshareStart deals one old shareholder's share to a new committee.
+//
+// Parameters:
+//   - share: the dealer's current share of the group secret
+//   - newN: number of participants in the new committee
+//   - newThreshold: threshold of the new committee (must be 1 < newThreshold <= newN)
+//
+// Returns:
+//   - commitments: newThreshold commitments to polynomial coefficients (broadcast to all);
+//     the first commitment is g^share.Value
+//   - shares: newN sub-shares, one for each new participant (send privately)
+func ReshareStart(share toprf.Share, newN, newThreshold uint8) (
+	commitments []*ristretto255.Element,
+	shares []toprf.Share,
+	err error,
+) {
+	if newThreshold < 2 || newThreshold > newN {
+		return nil, nil, errors.New("dkg: threshold must be > 1 and <= n")
+	}
+	if share.Value == nil {
+		return nil, nil, errors.New("dkg: share value is nil")
+	}
+
+	a, err := randomPolynomial(share.Value, uint16(newThreshold))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitments = commitPolynomial(a)
+
+	shares = make([]toprf.Share, newN)
+	for j := uint8(1); j <= newN; j++ {
+		shares[j-1] = polynom(j, newThreshold, a)
+	}
+
+	return commitments, shares, nil
+}
+
+// VerifyReshareCommitment verifies a sub-share that old shareholder dealer
+// sent to new participant self.
+// It checks that the dealer reshared exactly its old share, by comparing the
+// constant term of its commitments with the dealer's verification key under
+// the old group commitments, and that the sub-share matches the commitments.
+//
+// Parameters:
+//   - oldCommitments: the Feldman commitments of the old group (see SumCommitments)
+//   - newThreshold: threshold of the new committee
+//   - self: index of the receiving new participant (1-based)
+//   - dealer: old index of the dealing shareholder (1-based)
+//   - commitments: the newThreshold commitments from dealer
+//   - share: the sub-share received from dealer
+//
+// Returns error if verification fails.
+func VerifyReshareCommitment(oldCommitments []*ristretto255.Element, newThreshold, self, dealer uint8, commitments []*ristretto255.Element, share toprf.Share) error {
+	if len(oldCommitments) == 0 {
+		return errors.New("dkg: no group commitments provided")
+	}
+	if len(commitments) != int(newThreshold) {
+		return errors.New("dkg: wrong number of commitments")
+	}
+	if share.Index != self {
+		return errors.New("dkg: share has incorrect index")
+	}
+
+	vk := evalCommitments(dealer, oldCommitments)
+	if commitments[0].Equal(vk) != 1 {
+		return errors.New("dkg: dealer did not reshare its own share")
+	}
+
+	// Old and new indexes are unrelated, so pass 0 as the peer index to make
+	// sure VerifyCommitment never skips the check as "our own share"
+	return VerifyCommitment(0, newThreshold, self, 0, commitments, share)
+}
+
+// VerifyReshareCommitments verifies the sub-shares from all dealers.
+//
+// Parameters:
+//   - oldCommitments: the Feldman commitments of the old group
+//   - newThreshold: threshold of the new committee
+//   - self: index of the receiving new participant (1-based)
+//   - dealers: old indexes of the dealing shareholders
+//   - commitments: commitments from each dealer, in the order of dealers
+//   - shares: sub-shares received from each dealer, in the order of dealers
+//
+// Returns list of dealer indices that failed verification.
+func VerifyReshareCommitments(oldCommitments []*ristretto255.Element, newThreshold, self uint8, dealers []uint8, commitments [][]*ristretto255.Element, shares []toprf.Share) ([]uint8, error) {
+	if len(commitments) != len(dealers) || len(shares) != len(dealers) {
+		return nil, errors.New("dkg: expected commitments and shares from every dealer")
+	}
+
+	var fails []uint8
+
+	for k, dealer := range dealers {
+		err := VerifyReshareCommitment(oldCommitments, newThreshold, self, dealer, commitments[k], shares[k])
+		if err != nil {
+			fails = append(fails, dealer)
+		}
+	}
+
+	return fails, nil
+}
+
+// FinishReshare combines the verified sub-shares into the new participant's
+// share of the unchanged group secret.
+//
+// Parameters:
+//   - self: index of the new participant (1-based)
+//   - dealers: old indexes of the dealing shareholders (at least the old threshold)
+//   - shares: sub-shares received from each dealer, in the order of dealers
+//
+// Returns the participant's share for the new committee.
+func FinishReshare(self uint8, dealers []uint8, shares []toprf.Share) (toprf.Share, error) {
+	if len(dealers) == 0 {
+		return toprf.Share{}, errors.New("dkg: no dealers provided")
+	}
+	if len(shares) != len(dealers) {
+		return toprf.Share{}, errors.New("dkg: expected one share per dealer")
+	}
+	if err := checkDistinct(dealers); err != nil {
+		return toprf.Share{}, err
+	}
+
+	// Re-index the sub-shares by dealer so that interpolating at 0 applies
+	// the dealers' Lagrange coefficients
+	byDealer := make([]toprf.Share, len(shares))
+	for k := range shares {
+		if shares[k].Index != self {
+			return toprf.Share{}, errors.New("dkg: share has incorrect index")
+		}
+		byDealer[k] = toprf.Share{Index: dealers[k], Value: shares[k].Value}
+	}
+
+	value, err := toprf.InterpolateScalar(0, byDealer)
+	if err != nil {
+		return toprf.Share{}, err
+	}
+
+	return toprf.Share{Index: self, Value: value}, nil
+}
+
+// ReshareGroupCommitments computes the Feldman commitments of the new
+// committee and checks that the group public key did not change.
+//
+// Parameters:
+//   - oldCommitments: the Feldman commitments of the old group
+//   - dealers: old indexes of the dealing shareholders
+//   - commitments: commitments from each dealer, in the order of dealers
+//
+// Returns the new group commitments, whose first element equals
+// oldCommitments[0].
+func ReshareGroupCommitments(oldCommitments []*ristretto255.Element, dealers []uint8, commitments [][]*ristretto255.Element) ([]*ristretto255.Element, error) {
+	if len(oldCommitments) == 0 {
+		return nil, errors.New("dkg: no group commitments provided")
+	}
+	if len(dealers) < len(oldCommitments) {
+		return nil, errors.New("dkg: not enough dealers to reshare")
+	}
+	if len(commitments) != len(dealers) {
+		return nil, errors.New("dkg: expected commitments from every dealer")
+	}
+	if err := checkDistinct(dealers); err != nil {
+		return nil, err
+	}
+
+	weighted := make([][]*ristretto255.Element, len(dealers))
+	for k, dealer := range dealers {
+		l := toprf.LagrangeCoefficient(dealer, 0, dealers)
+		weighted[k] = make([]*ristretto255.Element, len(commitments[k]))
+		for c := range commitments[k] {
+			weighted[k][c] = ristretto255.NewElement().ScalarMult(l, commitments[k][c])
+		}
+	}
+
+	group, err := SumCommitments(weighted)
+	if err != nil {
+		return nil, err
+	}
+
+	if group[0].Equal(oldCommitments[0]) != 1 {
+		return nil, errors.New("dkg: resharing changed the group public key")
+	}
+
+	return group, nil
+}
+
+// checkDistinct returns an error if indexes contains 0 or a duplicate.
+func checkDistinct[T uint8 | uint16](indexes []T) error {
+	seen := make(map[T]bool, len(indexes))
+	for _, i := range indexes {
+		if i == 0 {
+			return errors.New("dkg: index must be > 0")
+		}
+		if seen[i] {
+			return errors.New("dkg: duplicate index")
+		}
+		seen[i] = true
+	}
+	return nil
+}
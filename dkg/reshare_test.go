@@ -0,0 +1,158 @@
+package dkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// thresholdOPRF evaluates input with the given shares using toprf.Evaluate
+// and returns the unblinded element.
+func thresholdOPRF(t *testing.T, input []byte, shares []toprf.Share) []byte {
+	t.Helper()
+
+	r, alpha, err := oprf.Blind(input, nil)
+	if err != nil {
+		t.Fatalf("Blind failed: %v", err)
+	}
+
+	indexes := make([]uint8, len(shares))
+	for i := range shares {
+		indexes[i] = shares[i].Index
+	}
+
+	responses := make([][]byte, len(shares))
+	for i := range shares {
+		responses[i], err = toprf.Evaluate(shares[i], alpha, indexes)
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+	}
+
+	beta, err := toprf.ThresholdCombine(responses)
+	if err != nil {
+		t.Fatalf("ThresholdCombine failed: %v", err)
+	}
+
+	n, err := oprf.Unblind(r, beta)
+	if err != nil {
+		t.Fatalf("Unblind failed: %v", err)
+	}
+	return n
+}
+
+// TestReshare moves a 3-of-5 key to a 4-of-7 committee
+func TestReshare(t *testing.T) {
+	const oldN, oldThreshold = 5, 3
+	const newN, newThreshold = 7, 4
+
+	commitments, oldShares := dealDKG(t, oldN, oldThreshold)
+	oldGroup, err := SumCommitments(commitments)
+	if err != nil {
+		t.Fatalf("SumCommitments failed: %v", err)
+	}
+
+	input := []byte("reshare input")
+	before := thresholdOPRF(t, input, oldShares[:oldThreshold])
+
+	// Old shareholders 1, 3 and 5 reshare to the new committee
+	dealers := []uint8{1, 3, 5}
+	dealerCommitments := make([][]*ristretto255.Element, len(dealers))
+	subShares := make([][]toprf.Share, len(dealers))
+	for k, dealer := range dealers {
+		dealerCommitments[k], subShares[k], err = ReshareStart(oldShares[dealer-1], newN, newThreshold)
+		if err != nil {
+			t.Fatalf("Dealer %d: ReshareStart failed: %v", dealer, err)
+		}
+	}
+
+	// Every new member verifies, combines and checks the group key
+	newShares := make([]toprf.Share, newN)
+	for j := uint8(1); j <= newN; j++ {
+		received := make([]toprf.Share, len(dealers))
+		for k := range dealers {
+			received[k] = subShares[k][j-1]
+		}
+
+		fails, err := VerifyReshareCommitments(oldGroup, newThreshold, j, dealers, dealerCommitments, received)
+		if err != nil {
+			t.Fatalf("Member %d: VerifyReshareCommitments failed: %v", j, err)
+		}
+		if len(fails) > 0 {
+			t.Fatalf("Member %d: verification failed for dealers %v", j, fails)
+		}
+
+		newShares[j-1], err = FinishReshare(j, dealers, received)
+		if err != nil {
+			t.Fatalf("Member %d: FinishReshare failed: %v", j, err)
+		}
+	}
+
+	newGroup, err := ReshareGroupCommitments(oldGroup, dealers, dealerCommitments)
+	if err != nil {
+		t.Fatalf("ReshareGroupCommitments failed: %v", err)
+	}
+	if len(newGroup) != newThreshold {
+		t.Errorf("Expected %d group commitments, got %d", newThreshold, len(newGroup))
+	}
+	for j := range newShares {
+		if err := VerifyCommitment(newN, newThreshold, uint8(j+1), 0, newGroup, newShares[j]); err != nil {
+			t.Errorf("Member %d: share does not match new group commitments: %v", j+1, err)
+		}
+	}
+
+	// Any 4 new members produce the same OPRF output as the old committee
+	after := thresholdOPRF(t, input, []toprf.Share{newShares[1], newShares[3], newShares[4], newShares[6]})
+	if !bytes.Equal(before, after) {
+		t.Error("Resharing changed the OPRF output")
+	}
+
+	// 3 new members are no longer enough
+	secret, _ := Reconstruct(oldShares[:oldThreshold])
+	partial, _ := Reconstruct(newShares[:oldThreshold])
+	if bytes.Equal(secret.Encode(nil), partial.Encode(nil)) {
+		t.Error("Old threshold of new shares reconstructed the secret")
+	}
+}
+
+// TestReshareRejectsWrongShare verifies that a dealer must reshare its own share
+func TestReshareRejectsWrongShare(t *testing.T) {
+	commitments, oldShares := dealDKG(t, 3, 2)
+	oldGroup, _ := SumCommitments(commitments)
+
+	// Dealer 2 reshares a share it does not hold
+	bogus := toprf.Share{Index: 2, Value: scalarFromUint8(42)}
+	bogusCommitments, bogusShares, err := ReshareStart(bogus, 4, 3)
+	if err != nil {
+		t.Fatalf("ReshareStart failed: %v", err)
+	}
+	honestCommitments, honestShares, err := ReshareStart(oldShares[0], 4, 3)
+	if err != nil {
+		t.Fatalf("ReshareStart failed: %v", err)
+	}
+
+	dealers := []uint8{1, 2}
+	fails, err := VerifyReshareCommitments(oldGroup, 3, 1, dealers,
+		[][]*ristretto255.Element{honestCommitments, bogusCommitments},
+		[]toprf.Share{honestShares[0], bogusShares[0]})
+	if err != nil {
+		t.Fatalf("VerifyReshareCommitments failed: %v", err)
+	}
+	if len(fails) != 1 || fails[0] != 2 {
+		t.Errorf("Expected dealer 2 to fail verification, got %v", fails)
+	}
+
+	if _, err := ReshareGroupCommitments(oldGroup, dealers,
+		[][]*ristretto255.Element{honestCommitments, bogusCommitments}); err == nil {
+		t.Error("ReshareGroupCommitments accepted a changed group public key")
+	}
+
+	// Too few dealers cannot preserve the key
+	if _, err := ReshareGroupCommitments(oldGroup, dealers[:1],
+		[][]*ristretto255.Element{honestCommitments}); err == nil {
+		t.Error("ReshareGroupCommitments accepted fewer dealers than the old threshold")
+	}
+}
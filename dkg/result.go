@@ -0,0 +1,293 @@
+package dkg
+
+// Public result of a DKG
+//
+// Finish returns only the participant's own share. FinishWithResult also
+// keeps what the commitments tell everyone about the generated key: the group
+// public key (the sum of the qualified dealers' C_0), the verification key of
+// every participant, the set of qualified dealers (QUAL) and the parameters.
+// A Result is public and identical for all honest participants, so it can be
+// published, stored next to each share, and handed to servers and clients:
+// Dealing converts it to the toprf.Dealing used to verify shares and part
+// proofs, and VerificationKeys configure a toprf.Client to check the part
+// proof of every share server.
+//
+// Result has 16-bit indexes, so it also describes DKGs with more than 255
+// participants (see index16.go). Such a result has no 8-bit Group or
+// toprf.Dealing, and its encoding starts with a zero byte and
+// toprf.FormatVersion16 instead of n.
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// Result is the public outcome of a DKG.
+//
+//   - N, Threshold: the parameters of the DKG
+//   - Qual: indexes of the qualified dealers whose contributions make up the key, sorted
+//   - PublicKey: the group public key g^s
+//   - VerificationKeys: g^s_j for every participant j, at index j-1
+//   - Commitments: the group's Feldman commitments, summed over Qual
+type Result struct {
+	N                uint16
+	Threshold        uint16
+	Qual             []uint16
+	PublicKey        *ristretto255.Element
+	VerificationKeys []*ristretto255.Element
+	Commitments      []*ristretto255.Element
+}
+
+// NewResult computes the public result of a DKG from the commitments of all
+// dealers.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold parameter
+//   - qual: indexes of the qualified dealers
+//   - commitments: commitments from all n dealers (only those in qual are used)
+func NewResult(n, threshold uint8, qual []uint8, commitments [][]*ristretto255.Element) (*Result, error) {
+	return NewResult16(uint16(n), uint16(threshold), widenIndexes(qual), commitments)
+}
+
+// NewResult16 is NewResult for up to 65535 participants.
+func NewResult16(n, threshold uint16, qual []uint16, commitments [][]*ristretto255.Element) (*Result, error) {
+	if threshold < 2 || threshold > n {
+		return nil, errors.New("dkg: threshold must be > 1 and <= n")
+	}
+	if len(commitments) != int(n) {
+		return nil, errors.New("dkg: expected commitments from all participants")
+	}
+	if len(qual) < int(threshold) {
+		return nil, errors.New("dkg: not enough qualified dealers")
+	}
+	if err := checkDistinct(qual); err != nil {
+		return nil, err
+	}
+
+	sorted := slices.Sorted(slices.Values(qual))
+	qualified := make([][]*ristretto255.Element, len(sorted))
+	for k, i := range sorted {
+		if i < 1 || i > n {
+			return nil, errors.New("dkg: qualified index out of range")
+		}
+		if len(commitments[i-1]) != int(threshold) {
+			return nil, errors.New("dkg: wrong number of commitments")
+		}
+		qualified[k] = commitments[i-1]
+	}
+
+	group, err := SumCommitments(qualified)
+	if err != nil {
+		return nil, err
+	}
+
+	return newResult(n, threshold, sorted, group), nil
+}
+
+// newResult derives the public and verification keys from group commitments.
+func newResult(n, threshold uint16, qual []uint16, group []*ristretto255.Element) *Result {
+	keys := make([]*ristretto255.Element, n)
+	for j := 1; j <= int(n); j++ {
+		keys[j-1] = toprf.EvaluateCommitments16(group, uint16(j))
+	}
+
+	return &Result{
+		N:                n,
+		Threshold:        threshold,
+		Qual:             qual,
+		PublicKey:        ristretto255.NewElement().Set(group[0]),
+		VerificationKeys: keys,
+		Commitments:      group,
+	}
+}
+
+// FinishWithResult combines the shares from the qualified dealers into the
+// participant's final share, like Finish, and returns the public result of
+// the DKG. The final share is checked against the participant's verification
+// key.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold parameter
+//   - self: index of current participant
+//   - qual: indexes of the qualified dealers
+//   - commitments: commitments from all n dealers
+//   - shares: shares received from all n dealers (only those in qual are used)
+func FinishWithResult(n, threshold, self uint8, qual []uint8, commitments [][]*ristretto255.Element, shares []toprf.Share) (toprf.Share, *Result, error) {
+	share, result, err := FinishWithResult16(uint16(n), uint16(threshold), uint16(self), widenIndexes(qual), commitments, widenShares(shares))
+	if err != nil {
+		return toprf.Share{}, nil, err
+	}
+	narrow, err := share.Narrow()
+	if err != nil {
+		return toprf.Share{}, nil, err
+	}
+	return narrow, result, nil
+}
+
+// FinishWithResult16 is FinishWithResult for up to 65535 participants.
+func FinishWithResult16(n, threshold, self uint16, qual []uint16, commitments [][]*ristretto255.Element, shares []toprf.Share16) (toprf.Share16, *Result, error) {
+	if len(shares) != int(n) {
+		return toprf.Share16{}, nil, errors.New("dkg: expected shares from all participants")
+	}
+
+	result, err := NewResult16(n, threshold, qual, commitments)
+	if err != nil {
+		return toprf.Share16{}, nil, err
+	}
+
+	qualified := make([]toprf.Share16, len(result.Qual))
+	for k, i := range result.Qual {
+		qualified[k] = shares[i-1]
+	}
+
+	share, err := Finish16(qualified, self)
+	if err != nil {
+		return toprf.Share16{}, nil, err
+	}
+
+	if err := result.VerifyShare16(share); err != nil {
+		return toprf.Share16{}, nil, err
+	}
+
+	return share, result, nil
+}
+
+// Group returns the group metadata of the result, or an error if the result
+// has more than 255 participants.
+func (r *Result) Group() (*Group, error) {
+	if r.N > 255 {
+		return nil, errors.New("dkg: result has more than 255 participants")
+	}
+	return &Group{N: uint8(r.N), Threshold: uint8(r.Threshold), Commitments: r.Commitments}, nil
+}
+
+// Dealing returns the result as a toprf.Dealing, for configuring share
+// servers and verifying shares and part proofs with the toprf package. It
+// returns an error if the result has more than 255 participants.
+func (r *Result) Dealing() (*toprf.Dealing, error) {
+	if r.N > 255 {
+		return nil, errors.New("dkg: result has more than 255 participants")
+	}
+	return &toprf.Dealing{N: uint8(r.N), Threshold: uint8(r.Threshold), Commitments: r.Commitments}, nil
+}
+
+// VerifyShare checks that share is the correct final share for its index.
+func (r *Result) VerifyShare(share toprf.Share) error {
+	return r.VerifyShare16(share.Wide())
+}
+
+// VerifyShare16 is VerifyShare for a share with a 16-bit index.
+func (r *Result) VerifyShare16(share toprf.Share16) error {
+	if share.Value == nil {
+		return errors.New("dkg: share value is nil")
+	}
+	if share.Index < 1 || share.Index > r.N {
+		return errors.New("dkg: index out of range")
+	}
+	return VerifyCommitment16(r.N, r.Threshold, share.Index, 0, r.Commitments, share)
+}
+
+// MarshalBinary encodes a Result for publication or storage. Public and
+// verification keys are derived from the commitments and not stored.
+//
+// A result with at most 255 participants is encoded with 8-bit indexes:
+//
+//	[n:1 byte][threshold:1 byte][qual count:1 byte][qual:1 byte each][commitments:threshold*32 bytes]
+//
+// Larger results start with a zero byte, which is never a valid n:
+//
+//	[0][version:1 byte][n:2 bytes][threshold:2 bytes][qual count:2 bytes][qual:2 bytes each][commitments:threshold*32 bytes]
+func (r *Result) MarshalBinary() ([]byte, error) {
+	if len(r.Commitments) != int(r.Threshold) {
+		return nil, errors.New("dkg: wrong number of commitments")
+	}
+
+	var data []byte
+	if r.N <= 255 {
+		data = make([]byte, 0, 3+len(r.Qual)+len(r.Commitments)*ElementBytes)
+		data = append(data, uint8(r.N), uint8(r.Threshold), uint8(len(r.Qual)))
+		for _, i := range r.Qual {
+			data = append(data, uint8(i))
+		}
+	} else {
+		data = make([]byte, 0, 8+2*len(r.Qual)+len(r.Commitments)*ElementBytes)
+		data = append(data, 0, toprf.FormatVersion16)
+		data = binary.BigEndian.AppendUint16(data, r.N)
+		data = binary.BigEndian.AppendUint16(data, r.Threshold)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(r.Qual)))
+		for _, i := range r.Qual {
+			data = binary.BigEndian.AppendUint16(data, i)
+		}
+	}
+	for _, c := range r.Commitments {
+		data = c.Encode(data)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a Result in either encoding.
+func (r *Result) UnmarshalBinary(data []byte) error {
+	var n, threshold uint16
+	var qual []uint16
+	switch {
+	case len(data) >= 8 && data[0] == 0:
+		if data[1] != toprf.FormatVersion16 {
+			return errors.New("dkg: unsupported result version")
+		}
+		n, threshold = binary.BigEndian.Uint16(data[2:]), binary.BigEndian.Uint16(data[4:])
+		count := int(binary.BigEndian.Uint16(data[6:]))
+		if len(data) < 8+2*count {
+			return errors.New("dkg: invalid result length")
+		}
+		qual = make([]uint16, count)
+		for k := range qual {
+			qual[k] = binary.BigEndian.Uint16(data[8+2*k:])
+		}
+		data = data[8+2*count:]
+	case len(data) >= 3 && data[0] != 0:
+		n, threshold = uint16(data[0]), uint16(data[1])
+		count := int(data[2])
+		if len(data) < 3+count {
+			return errors.New("dkg: invalid result length")
+		}
+		qual = widenIndexes(data[3 : 3+count])
+		data = data[3+count:]
+	default:
+		return errors.New("dkg: invalid result length")
+	}
+
+	if threshold < 2 || threshold > n {
+		return errors.New("dkg: threshold must be > 1 and <= n")
+	}
+	if len(data) != int(threshold)*ElementBytes {
+		return errors.New("dkg: invalid result length")
+	}
+	if len(qual) < int(threshold) {
+		return errors.New("dkg: not enough qualified dealers")
+	}
+	if err := checkDistinct(qual); err != nil {
+		return err
+	}
+	for _, i := range qual {
+		if i < 1 || i > n {
+			return errors.New("dkg: qualified index out of range")
+		}
+	}
+
+	group := make([]*ristretto255.Element, threshold)
+	for k := range group {
+		group[k] = ristretto255.NewElement()
+		if err := group[k].Decode(data[k*ElementBytes : (k+1)*ElementBytes]); err != nil {
+			return err
+		}
+	}
+
+	*r = *newResult(n, threshold, qual, group)
+	return nil
+}
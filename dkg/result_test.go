@@ -0,0 +1,228 @@
+package dkg
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// TestFinishWithResult tests that all participants agree on the public result
+func TestFinishWithResult(t *testing.T) {
+	n, threshold := uint8(5), uint8(3)
+
+	commitments := make([][]*ristretto255.Element, n)
+	allShares := make([][]toprf.Share, n)
+	for i := uint8(0); i < n; i++ {
+		var err error
+		commitments[i], allShares[i], err = Start(n, threshold)
+		if err != nil {
+			t.Fatalf("Participant %d: Start failed: %v", i+1, err)
+		}
+	}
+
+	// Dealer 4 is disqualified; its contribution must not be part of the key
+	qual := []uint8{5, 1, 2, 3}
+
+	finalShares := make([]toprf.Share, n)
+	results := make([]*Result, n)
+	for i := uint8(0); i < n; i++ {
+		received := make([]toprf.Share, n)
+		for j := uint8(0); j < n; j++ {
+			received[j] = allShares[j][i]
+		}
+
+		var err error
+		finalShares[i], results[i], err = FinishWithResult(n, threshold, i+1, qual, commitments, received)
+		if err != nil {
+			t.Fatalf("Participant %d: FinishWithResult failed: %v", i+1, err)
+		}
+	}
+
+	// Everyone computes the same result
+	encoded, _ := results[0].MarshalBinary()
+	for i := 1; i < int(n); i++ {
+		other, _ := results[i].MarshalBinary()
+		if !bytes.Equal(encoded, other) {
+			t.Errorf("Participant %d computed a different result", i+1)
+		}
+	}
+
+	result := results[0]
+	if !slices.Equal(result.Qual, []uint16{1, 2, 3, 5}) {
+		t.Errorf("Qual not sorted: %v", result.Qual)
+	}
+
+	// The public key matches the secret reconstructed from the final shares
+	secret, err := Reconstruct(finalShares[:threshold])
+	if err != nil {
+		t.Fatalf("Reconstruct failed: %v", err)
+	}
+	if result.PublicKey.Equal(ristretto255.NewElement().ScalarBaseMult(secret)) != 1 {
+		t.Error("Public key does not match the secret")
+	}
+
+	for i, share := range finalShares {
+		vk := ristretto255.NewElement().ScalarBaseMult(share.Value)
+		if result.VerificationKeys[i].Equal(vk) != 1 {
+			t.Errorf("Participant %d: verification key mismatch", share.Index)
+		}
+	}
+
+	// The result plugs into toprf: servers prove their parts, clients verify
+	dealing, err := result.Dealing()
+	if err != nil {
+		t.Fatalf("Dealing failed: %v", err)
+	}
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	for _, share := range finalShares {
+		part, proof, err := toprf.EvaluateWithProof(share, alpha)
+		if err != nil {
+			t.Fatalf("Participant %d: EvaluateWithProof failed: %v", share.Index, err)
+		}
+		if err := dealing.VerifyPart(alpha, part, proof); err != nil {
+			t.Errorf("Participant %d: VerifyPart failed: %v", share.Index, err)
+		}
+	}
+
+	// A client with the verification keys checks the proofs itself
+	servers := make([]toprf.ShareServer, len(finalShares))
+	for i, share := range finalShares {
+		servers[i], _ = toprf.NewLocalServer(share, nil)
+	}
+	client, err := toprf.NewClient(servers, toprf.ClientConfig{
+		Threshold:        uint16(threshold),
+		VerificationKeys: result.VerificationKeys,
+	})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	evaluated, err := client.Evaluate(context.Background(), alpha)
+	if err != nil {
+		t.Fatalf("Client Evaluate failed: %v", err)
+	}
+	expected, _ := oprf.Evaluate(secret.Encode(nil), alpha)
+	if !bytes.Equal(evaluated.Beta, expected) {
+		t.Error("Client evaluation differs from the reconstructed key")
+	}
+}
+
+// TestNewResultInvalid tests rejection of invalid QUAL sets
+func TestNewResultInvalid(t *testing.T) {
+	commitments, _ := dealDKG(t, 4, 3)
+
+	testCases := []struct {
+		name string
+		qual []uint8
+	}{
+		{"too few", []uint8{1, 2}},
+		{"duplicate", []uint8{1, 2, 2}},
+		{"zero index", []uint8{0, 1, 2}},
+		{"out of range", []uint8{1, 2, 5}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewResult(4, 3, tc.qual, commitments); err == nil {
+				t.Error("NewResult accepted an invalid qual set")
+			}
+		})
+	}
+}
+
+// TestResultMarshal tests Result serialization/deserialization
+func TestResultMarshal(t *testing.T) {
+	commitments, shares := dealDKG(t, 4, 3)
+	result, err := NewResult(4, 3, []uint8{1, 2, 3, 4}, commitments)
+	if err != nil {
+		t.Fatalf("NewResult failed: %v", err)
+	}
+
+	data, err := result.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if len(data) != 3+4+3*ElementBytes {
+		t.Errorf("Marshaled result has wrong length: %d", len(data))
+	}
+
+	var decoded Result
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.PublicKey.Equal(result.PublicKey) != 1 {
+		t.Error("Public key mismatch after round trip")
+	}
+	for _, share := range shares {
+		if err := decoded.VerifyShare(share); err != nil {
+			t.Errorf("Share %d does not verify against decoded result: %v", share.Index, err)
+		}
+	}
+
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("UnmarshalBinary accepted a truncated result")
+	}
+	bad := append([]byte(nil), data...)
+	bad[4] = bad[3]
+	if err := decoded.UnmarshalBinary(bad); err == nil {
+		t.Error("UnmarshalBinary accepted a duplicate qualified index")
+	}
+}
+
+// TestResultMarshal16 tests the encoding of a result with more than 255
+// participants
+func TestResultMarshal16(t *testing.T) {
+	const n, threshold = 300, 2
+	qual := []uint16{300, 1, 299}
+
+	commitments := make([][]*ristretto255.Element, n)
+	var received []toprf.Share16
+	for _, i := range qual {
+		var shares []toprf.Share16
+		var err error
+		commitments[i-1], shares, err = Start16(n, threshold)
+		if err != nil {
+			t.Fatalf("Start16 failed: %v", err)
+		}
+		received = append(received, shares[299])
+	}
+	share, err := Finish16(received, 300)
+	if err != nil {
+		t.Fatalf("Finish16 failed: %v", err)
+	}
+
+	result, err := NewResult16(n, threshold, qual, commitments)
+	if err != nil {
+		t.Fatalf("NewResult16 failed: %v", err)
+	}
+	data, err := result.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if data[0] != 0 || data[1] != toprf.FormatVersion16 || len(data) != 8+2*len(qual)+threshold*ElementBytes {
+		t.Errorf("Marshaled result has a wrong header or length: %x", data[:8])
+	}
+
+	var decoded Result
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.N != n || !slices.Equal(decoded.Qual, []uint16{1, 299, 300}) {
+		t.Errorf("Decoded N = %d, QUAL = %v", decoded.N, decoded.Qual)
+	}
+	if err := decoded.VerifyShare16(share); err != nil {
+		t.Errorf("Share 300 does not verify against decoded result: %v", err)
+	}
+	if _, err := decoded.Group(); err == nil {
+		t.Error("Group accepted more than 255 participants")
+	}
+
+	data[1] = 0x7f
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Error("UnmarshalBinary accepted an unknown version")
+	}
+}
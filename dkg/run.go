@@ -0,0 +1,703 @@
+package dkg
+
+// Running the DKG over a network
+//
+// Run drives one Participant through the complete protocol over a Transport:
+// every broadcast is signed by a Signer and recorded in a Transcript, private
+// shares are sealed to their recipient (see seal.go), and every broadcast
+// round is followed by an echo round (see transcript.go):
+//
+//	Deal + shares, echo, Complaints, echo, ShareComplaints, echo,
+//	Justifications, echo, Extraction, echo, ExtractionComplaints, echo,
+//	Reveals, echo
+//
+// Messages are authenticated with the Roster on receipt; anything that does
+// not open, e.g. because it was tampered with or belongs to another session,
+// is dropped. Messages may arrive in any order and more than once: messages
+// of later rounds wait until their round, and repeated ones are ignored
+// unless they differ, which is equivocation.
+//
+// If a participant's echo disagrees, Run sends its copy of the round and
+// waits for the copies of all others, and it answers the copy of a peer with
+// its own, so that omissions are repaired and equivocation is found by
+// everyone. A dealer that equivocated in RoundDeal is disqualified; any later
+// equivocation aborts the run with an EquivocationError carrying the
+// evidence.
+//
+// Without a RoundTimeout, Run waits for the message of every expected sender
+// in each round, so a participant that stops sending stalls it until the
+// context is done. With a RoundTimeout, every round (echo rounds included)
+// ends at its deadline, and the participants that did not deliver by then are
+// dropped: later rounds no longer wait for them, though their messages are
+// still used when they arrive in time. The protocol then treats them like
+// any participant whose messages are missing: a dealer without a Deal is
+// disqualified, a share that is missing draws a complaint, an unanswered
+// complaint disqualifies, and the Feldman commitments of a dealer in QUAL
+// without an Extraction are reconstructed from the reveals. If participants
+// see different messages at a deadline, the echo round reconciles their
+// views. The run completes as long as threshold dealers stay in QUAL and
+// threshold participants reveal, and every member of QUAL that received its
+// shares can evaluate with the group key. The deadlines assume messages
+// between honest participants arrive within RoundTimeout.
+//
+// A participant complains about every dealer whose sealed share does not
+// open, and backs each such complaint with a ShareComplaint in the next
+// round. Everyone checks the evidence with VerifyShareComplaint: a complaint
+// that the evidence refutes, i.e. the revealed pair key opens the dealer's
+// signed ciphertext to a valid share, is dropped before Justify, so false
+// complaints cannot force a dealer to justify or disqualify it. Complaints
+// about missing shares have no evidence and stand.
+//
+// With a Checkpoint function, Run seals a Checkpoint (see checkpoint.go)
+// after dealing and after every round: the Participant, the transcript, the
+// messages received for later rounds and every message sent. A participant
+// that restarts passes the latest one as Resume. Run then sends its
+// checkpointed Deal again instead of dealing anew, repeats the steps after
+// the checkpoint, which give the same messages, and broadcasts a
+// RoundResume request, which the others answer by sending everything they
+// sent it again. The others wait for the participant while it is down, so
+// it must come back within their RoundTimeout, if any.
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// Transport carries encoded messages between the participants of a Run,
+// addressed by participant index. Receive returns the next message for the
+// participant; the sender it reports is not trusted, messages are
+// authenticated by their signature.
+type Transport interface {
+	Send(ctx context.Context, to uint16, data []byte) error
+	Broadcast(ctx context.Context, data []byte) error
+	Receive(ctx context.Context) (from uint16, data []byte, err error)
+}
+
+// RunConfig configures a Run for one participant.
+//
+//   - Session: the session ID all participants agreed on
+//   - Threshold: minimum shares needed to use the key
+//   - Self: the participant's index (1-based)
+//   - Roster: the long-term public keys of all participants; its size is n
+//   - SigningKey: the participant's long-term Ed25519 key
+//   - EncryptionKey: the participant's long-term X25519 key
+//   - RoundTimeout: time limit of every round, after which participants that
+//     did not send are dropped (0 waits for everyone)
+//   - CheckpointKey: the participant's long-term checkpoint key
+//   - Checkpoint: called with every sealed checkpoint and its sequence; it
+//     must store both, the sequence in rollback-protected storage, before it
+//     returns (nil writes no checkpoints)
+//   - Resume: the latest checkpoint of the participant in this session, from
+//     OpenCheckpoint, to continue after a restart (nil starts the run)
+type RunConfig struct {
+	Session       SessionID
+	Threshold     uint16
+	Self          uint16
+	Roster        *Roster
+	SigningKey    ed25519.PrivateKey
+	EncryptionKey *ecdh.PrivateKey
+	RoundTimeout  time.Duration
+	CheckpointKey [CheckpointKeyBytes]byte
+	Checkpoint    func(ctx context.Context, sequence uint64, sealed []byte) error
+	Resume        *Checkpoint
+}
+
+// EquivocationError is returned by Run when participants signed different
+// messages for the same round after RoundDeal.
+type EquivocationError struct {
+	Evidence []*Equivocation
+}
+
+func (e *EquivocationError) Error() string {
+	senders := make([]uint16, len(e.Evidence))
+	for k, evidence := range e.Evidence {
+		senders[k] = evidence.Sender()
+	}
+	return fmt.Sprintf("dkg: participants %v equivocated", senders)
+}
+
+// runner is the state of one Run
+type runner struct {
+	config      RunConfig
+	n           uint16
+	transport   Transport
+	signer      *Signer
+	participant *Participant
+	transcript  *Transcript
+
+	// Received messages that were not consumed yet, per round and sender
+	pending map[inboxKey]map[uint16][]*Message
+	closed  map[inboxKey]bool
+
+	// Echo rounds that are done, and rounds whose copy was sent
+	echoed map[Round]bool
+	copied map[Round]bool
+
+	// Participants that missed a deadline
+	dropped []uint16
+
+	// Sealed shares received in RoundShare, per dealer
+	sealed map[uint16][]*Message
+
+	// Every message sent, to send again to peers that resume
+	sent []*Message
+
+	// Rounds completed, and the sequence of the last checkpoint
+	phase    uint8
+	sequence uint64
+}
+
+// inboxKey identifies the messages of one round. For echoes and transcript
+// copies, sub is the round they are about.
+type inboxKey struct {
+	round Round
+	sub   Round
+}
+
+// Run executes the DKG for one participant over a transport.
+//
+// Parameters:
+//   - ctx: Bounds the whole run; Run returns its error when it is done
+//   - config: The participant's keys and the session
+//   - transport: The participant's connection to the others
+//
+// Returns:
+//   - The participant's final share
+//   - The public result of the DKG
+//   - Error if the protocol failed, was aborted for equivocation
+//     (*EquivocationError) or the context is done
+func Run(ctx context.Context, config RunConfig, transport Transport) (toprf.Share16, *Result, error) {
+	if config.Roster == nil {
+		return toprf.Share16{}, nil, errors.New("dkg: no roster")
+	}
+	if config.EncryptionKey == nil {
+		return toprf.Share16{}, nil, errors.New("dkg: no encryption key")
+	}
+	n := config.Roster.N()
+	participant, err := NewParticipant(n, config.Threshold, config.Self)
+	if err != nil {
+		return toprf.Share16{}, nil, err
+	}
+	signer, err := NewSigner(config.Session, config.Self, config.SigningKey)
+	if err != nil {
+		return toprf.Share16{}, nil, err
+	}
+
+	r := &runner{
+		config:      config,
+		n:           n,
+		transport:   transport,
+		signer:      signer,
+		participant: participant,
+		transcript:  NewTranscript(config.Session, config.Roster),
+		pending:     make(map[inboxKey]map[uint16][]*Message),
+		closed:      make(map[inboxKey]bool),
+		echoed:      make(map[Round]bool),
+		copied:      make(map[Round]bool),
+	}
+	if config.Resume != nil {
+		if err := r.restore(config.Resume); err != nil {
+			return toprf.Share16{}, nil, err
+		}
+	}
+	return r.run(ctx)
+}
+
+// run executes the rounds of the protocol, from the checkpoint if the run
+// resumes
+func (r *runner) run(ctx context.Context) (toprf.Share16, *Result, error) {
+	p, others := r.participant, r.others(nil)
+
+	// Round 1: Deal and sealed shares. A participant that resumes after
+	// dealing sends its checkpointed Deal again instead.
+	if p.step == stepDeal {
+		if err := r.deal(ctx); err != nil {
+			return toprf.Share16{}, nil, err
+		}
+	}
+	if r.config.Resume != nil {
+		m, err := r.signer.Sign(RoundResume, 0, nil)
+		if err != nil {
+			return toprf.Share16{}, nil, err
+		}
+		if err := r.transmit(ctx, m); err != nil {
+			return toprf.Share16{}, nil, err
+		}
+	}
+	if r.phase == 0 {
+		for _, m := range r.sent {
+			if err := r.transmit(ctx, m); err != nil {
+				return toprf.Share16{}, nil, err
+			}
+		}
+		sealed, err := r.collect(ctx, inboxKey{round: RoundShare}, others)
+		if err != nil {
+			return toprf.Share16{}, nil, err
+		}
+		r.sealed = sealed
+		if err := r.round(ctx, RoundDeal, others); err != nil {
+			return toprf.Share16{}, nil, err
+		}
+	}
+	deals := decodeAll(r.agreed(RoundDeal), (*Message).Deal)
+	opened, disputed := r.openShares(deals, r.sealed)
+
+	// The rounds after the Deal, each with the step that gives the
+	// participant's broadcast
+	rounds := []struct {
+		round Round
+		step  func() (*Message, error)
+	}{
+		// Round 2: Complaints, then the evidence for shares that did not open
+		{RoundComplaint, func() (*Message, error) {
+			complaints, err := p.Verify(deals, opened)
+			if err != nil {
+				return nil, err
+			}
+			return r.signer.SignComplaints(complaints)
+		}},
+		{RoundShareComplaint, func() (*Message, error) {
+			return r.signer.SignShareComplaints(disputed)
+		}},
+
+		// Round 3: Justifications for the complaints that stand
+		{RoundJustification, func() (*Message, error) {
+			refuted := r.refuted(deals, slices.Concat(decodeAll(r.agreed(RoundShareComplaint), (*Message).ShareComplaints)...))
+			complaints := slices.DeleteFunc(slices.Concat(decodeAll(r.agreed(RoundComplaint), (*Message).Complaints)...), func(c Complaint) bool {
+				return slices.Contains(refuted, c)
+			})
+			justifications, err := p.Justify(complaints)
+			if err != nil {
+				return nil, err
+			}
+			return r.signer.SignJustifications(justifications)
+		}},
+
+		// Round 4: Extraction by the dealers in QUAL
+		{RoundExtraction, func() (*Message, error) {
+			extraction, err := p.Qualify(slices.Concat(decodeAll(r.agreed(RoundJustification), (*Message).Justifications)...))
+			if err != nil || extraction == nil {
+				return nil, err
+			}
+			return r.signer.SignExtraction(extraction)
+		}},
+
+		// Round 5: Extraction complaints
+		{RoundExtractionComplaint, func() (*Message, error) {
+			evidence, err := p.VerifyExtractions(decodeAll(r.agreed(RoundExtraction), (*Message).Extraction))
+			if err != nil {
+				return nil, err
+			}
+			return r.signer.SignExtractionComplaints(evidence)
+		}},
+
+		// Round 6: Reveals
+		{RoundReveal, func() (*Message, error) {
+			reveals, err := p.Reveal(slices.Concat(decodeAll(r.agreed(RoundExtractionComplaint), (*Message).ExtractionComplaints)...))
+			if err != nil {
+				return nil, err
+			}
+			return r.signer.SignReveals(reveals)
+		}},
+	}
+
+	for int(r.phase) <= len(rounds) {
+		next := rounds[r.phase-1]
+		m, err := next.step()
+		if err != nil {
+			return toprf.Share16{}, nil, err
+		}
+		if m != nil {
+			if err := r.broadcast(ctx, m); err != nil {
+				return toprf.Share16{}, nil, err
+			}
+		}
+		senders := others
+		if next.round == RoundExtraction {
+			senders = r.others(p.Qual())
+		}
+		if err := r.round(ctx, next.round, senders); err != nil {
+			return toprf.Share16{}, nil, err
+		}
+	}
+
+	return p.Finish(slices.Concat(decodeAll(r.agreed(RoundReveal), (*Message).Reveals)...))
+}
+
+// deal starts the protocol: it signs the participant's Deal and seals its
+// shares, and checkpoints them before anything is sent
+func (r *runner) deal(ctx context.Context) error {
+	deal, shares, err := r.participant.Deal()
+	if err != nil {
+		return err
+	}
+	m, err := r.signer.SignDeal(deal)
+	if err != nil {
+		return err
+	}
+	if _, err := r.transcript.Add(m); err != nil {
+		return err
+	}
+	r.sent = append(r.sent, m)
+
+	for k := range shares {
+		sealed, err := SealShare(r.config.Session, r.config.EncryptionKey, r.config.Roster.EncryptionKey(shares[k].Recipient), &shares[k])
+		if err != nil {
+			return err
+		}
+		m, err := r.signer.SignSealedShare(sealed)
+		if err != nil {
+			return err
+		}
+		r.sent = append(r.sent, m)
+	}
+	return r.save(ctx)
+}
+
+// others returns the indexes in set, or all indexes if set is nil, without
+// the participant's own
+func (r *runner) others(set []uint16) []uint16 {
+	var others []uint16
+	for _, i := range indexRange(r.n) {
+		if i != r.config.Self && (set == nil || containsIndex(set, i)) {
+			others = append(others, i)
+		}
+	}
+	return others
+}
+
+// broadcast records the participant's own broadcast in the transcript and
+// sends it to everyone
+func (r *runner) broadcast(ctx context.Context, m *Message) error {
+	if m.Round != RoundEcho && m.Round != RoundTranscript {
+		if _, err := r.transcript.Add(m); err != nil {
+			return err
+		}
+	}
+	r.sent = append(r.sent, m)
+	return r.transmit(ctx, m)
+}
+
+// transmit sends a message to its recipient, or to everyone if it is a
+// broadcast
+func (r *runner) transmit(ctx context.Context, m *Message) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if m.Recipient != 0 {
+		return r.transport.Send(ctx, m.Recipient, data)
+	}
+	return r.transport.Broadcast(ctx, data)
+}
+
+// resend sends everything the participant sent so far to a peer that
+// resumed
+func (r *runner) resend(ctx context.Context, to uint16) error {
+	for _, m := range r.sent {
+		if m.Recipient != 0 && m.Recipient != to {
+			continue
+		}
+		data, err := m.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if err := r.transport.Send(ctx, to, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes a checkpoint, if the run has a Checkpoint function
+func (r *runner) save(ctx context.Context) error {
+	if r.config.Checkpoint == nil {
+		return nil
+	}
+	state, err := r.marshalState()
+	if err != nil {
+		return err
+	}
+	r.sequence++
+	c := &Checkpoint{
+		Session:     r.config.Session,
+		Sequence:    r.sequence,
+		Participant: r.participant,
+		Outbox:      r.sent,
+		run:         state,
+	}
+	sealed, err := c.Seal(r.config.CheckpointKey)
+	if err != nil {
+		return err
+	}
+	return r.config.Checkpoint(ctx, r.sequence, sealed)
+}
+
+// openShares opens the sealed shares of the dealers with a Deal. Shares that
+// do not open are left out, so the participant complains about them, and
+// their ShareComplaints are returned as evidence.
+func (r *runner) openShares(deals []*Deal, sealed map[uint16][]*Message) ([]*PrivateShare, []ShareComplaint) {
+	var opened []*PrivateShare
+	var evidence []ShareComplaint
+	for _, d := range deals {
+		if d.Dealer == r.config.Self || len(sealed[d.Dealer]) == 0 {
+			continue
+		}
+		share, complaint, err := OpenShare(r.config.Session, r.config.EncryptionKey, r.config.Roster.EncryptionKey(d.Dealer), d.Commitments, sealed[d.Dealer][0])
+		switch {
+		case err != nil:
+		case share != nil:
+			opened = append(opened, share)
+		case complaint != nil:
+			evidence = append(evidence, *complaint)
+		}
+	}
+	return opened, evidence
+}
+
+// refuted returns the complaints whose evidence shows that the accuser
+// received a valid share, or that is not the accused dealer's signed share
+// for the accuser
+func (r *runner) refuted(deals []*Deal, evidence []ShareComplaint) []Complaint {
+	var refuted []Complaint
+	for k := range evidence {
+		c := &evidence[k]
+		for _, d := range deals {
+			if d.Dealer == c.Accused && VerifyShareComplaint(r.config.Session, r.config.Roster, d.Commitments, c) != nil {
+				refuted = append(refuted, c.Complaint)
+			}
+		}
+	}
+	return refuted
+}
+
+// round collects the broadcasts of a round from the expected senders, runs
+// its echo round and checkpoints the run. Equivocation after RoundDeal
+// aborts the run.
+func (r *runner) round(ctx context.Context, round Round, senders []uint16) error {
+	received, err := r.collect(ctx, inboxKey{round: round}, senders)
+	if err != nil {
+		return err
+	}
+	for _, sender := range r.others(nil) {
+		for _, m := range received[sender] {
+			r.transcript.Add(m)
+		}
+	}
+
+	if err := r.echo(ctx, round); err != nil {
+		return err
+	}
+
+	var evidence []*Equivocation
+	for _, e := range r.transcript.Equivocations() {
+		if e.First.Round != RoundDeal {
+			evidence = append(evidence, e)
+		}
+	}
+	if len(evidence) > 0 {
+		return &EquivocationError{Evidence: evidence}
+	}
+
+	r.phase++
+	return r.save(ctx)
+}
+
+// agreed returns the messages of a completed round, including the
+// participant's own. Dealers that equivocated in RoundDeal lose their
+// messages.
+func (r *runner) agreed(round Round) []*Message {
+	var equivocators []uint16
+	for _, e := range r.transcript.Equivocations() {
+		if e.First.Round == RoundDeal {
+			equivocators = append(equivocators, e.Sender())
+		}
+	}
+
+	var messages []*Message
+	for _, m := range r.transcript.Messages(round) {
+		if !containsIndex(equivocators, m.Sender) {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
+
+// echo sends the transcript digest after a round and compares it with the
+// echoes of the others. If they disagree, the participants exchange their
+// copies of the round and merge them.
+func (r *runner) echo(ctx context.Context, round Round) error {
+	m, err := r.signer.SignEcho(round, r.transcript.Digest())
+	if err != nil {
+		return err
+	}
+	if err := r.broadcast(ctx, m); err != nil {
+		return err
+	}
+
+	received, err := r.collect(ctx, inboxKey{round: RoundEcho, sub: round}, r.others(nil))
+	if err != nil {
+		return err
+	}
+	var echoes []*Echo
+	for _, messages := range received {
+		for _, m := range messages {
+			if e, err := m.Echo(); err == nil {
+				echoes = append(echoes, e)
+			}
+		}
+	}
+	r.echoed[round] = true
+
+	disagree := len(r.transcript.CheckEchoes(echoes)) > 0
+	requested := len(r.pending[inboxKey{round: RoundTranscript, sub: round}]) > 0
+	if disagree || requested {
+		if err := r.sendCopy(ctx, round); err != nil {
+			return err
+		}
+	}
+	if !disagree {
+		return nil
+	}
+
+	copies, err := r.collect(ctx, inboxKey{round: RoundTranscript, sub: round}, r.others(nil))
+	if err != nil {
+		return err
+	}
+	for _, messages := range copies {
+		for _, m := range messages {
+			if _, merged, err := m.Transcript(); err == nil {
+				r.transcript.Merge(merged)
+			}
+		}
+	}
+	return nil
+}
+
+// sendCopy broadcasts the participant's copy of a round, once
+func (r *runner) sendCopy(ctx context.Context, round Round) error {
+	if r.copied[round] {
+		return nil
+	}
+	r.copied[round] = true
+
+	m, err := r.signer.SignTranscript(r.transcript, round)
+	if err != nil {
+		return err
+	}
+	return r.broadcast(ctx, m)
+}
+
+// collect receives messages until every sender that was not dropped has
+// sent one for key, or the round deadline passes, and returns them. Senders
+// that missed the deadline are dropped. Messages for key that arrive later
+// are ignored.
+func (r *runner) collect(ctx context.Context, key inboxKey, senders []uint16) (map[uint16][]*Message, error) {
+	roundCtx := ctx
+	if r.config.RoundTimeout > 0 {
+		var cancel context.CancelFunc
+		roundCtx, cancel = context.WithTimeout(ctx, r.config.RoundTimeout)
+		defer cancel()
+	}
+
+	for {
+		received := r.pending[key]
+		var missing []uint16
+		for _, sender := range senders {
+			if len(received[sender]) == 0 && !containsIndex(r.dropped, sender) {
+				missing = append(missing, sender)
+			}
+		}
+
+		err := roundCtx.Err()
+		if len(missing) == 0 || (err != nil && ctx.Err() == nil) {
+			r.dropped = append(r.dropped, missing...)
+			delete(r.pending, key)
+			r.closed[key] = true
+			return received, nil
+		}
+
+		if err := r.receive(roundCtx); err != nil && (roundCtx.Err() == nil || ctx.Err() != nil) {
+			return nil, err
+		}
+	}
+}
+
+// receive waits for one message and files it
+func (r *runner) receive(ctx context.Context) error {
+	_, data, err := r.transport.Receive(ctx)
+	if err != nil {
+		return err
+	}
+	m, err := r.config.Roster.Open(r.config.Session, r.config.Self, data)
+	if err != nil || m.Sender == r.config.Self {
+		return nil
+	}
+
+	// A peer that resumed may have lost everything it received
+	if m.Round == RoundResume {
+		return r.resend(ctx, m.Sender)
+	}
+
+	key, ok := messageKey(m)
+	if !ok {
+		return nil
+	}
+
+	// A peer that disagrees waits for everyone's copy of the round
+	if key.round == RoundTranscript && r.echoed[key.sub] {
+		if err := r.sendCopy(ctx, key.sub); err != nil {
+			return err
+		}
+	}
+	r.file(key, m)
+	return nil
+}
+
+// file adds a received message to its inbox, unless the inbox is closed or
+// the message is repeated
+func (r *runner) file(key inboxKey, m *Message) {
+	if r.closed[key] {
+		return
+	}
+	if r.pending[key] == nil {
+		r.pending[key] = make(map[uint16][]*Message)
+	}
+	for _, previous := range r.pending[key][m.Sender] {
+		if same, _ := sameMessage(previous, m); same {
+			return
+		}
+	}
+	r.pending[key][m.Sender] = append(r.pending[key][m.Sender], m)
+}
+
+// messageKey returns the inbox of a message, or false if it has none
+func messageKey(m *Message) (inboxKey, bool) {
+	key := inboxKey{round: m.Round}
+	if m.Round == RoundEcho || m.Round == RoundTranscript {
+		if len(m.Payload) == 0 {
+			return key, false
+		}
+		key.sub = Round(m.Payload[0])
+	}
+	return key, true
+}
+
+// decodeAll decodes the payload of every message, skipping those that do not
+// decode
+func decodeAll[T any](messages []*Message, decode func(*Message) (T, error)) []T {
+	var decoded []T
+	for _, m := range messages {
+		if v, err := decode(m); err == nil {
+			decoded = append(decoded, v)
+		}
+	}
+	return decoded
+}
@@ -0,0 +1,418 @@
+package dkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/internal/simnet"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// runOutcome is what Run returned for one participant
+type runOutcome struct {
+	share  toprf.Share16
+	result *Result
+	err    error
+}
+
+// script returns a simnet intercept that lets rewrite replace the messages
+// in flight with messages signed by their sender, to simulate malicious
+// participants. Packets that are not messages pass unchanged.
+func script(keys []ed25519.PrivateKey, session SessionID, rewrite func(m *Message, to uint16, signer *Signer) []*Message) func(simnet.Packet) []simnet.Packet {
+	return func(p simnet.Packet) []simnet.Packet {
+		m := new(Message)
+		if err := m.UnmarshalBinary(p.Data); err != nil || m.Sender < 1 || int(m.Sender) > len(keys) {
+			return []simnet.Packet{p}
+		}
+		signer, _ := NewSigner(session, m.Sender, keys[m.Sender-1])
+
+		var packets []simnet.Packet
+		for _, rewritten := range rewrite(m, p.To, signer) {
+			data, _ := rewritten.MarshalBinary()
+			packets = append(packets, simnet.Packet{From: p.From, To: p.To, Data: data})
+		}
+		return packets
+	}
+}
+
+// runNetwork runs the DKG for n participants over a simulated network, with
+// a time limit for the whole run and for every round (0 for none)
+func runNetwork(t *testing.T, n, threshold uint16, timeout, roundTimeout time.Duration, config func(keys []ed25519.PrivateKey, session SessionID) simnet.Config) []runOutcome {
+	t.Helper()
+
+	keys, boxKeys, roster := newTestRoster(t, n)
+	session, _ := NewSessionID()
+	net := simnet.New(n, config(keys, session))
+	defer net.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	outcomes := make([]runOutcome, n)
+	var wg sync.WaitGroup
+	for i := range outcomes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			self := uint16(i + 1)
+			o := &outcomes[i]
+			o.share, o.result, o.err = Run(ctx, RunConfig{
+				Session:       session,
+				Threshold:     threshold,
+				Self:          self,
+				Roster:        roster,
+				SigningKey:    keys[i],
+				EncryptionKey: boxKeys[i],
+				RoundTimeout:  roundTimeout,
+			}, net.Endpoint(self))
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// checkRun checks that all participants but faulty agree on the result,
+// with the expected QUAL, and that their shares reconstruct the group key
+func checkRun(t *testing.T, outcomes []runOutcome, qual []uint16, faulty uint16) {
+	t.Helper()
+
+	var shares []toprf.Share16
+	var group *Result
+	for i, o := range outcomes {
+		if uint16(i+1) == faulty {
+			continue
+		}
+		if o.err != nil {
+			t.Fatalf("Participant %d: Run failed: %v", i+1, o.err)
+		}
+		if !slices.Equal(o.result.Qual, qual) {
+			t.Errorf("Participant %d: QUAL = %v, want %v", i+1, o.result.Qual, qual)
+		}
+		if group == nil {
+			group = o.result
+		} else if o.result.PublicKey.Equal(group.PublicKey) != 1 {
+			t.Errorf("Participant %d: different group key", i+1)
+		}
+		shares = append(shares, o.share)
+	}
+
+	secret, err := Reconstruct16(shares)
+	if err != nil {
+		t.Fatalf("Reconstruct failed: %v", err)
+	}
+	if ristretto255.NewElement().ScalarBaseMult(secret).Equal(group.PublicKey) != 1 {
+		t.Error("Shares do not reconstruct the group key")
+	}
+}
+
+// TestRun tests the DKG over reliable and unreliable networks
+func TestRun(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config simnet.Config
+	}{
+		{"reliable", simnet.Config{}},
+		{"delay and duplicate", simnet.Config{Seed: 1, MaxDelay: 2 * time.Millisecond, Duplicate: 0.2}},
+		{"forged copies", simnet.Config{Intercept: func(p simnet.Packet) []simnet.Packet {
+			// Every packet is followed by a corrupted copy that does not
+			// authenticate
+			forged := p
+			forged.Data = append([]byte(nil), p.Data...)
+			forged.Data[len(forged.Data)-1] ^= 1
+			return []simnet.Packet{p, forged}
+		}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			outcomes := runNetwork(t, 4, 3, 10*time.Second, 0, func([]ed25519.PrivateKey, SessionID) simnet.Config {
+				return tc.config
+			})
+			checkRun(t, outcomes, []uint16{1, 2, 3, 4}, 0)
+		})
+	}
+}
+
+// TestRunComplaints tests dealers that send bad sealed shares
+func TestRunComplaints(t *testing.T) {
+	// corrupt makes dealer 1's sealed shares for victims undecryptable
+	corrupt := func(victims ...uint16) func([]ed25519.PrivateKey, SessionID) simnet.Config {
+		return func(keys []ed25519.PrivateKey, session SessionID) simnet.Config {
+			return simnet.Config{Intercept: script(keys, session, func(m *Message, to uint16, signer *Signer) []*Message {
+				if m.Round != RoundShare || m.Sender != 1 || !containsIndex(victims, m.Recipient) {
+					return []*Message{m}
+				}
+				sealed, _ := m.SealedShare()
+				sealed.Ciphertext[0] ^= 1
+				bad, _ := signer.SignSealedShare(sealed)
+				return []*Message{bad}
+			})}
+		}
+	}
+
+	// Step 1: One complaint is backed by evidence and answered by a
+	// justification
+	var evidence []ShareComplaint
+	checkRun(t, runNetwork(t, 4, 2, 10*time.Second, 0, func(keys []ed25519.PrivateKey, session SessionID) simnet.Config {
+		config := corrupt(3)(keys, session)
+		intercept := config.Intercept
+		config.Intercept = func(p simnet.Packet) []simnet.Packet {
+			m := new(Message)
+			if m.UnmarshalBinary(p.Data) == nil && m.Round == RoundShareComplaint && m.Sender == 3 && p.To == 2 {
+				evidence, _ = m.ShareComplaints()
+			}
+			return intercept(p)
+		}
+		return config
+	}), []uint16{1, 2, 3, 4}, 0)
+	if len(evidence) != 1 || evidence[0].Accused != 1 {
+		t.Errorf("Participant 3 sent evidence %v, want one complaint against 1", evidence)
+	}
+
+	// Step 2: Threshold complaints disqualify the dealer
+	checkRun(t, runNetwork(t, 4, 2, 10*time.Second, 0, corrupt(3, 4)), []uint16{2, 3, 4}, 1)
+
+	// Step 3: Evidence refutes a complaint if it is the dealer's valid share
+	// for the accuser or another participant's share, but not if the share
+	// did not open
+	keys, boxKeys, roster := newTestRoster(t, 3)
+	session, _ := NewSessionID()
+	r := &runner{config: RunConfig{Session: session, Roster: roster}}
+	dealer, _ := NewSigner(session, 1, keys[0])
+	p, _ := NewParticipant(3, 2, 1)
+	deal, shares, _ := p.Deal()
+	signed := make([]*Message, len(shares))
+	for k := range shares {
+		sealed, _ := SealShare(session, boxKeys[0], roster.EncryptionKey(shares[k].Recipient), &shares[k])
+		signed[k], _ = dealer.SignSealedShare(sealed)
+	}
+	sealed, _ := signed[1].SealedShare()
+	sealed.Ciphertext[0] ^= 1
+	corrupted, _ := dealer.SignSealedShare(sealed)
+	pairKey, _ := derivePairKey(session, boxKeys[2], roster.EncryptionKey(1), 1, 3)
+
+	against := Complaint{Accuser: 3, Accused: 1}
+	evidence = []ShareComplaint{
+		{Complaint: against, Key: pairKey, Share: signed[1]},
+		{Complaint: against, Key: pairKey, Share: signed[0]},
+		{Complaint: against, Key: pairKey, Share: corrupted},
+	}
+	for k, want := range []bool{true, true, false} {
+		if refuted := r.refuted([]*Deal{deal}, evidence[k:k+1]); (len(refuted) == 1) != want {
+			t.Errorf("Evidence %d: refuted = %v, want %v", k, refuted, want)
+		}
+	}
+}
+
+// TestRunEquivocation tests participants that send different broadcasts to
+// different peers
+func TestRunEquivocation(t *testing.T) {
+	// Step 1: Dealer 1 sends participant 4 a different Deal and is
+	// disqualified
+	twin, _ := NewParticipant(4, 2, 1)
+	other, _, _ := twin.Deal()
+	outcomes := runNetwork(t, 4, 2, 10*time.Second, 0, func(keys []ed25519.PrivateKey, session SessionID) simnet.Config {
+		return simnet.Config{Intercept: script(keys, session, func(m *Message, to uint16, signer *Signer) []*Message {
+			if m.Round == RoundDeal && m.Sender == 1 && to == 4 {
+				forked, _ := signer.SignDeal(other)
+				return []*Message{forked}
+			}
+			return []*Message{m}
+		})}
+	})
+	checkRun(t, outcomes, []uint16{2, 3, 4}, 1)
+
+	// Step 2: Participant 2 sends participant 3 different complaints, and
+	// everyone aborts with evidence
+	outcomes = runNetwork(t, 4, 2, 10*time.Second, 0, func(keys []ed25519.PrivateKey, session SessionID) simnet.Config {
+		return simnet.Config{Intercept: script(keys, session, func(m *Message, to uint16, signer *Signer) []*Message {
+			if m.Round == RoundComplaint && m.Sender == 2 && to == 3 {
+				forked, _ := signer.SignComplaints([]Complaint{{Accuser: 2, Accused: 1}})
+				return []*Message{forked}
+			}
+			return []*Message{m}
+		})}
+	})
+	for i, o := range outcomes {
+		var equivocation *EquivocationError
+		if !errors.As(o.err, &equivocation) {
+			t.Fatalf("Participant %d: Run error = %v, want an EquivocationError", i+1, o.err)
+		}
+		if len(equivocation.Evidence) != 1 || equivocation.Evidence[0].Sender() != 2 {
+			t.Errorf("Participant %d: evidence against %v, want participant 2", i+1, equivocation)
+		}
+	}
+}
+
+// TestRunSilentParticipant tests that a participant that never sends
+// anything stalls the run until the context is done
+func TestRunSilentParticipant(t *testing.T) {
+	outcomes := runNetwork(t, 3, 2, 200*time.Millisecond, 0, func([]ed25519.PrivateKey, SessionID) simnet.Config {
+		return simnet.Config{Intercept: func(p simnet.Packet) []simnet.Packet {
+			if p.From == 3 {
+				return nil
+			}
+			return []simnet.Packet{p}
+		}}
+	})
+	for i, o := range outcomes[:2] {
+		if !errors.Is(o.err, context.DeadlineExceeded) {
+			t.Errorf("Participant %d: Run error = %v, want deadline exceeded", i+1, o.err)
+		}
+	}
+}
+
+// TestRunOffline tests that round deadlines drop participants that do not
+// respond, and that the run completes with the others
+func TestRunOffline(t *testing.T) {
+	// silent drops every message of the participants in offline from round
+	// on
+	silent := func(round Round, offline ...uint16) func([]ed25519.PrivateKey, SessionID) simnet.Config {
+		return func(keys []ed25519.PrivateKey, session SessionID) simnet.Config {
+			return simnet.Config{Intercept: script(keys, session, func(m *Message, to uint16, signer *Signer) []*Message {
+				if containsIndex(offline, m.Sender) && m.Round >= round {
+					return nil
+				}
+				return []*Message{m}
+			})}
+		}
+	}
+
+	// Step 1: A participant that never comes online is not in QUAL
+	outcomes := runNetwork(t, 4, 2, 10*time.Second, 100*time.Millisecond, silent(RoundDeal, 4))
+	checkRun(t, outcomes, []uint16{1, 2, 3}, 4)
+
+	// Step 2: A dealer that goes offline after dealing stays in QUAL, and
+	// its Feldman commitments are reconstructed
+	outcomes = runNetwork(t, 4, 2, 10*time.Second, 100*time.Millisecond, silent(RoundComplaint, 4))
+	checkRun(t, outcomes, []uint16{1, 2, 3, 4}, 4)
+
+	// Step 3: The run fails when fewer than threshold dealers remain
+	outcomes = runNetwork(t, 3, 2, 10*time.Second, 100*time.Millisecond, silent(RoundDeal, 2, 3))
+	if err := outcomes[0].err; err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run error = %v, want not enough qualified dealers", err)
+	}
+}
+
+// TestRunResume tests a participant that is killed in the middle of the DKG,
+// losing everything sent to it while it is down, and restarts from its
+// latest checkpoint
+func TestRunResume(t *testing.T) {
+	for _, crash := range []Round{RoundShare, RoundComplaint, RoundJustification, RoundReveal} {
+		t.Run(fmt.Sprintf("round %d", crash), func(t *testing.T) {
+			keys, boxKeys, roster := newTestRoster(t, 4)
+			session, _ := NewSessionID()
+			var checkpointKey [CheckpointKeyBytes]byte
+			checkpointKey[0] = 7
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			crashCtx, kill := context.WithCancel(ctx)
+			defer kill()
+
+			// Participant 2 goes down when it sends its first message of the
+			// crash round, and the network drops its traffic until it is back
+			var mu sync.Mutex
+			var down, restarted bool
+			var deals [][]byte
+			net := simnet.New(4, simnet.Config{Intercept: func(p simnet.Packet) []simnet.Packet {
+				mu.Lock()
+				defer mu.Unlock()
+				m := new(Message)
+				if p.From == 2 && m.UnmarshalBinary(p.Data) == nil {
+					if m.Round == crash && !down && !restarted {
+						down = true
+						kill()
+					}
+					if m.Round == RoundDeal && !down && !slices.ContainsFunc(deals, func(d []byte) bool { return bytes.Equal(d, p.Data) }) {
+						deals = append(deals, p.Data)
+					}
+				}
+				if down && (p.From == 2 || p.To == 2) {
+					return nil
+				}
+				return []simnet.Packet{p}
+			}})
+			defer net.Close()
+
+			var stored []byte
+			var latest uint64
+			config := func(i int) RunConfig {
+				config := RunConfig{
+					Session:       session,
+					Threshold:     3,
+					Self:          uint16(i + 1),
+					Roster:        roster,
+					SigningKey:    keys[i],
+					EncryptionKey: boxKeys[i],
+				}
+				if i == 1 {
+					config.CheckpointKey = checkpointKey
+					config.Checkpoint = func(_ context.Context, sequence uint64, sealed []byte) error {
+						stored, latest = sealed, sequence
+						return nil
+					}
+				}
+				return config
+			}
+
+			outcomes := make([]runOutcome, 4)
+			var wg sync.WaitGroup
+			for i := range outcomes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					o := &outcomes[i]
+					if i != 1 {
+						o.share, o.result, o.err = Run(ctx, config(i), net.Endpoint(uint16(i+1)))
+						return
+					}
+
+					// Step 1: Participant 2 is killed
+					if _, _, err := Run(crashCtx, config(i), net.Endpoint(2)); !errors.Is(err, context.Canceled) {
+						o.err = fmt.Errorf("run before the crash: %v", err)
+						return
+					}
+
+					// Step 2: It restarts from its latest checkpoint, without
+					// the messages it had received but not read
+					time.Sleep(20 * time.Millisecond)
+					for {
+						drainCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+						_, _, err := net.Endpoint(2).Receive(drainCtx)
+						cancel()
+						if err != nil {
+							break
+						}
+					}
+					resume, err := OpenCheckpoint(checkpointKey, session, latest, stored)
+					if err != nil {
+						o.err = err
+						return
+					}
+					mu.Lock()
+					down, restarted = false, true
+					mu.Unlock()
+					resumed := config(i)
+					resumed.Resume = resume
+					o.share, o.result, o.err = Run(ctx, resumed, net.Endpoint(2))
+				}()
+			}
+			wg.Wait()
+
+			// Step 3: Participant 2 did not deal again and stays in QUAL
+			checkRun(t, outcomes, []uint16{1, 2, 3, 4}, 0)
+			if len(deals) != 1 {
+				t.Errorf("Participant 2 sent %d different Deals, want 1", len(deals))
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package dkg
+
+// Encrypted share delivery
+//
+// A dealer's PrivateShare for participant j must only be readable by j, and
+// a participant must be able to prove that the share it received was bad.
+// Each participant has a long-term X25519 key, listed in the Roster next to
+// its signing key. The dealer i seals the share for j with ChaCha20-Poly1305
+// under the pair key
+//
+//	k_ij = HKDF-SHA256(X25519(sk_i, pk_j), salt = session, info = shareContext || i || j)
+//
+// where i and j are 2 bytes each, with the session, i and j as additional data, and signs the ciphertext in
+// a RoundShare message. k_ij is used for exactly one share, so the nonce is
+// fixed.
+//
+// OpenShare decrypts a share and checks it against the dealer's Pedersen
+// commitments in one step. If either fails, it returns a ShareComplaint
+// instead: the recipient's complaint, the pair key and the dealer's signed
+// message. Anyone can verify the complaint with VerifyShareComplaint by
+// checking the dealer's signature and decrypting the ciphertext. If the
+// revealed key opens it to a valid share, the complaint is false and the
+// accuser is misbehaving. Otherwise the complaint stands, and the dealer
+// answers it with a Justification as in GJKR (see participant.go). A wrong
+// key cannot be told apart from a bad ciphertext without the secret keys,
+// but the justification settles it either way.
+//
+// Revealing k_ij only exposes the disputed share: the key depends on the
+// session and on both indexes.
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// PairKeyBytes is the size of a pair key
+	PairKeyBytes = chacha20poly1305.KeySize
+
+	// SealedShareBytes is the size of an encoded SealedShare: the indexes and
+	// the encrypted PrivateShare
+	SealedShareBytes = 4 + privateShareBytes + chacha20poly1305.Overhead
+
+	// shareComplaintBytes is the size of an encoded ShareComplaint whose
+	// evidence is a RoundShare message
+	shareComplaintBytes = 4 + PairKeyBytes + messageHeaderBytes + SealedShareBytes + ed25519.SignatureSize
+
+	// privateShareBytes is the size of an encoded PrivateShare
+	privateShareBytes = 4 + sharePairBytes
+
+	// shareContext is the HKDF info prefix of pair keys
+	shareContext = "go-oprf DKG share v2"
+)
+
+// SealedShare is a PrivateShare encrypted to its recipient.
+type SealedShare struct {
+	Dealer     uint16
+	Recipient  uint16
+	Ciphertext []byte
+}
+
+// ShareComplaint is a complaint against a dealer whose sealed share did not
+// decrypt to a valid share, with the evidence to check it.
+type ShareComplaint struct {
+	Complaint
+	// Key is the pair key of the dealer and the accuser
+	Key [PairKeyBytes]byte
+	// Share is the dealer's signed RoundShare message
+	Share *Message
+}
+
+// SealShare encrypts a PrivateShare to its recipient.
+//
+// Parameters:
+//   - session: The session ID of the DKG
+//   - key: The dealer's long-term X25519 private key
+//   - recipientKey: The recipient's long-term X25519 public key
+//   - share: The share to seal
+//
+// Returns:
+//   - The sealed share, to send with Signer.SignSealedShare
+//   - Error if the keys are invalid
+func SealShare(session SessionID, key *ecdh.PrivateKey, recipientKey *ecdh.PublicKey, share *PrivateShare) (*SealedShare, error) {
+	plaintext, err := share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	pairKey, err := derivePairKey(session, key, recipientKey, share.Dealer, share.Recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.New(pairKey[:])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	ad := shareAD(session, share.Dealer, share.Recipient)
+
+	return &SealedShare{
+		Dealer:     share.Dealer,
+		Recipient:  share.Recipient,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, ad),
+	}, nil
+}
+
+// OpenShare decrypts a sealed share and verifies it against the dealer's
+// Pedersen commitments.
+//
+// Parameters:
+//   - session: The session ID of the DKG
+//   - key: The recipient's long-term X25519 private key
+//   - dealerKey: The dealer's long-term X25519 public key
+//   - commitments: The dealer's Pedersen commitments from its Deal
+//   - m: The dealer's RoundShare message, authenticated with Roster.Open
+//
+// Returns:
+//   - The share, if it decrypts and verifies
+//   - Otherwise a ShareComplaint to broadcast
+//   - Error if the message is not a sealed share or the keys are invalid
+func OpenShare(session SessionID, key *ecdh.PrivateKey, dealerKey *ecdh.PublicKey, commitments []*ristretto255.Element, m *Message) (*PrivateShare, *ShareComplaint, error) {
+	sealed, err := m.SealedShare()
+	if err != nil {
+		return nil, nil, err
+	}
+	pairKey, err := derivePairKey(session, key, dealerKey, sealed.Dealer, sealed.Recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	share, err := openSealedShare(session, pairKey, sealed, commitments)
+	if err != nil {
+		return nil, &ShareComplaint{
+			Complaint: Complaint{Accuser: sealed.Recipient, Accused: sealed.Dealer},
+			Key:       pairKey,
+			Share:     m,
+		}, nil
+	}
+	return share, nil, nil
+}
+
+// VerifyShareComplaint checks a ShareComplaint.
+//
+// Parameters:
+//   - session: The session ID of the DKG
+//   - roster: The participants' public keys
+//   - commitments: The accused dealer's Pedersen commitments
+//   - c: The complaint
+//
+// Returns:
+//   - nil if the complaint stands and the dealer must justify
+//   - Error if the evidence is invalid or the complaint is false
+func VerifyShareComplaint(session SessionID, roster *Roster, commitments []*ristretto255.Element, c *ShareComplaint) error {
+	if c.Share == nil {
+		return errors.New("dkg: complaint has no evidence")
+	}
+	if err := roster.Verify(session, c.Share); err != nil {
+		return err
+	}
+	sealed, err := c.Share.SealedShare()
+	if err != nil {
+		return err
+	}
+	if sealed.Dealer != c.Accused || sealed.Recipient != c.Accuser {
+		return errors.New("dkg: evidence does not match complaint")
+	}
+
+	if _, err := openSealedShare(session, c.Key, sealed, commitments); err == nil {
+		return errors.New("dkg: false complaint")
+	}
+	return nil
+}
+
+// MarshalBinary encodes a SealedShare.
+// Format: [dealer:2 bytes][recipient:2 bytes][ciphertext]
+func (s *SealedShare) MarshalBinary() ([]byte, error) {
+	if len(s.Ciphertext) != SealedShareBytes-4 {
+		return nil, errors.New("dkg: invalid ciphertext length")
+	}
+	data := binary.BigEndian.AppendUint16(nil, s.Dealer)
+	data = binary.BigEndian.AppendUint16(data, s.Recipient)
+	return append(data, s.Ciphertext...), nil
+}
+
+// UnmarshalBinary decodes a SealedShare.
+func (s *SealedShare) UnmarshalBinary(data []byte) error {
+	if len(data) != SealedShareBytes {
+		return errors.New("dkg: invalid sealed share length")
+	}
+	s.Dealer, s.Recipient = binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+	s.Ciphertext = append([]byte(nil), data[4:]...)
+	return nil
+}
+
+// MarshalBinary encodes a ShareComplaint.
+// Format: [accuser:2 bytes][accused:2 bytes][key:32 bytes][message]
+func (c *ShareComplaint) MarshalBinary() ([]byte, error) {
+	if c.Share == nil {
+		return nil, errors.New("dkg: complaint has no evidence")
+	}
+	message, err := c.Share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, 4+PairKeyBytes+len(message))
+	data = binary.BigEndian.AppendUint16(data, c.Accuser)
+	data = binary.BigEndian.AppendUint16(data, c.Accused)
+	data = append(data, c.Key[:]...)
+	return append(data, message...), nil
+}
+
+// UnmarshalBinary decodes a ShareComplaint.
+func (c *ShareComplaint) UnmarshalBinary(data []byte) error {
+	if len(data) < 4+PairKeyBytes {
+		return errors.New("dkg: invalid share complaint length")
+	}
+
+	m := new(Message)
+	if err := m.UnmarshalBinary(data[4+PairKeyBytes:]); err != nil {
+		return err
+	}
+	c.Accuser, c.Accused = binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:])
+	copy(c.Key[:], data[4:])
+	c.Share = m
+	return nil
+}
+
+// openSealedShare decrypts a sealed share with a pair key and verifies it
+func openSealedShare(session SessionID, pairKey [PairKeyBytes]byte, sealed *SealedShare, commitments []*ristretto255.Element) (*PrivateShare, error) {
+	aead, err := chacha20poly1305.New(pairKey[:])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	plaintext, err := aead.Open(nil, nonce, sealed.Ciphertext, shareAD(session, sealed.Dealer, sealed.Recipient))
+	if err != nil {
+		return nil, errors.New("dkg: share decryption failed")
+	}
+
+	share := new(PrivateShare)
+	if err := share.UnmarshalBinary(plaintext); err != nil {
+		return nil, err
+	}
+	if share.Dealer != sealed.Dealer || share.Recipient != sealed.Recipient {
+		return nil, errors.New("dkg: share does not match dealer or recipient")
+	}
+	if err := verifyPedersenShare(commitments, share.Recipient, share.Share); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// derivePairKey derives the key of a dealer and a recipient for a session
+func derivePairKey(session SessionID, key *ecdh.PrivateKey, peerKey *ecdh.PublicKey, dealer, recipient uint16) ([PairKeyBytes]byte, error) {
+	var pairKey [PairKeyBytes]byte
+	if key == nil || peerKey == nil || key.Curve() != ecdh.X25519() {
+		return pairKey, errors.New("dkg: invalid X25519 key")
+	}
+
+	shared, err := key.ECDH(peerKey)
+	if err != nil {
+		return pairKey, err
+	}
+	defer clear(shared)
+
+	info := binary.BigEndian.AppendUint16([]byte(shareContext), dealer)
+	info = binary.BigEndian.AppendUint16(info, recipient)
+	derived, err := hkdf.Key(sha256.New, shared, session[:], string(info), PairKeyBytes)
+	if err != nil {
+		return pairKey, err
+	}
+	copy(pairKey[:], derived)
+	clear(derived)
+	return pairKey, nil
+}
+
+// shareAD returns the additional data of a sealed share
+func shareAD(session SessionID, dealer, recipient uint16) []byte {
+	ad := binary.BigEndian.AppendUint16(session[:], dealer)
+	return binary.BigEndian.AppendUint16(ad, recipient)
+}
@@ -0,0 +1,125 @@
+package dkg
+
+import (
+	"testing"
+
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// TestShareComplaint tests that bad sealed shares become complaints that
+// others can check, and that false complaints are detected
+func TestShareComplaint(t *testing.T) {
+	keys, boxKeys, roster := newTestRoster(t, 3)
+	session, _ := NewSessionID()
+	dealer, _ := NewSigner(session, 1, keys[0])
+	accuser, _ := NewSigner(session, 2, keys[1])
+
+	p, _ := NewParticipant(3, 2, 1)
+	deal, shares, _ := p.Deal()
+	share := shares[0] // for participant 2
+
+	open := func(m *Message) (*PrivateShare, *ShareComplaint) {
+		t.Helper()
+		ps, complaint, err := OpenShare(session, boxKeys[1], roster.EncryptionKey(1), deal.Commitments, transmit(t, roster, session, 2, m))
+		if err != nil {
+			t.Fatalf("OpenShare failed: %v", err)
+		}
+		return ps, complaint
+	}
+
+	// Step 1: The dealer seals a share that does not match its commitments
+	bad := share
+	bad.Share = [2]toprf.Share16{share.Share[0], {Index: 2, Value: scalarFromUint8(1)}}
+	sealed, _ := SealShare(session, boxKeys[0], roster.EncryptionKey(2), &bad)
+	m, _ := dealer.SignSealedShare(sealed)
+	if ps, complaint := open(m); ps != nil || complaint == nil {
+		t.Fatal("OpenShare accepted an invalid share")
+	}
+
+	// Step 2: The dealer signs a corrupted ciphertext
+	sealed, _ = SealShare(session, boxKeys[0], roster.EncryptionKey(2), &share)
+	sealed.Ciphertext[0] ^= 1
+	m, _ = dealer.SignSealedShare(sealed)
+	_, complaint := open(m)
+	if complaint == nil {
+		t.Fatal("OpenShare accepted a corrupted ciphertext")
+	}
+	if complaint.Accuser != 2 || complaint.Accused != 1 {
+		t.Errorf("Complaint = %d against %d, want 2 against 1", complaint.Accuser, complaint.Accused)
+	}
+
+	// Step 3: The complaint is broadcast and checked by participant 3
+	cm, err := accuser.SignShareComplaints([]ShareComplaint{*complaint})
+	if err != nil {
+		t.Fatalf("SignShareComplaints failed: %v", err)
+	}
+	received, err := transmit(t, roster, session, 3, cm).ShareComplaints()
+	if err != nil || len(received) != 1 {
+		t.Fatalf("ShareComplaints failed: %v", err)
+	}
+	if err := VerifyShareComplaint(session, roster, deal.Commitments, &received[0]); err != nil {
+		t.Errorf("VerifyShareComplaint rejected a valid complaint: %v", err)
+	}
+
+	// Step 4: A complaint about a valid share is false
+	sealed, _ = SealShare(session, boxKeys[0], roster.EncryptionKey(2), &share)
+	m, _ = dealer.SignSealedShare(sealed)
+	if ps, complaint := open(m); ps == nil || complaint != nil {
+		t.Fatal("OpenShare rejected a valid share")
+	}
+	pairKey, _ := derivePairKey(session, boxKeys[1], roster.EncryptionKey(1), 1, 2)
+	falseComplaint := &ShareComplaint{Complaint: Complaint{Accuser: 2, Accused: 1}, Key: pairKey, Share: m}
+	if err := VerifyShareComplaint(session, roster, deal.Commitments, falseComplaint); err == nil {
+		t.Error("VerifyShareComplaint accepted a false complaint")
+	}
+
+	// Step 5: The evidence must be the accused dealer's message to the accuser
+	misdirected := &ShareComplaint{Complaint: Complaint{Accuser: 3, Accused: 1}, Key: pairKey, Share: m}
+	if err := VerifyShareComplaint(session, roster, deal.Commitments, misdirected); err == nil {
+		t.Error("VerifyShareComplaint accepted evidence for another accuser")
+	}
+	forged := *m
+	forged.Payload = append([]byte(nil), m.Payload...)
+	forged.Payload[len(forged.Payload)-1] ^= 1
+	unsigned := &ShareComplaint{Complaint: Complaint{Accuser: 2, Accused: 1}, Key: pairKey, Share: &forged}
+	if err := VerifyShareComplaint(session, roster, deal.Commitments, unsigned); err == nil {
+		t.Error("VerifyShareComplaint accepted evidence the dealer did not sign")
+	}
+}
+
+// TestSealShareBinding tests that a sealed share only opens in its session
+// and for its recipient
+func TestSealShareBinding(t *testing.T) {
+	keys, boxKeys, roster := newTestRoster(t, 3)
+	session, _ := NewSessionID()
+	other, _ := NewSessionID()
+
+	p, _ := NewParticipant(3, 2, 1)
+	deal, shares, _ := p.Deal()
+
+	sealed, _ := SealShare(session, boxKeys[0], roster.EncryptionKey(2), &shares[0])
+
+	// Another session derives another pair key
+	key, _ := derivePairKey(other, boxKeys[1], roster.EncryptionKey(1), 1, 2)
+	if _, err := openSealedShare(session, key, sealed, deal.Commitments); err == nil {
+		t.Error("Sealed share opened with the key of another session")
+	}
+
+	// Another recipient cannot decrypt it
+	key, _ = derivePairKey(session, boxKeys[2], roster.EncryptionKey(1), 1, 2)
+	if _, err := openSealedShare(session, key, sealed, deal.Commitments); err == nil {
+		t.Error("Sealed share opened with another recipient's key")
+	}
+
+	// Both sides derive the same pair key
+	dealerKey, _ := derivePairKey(session, boxKeys[0], roster.EncryptionKey(2), 1, 2)
+	key, _ = derivePairKey(session, boxKeys[1], roster.EncryptionKey(1), 1, 2)
+	if dealerKey != key {
+		t.Error("Dealer and recipient derived different pair keys")
+	}
+
+	signer, _ := NewSigner(session, 2, keys[1])
+	if _, err := signer.SignSealedShare(sealed); err == nil {
+		t.Error("SignSealedShare accepted the share of another dealer")
+	}
+}
@@ -0,0 +1,371 @@
+package dkg
+
+// Transcript hashing and echo broadcast
+//
+// The protocol assumes a broadcast channel, but over point-to-point links a
+// malicious participant can send different signed messages of the same round
+// to different peers (equivocation), e.g. different commitments, and each
+// peer would verify its shares against its own copy. To detect this, every
+// participant records the broadcast messages it accepted in a Transcript and,
+// after each broadcast round, sends an Echo of the transcript digest:
+//
+//	digest = SHA-256(transcriptContext || session || for each (round, sender) in order: len || message)
+//
+// where message is the signed part of the Message. The digest does not depend
+// on the order of arrival, so honest participants with the same view agree.
+//
+// If an echo disagrees, the participants broadcast their copy of the round
+// (RoundTranscript) and Merge the copies of the others into their
+// transcripts. Only messages signed by their sender are accepted, so a relay
+// cannot forge anything: either a message was just missing, and the merge
+// completes the view, or the sender signed two different messages for the
+// same round, and the transcript holds an Equivocation with both as
+// evidence that anyone can check with Equivocation.Verify.
+//
+// A dealer that equivocated in RoundDeal is disqualified: all honest
+// participants leave its Deal out of Participant.Verify. Equivocation in any
+// later round, or disagreement that persists after the merge, cannot be
+// resolved locally and the caller aborts the protocol, publishing the
+// evidence.
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sort"
+)
+
+const (
+	// TranscriptBytes is the size of a transcript digest
+	TranscriptBytes = sha256.Size
+
+	// transcriptContext is prepended to the transcript digest input
+	transcriptContext = "go-oprf DKG transcript v1"
+)
+
+// Transcript records the authenticated broadcast messages of a DKG session.
+type Transcript struct {
+	session       SessionID
+	roster        *Roster
+	messages      map[transcriptEntry]*Message
+	equivocations []*Equivocation
+}
+
+// transcriptEntry is the position of a message in the transcript
+type transcriptEntry struct {
+	round  Round
+	sender uint16
+}
+
+// Echo is a participant's transcript digest after a round.
+type Echo struct {
+	Sender uint16
+	Round  Round
+	Digest [TranscriptBytes]byte
+}
+
+// Equivocation is evidence that a participant signed two different
+// messages for the same round of a session.
+type Equivocation struct {
+	First  *Message
+	Second *Message
+}
+
+// NewTranscript creates an empty transcript for a session.
+func NewTranscript(session SessionID, roster *Roster) *Transcript {
+	return &Transcript{
+		session:  session,
+		roster:   roster,
+		messages: make(map[transcriptEntry]*Message),
+	}
+}
+
+// Add records a broadcast message after checking its signature.
+//
+// Parameters:
+//   - m: A broadcast message of the session
+//
+// Returns:
+//   - Equivocation evidence if the transcript already holds a different
+//     message of the same sender and round, otherwise nil
+//   - Error if the message is not an authenticated broadcast of a protocol
+//     round
+func (t *Transcript) Add(m *Message) (*Equivocation, error) {
+	if m.Recipient != 0 || m.Round == RoundEcho || m.Round == RoundTranscript || m.Round == RoundResume {
+		return nil, errors.New("dkg: message is not recorded in the transcript")
+	}
+	if err := t.roster.Verify(t.session, m); err != nil {
+		return nil, err
+	}
+
+	entry := transcriptEntry{round: m.Round, sender: m.Sender}
+	first, ok := t.messages[entry]
+	if !ok {
+		t.messages[entry] = m
+		return nil, nil
+	}
+
+	same, err := sameMessage(first, m)
+	if err != nil || same {
+		return nil, err
+	}
+
+	e := &Equivocation{First: first, Second: m}
+	if !containsIndex(t.Equivocators(), m.Sender) {
+		t.equivocations = append(t.equivocations, e)
+	}
+	return e, nil
+}
+
+// Merge records the messages of another participant's RoundTranscript copy.
+// Messages without a valid signature are skipped.
+//
+// Returns:
+//   - The equivocations found while merging
+func (t *Transcript) Merge(messages []*Message) []*Equivocation {
+	var found []*Equivocation
+	for _, m := range messages {
+		e, err := t.Add(m)
+		if err == nil && e != nil {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Messages returns the recorded messages of a round, ordered by sender.
+func (t *Transcript) Messages(round Round) []*Message {
+	var messages []*Message
+	for entry, m := range t.messages {
+		if entry.round == round {
+			messages = append(messages, m)
+		}
+	}
+	sort.Slice(messages, func(a, b int) bool { return messages[a].Sender < messages[b].Sender })
+	return messages
+}
+
+// records returns the recorded messages, followed by the second message of
+// every equivocation, so that adding them to a new transcript restores it.
+func (t *Transcript) records() []*Message {
+	messages := make([]*Message, 0, len(t.messages)+len(t.equivocations))
+	for _, m := range t.messages {
+		messages = append(messages, m)
+	}
+	for _, e := range t.equivocations {
+		messages = append(messages, e.Second)
+	}
+	return messages
+}
+
+// Digest returns the hash of all recorded messages.
+func (t *Transcript) Digest() [TranscriptBytes]byte {
+	entries := make([]transcriptEntry, 0, len(t.messages))
+	for entry := range t.messages {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		if entries[a].round != entries[b].round {
+			return entries[a].round < entries[b].round
+		}
+		return entries[a].sender < entries[b].sender
+	})
+
+	h := sha256.New()
+	h.Write([]byte(transcriptContext))
+	h.Write(t.session[:])
+	for _, entry := range entries {
+		// Recorded messages were verified, so their header encodes
+		signed, _ := t.messages[entry].signedBytes()
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(signed))))
+		h.Write(signed)
+	}
+
+	var digest [TranscriptBytes]byte
+	h.Sum(digest[:0])
+	return digest
+}
+
+// CheckEchoes compares the echoes of the other participants with the
+// transcript digest.
+//
+// Returns:
+//   - The senders of echoes that disagree, sorted
+func (t *Transcript) CheckEchoes(echoes []*Echo) []uint16 {
+	digest := t.Digest()
+
+	var disagree []uint16
+	for _, e := range echoes {
+		if e.Digest != digest && !containsIndex(disagree, e.Sender) {
+			disagree = append(disagree, e.Sender)
+		}
+	}
+	sort.Slice(disagree, func(a, b int) bool { return disagree[a] < disagree[b] })
+	return disagree
+}
+
+// Equivocations returns the evidence found so far, at most one per sender.
+func (t *Transcript) Equivocations() []*Equivocation {
+	return append([]*Equivocation(nil), t.equivocations...)
+}
+
+// Equivocators returns the senders that equivocated, in order of detection.
+func (t *Transcript) Equivocators() []uint16 {
+	senders := make([]uint16, len(t.equivocations))
+	for k, e := range t.equivocations {
+		senders[k] = e.First.Sender
+	}
+	return senders
+}
+
+// SignEcho signs the participant's transcript digest after a round.
+func (s *Signer) SignEcho(round Round, digest [TranscriptBytes]byte) (*Message, error) {
+	return s.Sign(RoundEcho, 0, append([]byte{uint8(round)}, digest[:]...))
+}
+
+// SignTranscript signs the participant's copy of a round.
+func (s *Signer) SignTranscript(t *Transcript, round Round) (*Message, error) {
+	messages := t.Messages(round)
+	payload := binary.BigEndian.AppendUint16([]byte{uint8(round)}, uint16(len(messages)))
+	for _, m := range messages {
+		encoded, err := m.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(encoded)))
+		payload = append(payload, encoded...)
+	}
+	return s.Sign(RoundTranscript, 0, payload)
+}
+
+// Echo decodes the Echo carried by a RoundEcho message.
+func (m *Message) Echo() (*Echo, error) {
+	if err := m.expect(RoundEcho); err != nil {
+		return nil, err
+	}
+	if len(m.Payload) != 1+TranscriptBytes {
+		return nil, errors.New("dkg: invalid echo length")
+	}
+
+	e := &Echo{Sender: m.Sender, Round: Round(m.Payload[0])}
+	copy(e.Digest[:], m.Payload[1:])
+	return e, nil
+}
+
+// Transcript decodes the copy of a round carried by a RoundTranscript
+// message. The messages are not authenticated yet; Transcript.Merge checks
+// them.
+func (m *Message) Transcript() (Round, []*Message, error) {
+	if err := m.expect(RoundTranscript); err != nil {
+		return 0, nil, err
+	}
+	if len(m.Payload) < 3 {
+		return 0, nil, errors.New("dkg: invalid transcript length")
+	}
+
+	round, data := Round(m.Payload[0]), m.Payload[3:]
+	messages := make([]*Message, binary.BigEndian.Uint16(m.Payload[1:]))
+	for k := range messages {
+		if len(data) < 4 || uint64(len(data)-4) < uint64(binary.BigEndian.Uint32(data)) {
+			return 0, nil, errors.New("dkg: invalid transcript length")
+		}
+		length := binary.BigEndian.Uint32(data)
+		messages[k] = new(Message)
+		if err := messages[k].UnmarshalBinary(data[4 : 4+length]); err != nil {
+			return 0, nil, err
+		}
+		if messages[k].Round != round {
+			return 0, nil, errors.New("dkg: transcript message of another round")
+		}
+		data = data[4+length:]
+	}
+	if len(data) != 0 {
+		return 0, nil, errors.New("dkg: invalid transcript length")
+	}
+	return round, messages, nil
+}
+
+// Sender returns the participant that equivocated.
+func (e *Equivocation) Sender() uint16 {
+	return e.First.Sender
+}
+
+// Verify checks equivocation evidence: two different broadcast messages of
+// the session, for the same round, both signed by the sender.
+func (e *Equivocation) Verify(session SessionID, roster *Roster) error {
+	if e.First == nil || e.Second == nil {
+		return errors.New("dkg: incomplete equivocation evidence")
+	}
+	if e.First.Sender != e.Second.Sender || e.First.Round != e.Second.Round {
+		return errors.New("dkg: messages are from different senders or rounds")
+	}
+	if e.First.Recipient != 0 || e.Second.Recipient != 0 {
+		return errors.New("dkg: messages are not broadcasts")
+	}
+	for _, m := range []*Message{e.First, e.Second} {
+		if err := roster.Verify(session, m); err != nil {
+			return err
+		}
+	}
+
+	same, err := sameMessage(e.First, e.Second)
+	if err != nil {
+		return err
+	}
+	if same {
+		return errors.New("dkg: messages are identical")
+	}
+	return nil
+}
+
+// MarshalBinary encodes equivocation evidence for publication.
+// Format: [first length:4 bytes][first][second]
+func (e *Equivocation) MarshalBinary() ([]byte, error) {
+	if e.First == nil || e.Second == nil {
+		return nil, errors.New("dkg: incomplete equivocation evidence")
+	}
+	first, err := e.First.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	second, err := e.Second.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(first)))
+	data = append(data, first...)
+	return append(data, second...), nil
+}
+
+// UnmarshalBinary decodes equivocation evidence. Check it with Verify.
+func (e *Equivocation) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 || uint64(len(data)-4) < uint64(binary.BigEndian.Uint32(data)) {
+		return errors.New("dkg: invalid equivocation length")
+	}
+
+	length := binary.BigEndian.Uint32(data)
+	first, second := new(Message), new(Message)
+	if err := first.UnmarshalBinary(data[4 : 4+length]); err != nil {
+		return err
+	}
+	if err := second.UnmarshalBinary(data[4+length:]); err != nil {
+		return err
+	}
+	e.First, e.Second = first, second
+	return nil
+}
+
+// sameMessage reports whether two messages have the same signed content
+func sameMessage(a, b *Message) (bool, error) {
+	signedA, err := a.signedBytes()
+	if err != nil {
+		return false, err
+	}
+	signedB, err := b.signedBytes()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(signedA, signedB), nil
+}
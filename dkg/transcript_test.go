@@ -0,0 +1,220 @@
+package dkg
+
+import (
+	"testing"
+)
+
+// echoRound runs an echo round between transcripts and returns, for each
+// participant, the senders whose echo disagrees
+func echoRound(t *testing.T, roster *Roster, session SessionID, signers []*Signer, transcripts []*Transcript, round Round) [][]uint16 {
+	t.Helper()
+
+	var echoes []*Echo
+	for i, tr := range transcripts {
+		m, err := signers[i].SignEcho(round, tr.Digest())
+		if err != nil {
+			t.Fatalf("SignEcho failed: %v", err)
+		}
+		e, err := transmit(t, roster, session, 1, m).Echo()
+		if err != nil {
+			t.Fatalf("Echo failed: %v", err)
+		}
+		echoes = append(echoes, e)
+	}
+
+	disagree := make([][]uint16, len(transcripts))
+	for i, tr := range transcripts {
+		disagree[i] = tr.CheckEchoes(echoes)
+	}
+	return disagree
+}
+
+// exchangeTranscripts broadcasts every participant's copy of a round and
+// merges it into the others' transcripts
+func exchangeTranscripts(t *testing.T, roster *Roster, session SessionID, signers []*Signer, transcripts []*Transcript, round Round) {
+	t.Helper()
+
+	var copies [][]*Message
+	for i, tr := range transcripts {
+		m, err := signers[i].SignTranscript(tr, round)
+		if err != nil {
+			t.Fatalf("SignTranscript failed: %v", err)
+		}
+		got, messages, err := transmit(t, roster, session, 1, m).Transcript()
+		if err != nil || got != round {
+			t.Fatalf("Transcript failed: %v", err)
+		}
+		copies = append(copies, messages)
+	}
+	for _, tr := range transcripts {
+		for _, messages := range copies {
+			tr.Merge(messages)
+		}
+	}
+}
+
+// TestEquivocatingDealer tests that a dealer sending different commitments
+// to different peers is detected and disqualified with evidence
+func TestEquivocatingDealer(t *testing.T) {
+	const n, threshold = 4, 2
+	keys, _, roster := newTestRoster(t, n)
+	session, _ := NewSessionID()
+
+	participants := make([]*Participant, n)
+	signers := make([]*Signer, n)
+	transcripts := make([]*Transcript, n)
+	deals := make([]*Message, n)
+	for i := range participants {
+		participants[i], _ = NewParticipant(n, threshold, uint16(i+1))
+		signers[i], _ = NewSigner(session, uint16(i+1), keys[i])
+		transcripts[i] = NewTranscript(session, roster)
+		deal, _, _ := participants[i].Deal()
+		deals[i], _ = signers[i].SignDeal(deal)
+	}
+
+	// Step 1: Dealer 1 sends participant 4 different commitments
+	twin, _ := NewParticipant(n, threshold, 1)
+	other, _, _ := twin.Deal()
+	forked, _ := signers[0].SignDeal(other)
+	for i, tr := range transcripts {
+		for j, m := range deals {
+			if i == 3 && j == 0 {
+				m = forked
+			}
+			if _, err := tr.Add(transmit(t, roster, session, uint16(i+1), m)); err != nil {
+				t.Fatalf("Add failed: %v", err)
+			}
+		}
+	}
+
+	// Step 2: The echoes disagree
+	disagree := echoRound(t, roster, session, signers, transcripts, RoundDeal)
+	if len(disagree[1]) != 1 || disagree[1][0] != 4 {
+		t.Errorf("Participant 2 disagrees with %v, want [4]", disagree[1])
+	}
+
+	// Step 3: Exchanging copies yields evidence against dealer 1 everywhere
+	exchangeTranscripts(t, roster, session, signers, transcripts, RoundDeal)
+	for i, tr := range transcripts {
+		equivocators := tr.Equivocators()
+		if len(equivocators) != 1 || equivocators[0] != 1 {
+			t.Fatalf("Participant %d: equivocators = %v, want [1]", i+1, equivocators)
+		}
+	}
+
+	// Step 4: The evidence can be published and checked by anyone
+	data, err := transcripts[2].Equivocations()[0].MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	var evidence Equivocation
+	if err := evidence.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if err := evidence.Verify(session, roster); err != nil {
+		t.Errorf("Verify rejected the evidence: %v", err)
+	}
+	if evidence.Sender() != 1 {
+		t.Errorf("Evidence names participant %d, want 1", evidence.Sender())
+	}
+
+	// Step 5: Honest participants leave the dealer's Deal out and
+	// disqualify it
+	for _, p := range participants[1:] {
+		var kept []*Deal
+		for _, m := range deals[1:] {
+			d, _ := m.Deal()
+			kept = append(kept, d)
+		}
+		if _, err := p.Verify(kept, nil); err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if got := p.Disqualified(); len(got) != 1 || got[0] != 1 {
+			t.Errorf("Participant %d disqualified %v, want [1]", p.Index(), got)
+		}
+	}
+}
+
+// TestTranscriptOmission tests that a missing message shows up in the echoes
+// and is repaired by the exchange without blaming anyone
+func TestTranscriptOmission(t *testing.T) {
+	const n = 3
+	keys, _, roster := newTestRoster(t, n)
+	session, _ := NewSessionID()
+
+	signers := make([]*Signer, n)
+	transcripts := make([]*Transcript, n)
+	var complaints []*Message
+	for i := range signers {
+		signers[i], _ = NewSigner(session, uint16(i+1), keys[i])
+		transcripts[i] = NewTranscript(session, roster)
+		m, _ := signers[i].SignComplaints(nil)
+		complaints = append(complaints, m)
+	}
+
+	// Participant 3 does not receive the complaints of participant 2, and
+	// receives the others in a different order
+	for i, tr := range transcripts {
+		for k := range complaints {
+			j := k
+			if i == 2 {
+				j = n - 1 - k
+			}
+			if i == 2 && j == 1 {
+				continue
+			}
+			tr.Add(complaints[j])
+		}
+	}
+
+	if disagree := echoRound(t, roster, session, signers, transcripts, RoundComplaint); len(disagree[0]) != 1 || disagree[0][0] != 3 {
+		t.Errorf("Participant 1 disagrees with %v, want [3]", disagree[0])
+	}
+
+	exchangeTranscripts(t, roster, session, signers, transcripts, RoundComplaint)
+	for i, disagree := range echoRound(t, roster, session, signers, transcripts, RoundComplaint) {
+		if len(disagree) != 0 {
+			t.Errorf("Participant %d still disagrees with %v", i+1, disagree)
+		}
+		if len(transcripts[i].Equivocators()) != 0 {
+			t.Errorf("Participant %d blamed %v for an omission", i+1, transcripts[i].Equivocators())
+		}
+	}
+
+	// A resent identical message is not an equivocation
+	if e, err := transcripts[0].Add(complaints[1]); e != nil || err != nil {
+		t.Errorf("Add of a duplicate = %v, %v", e, err)
+	}
+}
+
+// TestTranscriptAdd tests which messages are recorded
+func TestTranscriptAdd(t *testing.T) {
+	keys, boxKeys, roster := newTestRoster(t, 3)
+	session, _ := NewSessionID()
+	signer, _ := NewSigner(session, 1, keys[0])
+	tr := NewTranscript(session, roster)
+
+	p, _ := NewParticipant(3, 2, 1)
+	_, shares, _ := p.Deal()
+	sealed, _ := SealShare(session, boxKeys[0], roster.EncryptionKey(2), &shares[0])
+	private, _ := signer.SignSealedShare(sealed)
+	if _, err := tr.Add(private); err == nil {
+		t.Error("Add recorded a private message")
+	}
+
+	echo, _ := signer.SignEcho(RoundDeal, tr.Digest())
+	if _, err := tr.Add(echo); err == nil {
+		t.Error("Add recorded an echo")
+	}
+
+	m, _ := signer.SignComplaints(nil)
+	m.Signature[0] ^= 1
+	if _, err := tr.Add(m); err == nil {
+		t.Error("Add recorded a message with an invalid signature")
+	}
+
+	fake := &Equivocation{First: m, Second: m}
+	if err := fake.Verify(session, roster); err == nil {
+		t.Error("Verify accepted invalid evidence")
+	}
+}
@@ -0,0 +1,191 @@
+package dkg
+
+// Threshold key update
+//
+// A key update rotates the group key from k to k' = delta * k and publishes
+// delta as a toprf.UpdateToken, so stored OPRF results can be upgraded by
+// clients (see toprf/update.go). This corresponds to liboprf's toprf-update
+// flow.
+//
+// delta must be unpredictable and unbiased, so it is generated jointly: every
+// participant deals a random polynomial exactly like Start, and once the
+// shares are verified each participant opens its combined share of delta.
+// The openings are checked against the Feldman commitments of delta, so any
+// threshold honest participants determine it and nobody can bias it.
+//
+// Each participant then computes its new share as delta * k_i plus a refresh
+// share of zero (see refresh.go), dealt in the same round. The zero sharing
+// re-randomizes the shares, so old shares scaled by the public delta do not
+// give new shares and shares of different epochs cannot be combined.
+
+import (
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// UpdateDeal is one participant's contribution to a key update.
+//
+// The commitments are broadcast to all participants, and share j-1 of each
+// kind is sent privately to participant j.
+type UpdateDeal struct {
+	// DeltaCommitments and DeltaShares share a random contribution to delta.
+	DeltaCommitments []*ristretto255.Element
+	DeltaShares      []toprf.Share
+
+	// ZeroCommitments and ZeroShares share zero for the new epoch.
+	ZeroCommitments []*ristretto255.Element
+	ZeroShares      []EpochShare
+}
+
+// UpdateStart deals one participant's contribution to a key update.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold of the key being updated
+//   - epoch: the epoch of the updated shares (current epoch + 1)
+func UpdateStart(n, threshold uint8, epoch uint32) (*UpdateDeal, error) {
+	deltaCommitments, deltaShares, err := Start(n, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	zeroCommitments, zeroShares, err := RefreshStart(n, threshold, epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpdateDeal{
+		DeltaCommitments: deltaCommitments,
+		DeltaShares:      deltaShares,
+		ZeroCommitments:  zeroCommitments,
+		ZeroShares:       zeroShares,
+	}, nil
+}
+
+// VerifyUpdateDeals verifies the update shares received from all peers.
+//
+// Parameters:
+//   - n: number of participants
+//   - threshold: the threshold parameter
+//   - self: index of current participant (1-based)
+//   - epoch: the epoch being updated to
+//   - deltaCommitments, deltaShares: the delta commitments and shares from all n peers
+//   - zeroCommitments, zeroShares: the refresh commitments and shares from all n peers
+//
+// Returns list of peer indices that failed either verification.
+func VerifyUpdateDeals(n, threshold, self uint8, epoch uint32,
+	deltaCommitments [][]*ristretto255.Element, deltaShares []toprf.Share,
+	zeroCommitments [][]*ristretto255.Element, zeroShares []EpochShare,
+) ([]uint8, error) {
+	if len(deltaCommitments) != int(n) || len(deltaShares) != int(n) {
+		return nil, errors.New("dkg: expected commitments and shares from all participants")
+	}
+
+	deltaFails, err := VerifyCommitments(n, threshold, self, deltaCommitments, deltaShares)
+	if err != nil {
+		return nil, err
+	}
+	zeroFails, err := VerifyRefreshCommitments(n, threshold, self, epoch, zeroCommitments, zeroShares)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed [256]bool
+	for _, i := range deltaFails {
+		failed[i] = true
+	}
+	for _, i := range zeroFails {
+		failed[i] = true
+	}
+
+	var fails []uint8
+	for i := uint8(1); i <= n; i++ {
+		if failed[i] {
+			fails = append(fails, i)
+		}
+	}
+
+	return fails, nil
+}
+
+// OpenUpdateToken reconstructs the update token from the participants'
+// opened shares of delta.
+// Each participant opens the share returned by Finish over the delta shares it
+// received. Openings that do not match the delta commitments are ignored, so
+// any threshold honest openings suffice.
+//
+// Parameters:
+//   - threshold: the threshold parameter
+//   - deltaCommitments: the delta commitments from all dealers
+//   - openings: the opened delta shares
+//
+// Returns the update token and the list of participants whose opening was invalid.
+func OpenUpdateToken(threshold uint8, deltaCommitments [][]*ristretto255.Element, openings []toprf.Share) (*toprf.UpdateToken, []uint8, error) {
+	group, err := SumCommitments(deltaCommitments)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(group) != int(threshold) {
+		return nil, nil, errors.New("dkg: wrong number of commitments")
+	}
+
+	var valid []toprf.Share
+	var fails []uint8
+	var seen [256]bool
+	for _, opening := range openings {
+		if opening.Index == 0 || seen[opening.Index] || opening.Value == nil ||
+			VerifyCommitment(0, threshold, opening.Index, 0, group, opening) != nil {
+			fails = append(fails, opening.Index)
+			continue
+		}
+		seen[opening.Index] = true
+		valid = append(valid, opening)
+	}
+
+	if len(valid) < int(threshold) {
+		return nil, fails, errors.New("dkg: not enough valid openings")
+	}
+
+	delta, err := Reconstruct(valid[:threshold])
+	if err != nil {
+		return nil, fails, err
+	}
+	if delta.Equal(ristretto255.NewScalar()) == 1 {
+		return nil, fails, errors.New("dkg: update token is zero")
+	}
+
+	return &toprf.UpdateToken{Delta: delta}, fails, nil
+}
+
+// FinishUpdate computes a participant's share of the rotated key,
+// delta * current plus the verified refresh shares for the next epoch.
+func FinishUpdate(current EpochShare, token *toprf.UpdateToken, zeroShares []EpochShare) (EpochShare, error) {
+	if token == nil || token.Delta == nil {
+		return EpochShare{}, errors.New("dkg: update token is nil")
+	}
+	if current.Share.Value == nil {
+		return EpochShare{}, errors.New("dkg: share value is nil")
+	}
+
+	scaled := current
+	scaled.Share.Value = ristretto255.NewScalar().Multiply(token.Delta, current.Share.Value)
+
+	return FinishRefresh(scaled, zeroShares)
+}
+
+// UpdateGroupCommitments computes the group commitments of the rotated key:
+// delta times the old commitments plus the refresh commitments of all dealers.
+func UpdateGroupCommitments(oldCommitments []*ristretto255.Element, token *toprf.UpdateToken, zeroCommitments [][]*ristretto255.Element) ([]*ristretto255.Element, error) {
+	if token == nil || token.Delta == nil {
+		return nil, errors.New("dkg: update token is nil")
+	}
+
+	scaled := make([]*ristretto255.Element, len(oldCommitments))
+	for k := range oldCommitments {
+		scaled[k] = ristretto255.NewElement().ScalarMult(token.Delta, oldCommitments[k])
+	}
+
+	return SumCommitments(append([][]*ristretto255.Element{scaled}, zeroCommitments...))
+}
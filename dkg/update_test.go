@@ -0,0 +1,137 @@
+package dkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// TestUpdate rotates a 3-of-5 key and upgrades a stored OPRF result
+func TestUpdate(t *testing.T) {
+	const n = 5
+	const threshold = 3
+
+	commitments, shares := dealDKG(t, n, threshold)
+	group, _ := SumCommitments(commitments)
+
+	// Client evaluates and stores the unblinded element under the old key
+	input := []byte("updatable input")
+	oldN := thresholdOPRF(t, input, shares[:threshold])
+
+	// Round 1: every participant deals
+	deals := make([]*UpdateDeal, n)
+	for i := range deals {
+		var err error
+		deals[i], err = UpdateStart(n, threshold, 1)
+		if err != nil {
+			t.Fatalf("Participant %d: UpdateStart failed: %v", i+1, err)
+		}
+	}
+
+	deltaCommitments := make([][]*ristretto255.Element, n)
+	zeroCommitments := make([][]*ristretto255.Element, n)
+	for i := range deals {
+		deltaCommitments[i] = deals[i].DeltaCommitments
+		zeroCommitments[i] = deals[i].ZeroCommitments
+	}
+
+	// Round 2: verify and open delta shares
+	openings := make([]toprf.Share, n)
+	received := make([][]EpochShare, n)
+	for i := uint8(0); i < n; i++ {
+		deltaShares := make([]toprf.Share, n)
+		received[i] = make([]EpochShare, n)
+		for j := range deals {
+			deltaShares[j] = deals[j].DeltaShares[i]
+			received[i][j] = deals[j].ZeroShares[i]
+		}
+
+		fails, err := VerifyUpdateDeals(n, threshold, i+1, 1, deltaCommitments, deltaShares, zeroCommitments, received[i])
+		if err != nil {
+			t.Fatalf("Participant %d: VerifyUpdateDeals failed: %v", i+1, err)
+		}
+		if len(fails) > 0 {
+			t.Fatalf("Participant %d: verification failed for %v", i+1, fails)
+		}
+
+		openings[i], err = Finish(deltaShares, i+1)
+		if err != nil {
+			t.Fatalf("Participant %d: Finish failed: %v", i+1, err)
+		}
+	}
+
+	// Participant 2 opens a wrong share, which is ignored
+	openings[1].Value = scalarFromUint8(3)
+
+	token, badOpenings, err := OpenUpdateToken(threshold, deltaCommitments, openings)
+	if err != nil {
+		t.Fatalf("OpenUpdateToken failed: %v", err)
+	}
+	if len(badOpenings) != 1 || badOpenings[0] != 2 {
+		t.Errorf("Expected participant 2's opening to be rejected, got %v", badOpenings)
+	}
+
+	// Round 3: compute the rotated shares
+	updated := make([]toprf.Share, n)
+	for i := range shares {
+		next, err := FinishUpdate(EpochShare{Share: shares[i]}, token, received[i])
+		if err != nil {
+			t.Fatalf("Participant %d: FinishUpdate failed: %v", i+1, err)
+		}
+		if next.Epoch != 1 {
+			t.Errorf("Participant %d: expected epoch 1, got %d", i+1, next.Epoch)
+		}
+		updated[i] = next.Share
+	}
+
+	newGroup, err := UpdateGroupCommitments(group, token, zeroCommitments)
+	if err != nil {
+		t.Fatalf("UpdateGroupCommitments failed: %v", err)
+	}
+	for i := range updated {
+		if err := VerifyCommitment(n, threshold, uint8(i+1), 0, newGroup, updated[i]); err != nil {
+			t.Errorf("Participant %d: rotated share does not match group commitments: %v", i+1, err)
+		}
+	}
+
+	// The stored element upgraded with the token matches a fresh evaluation
+	newN := thresholdOPRF(t, input, []toprf.Share{updated[4], updated[0], updated[2]})
+	if bytes.Equal(oldN, newN) {
+		t.Error("Key update did not change the OPRF output")
+	}
+
+	upgraded, err := token.Apply(oldN)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !bytes.Equal(upgraded, newN) {
+		t.Error("Upgraded element differs from evaluation under the new key")
+	}
+
+	oldOutput, _ := oprf.Finalize(input, upgraded)
+	newOutput, _ := oprf.Finalize(input, newN)
+	if !bytes.Equal(oldOutput, newOutput) {
+		t.Error("Upgraded output differs from output under the new key")
+	}
+}
+
+// TestOpenUpdateTokenInsufficient verifies that too few valid openings fail
+func TestOpenUpdateTokenInsufficient(t *testing.T) {
+	const n = 3
+	const threshold = 2
+
+	deltaCommitments, finalShares := dealDKG(t, n, threshold)
+
+	// Only one opening, and a duplicate of it
+	openings := []toprf.Share{finalShares[0], finalShares[0]}
+	_, fails, err := OpenUpdateToken(threshold, deltaCommitments, openings)
+	if err == nil {
+		t.Error("OpenUpdateToken accepted fewer than threshold openings")
+	}
+	if len(fails) != 1 {
+		t.Errorf("Expected the duplicate opening to be rejected, got %v", fails)
+	}
+}
@@ -10,10 +10,8 @@ package dkg
 
 import (
 	"crypto/rand"
-	"crypto/subtle"
 	"errors"
 	"io"
-	"sort"
 
 	"github.com/gtank/ristretto255"
 	"github.com/wurp/go-oprf/toprf"
@@ -82,63 +80,14 @@ func Share(n, threshold uint8, secret *ristretto255.Scalar) (
 	blind *ristretto255.Scalar,
 	err error,
 ) {
-	if threshold == 0 {
-		return nil, nil, nil, errors.New("threshold must be > 0")
-	}
-
-	// Generate random polynomial coefficients for secret and blinding
-	a := make([]*ristretto255.Scalar, threshold)
-	b := make([]*ristretto255.Scalar, threshold)
-
-	// a[0] is the secret (or random if secret is nil)
-	if secret != nil {
-		a[0] = ristretto255.NewScalar()
-		a[0].Decode(secret.Encode(nil))
-	} else {
-		var err error
-		a[0], err = randomScalar()
-		if err != nil {
-			return nil, nil, nil, err
-		}
-	}
-
-	// Generate remaining coefficients for both polynomials
-	for k := uint8(1); k < threshold; k++ {
-		var err error
-		a[k], err = randomScalar()
-		if err != nil {
-			return nil, nil, nil, err
-		}
-	}
-	for k := uint8(0); k < threshold; k++ {
-		var err error
-		b[k], err = randomScalar()
-		if err != nil {
-			return nil, nil, nil, err
-		}
+	commitments, wide, blind, err := Share16(uint16(n), uint16(threshold), secret)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	// Blinding factor is b[0]
-	blind = ristretto255.NewScalar()
-	blind.Decode(b[0].Encode(nil))
-
-	// Create shares and commitments for each participant
-	commitments = make([]*ristretto255.Element, n)
 	shares = make([][2]toprf.Share, n)
-
-	for j := uint8(1); j <= n; j++ {
-		// f(j) = a[0] + a[1]*j + a[2]*j^2 + ... + a[threshold-1]*j^(threshold-1)
-		shares[j-1][0] = polynom(j, threshold, a)
-
-		// f'(j) = b[0] + b[1]*j + b[2]*j^2 + ... + b[threshold-1]*j^(threshold-1)
-		shares[j-1][1] = polynom(j, threshold, b)
-
-		// Commitment to this share
-		c, err := Commit(shares[j-1][0].Value, shares[j-1][1].Value)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		commitments[j-1] = c
+	for j := range wide {
+		shares[j] = narrowPair(wide[j])
 	}
 
 	return commitments, shares, blind, nil
@@ -148,20 +97,7 @@ func Share(n, threshold uint8, secret *ristretto255.Scalar) (
 //
 // Corresponds to dkg_vss_verify_commitment() in dkg-vss.c:70-76
 func VerifyShareCommitment(commitment *ristretto255.Element, share [2]toprf.Share) error {
-	// Recompute commitment from share
-	c, err := Commit(share[0].Value, share[1].Value)
-	if err != nil {
-		return err
-	}
-
-	// Compare commitments
-	cBytes := c.Encode(nil)
-	commitmentBytes := commitment.Encode(nil)
-	if subtle.ConstantTimeCompare(cBytes, commitmentBytes) != 1 {
-		return errors.New("commitment verification failed")
-	}
-
-	return nil
+	return VerifyShareCommitment16(commitment, widenPair(share))
 }
 
 // CombineShares combines shares from qualified participants to compute the final
@@ -182,43 +118,20 @@ func CombineShares(qual []uint8, shares [][2]toprf.Share, self uint8) (
 	commitment *ristretto255.Element,
 	err error,
 ) {
-	// Initialize final share to zero
-	share0 := ristretto255.NewScalar()
-	share1 := ristretto255.NewScalar()
-
-	// Sum shares from qualified participants
-	for _, qualIndex := range qual {
-		if qualIndex == 0 {
-			break // 0-terminated list
-		}
-		if qualIndex < 1 || int(qualIndex) > len(shares) {
-			return finalShare, nil, errors.New("invalid qualified index")
-		}
-
-		idx := qualIndex - 1
-		// Check that share has correct index
-		if shares[idx][0].Index != self {
-			return finalShare, nil, errors.New("share has incorrect index")
-		}
-
-		// Add to running sum
-		share0.Add(share0, shares[idx][0].Value)
-		share1.Add(share1, shares[idx][1].Value)
+	wideQual := make([]uint16, len(qual))
+	for i, index := range qual {
+		wideQual[i] = uint16(index)
+	}
+	wide := make([][2]toprf.Share16, len(shares))
+	for i := range shares {
+		wide[i] = widenPair(shares[i])
 	}
 
-	// Store final shares
-	finalShare[0].Index = self
-	finalShare[0].Value = share0
-	finalShare[1].Index = self
-	finalShare[1].Value = share1
-
-	// Compute commitment
-	commitment, err = Commit(share0, share1)
+	pair, commitment, err := CombineShares16(wideQual, wide, uint16(self))
 	if err != nil {
 		return finalShare, nil, err
 	}
-
-	return finalShare, commitment, nil
+	return narrowPair(pair), commitment, nil
 }
 
 // ReconstructSecret recovers the secret from a set of VSS share pairs.
@@ -238,62 +151,15 @@ func ReconstructSecret(t uint8, x uint8, shares [][2]toprf.Share, commitments []
 	result, blind *ristretto255.Scalar,
 	err error,
 ) {
-	if len(shares) > 128 {
+	if len(shares) > 255 {
 		return nil, nil, errors.New("too many shares")
 	}
 
-	// Collect valid shares
-	type validShare struct {
-		share [2]toprf.Share
-		index int
-	}
-	var valid []validShare
-
-	for i, share := range shares {
-		// Verify commitment if provided
-		if commitments != nil && i < len(commitments) {
-			if err := VerifyShareCommitment(commitments[i], share); err != nil {
-				continue // Skip invalid shares
-			}
-		}
-		valid = append(valid, validShare{share: share, index: i})
-		if len(valid) >= int(t) {
-			break
-		}
-	}
-
-	if len(valid) < int(t) {
-		return nil, nil, errors.New("insufficient valid shares")
-	}
-
-	// Sort by share index
-	sort.Slice(valid, func(i, j int) bool {
-		return valid[i].share[0].Index < valid[j].share[0].Index
-	})
-
-	// Extract first t shares for interpolation
-	secretShares := make([]toprf.Share, t)
-	blindingShares := make([]toprf.Share, t)
-	for i := uint8(0); i < t; i++ {
-		secretShares[i] = valid[i].share[0]
-		blindingShares[i] = valid[i].share[1]
+	wide := make([][2]toprf.Share16, len(shares))
+	for i := range shares {
+		wide[i] = widenPair(shares[i])
 	}
-
-	// Interpolate to recover value at x
-	result, err = toprf.InterpolateScalar(x, secretShares)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// Also interpolate blinding if needed
-	if commitments != nil {
-		blind, err = toprf.InterpolateScalar(x, blindingShares)
-		if err != nil {
-			return nil, nil, err
-		}
-	}
-
-	return result, blind, nil
+	return ReconstructSecret16(uint16(t), uint16(x), wide, commitments)
 }
 
 // randomScalar generates a cryptographically secure random scalar.
@@ -305,41 +171,40 @@ func randomScalar() (*ristretto255.Scalar, error) {
 	return ristretto255.NewScalar().FromUniformBytes(buf[:]), nil
 }
 
+// randomPolynomial returns threshold coefficients of a random polynomial whose
+// constant term is a copy of constant.
+func randomPolynomial(constant *ristretto255.Scalar, threshold uint16) ([]*ristretto255.Scalar, error) {
+	a := make([]*ristretto255.Scalar, threshold)
+	a[0] = ristretto255.NewScalar().Set(constant)
+	for k := 1; k < int(threshold); k++ {
+		var err error
+		a[k], err = randomScalar()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// commitPolynomial computes Feldman commitments C_k = g^a_k to the
+// coefficients of a polynomial.
+func commitPolynomial(a []*ristretto255.Scalar) []*ristretto255.Element {
+	commitments := make([]*ristretto255.Element, len(a))
+	for k := range a {
+		commitments[k] = ristretto255.NewElement().ScalarBaseMult(a[k])
+	}
+	return commitments
+}
+
 // polynom evaluates a polynomial at point j.
 // f(j) = a[0] + a[1]*j + a[2]*j^2 + ... + a[threshold-1]*j^(threshold-1)
 //
 // This is a helper function used by Share().
 // Corresponds to polynom() in dkg.c:45-68
 func polynom(j uint8, threshold uint8, a []*ristretto255.Scalar) toprf.Share {
-	// Start with a[0]
-	value := ristretto255.NewScalar()
-	value.Decode(a[0].Encode(nil))
-
-	// z = j (as scalar)
-	z := ristretto255.NewScalar()
-	zBytes := [32]byte{j}
-	z.Decode(zBytes[:])
-
-	// Add terms a[t] * z^t for t=1..threshold-1
-	for t := uint8(1); t < threshold; t++ {
-		// Compute z^t
-		tmp := ristretto255.NewScalar()
-		tmp.Decode([]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-			0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}) // = 1
-
-		for exp := uint8(1); exp <= t; exp++ {
-			tmp.Multiply(tmp, z)
-		}
-
-		// tmp = a[t] * z^t
-		tmp.Multiply(a[t], tmp)
-
-		// Add to result
-		value.Add(value, tmp)
-	}
-
+	share := polynom16(uint16(j), a[:threshold])
 	return toprf.Share{
 		Index: j,
-		Value: value,
+		Value: share.Value,
 	}
 }
@@ -0,0 +1,117 @@
+package dkg
+
+// Weighted DKG
+//
+// The weighted variant of the DKG generates a key for a toprf.WeightedScheme
+// without a dealer. Every operator acts as one DKG participant: it deals a
+// polynomial of degree threshold-1 over all TotalWeight indexes and sends
+// each operator the shares for that operator's block of indexes. Operators
+// verify every share of the block against the dealer's commitments and sum
+// the blocks of all dealers index by index. The result is a
+// toprf.WeightedShare for use with toprf.EvaluateWeighted.
+
+import (
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// StartWeighted initializes the weighted DKG for one operator.
+//
+// Returns:
+//   - commitments: threshold commitments to polynomial coefficients (broadcast to all)
+//   - shares: one WeightedShare per operator (send privately)
+func StartWeighted(scheme *toprf.WeightedScheme) (
+	commitments []*ristretto255.Element,
+	shares []toprf.WeightedShare,
+	err error,
+) {
+	commitments, all, err := Start16(scheme.TotalWeight(), scheme.Threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shares, err = toprf.GroupWeightedShares(scheme, all)
+	if err != nil {
+		return nil, nil, err
+	}
+	return commitments, shares, nil
+}
+
+// VerifyWeightedCommitment verifies the block of shares that operator self
+// received from dealer against the dealer's commitments.
+func VerifyWeightedCommitment(scheme *toprf.WeightedScheme, self, dealer uint16, commitments []*ristretto255.Element, share toprf.WeightedShare) error {
+	if dealer == self {
+		return nil // Don't verify our own shares
+	}
+	if share.Operator != self {
+		return errors.New("dkg: share has incorrect operator")
+	}
+
+	indexes, err := scheme.Indexes(self)
+	if err != nil {
+		return err
+	}
+	if len(share.Shares) != len(indexes) {
+		return errors.New("dkg: wrong number of shares for operator weight")
+	}
+
+	for k, index := range indexes {
+		if share.Shares[k].Index != index {
+			return errors.New("dkg: share has incorrect index")
+		}
+		// Pass peer index 0 so the check is never skipped
+		if err := VerifyCommitment16(scheme.TotalWeight(), scheme.Threshold, index, 0, commitments, share.Shares[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifyWeightedCommitments verifies the shares from all operators.
+//
+// Returns list of dealers that failed verification.
+func VerifyWeightedCommitments(scheme *toprf.WeightedScheme, self uint16, commitments [][]*ristretto255.Element, shares []toprf.WeightedShare) ([]uint16, error) {
+	n := len(scheme.Weights)
+	if len(commitments) != n || len(shares) != n {
+		return nil, errors.New("dkg: expected commitments and shares from all operators")
+	}
+
+	var fails []uint16
+	for i := 1; i <= n; i++ {
+		if err := VerifyWeightedCommitment(scheme, self, uint16(i), commitments[i-1], shares[i-1]); err != nil {
+			fails = append(fails, uint16(i))
+		}
+	}
+
+	return fails, nil
+}
+
+// FinishWeighted combines the blocks received from all dealers into the
+// operator's final WeightedShare.
+func FinishWeighted(scheme *toprf.WeightedScheme, self uint16, shares []toprf.WeightedShare) (toprf.WeightedShare, error) {
+	indexes, err := scheme.Indexes(self)
+	if err != nil {
+		return toprf.WeightedShare{}, err
+	}
+
+	result := toprf.WeightedShare{Operator: self, Shares: make([]toprf.Share16, len(indexes))}
+	for k, index := range indexes {
+		received := make([]toprf.Share16, len(shares))
+		for i := range shares {
+			if shares[i].Operator != self || len(shares[i].Shares) != len(indexes) {
+				return toprf.WeightedShare{}, errors.New("dkg: share has incorrect operator")
+			}
+			received[i] = shares[i].Shares[k]
+		}
+
+		result.Shares[k], err = Finish16(received, index)
+		if err != nil {
+			return toprf.WeightedShare{}, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package dkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// TestWeightedDKG runs a weighted DKG and evaluates with the result
+func TestWeightedDKG(t *testing.T) {
+	scheme, err := toprf.NewWeightedScheme([]uint16{2, 1, 1, 3}, 4)
+	if err != nil {
+		t.Fatalf("NewWeightedScheme failed: %v", err)
+	}
+	n := len(scheme.Weights)
+
+	// Step 1: Every operator deals
+	commitments := make([][]*ristretto255.Element, n)
+	allShares := make([][]toprf.WeightedShare, n)
+	for i := 0; i < n; i++ {
+		commitments[i], allShares[i], err = StartWeighted(scheme)
+		if err != nil {
+			t.Fatalf("Operator %d: StartWeighted failed: %v", i+1, err)
+		}
+	}
+
+	// Step 2: Every operator verifies and combines its blocks
+	finalShares := make([]toprf.WeightedShare, n)
+	for i := 0; i < n; i++ {
+		self := uint16(i + 1)
+		received := make([]toprf.WeightedShare, n)
+		for j := 0; j < n; j++ {
+			received[j] = allShares[j][i]
+		}
+
+		fails, err := VerifyWeightedCommitments(scheme, self, commitments, received)
+		if err != nil || len(fails) > 0 {
+			t.Fatalf("Operator %d: verification failed for %v: %v", self, fails, err)
+		}
+
+		finalShares[i], err = FinishWeighted(scheme, self, received)
+		if err != nil {
+			t.Fatalf("Operator %d: FinishWeighted failed: %v", self, err)
+		}
+	}
+
+	// Step 3: Operators 1 and 3 have weight 3 < 4; adding operator 2 suffices
+	group, _ := SumCommitments(commitments)
+	peers, err := scheme.Peers([]uint16{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Peers failed: %v", err)
+	}
+
+	input := []byte("weighted dkg")
+	r, alpha, _ := oprf.Blind(input, nil)
+	var parts [][]byte
+	for _, o := range []uint16{1, 2, 3} {
+		part, err := toprf.EvaluateWeighted(finalShares[o-1], alpha, peers)
+		if err != nil {
+			t.Fatalf("Operator %d: EvaluateWeighted failed: %v", o, err)
+		}
+		parts = append(parts, part)
+	}
+	beta, _ := toprf.ThresholdCombine16(parts)
+
+	// The output must match a non-threshold evaluation with the group secret
+	var all []toprf.Share16
+	for _, share := range finalShares {
+		all = append(all, share.Shares...)
+	}
+	secret, _ := Reconstruct16(all[:scheme.Threshold])
+	if group[0].Equal(ristretto255.NewElement().ScalarBaseMult(secret)) != 1 {
+		t.Fatal("Reconstructed secret does not match the group public key")
+	}
+	expectedBeta, _ := oprf.Evaluate(secret.Encode(nil), alpha)
+	got, _ := oprf.Unblind(r, beta)
+	expected, _ := oprf.Unblind(r, expectedBeta)
+	if !bytes.Equal(got, expected) {
+		t.Error("Weighted DKG output differs from non-threshold output")
+	}
+}
+
+// TestWeightedDKGRejectsBadBlock tests detection of an inconsistent block
+func TestWeightedDKGRejectsBadBlock(t *testing.T) {
+	scheme, _ := toprf.NewWeightedScheme([]uint16{2, 2}, 3)
+	commitments, shares, err := StartWeighted(scheme)
+	if err != nil {
+		t.Fatalf("StartWeighted failed: %v", err)
+	}
+
+	if err := VerifyWeightedCommitment(scheme, 2, 1, commitments, shares[1]); err != nil {
+		t.Errorf("Valid block rejected: %v", err)
+	}
+
+	// Swap the two shares of the block
+	bad := toprf.WeightedShare{Operator: 2, Shares: []toprf.Share16{
+		{Index: 3, Value: shares[1].Shares[1].Value},
+		{Index: 4, Value: shares[1].Shares[0].Value},
+	}}
+	if err := VerifyWeightedCommitment(scheme, 2, 1, commitments, bad); err == nil {
+		t.Error("VerifyWeightedCommitment accepted swapped shares")
+	}
+
+	// The block of another operator
+	if err := VerifyWeightedCommitment(scheme, 2, 1, commitments, shares[0]); err == nil {
+		t.Error("VerifyWeightedCommitment accepted another operator's block")
+	}
+}
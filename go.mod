@@ -2,9 +2,12 @@ module github.com/wurp/go-oprf
 
 go 1.24.5
 
+require (
+	github.com/gtank/ristretto255 v0.2.0
+	golang.org/x/crypto v0.43.0
+)
+
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/gtank/ristretto255 v0.2.0 // indirect
-	golang.org/x/crypto v0.43.0 // indirect
 	golang.org/x/sys v0.37.0 // indirect
 )
@@ -0,0 +1,358 @@
+// Package simnet provides an in-memory network for testing the distributed
+// protocols of this module under adverse conditions.
+//
+// A Network connects n nodes, numbered 1 to n like DKG participants and
+// share servers. Every node has an Endpoint that sends and receives packets
+// (Send, Broadcast, Receive) or makes request/response calls to a handler on
+// another node (Handle, Call). Each packet is subject to the faults of the
+// network's Config:
+//
+//   - Intercept sees every packet first and returns the packets to deliver
+//     instead: none to drop it, a modified copy to tamper with it, several to
+//     duplicate or misroute it. Tests use it to script malicious nodes and
+//     targeted faults.
+//   - Drop and Duplicate lose or repeat packets at random.
+//   - MinDelay and MaxDelay delay every packet by a random duration, so
+//     packets overtake each other (reordering).
+//
+// The random faults are drawn from a generator seeded with Config.Seed, so a
+// failing test can be repeated; the delivery order still depends on the
+// scheduler when packets have delays.
+package simnet
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by endpoints of a closed Network.
+var ErrClosed = errors.New("simnet: network closed")
+
+// Packet is a message in flight between two nodes.
+type Packet struct {
+	From uint16
+	To   uint16
+	Data []byte
+}
+
+// Config configures the faults of a Network.
+//
+//   - Seed: seed of the random faults
+//   - MinDelay, MaxDelay: range of the random delay of every packet (both 0
+//     delivers immediately, in order)
+//   - Drop: probability that a packet is lost
+//   - Duplicate: probability that a packet is delivered twice
+//   - Intercept: called for every packet before the random faults, one
+//     packet at a time; returns the packets to deliver in its place (nil
+//     drops it). It must not call into the Network.
+type Config struct {
+	Seed      uint64
+	MinDelay  time.Duration
+	MaxDelay  time.Duration
+	Drop      float64
+	Duplicate float64
+	Intercept func(p Packet) []Packet
+}
+
+// Stats counts the packets handled by a Network.
+type Stats struct {
+	Sent       int
+	Delivered  int
+	Dropped    int
+	Duplicated int
+}
+
+// Network is an in-memory network of n nodes.
+type Network struct {
+	config Config
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	nodes  []*Endpoint
+	stats  Stats
+	nextID uint64
+}
+
+// Endpoint is a node's connection to the Network.
+type Endpoint struct {
+	net   *Network
+	index uint16
+
+	mu      sync.Mutex
+	inbox   []Packet
+	notify  chan struct{}
+	handler func(ctx context.Context, from uint16, request []byte) ([]byte, error)
+	calls   map[uint64]chan envelope
+}
+
+// packetKind distinguishes datagrams from calls
+type packetKind uint8
+
+const (
+	kindDatagram packetKind = iota
+	kindRequest
+	kindResponse
+	kindError
+)
+
+// envelope is a packet with the routing information of calls
+type envelope struct {
+	Packet
+	kind packetKind
+	id   uint64
+}
+
+// New creates a network of n nodes.
+func New(n uint16, config Config) *Network {
+	ctx, cancel := context.WithCancel(context.Background())
+	net := &Network{
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+		rng:    rand.New(rand.NewPCG(config.Seed, config.Seed^0x5eed)),
+		nodes:  make([]*Endpoint, n),
+	}
+	for i := range net.nodes {
+		net.nodes[i] = &Endpoint{
+			net:    net,
+			index:  uint16(i + 1),
+			notify: make(chan struct{}, 1),
+			calls:  make(map[uint64]chan envelope),
+		}
+	}
+	return net
+}
+
+// Endpoint returns the endpoint of node i (1-based), or nil if there is no
+// such node.
+func (net *Network) Endpoint(i uint16) *Endpoint {
+	if i < 1 || int(i) > len(net.nodes) {
+		return nil
+	}
+	return net.nodes[i-1]
+}
+
+// Stats returns the packet counters so far.
+func (net *Network) Stats() Stats {
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	return net.stats
+}
+
+// Close shuts the network down: packets in flight are discarded and blocked
+// Receive and Call return ErrClosed.
+func (net *Network) Close() {
+	net.cancel()
+}
+
+// send applies the faults to a packet and schedules its delivery
+func (net *Network) send(e envelope) error {
+	if net.ctx.Err() != nil {
+		return ErrClosed
+	}
+	e.Data = append([]byte(nil), e.Data...)
+
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	net.stats.Sent++
+
+	packets := []Packet{e.Packet}
+	if net.config.Intercept != nil {
+		packets = net.config.Intercept(e.Packet)
+		if len(packets) == 0 {
+			net.stats.Dropped++
+		}
+	}
+
+	for _, p := range packets {
+		if net.rng.Float64() < net.config.Drop {
+			net.stats.Dropped++
+			continue
+		}
+		copies := 1
+		if net.rng.Float64() < net.config.Duplicate {
+			net.stats.Duplicated++
+			copies = 2
+		}
+		for range copies {
+			net.schedule(envelope{Packet: p, kind: e.kind, id: e.id}, net.delay())
+		}
+	}
+	return nil
+}
+
+// delay draws the delay of one packet. The caller holds net.mu.
+func (net *Network) delay() time.Duration {
+	spread := net.config.MaxDelay - net.config.MinDelay
+	if spread <= 0 {
+		return net.config.MinDelay
+	}
+	return net.config.MinDelay + time.Duration(net.rng.Int64N(int64(spread)+1))
+}
+
+// schedule delivers a packet after a delay. The caller holds net.mu.
+func (net *Network) schedule(e envelope, delay time.Duration) {
+	if delay <= 0 {
+		net.deliver(e)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		net.mu.Lock()
+		defer net.mu.Unlock()
+		net.deliver(e)
+	})
+}
+
+// deliver hands a packet to its recipient. The caller holds net.mu.
+func (net *Network) deliver(e envelope) {
+	to := net.Endpoint(e.To)
+	if net.ctx.Err() != nil || to == nil {
+		net.stats.Dropped++
+		return
+	}
+	net.stats.Delivered++
+
+	to.mu.Lock()
+	defer to.mu.Unlock()
+	switch e.kind {
+	case kindDatagram:
+		to.inbox = append(to.inbox, e.Packet)
+		select {
+		case to.notify <- struct{}{}:
+		default:
+		}
+	case kindRequest:
+		if to.handler != nil {
+			go to.serve(to.handler, e)
+		}
+	case kindResponse, kindError:
+		if reply, ok := to.calls[e.id]; ok {
+			select {
+			case reply <- e:
+			default:
+			}
+		}
+	}
+}
+
+// Index returns the endpoint's node index.
+func (e *Endpoint) Index() uint16 {
+	return e.index
+}
+
+// Send sends data to node to.
+func (e *Endpoint) Send(ctx context.Context, to uint16, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if to == e.index || e.net.Endpoint(to) == nil {
+		return errors.New("simnet: invalid recipient")
+	}
+	return e.net.send(envelope{Packet: Packet{From: e.index, To: to, Data: data}})
+}
+
+// Broadcast sends data to every other node. Each copy is a separate packet
+// and suffers its own faults.
+func (e *Endpoint) Broadcast(ctx context.Context, data []byte) error {
+	for k := range e.net.nodes {
+		j := uint16(k + 1)
+		if j == e.index {
+			continue
+		}
+		if err := e.Send(ctx, j, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Receive waits for the next packet addressed to the endpoint.
+//
+// Returns:
+//   - The sender and the data of the packet
+//   - Error if the context is done or the network is closed
+func (e *Endpoint) Receive(ctx context.Context) (uint16, []byte, error) {
+	for {
+		e.mu.Lock()
+		if len(e.inbox) > 0 {
+			p := e.inbox[0]
+			e.inbox = e.inbox[1:]
+			e.mu.Unlock()
+			return p.From, p.Data, nil
+		}
+		e.mu.Unlock()
+
+		select {
+		case <-e.notify:
+		case <-ctx.Done():
+			return 0, nil, ctx.Err()
+		case <-e.net.ctx.Done():
+			return 0, nil, ErrClosed
+		}
+	}
+}
+
+// Handle sets the handler answering the calls to the endpoint. Each request
+// is handled in its own goroutine; the handler's error is returned by Call.
+func (e *Endpoint) Handle(handler func(ctx context.Context, from uint16, request []byte) ([]byte, error)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handler = handler
+}
+
+// Call sends a request to the handler of node to and waits for the response.
+// Requests and responses are packets like any other: if either is lost, Call
+// waits until the context is done.
+func (e *Endpoint) Call(ctx context.Context, to uint16, request []byte) ([]byte, error) {
+	if to == e.index || e.net.Endpoint(to) == nil {
+		return nil, errors.New("simnet: invalid recipient")
+	}
+
+	reply := make(chan envelope, 1)
+	e.net.mu.Lock()
+	e.net.nextID++
+	id := e.net.nextID
+	e.net.mu.Unlock()
+
+	e.mu.Lock()
+	e.calls[id] = reply
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.calls, id)
+		e.mu.Unlock()
+	}()
+
+	err := e.net.send(envelope{Packet: Packet{From: e.index, To: to, Data: request}, kind: kindRequest, id: id})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-reply:
+		if r.kind == kindError {
+			return nil, errors.New(string(r.Data))
+		}
+		return r.Data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-e.net.ctx.Done():
+		return nil, ErrClosed
+	}
+}
+
+// serve answers one request
+func (e *Endpoint) serve(handler func(ctx context.Context, from uint16, request []byte) ([]byte, error), request envelope) {
+	response := envelope{Packet: Packet{From: e.index, To: request.From}, kind: kindResponse, id: request.id}
+	data, err := handler(e.net.ctx, request.From, request.Data)
+	if err != nil {
+		response.kind, data = kindError, []byte(err.Error())
+	}
+	response.Data = data
+	e.net.send(response)
+}
@@ -0,0 +1,177 @@
+package simnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// receiveAll collects packets at an endpoint until none arrives for a while
+func receiveAll(t *testing.T, e *Endpoint, wait time.Duration) []Packet {
+	t.Helper()
+
+	var packets []Packet
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+		from, data, err := e.Receive(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return packets
+		}
+		if err != nil {
+			t.Fatalf("Receive failed: %v", err)
+		}
+		packets = append(packets, Packet{From: from, To: e.Index(), Data: data})
+	}
+}
+
+// TestDelivery tests in-order delivery without faults
+func TestDelivery(t *testing.T) {
+	net := New(3, Config{})
+	defer net.Close()
+	ctx := context.Background()
+
+	data := []byte("hello")
+	if err := net.Endpoint(1).Broadcast(ctx, data); err != nil {
+		t.Fatalf("Broadcast failed: %v", err)
+	}
+	data[0] = 'j'
+	if err := net.Endpoint(2).Send(ctx, 3, []byte("second")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	got := receiveAll(t, net.Endpoint(3), 10*time.Millisecond)
+	if len(got) != 2 || got[0].From != 1 || string(got[0].Data) != "hello" || got[1].From != 2 {
+		t.Errorf("Node 3 received %v", got)
+	}
+	if got := receiveAll(t, net.Endpoint(2), 10*time.Millisecond); len(got) != 1 {
+		t.Errorf("Node 2 received %d packets, want 1", len(got))
+	}
+	if got := receiveAll(t, net.Endpoint(1), 10*time.Millisecond); len(got) != 0 {
+		t.Errorf("Node 1 received its own broadcast")
+	}
+
+	if err := net.Endpoint(1).Send(ctx, 1, data); err == nil {
+		t.Error("Send to self succeeded")
+	}
+	if err := net.Endpoint(1).Send(ctx, 4, data); err == nil {
+		t.Error("Send to an unknown node succeeded")
+	}
+	if net.Endpoint(0) != nil || net.Endpoint(4) != nil {
+		t.Error("Endpoint returned a node out of range")
+	}
+}
+
+// TestFaults tests the random and scripted faults
+func TestFaults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("drop and duplicate", func(t *testing.T) {
+		net := New(2, Config{Seed: 1, Drop: 0.3, Duplicate: 0.3})
+		defer net.Close()
+		for range 200 {
+			net.Endpoint(1).Send(ctx, 2, []byte{1})
+		}
+		got := receiveAll(t, net.Endpoint(2), 10*time.Millisecond)
+
+		stats := net.Stats()
+		if stats.Sent != 200 || stats.Dropped == 0 || stats.Duplicated == 0 {
+			t.Errorf("Stats = %+v", stats)
+		}
+		if len(got) != stats.Delivered || stats.Delivered != 200-stats.Dropped+stats.Duplicated {
+			t.Errorf("Received %d packets, stats %+v", len(got), stats)
+		}
+	})
+
+	t.Run("reorder", func(t *testing.T) {
+		net := New(2, Config{Seed: 2, MaxDelay: 5 * time.Millisecond})
+		defer net.Close()
+		for k := range 50 {
+			net.Endpoint(1).Send(ctx, 2, []byte{byte(k)})
+		}
+		got := receiveAll(t, net.Endpoint(2), 50*time.Millisecond)
+		if len(got) != 50 {
+			t.Fatalf("Received %d packets, want 50", len(got))
+		}
+		reordered := false
+		for k := range got {
+			reordered = reordered || got[k].Data[0] != byte(k)
+		}
+		if !reordered {
+			t.Error("Delays did not reorder any packet")
+		}
+	})
+
+	t.Run("intercept", func(t *testing.T) {
+		// Node 1 sends node 3 a different message, and node 2 gets it twice
+		net := New(3, Config{Intercept: func(p Packet) []Packet {
+			switch {
+			case p.From == 1 && p.To == 3:
+				p.Data = []byte("forged")
+			case p.From == 1 && p.To == 2:
+				return []Packet{p, p}
+			}
+			return []Packet{p}
+		}})
+		defer net.Close()
+		net.Endpoint(1).Broadcast(ctx, []byte("original"))
+
+		if got := receiveAll(t, net.Endpoint(2), 10*time.Millisecond); len(got) != 2 {
+			t.Errorf("Node 2 received %d packets, want 2", len(got))
+		}
+		got := receiveAll(t, net.Endpoint(3), 10*time.Millisecond)
+		if len(got) != 1 || !bytes.Equal(got[0].Data, []byte("forged")) {
+			t.Errorf("Node 3 received %v", got)
+		}
+	})
+}
+
+// TestCall tests request/response calls
+func TestCall(t *testing.T) {
+	drop := false
+	net := New(2, Config{Intercept: func(p Packet) []Packet {
+		if drop && p.From == 2 {
+			return nil
+		}
+		return []Packet{p}
+	}})
+	defer net.Close()
+
+	net.Endpoint(2).Handle(func(ctx context.Context, from uint16, request []byte) ([]byte, error) {
+		if len(request) == 0 {
+			return nil, errors.New("empty request")
+		}
+		return append([]byte{byte(from)}, request...), nil
+	})
+
+	ctx := context.Background()
+	response, err := net.Endpoint(1).Call(ctx, 2, []byte("ping"))
+	if err != nil || !bytes.Equal(response, []byte("\x01ping")) {
+		t.Errorf("Call = %q, %v", response, err)
+	}
+	if _, err := net.Endpoint(1).Call(ctx, 2, nil); err == nil || err.Error() != "empty request" {
+		t.Errorf("Call error = %v, want the handler's error", err)
+	}
+
+	// A lost response leaves the call waiting for the context
+	drop = true
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := net.Endpoint(1).Call(timeout, 2, []byte("ping")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Call error = %v, want deadline exceeded", err)
+	}
+
+	// Closing the network releases blocked endpoints
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		net.Close()
+	}()
+	if _, _, err := net.Endpoint(1).Receive(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Receive error = %v, want ErrClosed", err)
+	}
+	if err := net.Endpoint(1).Send(ctx, 2, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send error = %v, want ErrClosed", err)
+	}
+}
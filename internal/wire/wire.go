@@ -0,0 +1,209 @@
+// Package wire implements the signed message format and the share
+// encryption shared by the tpdkg and stpdkg ceremonies.
+//
+// Every message has a header laid out like liboprf's TP_DKG_Message, with
+// big-endian integers, but with 16-bit sender and recipient indexes:
+//
+//	sig[64] | msgno[1] | len[4] | from[2] | to[2] | ts[8] | data[len-81]
+//
+// len is the length of the whole message, and ts is the Unix time in seconds
+// at which it was sent. sig is an Ed25519 signature of everything after it.
+//
+// liboprf has single-byte from and to fields, and the share encryption is
+// this module's own, so the ceremonies built on this package do not
+// interoperate with liboprf.
+package wire
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// HeaderBytes is the size of the message header
+const HeaderBytes = ed25519.SignatureSize + 1 + 4 + 2 + 2 + 8
+
+var (
+	// ErrInvalid is returned for a message that does not authenticate or
+	// has an unexpected header
+	ErrInvalid = errors.New("wire: invalid message")
+	// ErrStale is returned for a message whose timestamp is out of bounds
+	ErrStale = errors.New("wire: stale message")
+)
+
+// Message is a parsed message.
+type Message struct {
+	// Raw is the whole signed message
+	Raw       []byte
+	Number    uint8
+	From      uint16
+	To        uint16
+	Timestamp uint64
+	// Data is the payload
+	Data []byte
+}
+
+// New signs a message with the current time.
+//
+// Parameters:
+//   - key: The sender's signing key
+//   - number: The message number
+//   - from, to: The sender and recipient indexes
+//   - data: The payload
+func New(key ed25519.PrivateKey, number uint8, from, to uint16, data []byte) []byte {
+	return NewAt(key, number, from, to, uint64(time.Now().Unix()), data)
+}
+
+// NewAt signs a message with the timestamp ts, in Unix seconds, instead of
+// the current time. It is used to sign a message again after changing it
+// without changing its place in the sender's sequence of timestamps.
+func NewAt(key ed25519.PrivateKey, number uint8, from, to uint16, ts uint64, data []byte) []byte {
+	raw := make([]byte, HeaderBytes, HeaderBytes+len(data))
+	raw[ed25519.SignatureSize] = number
+	binary.BigEndian.PutUint32(raw[ed25519.SignatureSize+1:], uint32(HeaderBytes+len(data)))
+	binary.BigEndian.PutUint16(raw[ed25519.SignatureSize+5:], from)
+	binary.BigEndian.PutUint16(raw[ed25519.SignatureSize+7:], to)
+	binary.BigEndian.PutUint64(raw[ed25519.SignatureSize+9:], ts)
+	raw = append(raw, data...)
+	copy(raw, ed25519.Sign(key, raw[ed25519.SignatureSize:]))
+	return raw
+}
+
+// Parse parses the message at the start of data and returns the rest
+func Parse(data []byte) (*Message, []byte, error) {
+	if len(data) < HeaderBytes {
+		return nil, nil, fmt.Errorf("%w: too short", ErrInvalid)
+	}
+	length := binary.BigEndian.Uint32(data[ed25519.SignatureSize+1:])
+	if length < HeaderBytes || uint64(length) > uint64(len(data)) {
+		return nil, nil, fmt.Errorf("%w: invalid length", ErrInvalid)
+	}
+
+	m := &Message{
+		Raw:       data[:length:length],
+		Number:    data[ed25519.SignatureSize],
+		From:      binary.BigEndian.Uint16(data[ed25519.SignatureSize+5:]),
+		To:        binary.BigEndian.Uint16(data[ed25519.SignatureSize+7:]),
+		Timestamp: binary.BigEndian.Uint64(data[ed25519.SignatureSize+9:]),
+	}
+	m.Data = m.Raw[HeaderBytes:]
+	return m, data[length:], nil
+}
+
+// ParseAll parses a sequence of count messages that fills data
+func ParseAll(data []byte, count int) ([]*Message, error) {
+	messages := make([]*Message, count)
+	for k := range messages {
+		var err error
+		if messages[k], data, err = Parse(data); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) != 0 {
+		return nil, fmt.Errorf("%w: trailing data after messages", ErrInvalid)
+	}
+	return messages, nil
+}
+
+// Check authenticates a message and checks its header.
+//
+// Parameters:
+//   - key: The sender's public key
+//   - number, from, to: The expected header fields
+//   - epsilon: The maximum difference between the timestamp and the clock,
+//     in whole seconds, or 0 for no limit
+//   - last: The timestamp of the sender's previous message, updated on
+//     success
+//
+// Returns an error that wraps ErrInvalid or ErrStale.
+func (m *Message) Check(key ed25519.PublicKey, number uint8, from, to uint16, epsilon time.Duration, last *uint64) error {
+	if m.Number != number || m.From != from || m.To != to {
+		return fmt.Errorf("%w: unexpected message %d from %d to %d", ErrInvalid, m.Number, m.From, m.To)
+	}
+	if len(key) != ed25519.PublicKeySize || !ed25519.Verify(key, m.Raw[ed25519.SignatureSize:], m.Raw[:ed25519.SignatureSize]) {
+		return fmt.Errorf("%w: bad signature", ErrInvalid)
+	}
+
+	if m.Timestamp < *last {
+		return fmt.Errorf("%w: older than the previous message", ErrStale)
+	}
+	if epsilon > 0 {
+		now, bound := uint64(time.Now().Unix()), uint64(epsilon/time.Second)
+		if m.Timestamp > now+bound || m.Timestamp+bound < now {
+			return fmt.Errorf("%w: timestamp out of bounds", ErrStale)
+		}
+	}
+	*last = m.Timestamp
+	return nil
+}
+
+// SessionID derives a session ID from a protocol name and a nonce
+func SessionID(protoName, nonce []byte) [32]byte {
+	return blake2b.Sum256(append(append([]byte(nil), protoName...), nonce...))
+}
+
+// NewTranscript starts the transcript of a session
+func NewTranscript(context string, session [32]byte) hash.Hash {
+	h, _ := blake2b.New256(nil)
+	h.Write([]byte(context))
+	h.Write(session[:])
+	return h
+}
+
+// Record adds messages to a transcript
+func Record(transcript hash.Hash, messages ...*Message) {
+	for _, m := range messages {
+		transcript.Write(m.Raw)
+	}
+}
+
+// PairKey derives the key that encrypts the share of dealer for recipient
+// from their X25519 keys
+func PairKey(context string, session [32]byte, key *ecdh.PrivateKey, peerKey *ecdh.PublicKey, dealer, recipient uint16) ([]byte, error) {
+	shared, err := key.ECDH(peerKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(shared)
+	return hkdf.Key(sha256.New, shared, session[:], string(pairInfo([]byte(context), dealer, recipient)), chacha20poly1305.KeySize)
+}
+
+// SealShare encrypts an encoded share under a pair key. Every pair key
+// encrypts a single share, so the nonce is fixed.
+func SealShare(session [32]byte, key []byte, dealer, recipient uint16, share []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Seal(nil, nonce, share, pairInfo(session[:], dealer, recipient)), nil
+}
+
+// OpenShare decrypts a share sealed by SealShare
+func OpenShare(session [32]byte, key []byte, dealer, recipient uint16, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	plaintext, err := aead.Open(nil, nonce, ciphertext, pairInfo(session[:], dealer, recipient))
+	if err != nil {
+		return nil, errors.New("wire: share decryption failed")
+	}
+	return plaintext, nil
+}
+
+// pairInfo appends the indexes of a dealer and a recipient to prefix
+func pairInfo(prefix []byte, dealer, recipient uint16) []byte {
+	data := binary.BigEndian.AppendUint16(prefix, dealer)
+	return binary.BigEndian.AppendUint16(data, recipient)
+}
@@ -0,0 +1,97 @@
+package wire
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestMessage tests the message header and its checks
+func TestMessage(t *testing.T) {
+	public, key, _ := ed25519.GenerateKey(nil)
+	raw := New(key, 4, 2, 300, []byte("payload"))
+
+	// Step 1: The header has liboprf's layout with 16-bit indexes
+	if len(raw) != HeaderBytes+7 || HeaderBytes != 81 {
+		t.Fatalf("Message is %d bytes", len(raw))
+	}
+	if raw[64] != 4 || binary.BigEndian.Uint32(raw[65:]) != uint32(len(raw)) || binary.BigEndian.Uint16(raw[69:]) != 2 || binary.BigEndian.Uint16(raw[71:]) != 300 {
+		t.Errorf("Header = %x", raw[64:HeaderBytes])
+	}
+
+	// Step 2: Messages are parsed from a stream
+	stream := append(slices.Clone(raw), raw...)
+	messages, err := ParseAll(stream, 2)
+	if err != nil || string(messages[1].Data) != "payload" {
+		t.Fatalf("ParseAll = %v, %v", messages, err)
+	}
+	if _, err := ParseAll(stream, 1); err == nil {
+		t.Error("ParseAll accepted trailing data")
+	}
+	if _, err := ParseAll(stream[:len(stream)-1], 2); err == nil {
+		t.Error("ParseAll accepted a truncated message")
+	}
+
+	// Step 3: The signature, header fields and timestamp are checked
+	var last uint64
+	check := func(raw []byte, to uint16) error {
+		m, _, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		return m.Check(public, 4, 2, to, time.Minute, &last)
+	}
+	if err := check(raw, 300); err != nil {
+		t.Fatalf("Valid message rejected: %v", err)
+	}
+	if err := check(raw, 0xffff); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Wrong recipient: %v", err)
+	}
+	tampered := slices.Clone(raw)
+	tampered[len(tampered)-1] ^= 1
+	if err := check(tampered, 300); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Tampered message: %v", err)
+	}
+	now := uint64(time.Now().Unix())
+	if err := check(NewAt(key, 4, 2, 3, now-3600, []byte("payload")), 3); !errors.Is(err, ErrStale) {
+		t.Errorf("Old message: %v", err)
+	}
+	if err := check(NewAt(key, 4, 2, 3, now+3600, []byte("payload")), 3); !errors.Is(err, ErrStale) {
+		t.Errorf("Future message: %v", err)
+	}
+	last = now + 30
+	if err := check(NewAt(key, 4, 2, 3, now+10, []byte("payload")), 3); !errors.Is(err, ErrStale) {
+		t.Errorf("Replayed message: %v", err)
+	}
+}
+
+// TestSealShare tests that a share opens with the pair key of both sides only
+func TestSealShare(t *testing.T) {
+	dealer, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	recipient, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	session := SessionID([]byte("test"), []byte("nonce"))
+
+	key, _ := PairKey("test", session, dealer, recipient.PublicKey(), 1, 2)
+	sealed, err := SealShare(session, key, 1, 2, []byte("share"))
+	if err != nil {
+		t.Fatalf("SealShare failed: %v", err)
+	}
+
+	same, _ := PairKey("test", session, recipient, dealer.PublicKey(), 1, 2)
+	if opened, err := OpenShare(session, same, 1, 2, sealed); err != nil || !bytes.Equal(opened, []byte("share")) {
+		t.Errorf("OpenShare = %q, %v", opened, err)
+	}
+	if _, err := OpenShare(session, same, 2, 1, sealed); err == nil {
+		t.Error("OpenShare accepted swapped indexes")
+	}
+	other, _ := PairKey("test", session, recipient, dealer.PublicKey(), 1, 3)
+	if _, err := OpenShare(session, other, 1, 2, sealed); err == nil {
+		t.Error("OpenShare accepted the key of another pair")
+	}
+}
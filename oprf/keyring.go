@@ -0,0 +1,180 @@
+package oprf
+
+// Multi-tenant keyring
+//
+// A Keyring derives one OPRF key per tenant from a single master seed with
+// DeriveKeyPair, using the tenant identifier as key info:
+//
+//	info = "tenant" || len(tenant) || tenant
+//
+// so only the seed needs to be stored and backed up, and any number of
+// tenants can be added without generating keys. Derived keys are decoded once
+// and cached.
+//
+// Tenants are isolated: Tenant returns a handle bound to a single tenant that
+// evaluates with that tenant's key only and never exposes it, and keys of
+// different tenants are independent pseudorandom values. Public keys can be
+// exported per tenant for verification by that tenant's clients.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gtank/ristretto255"
+)
+
+// tenantInfoPrefix prefixes the key info of tenant keys.
+const tenantInfoPrefix = "tenant"
+
+// Keyring derives and caches per-tenant OPRF keys from a master seed.
+// It is safe for concurrent use.
+type Keyring struct {
+	mu      sync.RWMutex
+	seed    []byte
+	tenants map[string]*TenantKey
+}
+
+// TenantKey is the OPRF key of one tenant.
+type TenantKey struct {
+	tenant    string
+	key       *ristretto255.Scalar
+	publicKey []byte
+}
+
+// NewKeyring creates a keyring from a master seed (32 bytes of uniform
+// randomness). The seed is copied.
+func NewKeyring(seed []byte) (*Keyring, error) {
+	if len(seed) != ScalarBytes {
+		return nil, fmt.Errorf("seed must be %d bytes, got %d", ScalarBytes, len(seed))
+	}
+
+	return &Keyring{
+		seed:    append([]byte(nil), seed...),
+		tenants: make(map[string]*TenantKey),
+	}, nil
+}
+
+// Tenant returns the key of a tenant, deriving and caching it on first use.
+func (k *Keyring) Tenant(tenant string) (*TenantKey, error) {
+	if tenant == "" {
+		return nil, errors.New("tenant must not be empty")
+	}
+
+	k.mu.RLock()
+	t, ok := k.tenants[tenant]
+	k.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if t, ok := k.tenants[tenant]; ok {
+		return t, nil
+	}
+	if k.seed == nil {
+		return nil, errors.New("keyring has been wiped")
+	}
+
+	info, err := tenantInfo(tenant)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes, publicKey, err := DeriveKeyPair(k.seed, info)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ristretto255.NewScalar()
+	if err := key.Decode(keyBytes); err != nil {
+		return nil, err
+	}
+	clear(keyBytes)
+
+	t = &TenantKey{tenant: tenant, key: key, publicKey: publicKey}
+	k.tenants[tenant] = t
+	return t, nil
+}
+
+// Evaluate evaluates a blinded element with the key of tenant.
+func (k *Keyring) Evaluate(tenant string, alpha []byte) ([]byte, error) {
+	t, err := k.Tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return t.Evaluate(alpha)
+}
+
+// PublicKey returns the public key of tenant.
+func (k *Keyring) PublicKey(tenant string) ([]byte, error) {
+	t, err := k.Tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	return t.PublicKey(), nil
+}
+
+// Forget removes a tenant's key from the cache. It is derived again on next
+// use.
+func (k *Keyring) Forget(tenant string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	delete(k.tenants, tenant)
+}
+
+// Wipe zeroes the seed and all cached keys. The keyring and the TenantKeys it
+// returned cannot be used afterwards, and must not be in use while Wipe runs.
+func (k *Keyring) Wipe() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	clear(k.seed)
+	k.seed = nil
+	for name, t := range k.tenants {
+		t.key.Zero()
+		delete(k.tenants, name)
+	}
+}
+
+// Tenant returns the tenant identifier of the key.
+func (t *TenantKey) Tenant() string {
+	return t.tenant
+}
+
+// PublicKey returns the tenant's public key (32 bytes).
+func (t *TenantKey) PublicKey() []byte {
+	return append([]byte(nil), t.publicKey...)
+}
+
+// Evaluate computes beta = alpha^k with the tenant's key, like Evaluate.
+func (t *TenantKey) Evaluate(alpha []byte) ([]byte, error) {
+	if len(alpha) != ElementBytes {
+		return nil, fmt.Errorf("alpha must be %d bytes, got %d", ElementBytes, len(alpha))
+	}
+	if t.key.Equal(ristretto255.NewScalar()) == 1 {
+		return nil, errors.New("tenant key has been wiped")
+	}
+
+	alphaElement := ristretto255.NewElement()
+	if err := alphaElement.Decode(alpha); err != nil {
+		return nil, fmt.Errorf("invalid alpha element: %w", err)
+	}
+
+	return ristretto255.NewElement().ScalarMult(t.key, alphaElement).Encode(nil), nil
+}
+
+// tenantInfo encodes the key info of a tenant.
+func tenantInfo(tenant string) ([]byte, error) {
+	if len(tenant) > 65535-len(tenantInfoPrefix)-2 {
+		return nil, errors.New("tenant identifier too long")
+	}
+
+	info := make([]byte, 0, len(tenantInfoPrefix)+2+len(tenant))
+	info = append(info, tenantInfoPrefix...)
+	info = binary.BigEndian.AppendUint16(info, uint16(len(tenant)))
+	return append(info, tenant...), nil
+}
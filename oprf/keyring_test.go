@@ -0,0 +1,124 @@
+package oprf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sync"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+)
+
+// TestDeriveKeyPair tests key derivation against the RFC 9497 test vector
+// (Appendix A.1.1, OPRF(ristretto255, SHA-512))
+func TestDeriveKeyPair(t *testing.T) {
+	seed := bytes.Repeat([]byte{0xa3}, 32)
+	info, _ := hex.DecodeString("74657374206b6579")
+
+	key, publicKey, err := DeriveKeyPair(seed, info)
+	if err != nil {
+		t.Fatalf("DeriveKeyPair failed: %v", err)
+	}
+	if got := hex.EncodeToString(key); got != testPrivateKey {
+		t.Errorf("DeriveKeyPair key = %s, want %s", got, testPrivateKey)
+	}
+
+	scalar := ristretto255.NewScalar()
+	scalar.Decode(key)
+	if !bytes.Equal(publicKey, ristretto255.NewElement().ScalarBaseMult(scalar).Encode(nil)) {
+		t.Error("Public key does not match the private key")
+	}
+
+	if _, _, err := DeriveKeyPair(seed[:31], info); err == nil {
+		t.Error("DeriveKeyPair accepted a short seed")
+	}
+}
+
+// TestKeyring tests per-tenant derivation, caching and isolation
+func TestKeyring(t *testing.T) {
+	seed, _ := KeyGen()
+	keyring, err := NewKeyring(seed)
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+
+	acme, err := keyring.Tenant("acme")
+	if err != nil {
+		t.Fatalf("Tenant failed: %v", err)
+	}
+	if again, _ := keyring.Tenant("acme"); again != acme {
+		t.Error("Tenant key was not cached")
+	}
+
+	// Tenants get different keys
+	acmePK, _ := keyring.PublicKey("acme")
+	globexPK, _ := keyring.PublicKey("globex")
+	if bytes.Equal(acmePK, globexPK) {
+		t.Error("Different tenants have the same public key")
+	}
+
+	// A tenant's evaluation differs from other tenants
+	input := []byte("password")
+	_, alpha, _ := Blind(input, mustHex(t, "64d37aed22a27f5191de1c1d69fadb899d8862b58eb4220029e036ec4c1f6706"))
+	beta, err := acme.Evaluate(alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	other, _ := keyring.Evaluate("globex", alpha)
+	if bytes.Equal(beta, other) {
+		t.Error("Different tenants evaluated to the same element")
+	}
+
+	// The same seed derives the same tenant keys after a restart
+	restarted, _ := NewKeyring(seed)
+	if pk, _ := restarted.PublicKey("acme"); !bytes.Equal(pk, acmePK) {
+		t.Error("Tenant key is not deterministic")
+	}
+	if b, _ := restarted.Evaluate("acme", alpha); !bytes.Equal(b, beta) {
+		t.Error("Tenant evaluation is not deterministic")
+	}
+
+	if _, err := keyring.Tenant(""); err == nil {
+		t.Error("Tenant accepted an empty identifier")
+	}
+
+	keyring.Wipe()
+	if _, err := keyring.Tenant("initech"); err == nil {
+		t.Error("Wiped keyring derived a key")
+	}
+	if _, err := acme.Evaluate(alpha); err == nil {
+		t.Error("Wiped tenant key evaluated")
+	}
+}
+
+// TestKeyringConcurrent tests concurrent use of a keyring
+func TestKeyringConcurrent(t *testing.T) {
+	seed, _ := KeyGen()
+	keyring, _ := NewKeyring(seed)
+
+	var wg sync.WaitGroup
+	keys := make([]*TenantKey, 16)
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys[i], _ = keyring.Tenant("shared")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, k := range keys[1:] {
+		if k != keys[0] {
+			t.Fatal("Concurrent lookups derived different key handles")
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex: %v", err)
+	}
+	return b
+}
@@ -71,6 +71,10 @@
 //
 // All scalar operations are constant-time to prevent timing attacks.
 //
+// Keys can also be derived deterministically with DeriveKeyPair (RFC 9497
+// Section 3.2.1). Keyring uses it to derive one key per tenant from a single
+// master seed. See keyring.go.
+//
 // # Security Considerations
 //
 // - The blinding factor r must be randomly generated for each OPRF evaluation
@@ -116,6 +120,9 @@ const (
 
 	// FinalizeDST is the domain separation tag for finalize operations
 	FinalizeDST = "Finalize"
+
+	// DeriveKeyPairDST is the domain separation tag for key derivation
+	DeriveKeyPairDST = "DeriveKeyPairOPRFV1-\x00-ristretto255-SHA512"
 )
 
 // SHA-512 parameters for expand_message_xmd
@@ -460,3 +467,51 @@ func KeyGen() ([]byte, error) {
 
 	return key, nil
 }
+
+// DeriveKeyPair deterministically derives an OPRF key pair from a seed and
+// public key info, as specified in RFC 9497 Section 3.2.1.
+//
+// Parameters:
+//   - seed: secret seed (32 bytes of uniform randomness)
+//   - info: public info that distinguishes keys derived from the same seed
+//
+// Returns:
+//   - key: the private key (32 bytes), usable with Evaluate
+//   - publicKey: the public key key*G (32 bytes)
+//   - error: any error that occurred
+//
+// The derivation computes, for counter = 0, 1, ... until the key is non-zero:
+//
+//	key = HashToScalar(seed || len(info) || info || counter, "DeriveKeyPair" || contextString)
+func DeriveKeyPair(seed, info []byte) (key, publicKey []byte, err error) {
+	if len(seed) != ScalarBytes {
+		return nil, nil, fmt.Errorf("seed must be %d bytes, got %d", ScalarBytes, len(seed))
+	}
+	if len(info) > 65535 {
+		return nil, nil, errors.New("info too long")
+	}
+
+	// deriveInput = seed || I2OSP(len(info), 2) || info
+	deriveInput := make([]byte, 0, len(seed)+2+len(info)+1)
+	deriveInput = append(deriveInput, seed...)
+	deriveInput = binary.BigEndian.AppendUint16(deriveInput, uint16(len(info)))
+	deriveInput = append(deriveInput, info...)
+
+	zero := ristretto255.NewScalar()
+	for counter := 0; counter <= 255; counter++ {
+		uniformBytes, err := expandMessageXMD(append(deriveInput, byte(counter)), []byte(DeriveKeyPairDST), HashBytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("expand_message_xmd failed: %w", err)
+		}
+
+		scalar := ristretto255.NewScalar().FromUniformBytes(uniformBytes)
+		if scalar.Equal(zero) == 1 {
+			continue
+		}
+
+		publicKey = ristretto255.NewElement().ScalarBaseMult(scalar).Encode(nil)
+		return scalar.Encode(nil), publicKey, nil
+	}
+
+	return nil, nil, errors.New("key derivation failed")
+}
@@ -0,0 +1,417 @@
+package stpdkg
+
+// The peer
+//
+// A peer checks every message the STP relays against its sender's key, and
+// takes every decision itself on its board. The only thing it has to take
+// from the STP on trust is an abort.
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"time"
+
+	"github.com/wurp/go-oprf/dkg"
+	"github.com/wurp/go-oprf/internal/wire"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// PeerConfig configures a peer.
+//
+// - Self: The peer's index, from 1 to n
+// - ProtoName: The name of the protocol instance, as given to the STP
+// - SigningKey: The peer's long-term Ed25519 key
+// - PeerKeys: All peers' long-term Ed25519 public keys, PeerKeys[i-1] for peer i
+// - STPKey: The STP's long-term Ed25519 public key, or nil to accept the key
+// announced in the STP's first message
+// - TimestampEpsilon: The maximum clock difference to the STP and other
+// peers, or 0 for none
+type PeerConfig struct {
+	Self             uint16
+	ProtoName        []byte
+	SigningKey       ed25519.PrivateKey
+	PeerKeys         []ed25519.PublicKey
+	STPKey           ed25519.PublicKey
+	TimestampEpsilon time.Duration
+}
+
+// PeerState is a peer of an stp-dkg ceremony, like liboprf's
+// STP_DKG_PeerState.
+type PeerState struct {
+	config     PeerConfig
+	board      *board
+	stpKey     ed25519.PublicKey
+	transcript hash.Hash
+	// step is the number of the STP message Next expects
+	step uint8
+	// last is the timestamp of the latest message of the STP (index 0) and
+	// of every peer
+	last []uint64
+
+	sigKey ed25519.PrivateKey
+	boxKey *ecdh.PrivateKey
+	// dealt are the share pairs the peer dealt, and commitments their
+	// encoded commitments
+	dealt       [][2]toprf.Share16
+	commitments []byte
+	// shares are the share pairs the peer received from every dealer
+	shares [][2]toprf.Share16
+	defend []complaint
+
+	share  [2]toprf.Share16
+	result *Result
+	done   bool
+}
+
+// NewPeer joins a ceremony.
+//
+// Parameters:
+//   - config: The peer's keys and index
+//   - msg0: The STP's first message
+//
+// Returns:
+//   - The peer
+//   - The peer's first message, for the STP
+func NewPeer(config PeerConfig, msg0 []byte) (*PeerState, []byte, error) {
+	if len(config.SigningKey) != ed25519.PrivateKeySize {
+		return nil, nil, errors.New("stpdkg: invalid signing key")
+	}
+
+	m, rest, err := wire.Parse(msg0)
+	if err != nil || len(rest) != 0 || len(m.Data) != paramsBytes {
+		return nil, nil, errors.New("stpdkg: invalid parameters message")
+	}
+	n, threshold := binary.BigEndian.Uint16(m.Data), binary.BigEndian.Uint16(m.Data[2:])
+	stpKey := ed25519.PublicKey(m.Data[4 : 4+ed25519.PublicKeySize])
+	if config.STPKey != nil && !stpKey.Equal(config.STPKey) {
+		return nil, nil, errors.New("stpdkg: parameters from an unknown STP")
+	}
+	if threshold < 2 || threshold > n || n == Broadcast {
+		return nil, nil, errors.New("stpdkg: invalid threshold or number of peers")
+	}
+	if config.Self < 1 || config.Self > n || len(config.PeerKeys) != int(n) {
+		return nil, nil, errors.New("stpdkg: peer index or keys do not match the parameters")
+	}
+	for _, key := range config.PeerKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("stpdkg: invalid peer key")
+		}
+	}
+
+	session := wire.SessionID(config.ProtoName, m.Data[4+ed25519.PublicKeySize:])
+	p := &PeerState{
+		config:     config,
+		board:      newBoard(n, threshold, session),
+		stpKey:     stpKey,
+		transcript: newTranscript(session),
+		step:       msgKeyBundle,
+		last:       make([]uint64, int(n)+1),
+		shares:     make([][2]toprf.Share16, n),
+	}
+	if err := m.Check(stpKey, msgParams, STP, Broadcast, config.TimestampEpsilon, &p.last[STP]); err != nil {
+		return nil, nil, err
+	}
+	wire.Record(p.transcript, m)
+
+	// Ephemeral keys for the session
+	sigPublic, sigKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.boxKey, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+		return nil, nil, err
+	}
+	p.sigKey = sigKey
+
+	data := append(append([]byte(nil), sigPublic...), p.boxKey.PublicKey().Bytes()...)
+	return p, wire.New(config.SigningKey, msgKeys, config.Self, STP, data), nil
+}
+
+// Next runs one step of the ceremony.
+//
+// Parameters:
+//   - input: The STP's message for this step
+//
+// Returns the peer's message for the STP, or nil when the peer is done. If
+// the ceremony fails because of cheaters, the error is a *CheatersError.
+func (p *PeerState) Next(input []byte) ([]byte, error) {
+	if p.done {
+		return nil, errors.New("stpdkg: ceremony is over")
+	}
+
+	m, rest, err := wire.Parse(input)
+	if err != nil || len(rest) != 0 {
+		return nil, errors.New("stpdkg: invalid message from the STP")
+	}
+	number, to := p.step, uint16(Broadcast)
+	if p.step == msgDeal {
+		to = p.config.Self
+	}
+	if m.Number == msgAbort {
+		// The STP may abort the ceremony at any step
+		number, to = msgAbort, Broadcast
+	}
+	if err := m.Check(p.stpKey, number, STP, to, p.config.TimestampEpsilon, &p.last[STP]); err != nil {
+		return nil, err
+	}
+	if number == msgAbort {
+		p.done = true
+		cheaters, err := decodeCheaters(m.Data)
+		if err != nil || len(cheaters) == 0 {
+			return nil, errors.New("stpdkg: the STP aborted without naming a cheater")
+		}
+		return nil, &CheatersError{Cheaters: cheaters}
+	}
+
+	switch p.step {
+	case msgKeyBundle:
+		return p.commit(m)
+	case msgHashBundle:
+		return p.deal(m)
+	case msgDeal:
+		return p.verify(m)
+	case msgComplaintBundle:
+		return p.answer(m)
+	case msgDefenseBundle:
+		return p.confirm(m)
+	default:
+		return nil, p.finish(m)
+	}
+}
+
+// Done reports whether the ceremony is over for the peer, like
+// stp_dkg_peer_not_done() negated
+func (p *PeerState) Done() bool {
+	return p.done
+}
+
+// Result returns the peer's final share pair, [secret, blinding], and the
+// public result of the ceremony, once it finished
+func (p *PeerState) Result() ([2]toprf.Share16, *Result, error) {
+	if p.result == nil {
+		return [2]toprf.Share16{}, nil, errors.New("stpdkg: ceremony did not finish")
+	}
+	return p.share, p.result, nil
+}
+
+// Cheaters returns the peers this peer caught cheating
+func (p *PeerState) Cheaters() []Cheater {
+	return p.board.cheaters
+}
+
+// SessionID returns the ID of the ceremony
+func (p *PeerState) SessionID() [SessionIDBytes]byte {
+	return p.board.session
+}
+
+// receive checks the messages the STP relayed in a bundle, adds them to the
+// board and to the transcript
+func (p *PeerState) receive(data []byte, number uint8, to uint16, add func(peer uint16, data []byte) error) ([]*wire.Message, error) {
+	messages, err := wire.ParseAll(data, int(p.board.n))
+	if err != nil {
+		return nil, err
+	}
+	for i, m := range messages {
+		peer := uint16(i + 1)
+		key := p.board.sigKeys[i]
+		if number == msgKeys {
+			key = p.config.PeerKeys[i]
+		}
+		if err := p.relayed(m, key, number, peer, to); err != nil {
+			return nil, err
+		}
+		if err := add(peer, m.Data); err != nil {
+			return nil, err
+		}
+	}
+	wire.Record(p.transcript, messages...)
+	return messages, nil
+}
+
+// commit records the peers' ephemeral keys, deals the peer's shares and
+// commits to them
+func (p *PeerState) commit(m *wire.Message) ([]byte, error) {
+	if _, err := p.receive(m.Data, msgKeys, STP, p.board.addKeys); err != nil {
+		return nil, err
+	}
+	self := p.config.Self
+	if !p.board.sigKeys[self-1].Equal(p.sigKey.Public()) || !p.board.boxKeys[self-1].Equal(p.boxKey.PublicKey()) {
+		return nil, errors.New("stpdkg: the STP replaced the peer's keys")
+	}
+
+	commitments, dealt, _, err := dkg.Share16(p.board.n, p.board.threshold, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.dealt = dealt
+	for _, c := range commitments {
+		p.commitments = c.Encode(p.commitments)
+	}
+
+	hash := commitmentHash(p.board.session, self, p.commitments)
+	p.step = msgHashBundle
+	return wire.New(p.sigKey, msgCommitHash, self, Broadcast, hash[:]), nil
+}
+
+// deal records the commitment hashes and sends the commitments and shares
+func (p *PeerState) deal(m *wire.Message) ([]byte, error) {
+	if _, err := p.receive(m.Data, msgCommitHash, Broadcast, p.board.addHash); err != nil {
+		return nil, err
+	}
+
+	self := p.config.Self
+	output := wire.New(p.sigKey, msgCommitments, self, Broadcast, p.commitments)
+	for j := range p.board.n {
+		recipient := j + 1
+		if recipient == self {
+			continue
+		}
+		key, err := wire.PairKey(shareContext, p.board.session, p.boxKey, p.board.boxKeys[j], self, recipient)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := wire.SealShare(p.board.session, key, self, recipient, encodeSharePair(p.dealt[j]))
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, wire.New(p.sigKey, msgShare, self, recipient, sealed)...)
+	}
+
+	p.step = msgDeal
+	return output, nil
+}
+
+// verify records the commitments, opens the shares of the other dealers
+// and complains about the bad ones
+func (p *PeerState) verify(m *wire.Message) ([]byte, error) {
+	self, n := p.config.Self, int(p.board.n)
+	messages, err := wire.ParseAll(m.Data, 2*n-1)
+	if err != nil {
+		return nil, err
+	}
+	commitments, shares := messages[:n], messages[n:]
+	for i, c := range commitments {
+		dealer := uint16(i + 1)
+		if err := p.relayed(c, p.board.sigKeys[i], msgCommitments, dealer, Broadcast); err != nil {
+			return nil, err
+		}
+		if err := p.board.addCommitments(dealer, c.Data); err != nil {
+			return nil, err
+		}
+	}
+	wire.Record(p.transcript, commitments...)
+	p.shares[self-1] = p.dealt[self-1]
+
+	var complaints []complaint
+	for k, s := range shares {
+		dealer := uint16(k + 1)
+		if dealer >= self {
+			dealer++
+		}
+		if err := p.relayed(s, p.board.sigKeys[dealer-1], msgShare, dealer, self); err != nil {
+			return nil, err
+		}
+		key, err := wire.PairKey(shareContext, p.board.session, p.boxKey, p.board.boxKeys[dealer-1], dealer, self)
+		if err != nil {
+			return nil, err
+		}
+		if p.shares[dealer-1], err = p.board.openShare(key, dealer, self, s.Data); err != nil {
+			complaints = append(complaints, complaint{accuser: self, dealer: dealer, key: key, share: s})
+		}
+	}
+
+	p.step = msgComplaintBundle
+	return wire.New(p.sigKey, msgComplaints, self, Broadcast, encodeComplaints(complaints)), nil
+}
+
+// answer records the complaints and defends the peer against those that
+// stand
+func (p *PeerState) answer(m *wire.Message) ([]byte, error) {
+	if _, err := p.receive(m.Data, msgComplaints, Broadcast, p.board.addComplaints); err != nil {
+		return nil, err
+	}
+	p.defend = p.board.judgeComplaints()
+
+	self := p.config.Self
+	var count uint16
+	data := []byte{0, 0}
+	for _, c := range p.defend {
+		if c.dealer == self {
+			data = binary.BigEndian.AppendUint16(data, c.accuser)
+			data = append(data, encodeSharePair(p.dealt[c.accuser-1])...)
+			count++
+		}
+	}
+	binary.BigEndian.PutUint16(data, count)
+
+	p.step = msgDefenseBundle
+	return wire.New(p.sigKey, msgDefense, self, Broadcast, data), nil
+}
+
+// confirm records the defenses, takes the revealed shares the peer
+// complained about and sends the peer's transcript
+func (p *PeerState) confirm(m *wire.Message) ([]byte, error) {
+	if _, err := p.receive(m.Data, msgDefense, Broadcast, p.board.addDefense); err != nil {
+		return nil, err
+	}
+	p.board.judgeDefenses(p.defend)
+
+	self := p.config.Self
+	for _, c := range p.defend {
+		if c.accuser == self && !p.board.disqualified[c.dealer-1] {
+			p.shares[c.dealer-1] = p.board.defenses[[2]uint16{c.dealer, self}]
+		}
+	}
+
+	p.step = msgTranscriptBundle
+	return wire.New(p.sigKey, msgTranscript, self, STP, p.transcript.Sum(nil)), nil
+}
+
+// finish compares the transcripts of all peers and computes the peer's
+// final share
+func (p *PeerState) finish(m *wire.Message) error {
+	p.done = true
+	messages, err := wire.ParseAll(m.Data, int(p.board.n))
+	if err != nil {
+		return err
+	}
+	transcript := p.transcript.Sum(nil)
+	for i, t := range messages {
+		peer := uint16(i + 1)
+		if err := p.relayed(t, p.board.sigKeys[i], msgTranscript, peer, STP); err != nil {
+			return err
+		}
+		if !bytes.Equal(t.Data, transcript) {
+			p.board.cheat(msgTranscript, TranscriptMismatch, peer, 0)
+		}
+	}
+	for _, c := range p.board.cheaters {
+		if c.Offense == TranscriptMismatch {
+			return &CheatersError{Cheaters: p.board.cheaters}
+		}
+	}
+
+	result, err := p.board.result()
+	if err != nil {
+		return err
+	}
+	share, commitment, err := dkg.CombineShares16(result.Qual, p.shares, p.config.Self)
+	if err != nil {
+		return err
+	}
+	if commitment.Equal(result.Commitments[p.config.Self-1]) != 1 {
+		return errors.New("stpdkg: final share does not match its commitment")
+	}
+	p.share, p.result = share, result
+	return nil
+}
+
+// relayed checks a message of another peer that the STP relayed
+func (p *PeerState) relayed(m *wire.Message, key ed25519.PublicKey, number uint8, from, to uint16) error {
+	return m.Check(key, number, from, to, p.config.TimestampEpsilon, &p.last[from])
+}
@@ -0,0 +1,300 @@
+package stpdkg
+
+// The semi-trusted party
+//
+// The STP relays the messages of every step and checks that each one parses
+// and authenticates, so that a peer never has to deal with a message it
+// cannot attribute. It keeps the same board as the peers and applies the
+// same rules, so that its Cheaters match theirs, but nothing it concludes is
+// binding: the peers check everything themselves.
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"time"
+
+	"github.com/wurp/go-oprf/internal/wire"
+)
+
+// STPConfig configures the semi-trusted party.
+//
+// - N: The number of peers
+// - Threshold: The number of shares needed to use the key
+// - ProtoName: The name of the protocol instance, bound to the session ID
+// - SigningKey: The STP's long-term Ed25519 key
+// - PeerKeys: The peers' long-term Ed25519 public keys, PeerKeys[i-1] for peer i
+// - TimestampEpsilon: The maximum clock difference to a peer, or 0 for none
+type STPConfig struct {
+	N                uint16
+	Threshold        uint16
+	ProtoName        []byte
+	SigningKey       ed25519.PrivateKey
+	PeerKeys         []ed25519.PublicKey
+	TimestampEpsilon time.Duration
+}
+
+// STPState is the semi-trusted party of an stp-dkg ceremony, like liboprf's
+// STP_DKG_STPState.
+type STPState struct {
+	config     STPConfig
+	board      *board
+	transcript hash.Hash
+	// step is the number of the peer messages Next expects
+	step uint8
+	// last is the timestamp of every peer's latest message
+	last []uint64
+
+	// shares[i][j] is the share message of dealer i+1 for peer j+1
+	shares [][]*wire.Message
+	// defend are the complaints the accused dealers must answer
+	defend []complaint
+	// rejected are the peers whose messages the STP could not relay
+	rejected []Cheater
+	done     bool
+}
+
+// NewSTP starts a ceremony as the semi-trusted party.
+//
+// Parameters:
+//   - config: The ceremony parameters
+//
+// Returns:
+//   - The STP
+//   - The first message, for all peers
+func NewSTP(config STPConfig) (*STPState, []byte, error) {
+	if config.Threshold < 2 || config.Threshold > config.N || config.N == Broadcast {
+		return nil, nil, errors.New("stpdkg: invalid threshold or number of peers")
+	}
+	if len(config.PeerKeys) != int(config.N) {
+		return nil, nil, errors.New("stpdkg: need a public key for every peer")
+	}
+	for _, key := range config.PeerKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("stpdkg: invalid peer key")
+		}
+	}
+	if len(config.SigningKey) != ed25519.PrivateKeySize {
+		return nil, nil, errors.New("stpdkg: invalid signing key")
+	}
+
+	var nonce [32]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, nil, err
+	}
+
+	session := wire.SessionID(config.ProtoName, nonce[:])
+	s := &STPState{
+		config:     config,
+		board:      newBoard(config.N, config.Threshold, session),
+		transcript: newTranscript(session),
+		step:       msgKeys,
+		last:       make([]uint64, config.N),
+		shares:     make([][]*wire.Message, config.N),
+	}
+
+	data := binary.BigEndian.AppendUint16(nil, config.N)
+	data = binary.BigEndian.AppendUint16(data, config.Threshold)
+	data = append(data, config.SigningKey.Public().(ed25519.PublicKey)...)
+	msg0 := wire.New(config.SigningKey, msgParams, STP, Broadcast, append(data, nonce[:]...))
+	m, _, _ := wire.Parse(msg0)
+	wire.Record(s.transcript, m)
+	return s, msg0, nil
+}
+
+// Next runs one step of the ceremony.
+//
+// Parameters:
+//   - inputs: The message of every peer for this step, inputs[i-1] for peer i
+//
+// Returns the message for every peer, outputs[i-1] for peer i. If a peer
+// sent a message that the STP cannot relay, the outputs abort the ceremony.
+func (s *STPState) Next(inputs [][]byte) ([][]byte, error) {
+	if s.done {
+		return nil, errors.New("stpdkg: ceremony is over")
+	}
+	if len(inputs) != int(s.config.N) {
+		return nil, errors.New("stpdkg: need one message from every peer")
+	}
+
+	var outputs [][]byte
+	switch s.step {
+	case msgKeys:
+		outputs = s.relay(inputs, msgKeys, STP, msgKeyBundle, s.board.addKeys)
+	case msgCommitHash:
+		outputs = s.relay(inputs, msgCommitHash, Broadcast, msgHashBundle, s.board.addHash)
+	case msgCommitments:
+		outputs = s.deal(inputs)
+	case msgComplaints:
+		outputs = s.relay(inputs, msgComplaints, Broadcast, msgComplaintBundle, s.board.addComplaints)
+		s.defend = s.board.judgeComplaints()
+	case msgDefense:
+		outputs = s.relay(inputs, msgDefense, Broadcast, msgDefenseBundle, s.board.addDefense)
+		s.board.judgeDefenses(s.defend)
+	case msgTranscript:
+		outputs = s.finish(inputs)
+	}
+
+	if len(s.rejected) > 0 {
+		outputs = s.broadcast(msgAbort, encodeCheaters(s.rejected))
+		s.done = true
+	}
+	s.step += 2
+	if s.step == msgDeal {
+		s.step = msgComplaints
+	}
+	return outputs, nil
+}
+
+// Done reports whether the ceremony is over, like stp_dkg_stp_not_done()
+// negated
+func (s *STPState) Done() bool {
+	return s.done
+}
+
+// Cheaters returns the peers the STP caught cheating: the same as every
+// honest peer reports, and the peers whose messages it could not relay
+func (s *STPState) Cheaters() []Cheater {
+	return append(append([]Cheater(nil), s.board.cheaters...), s.rejected...)
+}
+
+// SessionID returns the ID of the ceremony
+func (s *STPState) SessionID() [SessionIDBytes]byte {
+	return s.board.session
+}
+
+// relay checks one message from every peer, adds it to the board and
+// broadcasts them all
+func (s *STPState) relay(inputs [][]byte, number uint8, to uint16, bundle uint8, add func(peer uint16, data []byte) error) [][]byte {
+	var data []byte
+	for i, input := range inputs {
+		peer := uint16(i + 1)
+		key := s.board.sigKeys[i]
+		if number == msgKeys {
+			key = s.config.PeerKeys[i]
+		}
+		m, rest, err := wire.Parse(input)
+		if err != nil || len(rest) != 0 {
+			s.reject(InvalidMessage, peer)
+			continue
+		}
+		if m = s.check(m, key, number, peer, to); m == nil {
+			continue
+		}
+		if err := add(peer, m.Data); err != nil {
+			s.reject(InvalidPayload, peer)
+			continue
+		}
+		wire.Record(s.transcript, m)
+		data = append(data, m.Raw...)
+	}
+	return s.broadcast(bundle, data)
+}
+
+// deal checks the commitments and shares of every dealer and routes them
+func (s *STPState) deal(inputs [][]byte) [][]byte {
+	n := int(s.config.N)
+	var commitments []byte
+	for i, input := range inputs {
+		dealer := uint16(i + 1)
+		m, rest, err := wire.Parse(input)
+		if err != nil {
+			s.reject(InvalidMessage, dealer)
+			continue
+		}
+		if m = s.check(m, s.board.sigKeys[i], msgCommitments, dealer, Broadcast); m == nil {
+			continue
+		}
+		if err := s.board.addCommitments(dealer, m.Data); err != nil {
+			s.reject(InvalidPayload, dealer)
+			continue
+		}
+		wire.Record(s.transcript, m)
+		commitments = append(commitments, m.Raw...)
+
+		shares, err := wire.ParseAll(rest, n-1)
+		if err != nil {
+			s.reject(InvalidMessage, dealer)
+			continue
+		}
+		s.shares[i] = make([]*wire.Message, n)
+		for _, share := range shares {
+			// The shares go to the other peers, one each, in any order
+			recipient := share.To
+			if recipient < 1 || int(recipient) > n || recipient == dealer || s.shares[i][recipient-1] != nil {
+				s.reject(InvalidMessage, dealer)
+				break
+			}
+			if s.shares[i][recipient-1] = s.check(share, s.board.sigKeys[i], msgShare, dealer, recipient); s.shares[i][recipient-1] == nil {
+				break
+			}
+		}
+	}
+	if len(s.rejected) > 0 {
+		return nil
+	}
+
+	outputs := make([][]byte, n)
+	for j := range outputs {
+		data := append([]byte(nil), commitments...)
+		for i := range n {
+			if i != j {
+				data = append(data, s.shares[i][j].Raw...)
+			}
+		}
+		outputs[j] = wire.New(s.config.SigningKey, msgDeal, STP, uint16(j+1), data)
+	}
+	return outputs
+}
+
+// finish checks the peers' transcripts against the STP's and broadcasts
+// them
+func (s *STPState) finish(inputs [][]byte) [][]byte {
+	transcript := s.transcript.Sum(nil)
+	var data []byte
+	for i, input := range inputs {
+		peer := uint16(i + 1)
+		m, rest, err := wire.Parse(input)
+		if err != nil || len(rest) != 0 {
+			s.reject(InvalidMessage, peer)
+			continue
+		}
+		if m = s.check(m, s.board.sigKeys[i], msgTranscript, peer, STP); m == nil {
+			continue
+		}
+		if !bytes.Equal(m.Data, transcript) {
+			s.board.cheat(msgTranscript, TranscriptMismatch, peer, 0)
+		}
+		data = append(data, m.Raw...)
+	}
+
+	s.done = true
+	return s.broadcast(msgTranscriptBundle, data)
+}
+
+// check checks a message from a peer and rejects the peer if it fails
+func (s *STPState) check(m *wire.Message, key ed25519.PublicKey, number uint8, from, to uint16) *wire.Message {
+	if err := m.Check(key, number, from, to, s.config.TimestampEpsilon, &s.last[from-1]); err != nil {
+		s.reject(offense(err), from)
+		return nil
+	}
+	return m
+}
+
+// reject records a peer whose message cannot be relayed
+func (s *STPState) reject(offense Offense, peer uint16) {
+	s.rejected = append(s.rejected, Cheater{Step: s.step, Offense: offense, Peer: peer})
+}
+
+// broadcast signs a message for all peers
+func (s *STPState) broadcast(number uint8, data []byte) [][]byte {
+	m := wire.New(s.config.SigningKey, number, STP, Broadcast, data)
+	outputs := make([][]byte, s.config.N)
+	for k := range outputs {
+		outputs[k] = m
+	}
+	return outputs
+}
@@ -0,0 +1,288 @@
+package stpdkg
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/wurp/go-oprf/dkg"
+	"github.com/wurp/go-oprf/internal/wire"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// tamperFunc may replace the message a peer sends the STP at a step
+type tamperFunc func(number uint8, peer *PeerState, raw []byte) []byte
+
+// ceremony runs stp-dkg with n peers and returns the STP, the peers and the
+// error every peer ended with
+func ceremony(t *testing.T, n, threshold uint16, tamper tamperFunc) (*STPState, []*PeerState, []error) {
+	t.Helper()
+
+	stpPublic, stpKey, _ := ed25519.GenerateKey(nil)
+	keys := make([]ed25519.PrivateKey, n)
+	public := make([]ed25519.PublicKey, n)
+	for i := range keys {
+		public[i], keys[i], _ = ed25519.GenerateKey(nil)
+	}
+
+	proto := []byte("stpdkg test")
+	stp, msg0, err := NewSTP(STPConfig{
+		N:                n,
+		Threshold:        threshold,
+		ProtoName:        proto,
+		SigningKey:       stpKey,
+		PeerKeys:         public,
+		TimestampEpsilon: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewSTP failed: %v", err)
+	}
+
+	peers := make([]*PeerState, n)
+	inputs := make([][]byte, n)
+	for i := range peers {
+		peers[i], inputs[i], err = NewPeer(PeerConfig{
+			Self:             uint16(i + 1),
+			ProtoName:        proto,
+			SigningKey:       keys[i],
+			PeerKeys:         public,
+			STPKey:           stpPublic,
+			TimestampEpsilon: time.Minute,
+		}, msg0)
+		if err != nil {
+			t.Fatalf("NewPeer failed: %v", err)
+		}
+	}
+
+	errs := make([]error, n)
+	for !stp.Done() {
+		number := stp.step
+		if tamper != nil {
+			for i := range inputs {
+				inputs[i] = tamper(number, peers[i], inputs[i])
+			}
+		}
+		outputs, err := stp.Next(inputs)
+		if err != nil {
+			t.Fatalf("STP step %d failed: %v", number, err)
+		}
+		for i, p := range peers {
+			inputs[i], errs[i] = p.Next(outputs[i])
+			if errs[i] != nil && !stp.Done() {
+				t.Fatalf("Peer %d failed after step %d: %v", i+1, number, errs[i])
+			}
+		}
+	}
+	return stp, peers, errs
+}
+
+// checkFinished checks that every peer finished with the same result and
+// cheaters as the STP, and that the final shares match their commitments
+func checkFinished(t *testing.T, stp *STPState, peers []*PeerState, errs []error, qual []uint16, cheaters []Cheater) {
+	t.Helper()
+
+	if !slices.Equal(stp.Cheaters(), cheaters) {
+		t.Errorf("STP cheaters = %v, want %v", stp.Cheaters(), cheaters)
+	}
+	var pairs [][2]toprf.Share16
+	var first *Result
+	for i, p := range peers {
+		if errs[i] != nil {
+			t.Fatalf("Peer %d failed: %v", i+1, errs[i])
+		}
+		if !slices.Equal(p.Cheaters(), cheaters) {
+			t.Errorf("Peer %d: cheaters = %v, want %v", i+1, p.Cheaters(), cheaters)
+		}
+		pair, result, err := p.Result()
+		if err != nil {
+			t.Fatalf("Result failed: %v", err)
+		}
+		if !slices.Equal(result.Qual, qual) {
+			t.Errorf("Peer %d: QUAL = %v, want %v", i+1, result.Qual, qual)
+		}
+		if first == nil {
+			first = result
+		}
+		for j, c := range result.Commitments {
+			if c.Equal(first.Commitments[j]) != 1 {
+				t.Errorf("Peer %d: different commitment for peer %d", i+1, j+1)
+			}
+		}
+		pairs = append(pairs, pair)
+	}
+
+	// Any threshold of the final shares reconstruct the same secret
+	threshold := peers[0].board.threshold
+	secret, _, err := dkg.ReconstructSecret16(threshold, 0, pairs, first.Commitments)
+	if err != nil {
+		t.Fatalf("ReconstructSecret failed: %v", err)
+	}
+	other, _, err := dkg.ReconstructSecret16(threshold, 0, pairs[len(pairs)-int(threshold):], nil)
+	if err != nil || other.Equal(secret) != 1 {
+		t.Errorf("Final shares do not reconstruct a single secret: %v", err)
+	}
+}
+
+// rewrite replaces the message number of a step in a peer's output with the
+// result of change, signed again with the peer's ephemeral key. The message
+// keeps its timestamp, so the untouched messages after it are not older.
+func rewrite(p *PeerState, raw []byte, number uint8, change func(m *wire.Message) []byte) []byte {
+	var out []byte
+	for len(raw) > 0 {
+		m, rest, _ := wire.Parse(raw)
+		if m.Number == number {
+			if data := change(m); data != nil {
+				m.Raw = wire.NewAt(p.sigKey, m.Number, m.From, m.To, m.Timestamp, data)
+			}
+		}
+		out = append(out, m.Raw...)
+		raw = rest
+	}
+	return out
+}
+
+// corrupt makes dealer's sealed shares for the victims undecryptable
+func corrupt(dealer uint16, victims ...uint16) tamperFunc {
+	return func(number uint8, p *PeerState, raw []byte) []byte {
+		if number != msgCommitments || p.config.Self != dealer {
+			return raw
+		}
+		return rewrite(p, raw, msgShare, func(m *wire.Message) []byte {
+			if !slices.Contains(victims, m.To) {
+				return nil
+			}
+			data := slices.Clone(m.Data)
+			data[0] ^= 1
+			return data
+		})
+	}
+}
+
+// TestCeremony tests a ceremony without cheaters
+func TestCeremony(t *testing.T) {
+	stp, peers, errs := ceremony(t, 5, 3, nil)
+	checkFinished(t, stp, peers, errs, []uint16{1, 2, 3, 4, 5}, nil)
+	for _, p := range peers {
+		if p.SessionID() != stp.SessionID() || !p.Done() {
+			t.Errorf("Peer %d: session or state differs", p.config.Self)
+		}
+	}
+}
+
+// TestCeremonyCheaters tests that peers detect cheaters, disqualify the
+// cheating dealers and agree with the STP
+func TestCeremonyCheaters(t *testing.T) {
+	t.Run("defended complaint", func(t *testing.T) {
+		// Peer 3 cannot open its share from dealer 1, which reveals it
+		stp, peers, errs := ceremony(t, 4, 2, corrupt(1, 3))
+		checkFinished(t, stp, peers, errs, []uint16{1, 2, 3, 4}, nil)
+	})
+
+	t.Run("undefended complaint", func(t *testing.T) {
+		// Dealer 1 does not reveal peer 3's share
+		corrupted := corrupt(1, 3)
+		stp, peers, errs := ceremony(t, 4, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number == msgDefense && p.config.Self == 1 {
+				return wire.New(p.sigKey, msgDefense, 1, Broadcast, []byte{0, 0})
+			}
+			return corrupted(number, p, raw)
+		})
+		checkFinished(t, stp, peers, errs, []uint16{2, 3, 4},
+			[]Cheater{{Step: msgDefense, Offense: InvalidShare, Peer: 1, Other: 3}})
+	})
+
+	t.Run("too many complaints", func(t *testing.T) {
+		stp, peers, errs := ceremony(t, 4, 2, corrupt(1, 2, 3))
+		checkFinished(t, stp, peers, errs, []uint16{2, 3, 4},
+			[]Cheater{{Step: msgComplaints, Offense: TooManyComplaints, Peer: 1}})
+	})
+
+	t.Run("false complaint", func(t *testing.T) {
+		// Peer 2 complains about the valid share of dealer 4
+		var share *wire.Message
+		stp, peers, errs := ceremony(t, 4, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number == msgCommitments && p.config.Self == 4 {
+				rewrite(p, raw, msgShare, func(m *wire.Message) []byte {
+					if m.To == 2 {
+						share = m
+					}
+					return nil
+				})
+			}
+			if number != msgComplaints || p.config.Self != 2 {
+				return raw
+			}
+			return rewrite(p, raw, msgComplaints, func(*wire.Message) []byte {
+				key, _ := wire.PairKey(shareContext, p.board.session, p.boxKey, p.board.boxKeys[3], 4, 2)
+				return encodeComplaints([]complaint{{dealer: 4, key: key, share: share}})
+			})
+		})
+		checkFinished(t, stp, peers, errs, []uint16{1, 2, 3, 4},
+			[]Cheater{{Step: msgComplaints, Offense: FalseComplaint, Peer: 2, Other: 4}})
+	})
+
+	t.Run("commitment mismatch", func(t *testing.T) {
+		// Dealer 2 sends other commitments than it committed to
+		stp, peers, errs := ceremony(t, 4, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number != msgCommitments || p.config.Self != 2 {
+				return raw
+			}
+			return rewrite(p, raw, msgCommitments, func(m *wire.Message) []byte {
+				data := slices.Clone(m.Data)
+				copy(data, data[dkg.ElementBytes:])
+				return data
+			})
+		})
+		checkFinished(t, stp, peers, errs, []uint16{1, 3, 4},
+			[]Cheater{{Step: msgCommitments, Offense: CommitmentMismatch, Peer: 2}})
+	})
+}
+
+// TestCeremonyAborts tests the failures that stop a ceremony
+func TestCeremonyAborts(t *testing.T) {
+	t.Run("forged message", func(t *testing.T) {
+		// The STP cannot relay a hash that peer 3 did not sign
+		stp, _, errs := ceremony(t, 3, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number == msgCommitHash && p.config.Self == 3 {
+				raw = slices.Clone(raw)
+				raw[len(raw)-1] ^= 1
+			}
+			return raw
+		})
+		want := []Cheater{{Step: msgCommitHash, Offense: InvalidMessage, Peer: 3}}
+		if !slices.Equal(stp.Cheaters(), want) {
+			t.Errorf("STP cheaters = %v, want %v", stp.Cheaters(), want)
+		}
+		for i, err := range errs {
+			var cheaters *CheatersError
+			if !errors.As(err, &cheaters) || !slices.Equal(cheaters.Cheaters, want) {
+				t.Errorf("Peer %d: error = %v, want cheaters %v", i+1, err, want)
+			}
+		}
+	})
+
+	t.Run("transcript mismatch", func(t *testing.T) {
+		// Peer 1 reports another transcript, and nobody accepts the key
+		stp, peers, errs := ceremony(t, 3, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number == msgTranscript && p.config.Self == 1 {
+				return wire.New(p.sigKey, msgTranscript, 1, STP, make([]byte, TranscriptBytes))
+			}
+			return raw
+		})
+		want := []Cheater{{Step: msgTranscript, Offense: TranscriptMismatch, Peer: 1}}
+		if !slices.Equal(stp.Cheaters(), want) {
+			t.Errorf("STP cheaters = %v, want %v", stp.Cheaters(), want)
+		}
+		for i, err := range errs {
+			var cheaters *CheatersError
+			if !errors.As(err, &cheaters) || !slices.Equal(cheaters.Cheaters, want) {
+				t.Errorf("Peer %d: error = %v, want cheaters %v", i+1, err, want)
+			}
+			if _, _, err := peers[i].Result(); err == nil {
+				t.Errorf("Peer %d: Result succeeded", i+1)
+			}
+		}
+	})
+}
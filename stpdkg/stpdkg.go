@@ -0,0 +1,594 @@
+// Package stpdkg implements a semi-trusted-party distributed key
+// generation on top of the Pedersen VSS in dkg/vss.go. It is modeled on the
+// stp-dkg of liboprf but is not compatible with it (see Compatibility).
+//
+// Like in tpdkg, the peers only talk to a party that orchestrates the
+// ceremony and relays every message: the semi-trusted party (STP). Unlike
+// the TP of tpdkg, the STP is not trusted to judge anybody. Every decision is
+// taken by every peer from the signed broadcasts, and the STP only reaches
+// the same conclusions from the same data. The STP can stop the ceremony,
+// but it cannot make honest peers disqualify an honest dealer or accept a
+// bad one, and a final transcript round catches an STP that shows different
+// broadcasts to different peers.
+//
+// # Protocol
+//
+// The STP is created with NewSTP, which returns the first message for all
+// peers, and then fed one message from every peer per step with STP.Next. A
+// peer is created with NewPeer from the STP's first message and then fed
+// every following STP message with Peer.Next.
+//
+//  0. STP: the parameters n and threshold, the STP's signing key and a nonce
+//     that, with the protocol name, makes the session ID.
+//  1. Peer: ephemeral Ed25519 and X25519 keys for the session, signed with
+//     the peer's long-term key.
+//  2. STP: all peers' key messages.
+//  3. Peer: a hash of its commitments, so that no dealer can choose its
+//     commitments after seeing the others'.
+//  4. STP: all commitment hashes.
+//  5. Peer: the Pedersen commitments C_j = g^f(j) * h^f'(j) of a VSS of a
+//     random secret (dkg.Share), and
+//  6. for every other peer j, its share pair (f(j), f'(j)) encrypted under
+//     an X25519 pair key.
+//  7. STP: to every peer, all commitments and the shares for that peer.
+//  8. Peer: complaints against the dealers whose share did not decrypt or
+//     did not match its commitment, each with the pair key and the dealer's
+//     signed share message as evidence.
+//  9. STP: all complaints.
+//  10. Peer: as an accused dealer, the disputed share pairs in the clear.
+//  11. STP: all defenses.
+//  12. Peer: the hash of its transcript of the broadcasts.
+//  13. STP: all transcript hashes.
+//
+// A dealer is disqualified when its commitments do not match their hash or
+// do not lie on a polynomial of degree threshold-1, when threshold or more
+// peers complain about it (defending would reveal its secret), or when it
+// does not defend a complaint with a share pair that matches its
+// commitment. A complaint whose revealed pair key opens a valid share is
+// false, and only reports the accuser. Everybody reports the same cheaters,
+// see Cheater. The dealers that remain form QUAL, and every peer finishes
+// with the sum of its share pairs from QUAL (dkg.CombineShares) and the
+// Pedersen commitments of every peer's final share.
+//
+// The STP sends an abort message instead when a peer sends a message that
+// does not parse or authenticate. Peers then fail with a *CheatersError.
+//
+// # Compatibility
+//
+// This package does not interoperate with liboprf, and it is not a port of
+// stp-dkg.c. Its roles and steps follow liboprf's stp-dkg.c and its VSS
+// follows dkg-vss.c, but like tpdkg it seals shares with ChaCha20-Poly1305
+// under X25519 pair keys instead of Noise XK channels, and its payloads are
+// its own. Its message header and payloads carry 16-bit peer indexes and
+// toprf.Share16 shares, where liboprf has single bytes, so that a ceremony
+// can have up to 65534 peers. A ceremony must be run entirely with this
+// package.
+package stpdkg
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/dkg"
+	"github.com/wurp/go-oprf/internal/wire"
+	"github.com/wurp/go-oprf/toprf"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// HeaderBytes is the size of the message header
+	HeaderBytes = wire.HeaderBytes
+
+	// STP is the index of the semi-trusted party in message headers
+	STP = 0
+
+	// Broadcast is the recipient index of a message to all peers
+	Broadcast = 0xffff
+
+	// SessionIDBytes is the size of a session ID
+	SessionIDBytes = 32
+
+	// TranscriptBytes is the size of a transcript hash
+	TranscriptBytes = blake2b.Size256
+
+	// keyBytes is the size of an ephemeral key message payload: an Ed25519
+	// and an X25519 public key
+	keyBytes = ed25519.PublicKeySize + 32
+
+	// paramsBytes is the size of the parameters payload: n and threshold (2
+	// bytes each), the STP's public key and the session nonce
+	paramsBytes = 4 + ed25519.PublicKeySize + 32
+
+	// sharePairBytes is the size of an encoded share pair
+	sharePairBytes = 2 * toprf.Share16Bytes
+
+	// cheaterBytes is the size of an encoded Cheater
+	cheaterBytes = 6
+
+	// shareContext is the HKDF info prefix of pair keys
+	shareContext = "go-oprf stp-dkg share v2"
+
+	// transcriptContext starts every transcript
+	transcriptContext = "go-oprf stp-dkg transcript v2"
+
+	// commitmentContext starts every commitment hash
+	commitmentContext = "go-oprf stp-dkg commitments v2"
+)
+
+// Message numbers of the protocol steps
+const (
+	msgParams uint8 = iota
+	msgKeys
+	msgKeyBundle
+	msgCommitHash
+	msgHashBundle
+	msgCommitments
+	msgShare
+	msgDeal
+	msgComplaints
+	msgComplaintBundle
+	msgDefense
+	msgDefenseBundle
+	msgTranscript
+	msgTranscriptBundle
+	msgAbort
+)
+
+// Offense is the reason a peer was reported as a cheater.
+type Offense uint8
+
+const (
+	// InvalidMessage is a message that does not parse or authenticate, or
+	// that has the wrong number, sender or recipient
+	InvalidMessage Offense = iota + 1
+	// StaleMessage is a message whose timestamp is out of bounds
+	StaleMessage
+	// InvalidPayload is a message whose content is malformed, e.g. keys that
+	// do not decode or complaints with forged evidence
+	InvalidPayload
+	// CommitmentMismatch is a dealer whose commitments do not match the hash
+	// it committed to
+	CommitmentMismatch
+	// InvalidCommitments is a dealer whose commitments do not lie on a
+	// polynomial of degree threshold-1
+	InvalidCommitments
+	// FalseComplaint is a peer that complained about a valid share from Other
+	FalseComplaint
+	// TooManyComplaints is a dealer accused by threshold or more peers
+	TooManyComplaints
+	// InvalidShare is a dealer that did not defend the complaint of Other
+	// with a valid share pair
+	InvalidShare
+	// TranscriptMismatch is a peer whose transcript differs from the
+	// reporter's
+	TranscriptMismatch
+)
+
+// String returns a description of the offense
+func (o Offense) String() string {
+	switch o {
+	case InvalidMessage:
+		return "invalid message"
+	case StaleMessage:
+		return "stale message"
+	case InvalidPayload:
+		return "invalid payload"
+	case CommitmentMismatch:
+		return "commitments do not match their hash"
+	case InvalidCommitments:
+		return "invalid commitments"
+	case FalseComplaint:
+		return "false complaint"
+	case TooManyComplaints:
+		return "too many complaints"
+	case InvalidShare:
+		return "invalid share"
+	case TranscriptMismatch:
+		return "transcript mismatch"
+	}
+	return fmt.Sprintf("offense %d", uint8(o))
+}
+
+// Cheater is a peer caught misbehaving, like liboprf's STP_DKG_Cheater.
+type Cheater struct {
+	// Step is the number of the message in which the offense was found
+	Step uint8
+	// Offense is what the peer did
+	Offense Offense
+	// Peer is the index of the cheater
+	Peer uint16
+	// Other is the index of the other peer involved, or 0
+	Other uint16
+}
+
+// String describes the cheater, like liboprf's stpdkg_cheater_msg
+func (c Cheater) String() string {
+	s := fmt.Sprintf("step %d: peer %d: %v", c.Step, c.Peer, c.Offense)
+	if c.Other != 0 {
+		s += fmt.Sprintf(" (peer %d)", c.Other)
+	}
+	return s
+}
+
+// CheatersError is returned by a peer when the ceremony fails because of
+// cheaters.
+type CheatersError struct {
+	Cheaters []Cheater
+}
+
+func (e *CheatersError) Error() string {
+	descriptions := make([]string, len(e.Cheaters))
+	for k, c := range e.Cheaters {
+		descriptions[k] = c.String()
+	}
+	return "stpdkg: ceremony failed: " + strings.Join(descriptions, "; ")
+}
+
+// Result is the public outcome of a ceremony.
+type Result struct {
+	// Qual lists the dealers whose sharings make up the key
+	Qual []uint16
+	// Commitments[j-1] is the Pedersen commitment to peer j's final share
+	// pair
+	Commitments []*ristretto255.Element
+}
+
+// complaint is a complaint with its evidence
+type complaint struct {
+	accuser uint16
+	dealer  uint16
+	key     []byte
+	// share is the dealer's signed share message for the accuser
+	share *wire.Message
+}
+
+// board is the public state of a ceremony that the STP and every peer
+// build from the same broadcasts, and from which they take the same
+// decisions.
+type board struct {
+	n         uint16
+	threshold uint16
+	session   [SessionIDBytes]byte
+
+	sigKeys     []ed25519.PublicKey
+	boxKeys     []*ecdh.PublicKey
+	hashes      [][]byte
+	commitments [][]*ristretto255.Element
+	// standing are the complaints that were not proven false
+	standing []complaint
+	// defenses holds the share pairs revealed by accused dealers, by dealer
+	// and accuser
+	defenses     map[[2]uint16][2]toprf.Share16
+	disqualified []bool
+	cheaters     []Cheater
+}
+
+// newBoard starts the public state of a ceremony
+func newBoard(n, threshold uint16, session [SessionIDBytes]byte) *board {
+	return &board{
+		n:            n,
+		threshold:    threshold,
+		session:      session,
+		sigKeys:      make([]ed25519.PublicKey, n),
+		boxKeys:      make([]*ecdh.PublicKey, n),
+		hashes:       make([][]byte, n),
+		commitments:  make([][]*ristretto255.Element, n),
+		defenses:     make(map[[2]uint16][2]toprf.Share16),
+		disqualified: make([]bool, n),
+	}
+}
+
+// cheat reports a cheater, and disqualifies it if it is a dealer that
+// misbehaved
+func (b *board) cheat(step uint8, offense Offense, peer, other uint16) {
+	b.cheaters = append(b.cheaters, Cheater{Step: step, Offense: offense, Peer: peer, Other: other})
+	switch offense {
+	case CommitmentMismatch, InvalidCommitments, TooManyComplaints, InvalidShare:
+		b.disqualified[peer-1] = true
+	}
+}
+
+// addKeys records the ephemeral keys of a peer
+func (b *board) addKeys(peer uint16, data []byte) error {
+	if len(data) != keyBytes {
+		return errors.New("stpdkg: invalid peer keys")
+	}
+	boxKey, err := ecdh.X25519().NewPublicKey(data[ed25519.PublicKeySize:])
+	if err != nil {
+		return err
+	}
+	b.sigKeys[peer-1] = data[:ed25519.PublicKeySize]
+	b.boxKeys[peer-1] = boxKey
+	return nil
+}
+
+// addHash records the commitment hash of a dealer
+func (b *board) addHash(dealer uint16, data []byte) error {
+	if len(data) != blake2b.Size256 {
+		return errors.New("stpdkg: invalid commitment hash")
+	}
+	b.hashes[dealer-1] = data
+	return nil
+}
+
+// addCommitments records the commitments of a dealer, and disqualifies it
+// if they do not match its hash or the threshold. It only fails if the
+// commitments do not decode.
+func (b *board) addCommitments(dealer uint16, data []byte) error {
+	if len(data) != int(b.n)*dkg.ElementBytes {
+		return errors.New("stpdkg: invalid commitments")
+	}
+	commitments := make([]*ristretto255.Element, b.n)
+	for k := range commitments {
+		commitments[k] = ristretto255.NewElement()
+		if err := commitments[k].Decode(data[k*dkg.ElementBytes : (k+1)*dkg.ElementBytes]); err != nil {
+			return err
+		}
+	}
+	b.commitments[dealer-1] = commitments
+
+	hash := commitmentHash(b.session, dealer, data)
+	switch {
+	case !bytes.Equal(hash[:], b.hashes[dealer-1]):
+		b.cheat(msgCommitments, CommitmentMismatch, dealer, 0)
+	case verifyDegree(b.threshold, commitments) != nil:
+		b.cheat(msgCommitments, InvalidCommitments, dealer, 0)
+	}
+	return nil
+}
+
+// addComplaints records the complaints of a peer. Complaints whose evidence
+// opens a valid share report the accuser instead. It fails if a complaint
+// is malformed or its evidence is not the dealer's signed share message.
+func (b *board) addComplaints(accuser uint16, data []byte) error {
+	complaints, err := decodeComplaints(data, accuser)
+	if err != nil {
+		return err
+	}
+	seen := make(map[uint16]bool)
+	for _, c := range complaints {
+		if c.dealer < 1 || c.dealer > b.n || c.dealer == accuser || seen[c.dealer] {
+			return errors.New("stpdkg: invalid complaint")
+		}
+		seen[c.dealer] = true
+		var last uint64
+		if err := c.share.Check(b.sigKeys[c.dealer-1], msgShare, c.dealer, accuser, 0, &last); err != nil {
+			return err
+		}
+
+		if _, err := b.openShare(c.key, c.dealer, accuser, c.share.Data); err == nil {
+			b.cheat(msgComplaints, FalseComplaint, accuser, c.dealer)
+			continue
+		}
+		b.standing = append(b.standing, c)
+	}
+	return nil
+}
+
+// judgeComplaints disqualifies the dealers accused by threshold or more
+// peers, and returns the complaints the others must defend
+func (b *board) judgeComplaints() []complaint {
+	count := make([]int, b.n)
+	for _, c := range b.standing {
+		count[c.dealer-1]++
+	}
+	for i, k := range count {
+		if k >= int(b.threshold) && !b.disqualified[i] {
+			b.cheat(msgComplaints, TooManyComplaints, uint16(i+1), 0)
+		}
+	}
+
+	var defend []complaint
+	for _, c := range b.standing {
+		if !b.disqualified[c.dealer-1] {
+			defend = append(defend, c)
+		}
+	}
+	return defend
+}
+
+// addDefense records the share pairs an accused dealer revealed: a 2-byte
+// count, then for each the 2-byte accuser index and the share pair
+func (b *board) addDefense(dealer uint16, data []byte) error {
+	if len(data) < 2 || len(data) != 2+int(binary.BigEndian.Uint16(data))*(2+sharePairBytes) {
+		return errors.New("stpdkg: invalid defense")
+	}
+	for k := range int(binary.BigEndian.Uint16(data)) {
+		entry := data[2+k*(2+sharePairBytes):]
+		pair, err := decodeSharePair(entry[2 : 2+sharePairBytes])
+		if err != nil {
+			return err
+		}
+		b.defenses[[2]uint16{dealer, binary.BigEndian.Uint16(entry)}] = pair
+	}
+	return nil
+}
+
+// judgeDefenses disqualifies the accused dealers that did not reveal a
+// valid share pair for their accuser
+func (b *board) judgeDefenses(defend []complaint) {
+	for _, c := range defend {
+		pair, ok := b.defenses[[2]uint16{c.dealer, c.accuser}]
+		if !ok || pair[0].Index != c.accuser || pair[1].Index != c.accuser ||
+			dkg.VerifyShareCommitment16(b.commitments[c.dealer-1][c.accuser-1], pair) != nil {
+			b.cheat(msgDefense, InvalidShare, c.dealer, c.accuser)
+		}
+	}
+}
+
+// result returns QUAL and the commitments of the final shares
+func (b *board) result() (*Result, error) {
+	var qual []uint16
+	for i, disqualified := range b.disqualified {
+		if !disqualified {
+			qual = append(qual, uint16(i+1))
+		}
+	}
+	if len(qual) < int(b.threshold) {
+		return nil, &CheatersError{Cheaters: b.cheaters}
+	}
+
+	commitments := make([]*ristretto255.Element, b.n)
+	for j := range commitments {
+		commitments[j] = ristretto255.NewElement()
+		for _, i := range qual {
+			commitments[j].Add(commitments[j], b.commitments[i-1][j])
+		}
+	}
+	return &Result{Qual: qual, Commitments: commitments}, nil
+}
+
+// openShare decrypts the share pair of dealer for recipient with a pair key
+// and checks it against the dealer's commitment
+func (b *board) openShare(key []byte, dealer, recipient uint16, sealed []byte) ([2]toprf.Share16, error) {
+	plaintext, err := wire.OpenShare(b.session, key, dealer, recipient, sealed)
+	if err != nil {
+		return [2]toprf.Share16{}, err
+	}
+	pair, err := decodeSharePair(plaintext)
+	if err != nil {
+		return pair, err
+	}
+	if pair[0].Index != recipient || pair[1].Index != recipient {
+		return pair, errors.New("stpdkg: share for another peer")
+	}
+	if err := dkg.VerifyShareCommitment16(b.commitments[dealer-1][recipient-1], pair); err != nil {
+		return pair, err
+	}
+	return pair, nil
+}
+
+// verifyDegree checks that the share commitments of a dealer lie on a
+// polynomial of degree threshold-1: the commitments of shares threshold+1 to
+// n must be the interpolation of the first threshold ones in the exponent.
+func verifyDegree(threshold uint16, commitments []*ristretto255.Element) error {
+	peers := make([]uint16, threshold)
+	for k := range peers {
+		peers[k] = uint16(k + 1)
+	}
+	for j := int(threshold) + 1; j <= len(commitments); j++ {
+		expected := ristretto255.NewElement()
+		for _, k := range peers {
+			term := ristretto255.NewElement().ScalarMult(toprf.LagrangeCoefficient16(k, uint16(j), peers), commitments[k-1])
+			expected.Add(expected, term)
+		}
+		if expected.Equal(commitments[j-1]) != 1 {
+			return errors.New("stpdkg: commitments exceed the threshold degree")
+		}
+	}
+	return nil
+}
+
+// commitmentHash hashes the encoded commitments of a dealer
+func commitmentHash(session [SessionIDBytes]byte, dealer uint16, data []byte) [blake2b.Size256]byte {
+	prefix := binary.BigEndian.AppendUint16(append([]byte(commitmentContext), session[:]...), dealer)
+	return blake2b.Sum256(append(prefix, data...))
+}
+
+// encodeComplaints encodes complaints: a 2-byte count, then for each the
+// 2-byte dealer index, the pair key and the dealer's share message
+func encodeComplaints(complaints []complaint) []byte {
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(complaints)))
+	for _, c := range complaints {
+		data = binary.BigEndian.AppendUint16(data, c.dealer)
+		data = append(append(data, c.key...), c.share.Raw...)
+	}
+	return data
+}
+
+// decodeComplaints decodes the complaints of an accuser
+func decodeComplaints(data []byte, accuser uint16) ([]complaint, error) {
+	if len(data) < 2 {
+		return nil, errors.New("stpdkg: invalid complaints")
+	}
+	complaints := make([]complaint, binary.BigEndian.Uint16(data))
+	data = data[2:]
+	for k := range complaints {
+		if len(data) < 2+chacha20poly1305.KeySize {
+			return nil, errors.New("stpdkg: invalid complaints")
+		}
+		c := &complaints[k]
+		c.accuser, c.dealer, c.key = accuser, binary.BigEndian.Uint16(data), data[2:2+chacha20poly1305.KeySize]
+		var err error
+		if c.share, data, err = wire.Parse(data[2+chacha20poly1305.KeySize:]); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) != 0 {
+		return nil, errors.New("stpdkg: trailing data after complaints")
+	}
+	return complaints, nil
+}
+
+// encodeSharePair encodes a share pair
+func encodeSharePair(pair [2]toprf.Share16) []byte {
+	first, _ := pair[0].MarshalBinary()
+	second, _ := pair[1].MarshalBinary()
+	return append(first, second...)
+}
+
+// decodeSharePair decodes a share pair
+func decodeSharePair(data []byte) ([2]toprf.Share16, error) {
+	var pair [2]toprf.Share16
+	if len(data) != sharePairBytes {
+		return pair, errors.New("stpdkg: invalid share pair")
+	}
+	if err := pair[0].UnmarshalBinary(data[:toprf.Share16Bytes]); err != nil {
+		return pair, err
+	}
+	if err := pair[1].UnmarshalBinary(data[toprf.Share16Bytes:]); err != nil {
+		return pair, err
+	}
+	return pair, nil
+}
+
+// encodeCheaters encodes a list of cheaters: a 4-byte count, as every pair
+// of peers can be involved in an offense, and the cheaters
+func encodeCheaters(cheaters []Cheater) []byte {
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(cheaters)))
+	for _, c := range cheaters {
+		data = append(data, c.Step, uint8(c.Offense))
+		data = binary.BigEndian.AppendUint16(data, c.Peer)
+		data = binary.BigEndian.AppendUint16(data, c.Other)
+	}
+	return data
+}
+
+// decodeCheaters decodes a list of cheaters
+func decodeCheaters(data []byte) ([]Cheater, error) {
+	if len(data) < 4 || uint64(len(data)-4) != uint64(binary.BigEndian.Uint32(data))*cheaterBytes {
+		return nil, errors.New("stpdkg: invalid cheaters")
+	}
+	cheaters := make([]Cheater, binary.BigEndian.Uint32(data))
+	for k := range cheaters {
+		c := data[4+k*cheaterBytes:]
+		cheaters[k] = Cheater{
+			Step:    c[0],
+			Offense: Offense(c[1]),
+			Peer:    binary.BigEndian.Uint16(c[2:]),
+			Other:   binary.BigEndian.Uint16(c[4:]),
+		}
+	}
+	return cheaters, nil
+}
+
+// offense returns the offense of a message that failed its check
+func offense(err error) Offense {
+	if errors.Is(err, wire.ErrStale) {
+		return StaleMessage
+	}
+	return InvalidMessage
+}
+
+// newTranscript starts the transcript of a session
+func newTranscript(session [SessionIDBytes]byte) hash.Hash {
+	return wire.NewTranscript(transcriptContext, session)
+}
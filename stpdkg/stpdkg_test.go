@@ -0,0 +1,98 @@
+package stpdkg
+
+import (
+	"crypto/ed25519"
+	"slices"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/dkg"
+	"github.com/wurp/go-oprf/internal/wire"
+)
+
+// TestVerifyDegree tests the check that share commitments lie on a
+// polynomial of degree threshold-1
+func TestVerifyDegree(t *testing.T) {
+	commitments, _, _, err := dkg.Share(5, 3, nil)
+	if err != nil {
+		t.Fatalf("Share failed: %v", err)
+	}
+	if err := verifyDegree(3, commitments); err != nil {
+		t.Errorf("verifyDegree rejected a valid sharing: %v", err)
+	}
+
+	// Step 1: A sharing of a higher degree is rejected
+	if err := verifyDegree(2, commitments); err == nil {
+		t.Error("verifyDegree accepted a sharing above the threshold")
+	}
+
+	// Step 2: So is a sharing with one commitment replaced
+	other, _, _, _ := dkg.Share(5, 3, nil)
+	tampered := slices.Clone(commitments)
+	tampered[4] = other[4]
+	if err := verifyDegree(3, tampered); err == nil {
+		t.Error("verifyDegree accepted a modified commitment")
+	}
+
+	// Step 3: With n = threshold, any commitments define the polynomial
+	if err := verifyDegree(5, tampered); err != nil {
+		t.Errorf("verifyDegree rejected n = threshold: %v", err)
+	}
+}
+
+// TestEncoding tests the encoding of complaints, share pairs and cheaters
+func TestEncoding(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(nil)
+	share, _, _ := wire.Parse(wire.New(key, msgShare, 300, 1, []byte("sealed")))
+	complaints := []complaint{{accuser: 1, dealer: 300, key: make([]byte, 32), share: share}}
+
+	decoded, err := decodeComplaints(encodeComplaints(complaints), 1)
+	if err != nil || len(decoded) != 1 || decoded[0].dealer != 300 || string(decoded[0].share.Data) != "sealed" {
+		t.Errorf("decodeComplaints = %v, %v", decoded, err)
+	}
+	if _, err := decodeComplaints(encodeComplaints(complaints)[:40], 1); err == nil {
+		t.Error("decodeComplaints accepted a truncated complaint")
+	}
+
+	_, pairs, _, _ := dkg.Share16(300, 2, nil)
+	pair, err := decodeSharePair(encodeSharePair(pairs[299]))
+	if err != nil || pair[0].Index != 300 || pair[1].Value.Equal(pairs[299][1].Value) != 1 {
+		t.Errorf("decodeSharePair = %v, %v", pair, err)
+	}
+
+	cheaters := []Cheater{
+		{Step: msgDefense, Offense: InvalidShare, Peer: 1, Other: 3},
+		{Step: msgComplaints, Offense: FalseComplaint, Peer: 300, Other: 65534},
+	}
+	if got, err := decodeCheaters(encodeCheaters(cheaters)); err != nil || !slices.Equal(got, cheaters) {
+		t.Errorf("decodeCheaters = %v, %v", got, err)
+	}
+	err = &CheatersError{Cheaters: cheaters[:1]}
+	if want := "stpdkg: ceremony failed: step 10: peer 1: invalid share (peer 3)"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+// TestBoardResult tests that QUAL needs threshold dealers and that the final
+// commitments add up the dealers' commitments
+func TestBoardResult(t *testing.T) {
+	b := newBoard(3, 2, [SessionIDBytes]byte{})
+	for i := range b.commitments {
+		b.commitments[i], _, _, _ = dkg.Share(3, 2, nil)
+	}
+	b.cheat(msgCommitments, InvalidCommitments, 2, 0)
+
+	result, err := b.result()
+	if err != nil || !slices.Equal(result.Qual, []uint16{1, 3}) {
+		t.Fatalf("result = %v, %v", result, err)
+	}
+	sum := ristretto255.NewElement().Add(b.commitments[0][1], b.commitments[2][1])
+	if result.Commitments[1].Equal(sum) != 1 {
+		t.Error("Final commitment is not the sum of the qualified dealers'")
+	}
+
+	b.cheat(msgDefense, InvalidShare, 3, 1)
+	if _, err := b.result(); err == nil {
+		t.Error("result accepted fewer than threshold dealers")
+	}
+}
@@ -0,0 +1,408 @@
+package toprf
+
+// Concurrent threshold client
+//
+// Client fans a blinded element out to share servers and combines the first
+// threshold good answers. Servers are asked for raw parts (no Lagrange
+// coefficient), so the answers of any threshold servers can be combined with
+// ThresholdMult, whichever servers they turn out to be.
+//
+// ThresholdMult takes the place of the Evaluate-with-indexes and
+// ThresholdCombine pair. ThresholdCombine only adds up parts, so every server
+// must apply its Lagrange coefficient itself. Each coefficient depends on the
+// indexes of all servers that take part, and that set has to be fixed before
+// the first request. A client that asks Extra servers up front, or replaces
+// a failed server, only learns the set once the answers are in. Under
+// ThresholdCombine, every replacement would mean asking all servers again
+// with the new set. ThresholdMult applies the same coefficients on the
+// client side instead, so both give the same beta for the same servers:
+//
+//	ThresholdMult(raw parts) == ThresholdCombine(Evaluate(share_i, alpha, indexes))
+//
+// Raw parts are also what 3HashTDH produces and what part proofs cover.
+//
+// Servers have 16-bit indexes. Their parts come as Part or Part16 encodings
+// (see transport.go) and are combined with ThresholdMult16, which accepts
+// both.
+//
+// A client configured with the servers' verification keys (for example
+// dkg.Result.VerificationKeys, or Dealing.VerificationKeys) asks every server
+// for a proof of its part and checks it with VerifyPart. A server whose part
+// does not verify is reported with ErrInvalidProof and replaced like a
+// failed one, so a malicious server cannot change the output. Proofs only
+// cover plain Evaluate, not 3HashTDH.
+//
+// The client keeps simple health statistics for every server: how often it
+// failed recently and an exponentially weighted average of its latency.
+// Requests go to the healthiest, fastest servers first; every server that
+// fails (after retries) is replaced by the next best one until threshold
+// answers arrive, the candidates run out, or the context is done.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gtank/ristretto255"
+)
+
+// ErrNotEnoughServers is returned when fewer than threshold share servers
+// produced a valid part.
+var ErrNotEnoughServers = errors.New("toprf: not enough share servers responded")
+
+// ErrInvalidProof is returned for a share server whose part does not match
+// its verification key.
+var ErrInvalidProof = errors.New("toprf: part proof does not verify")
+
+// ClientConfig configures a Client.
+//
+//   - Threshold: number of parts needed to combine a result
+//   - Extra: number of servers asked in addition to Threshold up front, to
+//     hide the latency of slow or failing servers (0 asks exactly Threshold)
+//   - Timeout: time limit for a single request to one server (0 means no limit
+//     beyond the caller's context)
+//   - Retries: number of times a failed request to a server is repeated
+//     before the server is given up on
+//   - VerificationKeys: the verification key g^k_j of every share j, at index
+//     j-1, to check proofs of the parts; nil combines parts unchecked
+type ClientConfig struct {
+	Threshold        uint16
+	Extra            int
+	Timeout          time.Duration
+	Retries          int
+	VerificationKeys []*ristretto255.Element
+}
+
+// ServerError records why a share server did not contribute a part.
+type ServerError struct {
+	Index uint16
+	Err   error
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("toprf: share server %d: %v", e.Index, e.Err)
+}
+
+func (e *ServerError) Unwrap() error {
+	return e.Err
+}
+
+// EvalResult is the outcome of a threshold evaluation.
+//
+//   - Beta: the combined evaluation, to be passed to oprf.Unblind
+//   - Parts: the marshaled parts that were combined
+//   - Failures: the servers that were asked but did not contribute a part
+type EvalResult struct {
+	Beta     []byte
+	Parts    [][]byte
+	Failures []ServerError
+}
+
+// ServerStats is a snapshot of the health the client tracks for a server.
+type ServerStats struct {
+	Index     uint16
+	Successes int
+	Failures  int
+	Latency   time.Duration
+}
+
+// serverHealth is the mutable health state of one server.
+type serverHealth struct {
+	successes int
+	failures  int
+	// recentFailures decays with every success and is used for ordering
+	recentFailures int
+	latency        time.Duration
+}
+
+// latencyWeight is the weight of a new sample in the latency average.
+const latencyWeight = 0.2
+
+// Client evaluates blinded elements against a set of share servers.
+// A Client is safe for concurrent use.
+type Client struct {
+	servers []ShareServer
+	config  ClientConfig
+
+	mu     sync.Mutex
+	health map[uint16]*serverHealth
+}
+
+// NewClient creates a threshold client for the given share servers.
+func NewClient(servers []ShareServer, config ClientConfig) (*Client, error) {
+	if config.Threshold < 1 || int(config.Threshold) > len(servers) {
+		return nil, errors.New("toprf: invalid threshold parameters")
+	}
+	if config.Extra < 0 || config.Retries < 0 || config.Timeout < 0 {
+		return nil, errors.New("toprf: invalid client configuration")
+	}
+
+	health := make(map[uint16]*serverHealth, len(servers))
+	for _, s := range servers {
+		if s.Index() == 0 {
+			return nil, errors.New("toprf: share server index must be > 0")
+		}
+		if _, ok := health[s.Index()]; ok {
+			return nil, errors.New("toprf: duplicate share server index")
+		}
+		if config.VerificationKeys != nil {
+			if int(s.Index()) > len(config.VerificationKeys) || config.VerificationKeys[s.Index()-1] == nil {
+				return nil, errors.New("toprf: no verification key for share server")
+			}
+		}
+		health[s.Index()] = &serverHealth{}
+	}
+
+	return &Client{servers: servers, config: config, health: health}, nil
+}
+
+// Evaluate obtains a threshold evaluation of alpha using plain Evaluate on
+// the servers, with part proofs if the client has verification keys.
+func (c *Client) Evaluate(ctx context.Context, alpha []byte) (*EvalResult, error) {
+	return c.evaluate(ctx, &EvalRequest{Alpha: alpha, Proof: c.config.VerificationKeys != nil})
+}
+
+// EvaluateTDH obtains a threshold evaluation of alpha using ThreeHashTDH on
+// the servers. ssid must be unique for the session. It is not available to
+// a client with verification keys, since 3HashTDH parts cannot be proven.
+func (c *Client) EvaluateTDH(ctx context.Context, alpha, ssid []byte) (*EvalResult, error) {
+	if len(ssid) == 0 {
+		return nil, errors.New("toprf: ssid is empty")
+	}
+	if c.config.VerificationKeys != nil {
+		return nil, errors.New("toprf: 3HashTDH parts cannot be proven")
+	}
+	return c.evaluate(ctx, &EvalRequest{Alpha: alpha, SSID: ssid})
+}
+
+// Stats returns the health statistics of all servers, ordered by preference.
+func (c *Client) Stats() []ServerStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := make([]ServerStats, 0, len(c.servers))
+	for _, s := range c.rankLocked() {
+		h := c.health[s.Index()]
+		stats = append(stats, ServerStats{
+			Index:     s.Index(),
+			Successes: h.successes,
+			Failures:  h.failures,
+			Latency:   h.latency,
+		})
+	}
+	return stats
+}
+
+// serverResult is the outcome of asking one server.
+type serverResult struct {
+	index uint16
+	part  []byte
+	err   error
+}
+
+func (c *Client) evaluate(ctx context.Context, req *EvalRequest) (*EvalResult, error) {
+	if len(req.Alpha) != ElementBytes {
+		return nil, errors.New("toprf: invalid alpha length")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.mu.Lock()
+	candidates := c.rankLocked()
+	c.mu.Unlock()
+
+	threshold := int(c.config.Threshold)
+	results := make(chan serverResult, len(candidates))
+	next := 0
+	launch := func() {
+		s := candidates[next]
+		next++
+		go func() {
+			part, err := c.ask(ctx, s, req)
+			results <- serverResult{index: s.Index(), part: part, err: err}
+		}()
+	}
+
+	initial := min(threshold+c.config.Extra, len(candidates))
+	for next < initial {
+		launch()
+	}
+
+	result := &EvalResult{}
+	pending := initial
+	for pending > 0 && len(result.Parts) < threshold {
+		var r serverResult
+		select {
+		case r = <-results:
+		case <-ctx.Done():
+			// Servers still outstanding count as failed
+			for _, s := range candidates[:next] {
+				if !answered(result, s.Index()) {
+					result.Failures = append(result.Failures, ServerError{Index: s.Index(), Err: ctx.Err()})
+				}
+			}
+			return result, fmt.Errorf("%w: %w", ErrNotEnoughServers, ctx.Err())
+		}
+		pending--
+
+		if r.err != nil {
+			result.Failures = append(result.Failures, ServerError{Index: r.index, Err: r.err})
+			// Replace the failed server with the next best one
+			if next < len(candidates) && len(result.Parts)+pending < threshold {
+				launch()
+				pending++
+			}
+			continue
+		}
+
+		result.Parts = append(result.Parts, r.part)
+	}
+
+	if len(result.Parts) < threshold {
+		return result, ErrNotEnoughServers
+	}
+
+	beta, err := ThresholdMult16(result.Parts)
+	if err != nil {
+		return result, err
+	}
+	result.Beta = beta
+
+	return result, nil
+}
+
+// answered reports whether index contributed a part or already failed.
+func answered(result *EvalResult, index uint16) bool {
+	for _, data := range result.Parts {
+		if i, _, _ := decodeIndexed16(data); i == index {
+			return true
+		}
+	}
+	for _, f := range result.Failures {
+		if f.Index == index {
+			return true
+		}
+	}
+	return false
+}
+
+// ask requests a part from one server, retrying on failure, and records the
+// outcome in the server's health.
+func (c *Client) ask(ctx context.Context, s ShareServer, req *EvalRequest) ([]byte, error) {
+	var err error
+	for attempt := 0; attempt <= c.config.Retries; attempt++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		start := time.Now()
+		var part []byte
+		part, err = c.askOnce(ctx, s, req)
+		if err == nil {
+			c.record(s.Index(), time.Since(start), nil)
+			return part, nil
+		}
+
+		// Cancellation by the caller (or because enough parts arrived)
+		// says nothing about the server's health
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		c.record(s.Index(), time.Since(start), err)
+
+		// A wrong part is not a transient failure
+		if errors.Is(err, ErrInvalidProof) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// askOnce performs a single request and validates the returned part, and
+// its proof if the request asked for one.
+func (c *Client) askOnce(ctx context.Context, s ShareServer, req *EvalRequest) ([]byte, error) {
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+
+	data, err := s.Evaluate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var proof []byte
+	if req.Proof {
+		if len(data) != PartBytes+ProofBytes && len(data) != Part16Bytes+ProofBytes {
+			return nil, errors.New("toprf: invalid part length")
+		}
+		data, proof = data[:len(data)-ProofBytes], data[len(data)-ProofBytes:]
+	}
+
+	var part Part16
+	if err := part.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if part.Index != s.Index() {
+		return nil, errors.New("toprf: part index does not match server index")
+	}
+	if part.Element.Equal(ristretto255.NewIdentityElement()) == 1 {
+		return nil, errors.New("toprf: part is the identity element")
+	}
+	if req.Proof {
+		if err := VerifyPart(c.config.VerificationKeys[part.Index-1], req.Alpha, data, proof); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+		}
+	}
+
+	return data, nil
+}
+
+// record updates the health of server index after a request.
+func (c *Client) record(index uint16, latency time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h := c.health[index]
+	if err != nil {
+		h.failures++
+		h.recentFailures++
+		return
+	}
+
+	h.successes++
+	if h.recentFailures > 0 {
+		h.recentFailures--
+	}
+	if h.successes == 1 {
+		h.latency = latency
+	} else {
+		h.latency = time.Duration((1-latencyWeight)*float64(h.latency) + latencyWeight*float64(latency))
+	}
+}
+
+// rankLocked returns the servers ordered by preference: fewest recent
+// failures first, then lowest average latency, then index. Servers without
+// any successful request yet are tried before slower known servers.
+// c.mu must be held.
+func (c *Client) rankLocked() []ShareServer {
+	ranked := make([]ShareServer, len(c.servers))
+	copy(ranked, c.servers)
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		hi, hj := c.health[ranked[i].Index()], c.health[ranked[j].Index()]
+		if hi.recentFailures != hj.recentFailures {
+			return hi.recentFailures < hj.recentFailures
+		}
+		if hi.latency != hj.latency {
+			return hi.latency < hj.latency
+		}
+		return ranked[i].Index() < ranked[j].Index()
+	})
+	return ranked
+}
@@ -0,0 +1,461 @@
+package toprf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/internal/simnet"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// testServer wraps a ShareServer with configurable misbehaviour.
+type testServer struct {
+	ShareServer
+	delay time.Duration
+	err   error
+	calls atomic.Int32
+}
+
+func (s *testServer) Evaluate(ctx context.Context, req *EvalRequest) ([]byte, error) {
+	s.calls.Add(1)
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.ShareServer.Evaluate(ctx, req)
+}
+
+// newTestServers creates n local share servers for a fresh key with the
+// given threshold, wrapped in testServers.
+func newTestServers(t *testing.T, n, threshold uint8) ([]byte, []*testServer) {
+	t.Helper()
+
+	keyBytes, err := oprf.KeyGen()
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	shares, err := CreateShares(secret, n, threshold)
+	if err != nil {
+		t.Fatalf("CreateShares failed: %v", err)
+	}
+	zeroShares, err := CreateShares(ristretto255.NewScalar(), n, threshold)
+	if err != nil {
+		t.Fatalf("CreateShares for zero failed: %v", err)
+	}
+
+	servers := make([]*testServer, n)
+	for i := range shares {
+		local, err := NewLocalServer(shares[i], &zeroShares[i])
+		if err != nil {
+			t.Fatalf("NewLocalServer failed: %v", err)
+		}
+		servers[i] = &testServer{ShareServer: local}
+	}
+	return keyBytes, servers
+}
+
+func asShareServers(servers []*testServer) []ShareServer {
+	result := make([]ShareServer, len(servers))
+	for i := range servers {
+		result[i] = servers[i]
+	}
+	return result
+}
+
+// TestClientEvaluate tests that the client output matches a non-threshold evaluation
+func TestClientEvaluate(t *testing.T) {
+	keyBytes, servers := newTestServers(t, 5, 3)
+	client, err := NewClient(asShareServers(servers), ClientConfig{Threshold: 3})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+
+	result, err := client.Evaluate(context.Background(), alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("Client Evaluate differs from non-threshold evaluation")
+	}
+	if len(result.Parts) != 3 || len(result.Failures) != 0 {
+		t.Errorf("Expected 3 parts and no failures, got %d parts and %v", len(result.Parts), result.Failures)
+	}
+
+	// The same servers evaluating with their coefficients give the same
+	// beta through ThresholdCombine
+	indexes := make([]uint16, len(result.Parts))
+	for i, part := range result.Parts {
+		indexes[i] = uint16(part[0])
+	}
+	combined := make([][]byte, len(indexes))
+	for i, index := range indexes {
+		combined[i], err = servers[index-1].Evaluate(context.Background(), &EvalRequest{Alpha: alpha, Indexes: indexes})
+		if err != nil {
+			t.Fatalf("Evaluate with indexes failed: %v", err)
+		}
+	}
+	if beta, _ := ThresholdCombine(combined); !bytes.Equal(beta, result.Beta) {
+		t.Error("ThresholdMult of raw parts differs from ThresholdCombine")
+	}
+
+	result, err = client.EvaluateTDH(context.Background(), alpha, []byte("ssid-1"))
+	if err != nil {
+		t.Fatalf("EvaluateTDH failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("Client EvaluateTDH differs from non-threshold evaluation")
+	}
+}
+
+// TestClientFailover tests that failing servers are replaced and reported
+func TestClientFailover(t *testing.T) {
+	keyBytes, servers := newTestServers(t, 5, 3)
+	servers[0].err = errors.New("disk on fire")
+	servers[2].err = errors.New("connection refused")
+
+	client, err := NewClient(asShareServers(servers), ClientConfig{Threshold: 3, Retries: 1})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+
+	result, err := client.Evaluate(context.Background(), alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("Client Evaluate differs from non-threshold evaluation")
+	}
+
+	failed := map[uint16]bool{}
+	for _, f := range result.Failures {
+		failed[f.Index] = true
+	}
+	if len(failed) != 2 || !failed[1] || !failed[3] {
+		t.Errorf("Expected servers 1 and 3 to be reported, got %v", result.Failures)
+	}
+	if servers[0].calls.Load() != 2 {
+		t.Errorf("Expected 2 attempts at server 1, got %d", servers[0].calls.Load())
+	}
+
+	// Failed servers are now ranked last and are not asked again
+	stats := client.Stats()
+	if stats[3].Index != 1 && stats[4].Index != 1 {
+		t.Errorf("Failed server 1 should rank last: %+v", stats)
+	}
+	servers[0].calls.Store(0)
+	if _, err := client.Evaluate(context.Background(), alpha); err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if servers[0].calls.Load() != 0 {
+		t.Error("Client asked an unhealthy server while healthy ones were available")
+	}
+}
+
+// TestClientNotEnoughServers tests the error when too many servers fail
+func TestClientNotEnoughServers(t *testing.T) {
+	_, servers := newTestServers(t, 3, 2)
+	servers[0].err = errors.New("down")
+	servers[1].err = errors.New("down")
+
+	client, _ := NewClient(asShareServers(servers), ClientConfig{Threshold: 2})
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+
+	result, err := client.Evaluate(context.Background(), alpha)
+	if !errors.Is(err, ErrNotEnoughServers) {
+		t.Fatalf("Expected ErrNotEnoughServers, got %v", err)
+	}
+	if len(result.Failures) != 2 || result.Beta != nil {
+		t.Errorf("Expected 2 failures and no result, got %+v", result)
+	}
+}
+
+// TestClientTimeout tests per-request timeouts and context cancellation
+func TestClientTimeout(t *testing.T) {
+	keyBytes, servers := newTestServers(t, 4, 2)
+	servers[0].delay = time.Minute
+	servers[1].delay = time.Minute
+
+	client, _ := NewClient(asShareServers(servers), ClientConfig{Threshold: 2, Timeout: 20 * time.Millisecond})
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+
+	result, err := client.Evaluate(context.Background(), alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("Client Evaluate differs from non-threshold evaluation")
+	}
+	for _, f := range result.Failures {
+		if !errors.Is(f.Err, context.DeadlineExceeded) {
+			t.Errorf("Server %d: expected a timeout, got %v", f.Index, f.Err)
+		}
+	}
+
+	// With every server hanging, the caller's context ends the request
+	for _, s := range servers {
+		s.delay = time.Minute
+	}
+	slow, _ := NewClient(asShareServers(servers), ClientConfig{Threshold: 2})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = slow.Evaluate(ctx, alpha)
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrNotEnoughServers) {
+		t.Errorf("Expected a deadline error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Evaluate did not return promptly after the context ended")
+	}
+}
+
+// TestClientRejectsBadParts tests that parts with the wrong index are not combined
+func TestClientRejectsBadParts(t *testing.T) {
+	keyBytes, servers := newTestServers(t, 3, 2)
+
+	// Server 1 answers with server 2's part
+	servers[0].ShareServer = servers[1].ShareServer
+	client, err := NewClient([]ShareServer{
+		&indexOverride{servers[0], 1}, servers[1], servers[2],
+	}, ClientConfig{Threshold: 2})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+
+	result, err := client.Evaluate(context.Background(), alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("Client combined a bad part")
+	}
+	if len(result.Failures) != 1 || result.Failures[0].Index != 1 {
+		t.Errorf("Expected server 1 to be reported, got %v", result.Failures)
+	}
+}
+
+// indexOverride reports a different index than the wrapped server.
+type indexOverride struct {
+	ShareServer
+	index uint16
+}
+
+func (s *indexOverride) Index() uint16 {
+	return s.index
+}
+
+// TestClientOverHTTP runs the client against HTTP share servers
+func TestClientOverHTTP(t *testing.T) {
+	keyBytes, servers := newTestServers(t, 3, 2)
+
+	remotes := make([]ShareServer, len(servers))
+	for i, s := range servers {
+		ts := httptest.NewServer(NewHTTPHandler(s))
+		defer ts.Close()
+		remotes[i] = NewHTTPShareServer(s.Index(), ts.URL, ts.Client())
+	}
+
+	client, err := NewClient(remotes, ClientConfig{Threshold: 2, Extra: 1})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+
+	result, err := client.EvaluateTDH(context.Background(), alpha, []byte("http-ssid"))
+	if err != nil {
+		t.Fatalf("EvaluateTDH failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("Client over HTTP differs from non-threshold evaluation")
+	}
+}
+
+// simnetServer reaches a share server through a simulated network.
+type simnetServer struct {
+	index    uint16
+	endpoint *simnet.Endpoint
+}
+
+func (s *simnetServer) Index() uint16 {
+	return s.index
+}
+
+func (s *simnetServer) Evaluate(ctx context.Context, req *EvalRequest) ([]byte, error) {
+	data, err := req.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return s.endpoint.Call(ctx, s.index, data)
+}
+
+// TestClientOverSimulatedNetwork runs the client against share servers on a
+// network that delays and duplicates packets, with one server unreachable
+// and one whose answers are tampered with
+func TestClientOverSimulatedNetwork(t *testing.T) {
+	keyBytes, servers := newTestServers(t, 5, 3)
+
+	// The servers are nodes 1-5, the client is node 6
+	net := simnet.New(6, simnet.Config{
+		Seed:      1,
+		MaxDelay:  2 * time.Millisecond,
+		Duplicate: 0.2,
+		Intercept: func(p simnet.Packet) []simnet.Packet {
+			switch {
+			case p.To == 1:
+				return nil
+			case p.From == 2:
+				p.Data = append([]byte(nil), p.Data...)
+				p.Data[0] ^= 0x80
+			}
+			return []simnet.Packet{p}
+		},
+	})
+	defer net.Close()
+
+	remotes := make([]ShareServer, len(servers))
+	for i, s := range servers {
+		net.Endpoint(s.Index()).Handle(func(ctx context.Context, from uint16, request []byte) ([]byte, error) {
+			var req EvalRequest
+			if err := req.UnmarshalBinary(request); err != nil {
+				return nil, err
+			}
+			return s.Evaluate(ctx, &req)
+		})
+		remotes[i] = &simnetServer{index: s.Index(), endpoint: net.Endpoint(6)}
+	}
+
+	client, err := NewClient(remotes, ClientConfig{Threshold: 3, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+
+	result, err := client.Evaluate(context.Background(), alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("Client over the simulated network differs from non-threshold evaluation")
+	}
+	failed := map[uint16]bool{}
+	for _, f := range result.Failures {
+		failed[f.Index] = true
+	}
+	if len(failed) != 2 || !failed[1] || !failed[2] {
+		t.Errorf("Expected servers 1 and 2 to be reported, got %v", result.Failures)
+	}
+
+	// The client now prefers the healthy servers
+	result, err = client.EvaluateTDH(context.Background(), alpha, []byte("simnet-ssid"))
+	if err != nil {
+		t.Fatalf("EvaluateTDH failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) || len(result.Failures) != 0 {
+		t.Errorf("EvaluateTDH over the simulated network: failures %v", result.Failures)
+	}
+}
+
+// TestClientVerifiesProofs tests that a client with verification keys
+// replaces a server whose part does not match its key
+func TestClientVerifiesProofs(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+	shares, dealing, err := CreateVerifiableShares(secret, 4, 2)
+	if err != nil {
+		t.Fatalf("CreateVerifiableShares failed: %v", err)
+	}
+
+	// Server 1 evaluates with a wrong share, and proves it correctly
+	servers := make([]*testServer, len(shares))
+	for i := range shares {
+		share := shares[i]
+		if i == 0 {
+			share.Value = scalarFromUint8(7)
+		}
+		local, _ := NewLocalServer(share, nil)
+		servers[i] = &testServer{ShareServer: local}
+	}
+
+	config := ClientConfig{Threshold: 2, Retries: 2, VerificationKeys: dealing.VerificationKeys()}
+	client, err := NewClient(asShareServers(servers), config)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+
+	result, err := client.Evaluate(context.Background(), alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("Client combined a part that failed its proof")
+	}
+	if len(result.Failures) != 1 || result.Failures[0].Index != 1 || !errors.Is(&result.Failures[0], ErrInvalidProof) {
+		t.Errorf("Expected server 1 to fail its proof, got %v", result.Failures)
+	}
+	if calls := servers[0].calls.Load(); calls != 1 {
+		t.Errorf("Server with a wrong part was asked %d times, want 1", calls)
+	}
+
+	// 3HashTDH parts have no proofs
+	if _, err := client.EvaluateTDH(context.Background(), alpha, []byte("ssid")); err == nil {
+		t.Error("EvaluateTDH should fail for a client with verification keys")
+	}
+	if _, err := NewCoordinator(asShareServers(servers), CoordinatorConfig{Client: config, TDH: true}); err == nil {
+		t.Error("NewCoordinator should fail for TDH with verification keys")
+	}
+
+	// Every server needs a key
+	config.VerificationKeys = config.VerificationKeys[:3]
+	if _, err := NewClient(asShareServers(servers), config); err == nil {
+		t.Error("NewClient should fail without a verification key for every server")
+	}
+}
+
+// TestNewClientInvalid tests error handling of NewClient
+func TestNewClientInvalid(t *testing.T) {
+	_, servers := newTestServers(t, 3, 2)
+	shareServers := asShareServers(servers)
+
+	if _, err := NewClient(shareServers, ClientConfig{Threshold: 4}); err == nil {
+		t.Error("NewClient should fail when threshold exceeds the number of servers")
+	}
+	if _, err := NewClient(shareServers, ClientConfig{Threshold: 2, Retries: -1}); err == nil {
+		t.Error("NewClient should fail with negative retries")
+	}
+	if _, err := NewClient(append(shareServers, servers[0]), ClientConfig{Threshold: 2}); err == nil {
+		t.Error("NewClient should fail with duplicate server indexes")
+	}
+}
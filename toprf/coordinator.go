@@ -0,0 +1,163 @@
+package toprf
+
+// Threshold aggregator / coordinator
+//
+// A Coordinator sits between clients and the share servers. A client sends it
+// a single blinded element and gets back a single beta, exactly as if it were
+// talking to one non-threshold OPRF server; the coordinator collects the parts
+// from the share servers with a Client, checks them and combines them. It only
+// ever handles the blinded element alpha and the combined beta, never the
+// client's input or the unblinded result.
+//
+// In ThreeHashTDH mode the coordinator picks a fresh random session
+// identifier for every request, so the zero-sharing terms differ between
+// sessions.
+//
+// With Verify set, the coordinator asks for one part more than the threshold
+// and checks that every threshold-sized subset of the parts combines to the
+// same beta. A single wrong part then makes the request fail instead of
+// silently producing a wrong result.
+//
+// With Client.VerificationKeys set, the coordinator checks the proof of every
+// part instead, and a server with a wrong part is replaced rather than
+// failing the request. Proofs cover plain Evaluate only, so they cannot be
+// combined with TDH.
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gtank/ristretto255"
+)
+
+// ErrInconsistentParts is returned by a verifying Coordinator when the parts
+// of the share servers do not all lie on the same polynomial.
+var ErrInconsistentParts = errors.New("toprf: share servers returned inconsistent parts")
+
+// CoordinatorConfig configures a Coordinator.
+//
+//   - Client: configuration of the client used to reach the share servers;
+//     Client.Threshold is the threshold of the key
+//   - TDH: evaluate with ThreeHashTDH instead of plain Evaluate
+//   - Verify: cross-check one extra part before answering
+type CoordinatorConfig struct {
+	Client ClientConfig
+	TDH    bool
+	Verify bool
+}
+
+// Coordinator aggregates partial evaluations from share servers on behalf of
+// clients. A Coordinator is safe for concurrent use.
+type Coordinator struct {
+	client *Client
+	tdh    bool
+	verify bool
+}
+
+// NewCoordinator creates a coordinator for the given share servers.
+func NewCoordinator(servers []ShareServer, config CoordinatorConfig) (*Coordinator, error) {
+	clientConfig := config.Client
+	if config.TDH && clientConfig.VerificationKeys != nil {
+		return nil, errors.New("toprf: 3HashTDH parts cannot be proven")
+	}
+	if config.Verify {
+		if clientConfig.Threshold == 0xffff {
+			return nil, errors.New("toprf: invalid threshold parameters")
+		}
+		clientConfig.Threshold++
+	}
+
+	client, err := NewClient(servers, clientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Coordinator{
+		client: client,
+		tdh:    config.TDH,
+		verify: config.Verify,
+	}, nil
+}
+
+// Evaluate computes beta for a client's blinded element alpha.
+func (c *Coordinator) Evaluate(ctx context.Context, alpha []byte) ([]byte, error) {
+	var result *EvalResult
+	var err error
+	if c.tdh {
+		ssid := make([]byte, 32)
+		if _, err := rand.Read(ssid); err != nil {
+			return nil, err
+		}
+		result, err = c.client.EvaluateTDH(ctx, alpha, ssid)
+	} else {
+		result, err = c.client.Evaluate(ctx, alpha)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.verify {
+		if err := c.checkParts(result); err != nil {
+			return nil, err
+		}
+	}
+
+	return result.Beta, nil
+}
+
+// checkParts verifies that every subset of threshold parts combines to the
+// same beta as all parts together.
+func (c *Coordinator) checkParts(result *EvalResult) error {
+	for skip := range result.Parts {
+		subset := make([][]byte, 0, len(result.Parts)-1)
+		subset = append(subset, result.Parts[:skip]...)
+		subset = append(subset, result.Parts[skip+1:]...)
+
+		beta, err := ThresholdMult16(subset)
+		if err != nil {
+			return err
+		}
+		if subtle.ConstantTimeCompare(beta, result.Beta) != 1 {
+			return ErrInconsistentParts
+		}
+	}
+	return nil
+}
+
+// Stats returns the health statistics of the share servers.
+func (c *Coordinator) Stats() []ServerStats {
+	return c.client.Stats()
+}
+
+// ServeHTTP serves evaluations over HTTP. It accepts POST requests whose body
+// is the 32 byte blinded element and responds with the 32 byte beta.
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	alpha, err := io.ReadAll(io.LimitReader(r.Body, ElementBytes+1))
+	if err != nil || len(alpha) != ElementBytes ||
+		ristretto255.NewElement().Decode(alpha) != nil {
+		http.Error(w, "invalid blinded element", http.StatusBadRequest)
+		return
+	}
+
+	beta, err := c.Evaluate(r.Context(), alpha)
+	switch {
+	case errors.Is(err, ErrNotEnoughServers):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(beta)
+}
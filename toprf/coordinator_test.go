@@ -0,0 +1,137 @@
+package toprf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// wrongServer returns a well-formed part computed with a wrong share.
+type wrongServer struct {
+	index uint16
+}
+
+func (s *wrongServer) Index() uint16 {
+	return s.index
+}
+
+func (s *wrongServer) Evaluate(ctx context.Context, req *EvalRequest) ([]byte, error) {
+	return Evaluate16(Share16{Index: s.index, Value: scalarFromUint8(7)}, req.Alpha, req.Indexes)
+}
+
+// TestCoordinator runs a client through a coordinator in both modes
+func TestCoordinator(t *testing.T) {
+	for _, tdh := range []bool{false, true} {
+		keyBytes, servers := newTestServers(t, 7, 4)
+		coordinator, err := NewCoordinator(asShareServers(servers), CoordinatorConfig{
+			Client: ClientConfig{Threshold: 4},
+			TDH:    tdh,
+			Verify: true,
+		})
+		if err != nil {
+			t.Fatalf("NewCoordinator failed: %v", err)
+		}
+
+		ts := httptest.NewServer(coordinator)
+		defer ts.Close()
+
+		// The mobile client only talks to the coordinator
+		input := []byte("mobile password")
+		r, alpha, _ := oprf.Blind(input, nil)
+
+		resp, err := ts.Client().Post(ts.URL, "application/octet-stream", bytes.NewReader(alpha))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		beta, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Coordinator returned %s: %s", resp.Status, beta)
+		}
+
+		n, err := oprf.Unblind(r, beta)
+		if err != nil {
+			t.Fatalf("Unblind failed: %v", err)
+		}
+		output, _ := oprf.Finalize(input, n)
+
+		expectedBeta, _ := oprf.Evaluate(keyBytes, alpha)
+		expectedN, _ := oprf.Unblind(r, expectedBeta)
+		expected, _ := oprf.Finalize(input, expectedN)
+		if !bytes.Equal(output, expected) {
+			t.Errorf("TDH=%v: coordinator output differs from non-threshold output", tdh)
+		}
+	}
+}
+
+// TestCoordinatorDetectsWrongPart tests the cross-check of a verifying coordinator
+func TestCoordinatorDetectsWrongPart(t *testing.T) {
+	_, servers := newTestServers(t, 3, 2)
+	shareServers := []ShareServer{servers[0], servers[1], &wrongServer{index: 3}}
+
+	coordinator, err := NewCoordinator(shareServers, CoordinatorConfig{
+		Client: ClientConfig{Threshold: 2},
+		Verify: true,
+	})
+	if err != nil {
+		t.Fatalf("NewCoordinator failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("password"), nil)
+	if _, err := coordinator.Evaluate(context.Background(), alpha); !errors.Is(err, ErrInconsistentParts) {
+		t.Errorf("Expected ErrInconsistentParts, got %v", err)
+	}
+
+	// Without the wrong server, verification succeeds
+	coordinator, _ = NewCoordinator(asShareServers(servers), CoordinatorConfig{
+		Client: ClientConfig{Threshold: 2},
+		Verify: true,
+	})
+	if _, err := coordinator.Evaluate(context.Background(), alpha); err != nil {
+		t.Errorf("Evaluate failed: %v", err)
+	}
+}
+
+// TestCoordinatorHTTPErrors tests HTTP error handling of the coordinator
+func TestCoordinatorHTTPErrors(t *testing.T) {
+	_, servers := newTestServers(t, 3, 2)
+	servers[0].err = errors.New("down")
+	servers[1].err = errors.New("down")
+
+	coordinator, _ := NewCoordinator(asShareServers(servers), CoordinatorConfig{
+		Client: ClientConfig{Threshold: 2},
+	})
+	ts := httptest.NewServer(coordinator)
+	defer ts.Close()
+
+	alpha := ristretto255.NewElement().ScalarBaseMult(scalarFromUint8(9)).Encode(nil)
+	testCases := []struct {
+		name   string
+		body   []byte
+		status int
+	}{
+		{"short element", alpha[:31], http.StatusBadRequest},
+		{"invalid element", bytes.Repeat([]byte{0xff}, ElementBytes), http.StatusBadRequest},
+		{"servers down", alpha, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := ts.Client().Post(ts.URL, "application/octet-stream", bytes.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("POST failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Errorf("Expected status %d, got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package toprf
+
+// Verifiable dealer setup
+//
+// CreateShares hands out bare shares, so a server that receives one cannot
+// tell whether it is consistent with the shares of the other servers.
+// CreateVerifiableShares additionally returns a Dealing: Feldman commitments
+// C_k = g^a_k to the coefficients of the sharing polynomial, from which follow
+// the group public key C_0 = g^secret and the verification key
+// g^f(i) = C_0 * C_1^i * ... * C_{t-1}^(i^(t-1)) of every share. The dealer
+// publishes the Dealing to all servers, and each server checks its share on
+// receipt with VerifyShare. This is the same check dkg.VerifyCommitment
+// performs for shares received during a DKG.
+
+import (
+	"errors"
+
+	"github.com/gtank/ristretto255"
+)
+
+// Dealing is the public output of a dealer: the parameters of the sharing
+// and the Feldman commitments to the sharing polynomial.
+type Dealing struct {
+	N           uint8
+	Threshold   uint8
+	Commitments []*ristretto255.Element
+}
+
+// CreateVerifiableShares splits a secret into n shares like CreateShares, and
+// also returns the Dealing that servers use to verify their shares.
+func CreateVerifiableShares(secret *ristretto255.Scalar, n, threshold uint8) ([]Share, *Dealing, error) {
+	shares, coeffs, err := createShares(secret, n, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitments := make([]*ristretto255.Element, threshold)
+	commitments[0] = ristretto255.NewElement().ScalarBaseMult(secret)
+	for k := range coeffs {
+		commitments[k+1] = ristretto255.NewElement().ScalarBaseMult(coeffs[k])
+	}
+
+	return shares, &Dealing{N: n, Threshold: threshold, Commitments: commitments}, nil
+}
+
+// PublicKey returns the group public key g^secret.
+func (d *Dealing) PublicKey() *ristretto255.Element {
+	return ristretto255.NewElement().Set(d.Commitments[0])
+}
+
+// VerificationKey returns g^s_index, the public counterpart of share index.
+func (d *Dealing) VerificationKey(index uint8) (*ristretto255.Element, error) {
+	if index < 1 || index > d.N {
+		return nil, errors.New("toprf: index out of range")
+	}
+	return EvaluateCommitments(d.Commitments, index), nil
+}
+
+// VerificationKeys returns the verification keys of all n shares, in index
+// order.
+func (d *Dealing) VerificationKeys() []*ristretto255.Element {
+	keys := make([]*ristretto255.Element, d.N)
+	for i := uint8(1); i <= d.N; i++ {
+		keys[i-1] = EvaluateCommitments(d.Commitments, i)
+	}
+	return keys
+}
+
+// VerifyShare checks that share is consistent with the dealing.
+func (d *Dealing) VerifyShare(share Share) error {
+	if share.Index < 1 || share.Index > d.N {
+		return errors.New("toprf: index out of range")
+	}
+	return VerifyShare(share, d.Commitments)
+}
+
+// MarshalBinary encodes a Dealing for publication.
+// Format: [n:1 byte][threshold:1 byte][commitments:threshold*32 bytes]
+func (d *Dealing) MarshalBinary() ([]byte, error) {
+	if len(d.Commitments) != int(d.Threshold) {
+		return nil, errors.New("toprf: wrong number of commitments")
+	}
+
+	data := make([]byte, 2, 2+len(d.Commitments)*ElementBytes)
+	data[0] = d.N
+	data[1] = d.Threshold
+	for _, c := range d.Commitments {
+		data = c.Encode(data)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a Dealing from bytes.
+func (d *Dealing) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return errors.New("toprf: invalid dealing length")
+	}
+
+	n, threshold := data[0], data[1]
+	if threshold < 1 || threshold > n {
+		return errors.New("toprf: invalid threshold parameters")
+	}
+	if len(data) != 2+int(threshold)*ElementBytes {
+		return errors.New("toprf: invalid dealing length")
+	}
+
+	commitments := make([]*ristretto255.Element, threshold)
+	for k := range commitments {
+		commitments[k] = ristretto255.NewElement()
+		if err := commitments[k].Decode(data[2+k*ElementBytes : 2+(k+1)*ElementBytes]); err != nil {
+			return err
+		}
+	}
+
+	d.N = n
+	d.Threshold = threshold
+	d.Commitments = commitments
+	return nil
+}
+
+// VerifyShare checks a share against Feldman commitments to the sharing
+// polynomial: g^share.Value must equal the commitments evaluated at
+// share.Index.
+func VerifyShare(share Share, commitments []*ristretto255.Element) error {
+	return VerifyShare16(share.Wide(), commitments)
+}
+
+// EvaluateCommitments evaluates committed polynomial coefficients "in the
+// exponent" at point x, returning g^f(x) = C[0] * C[1]^x * ... * C[t-1]^x^(t-1).
+// For Feldman commitments to a sharing polynomial this is the verification
+// key of index x.
+// This is used internally but also exported for use by the DKG package.
+func EvaluateCommitments(commitments []*ristretto255.Element, x uint8) *ristretto255.Element {
+	return EvaluateCommitments16(commitments, uint16(x))
+}
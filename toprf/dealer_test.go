@@ -0,0 +1,102 @@
+package toprf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// TestCreateVerifiableShares tests that every share verifies against the dealing
+func TestCreateVerifiableShares(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	shares, dealing, err := CreateVerifiableShares(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("CreateVerifiableShares failed: %v", err)
+	}
+
+	if dealing.PublicKey().Equal(ristretto255.NewElement().ScalarBaseMult(secret)) != 1 {
+		t.Error("Public key does not match the secret")
+	}
+
+	keys := dealing.VerificationKeys()
+	for i, share := range shares {
+		if err := dealing.VerifyShare(share); err != nil {
+			t.Errorf("Share %d: VerifyShare failed: %v", share.Index, err)
+		}
+		if keys[i].Equal(ristretto255.NewElement().ScalarBaseMult(share.Value)) != 1 {
+			t.Errorf("Share %d: verification key mismatch", share.Index)
+		}
+	}
+
+	// The shares are ordinary Shamir shares of the secret
+	reconstructed := interpolate(0, shares[2:])
+	if !bytes.Equal(reconstructed.Encode(nil), secret.Encode(nil)) {
+		t.Error("Failed to reconstruct secret from verifiable shares")
+	}
+}
+
+// TestVerifyShareRejectsInconsistent tests detection of a bad share
+func TestVerifyShareRejectsInconsistent(t *testing.T) {
+	secret := scalarFromUint8(99)
+	shares, dealing, err := CreateVerifiableShares(secret, 3, 2)
+	if err != nil {
+		t.Fatalf("CreateVerifiableShares failed: %v", err)
+	}
+
+	// A share from a different sharing of the same secret
+	other, _ := CreateShares(secret, 3, 2)
+	if err := dealing.VerifyShare(other[1]); err == nil {
+		t.Error("VerifyShare accepted a share from a different polynomial")
+	}
+
+	// A correct value under the wrong index
+	if err := dealing.VerifyShare(Share{Index: 3, Value: shares[0].Value}); err == nil {
+		t.Error("VerifyShare accepted a share under the wrong index")
+	}
+
+	if err := dealing.VerifyShare(Share{Index: 4, Value: shares[0].Value}); err == nil {
+		t.Error("VerifyShare accepted an index outside the dealing")
+	}
+}
+
+// TestDealingMarshal tests Dealing serialization/deserialization
+func TestDealingMarshal(t *testing.T) {
+	shares, dealing, err := CreateVerifiableShares(scalarFromUint8(5), 4, 3)
+	if err != nil {
+		t.Fatalf("CreateVerifiableShares failed: %v", err)
+	}
+
+	data, err := dealing.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if len(data) != 2+3*ElementBytes {
+		t.Errorf("Marshaled dealing has wrong length: %d", len(data))
+	}
+
+	var decoded Dealing
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.N != 4 || decoded.Threshold != 3 {
+		t.Errorf("Parameter mismatch: n=%d threshold=%d", decoded.N, decoded.Threshold)
+	}
+	for _, share := range shares {
+		if err := decoded.VerifyShare(share); err != nil {
+			t.Errorf("Share %d does not verify against decoded dealing: %v", share.Index, err)
+		}
+	}
+
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("UnmarshalBinary accepted a truncated dealing")
+	}
+	bad := append([]byte{2, 3}, data[2:]...)
+	if err := decoded.UnmarshalBinary(bad); err == nil {
+		t.Error("UnmarshalBinary accepted threshold > n")
+	}
+}
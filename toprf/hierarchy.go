@@ -0,0 +1,254 @@
+package toprf
+
+// Hierarchical access structures
+//
+// Flat Shamir sharing lets any threshold servers evaluate. Policies such as
+// "2 of the 3 security officers, plus 3 of the 5 regional servers" need nested
+// thresholds. They are expressed as a tree of threshold gates:
+//
+//	policy := toprf.NewGate(2,
+//		toprf.NewGate(2, toprf.NewLeaf(1), toprf.NewLeaf(2), toprf.NewLeaf(3)),
+//		toprf.NewGate(3, toprf.NewLeaf(4), toprf.NewLeaf(5), toprf.NewLeaf(6),
+//			toprf.NewLeaf(7), toprf.NewLeaf(8)),
+//	)
+//
+// The secret is shared recursively: a gate with threshold t and m children
+// splits its value with a random polynomial of degree t-1 and gives f(j) to
+// its j-th child. Each leaf holds the value that reached it as the share of
+// one server.
+//
+// To evaluate, a satisfying set of servers is fixed in advance. At every gate
+// the first t satisfied children are used, and a server's coefficient is the
+// product of the Lagrange coefficients along its path to the root. Servers
+// multiply their share by that coefficient exactly like Evaluate does with
+// the flat coefficient, and the client adds the parts with ThresholdCombine.
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/gtank/ristretto255"
+)
+
+// Gate is a node of a hierarchical access structure. A leaf stands for a
+// server; an inner node is satisfied when at least Threshold of its children
+// are satisfied.
+type Gate struct {
+	Threshold uint8
+	Children  []*Gate
+	Server    uint8
+}
+
+// NewLeaf returns the leaf for a server index.
+func NewLeaf(server uint8) *Gate {
+	return &Gate{Server: server}
+}
+
+// NewGate returns a gate satisfied by threshold of its children.
+func NewGate(threshold uint8, children ...*Gate) *Gate {
+	return &Gate{Threshold: threshold, Children: children}
+}
+
+// IsLeaf reports whether the gate is a leaf.
+func (g *Gate) IsLeaf() bool {
+	return len(g.Children) == 0
+}
+
+// Validate checks the structure: every inner gate has 1 <= threshold <=
+// children <= 255, and every server index is non-zero and appears once.
+func (g *Gate) Validate() error {
+	return g.validate(make(map[uint8]bool))
+}
+
+func (g *Gate) validate(seen map[uint8]bool) error {
+	if g.IsLeaf() {
+		if g.Server == 0 {
+			return errors.New("toprf: server index must be > 0")
+		}
+		if seen[g.Server] {
+			return errors.New("toprf: server appears more than once")
+		}
+		seen[g.Server] = true
+		return nil
+	}
+
+	if len(g.Children) > 255 || g.Threshold < 1 || int(g.Threshold) > len(g.Children) {
+		return errors.New("toprf: invalid gate threshold")
+	}
+	for _, child := range g.Children {
+		if err := child.validate(seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Servers returns the server indexes of all leaves, sorted.
+func (g *Gate) Servers() []uint8 {
+	var servers []uint8
+	g.walk(func(leaf *Gate) { servers = append(servers, leaf.Server) })
+	sort.Slice(servers, func(i, j int) bool { return servers[i] < servers[j] })
+	return servers
+}
+
+// walk calls fn for every leaf, depth first.
+func (g *Gate) walk(fn func(leaf *Gate)) {
+	if g.IsLeaf() {
+		fn(g)
+		return
+	}
+	for _, child := range g.Children {
+		child.walk(fn)
+	}
+}
+
+// Satisfied reports whether the given servers satisfy the structure.
+func (g *Gate) Satisfied(servers []uint8) bool {
+	if g.IsLeaf() {
+		return containsIndex(servers, g.Server)
+	}
+
+	count := 0
+	for _, child := range g.Children {
+		if child.Satisfied(servers) {
+			count++
+		}
+	}
+	return count >= int(g.Threshold)
+}
+
+// CreateHierarchicalShares splits a secret according to the access structure
+// rooted at root. Returns one share per server, sorted by server index.
+func CreateHierarchicalShares(secret *ristretto255.Scalar, root *Gate) ([]Share, error) {
+	if err := root.Validate(); err != nil {
+		return nil, err
+	}
+
+	var shares []Share
+	if err := root.share(secret, &shares); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Index < shares[j].Index })
+	return shares, nil
+}
+
+// share hands value down the tree, appending the leaves' shares.
+func (g *Gate) share(value *ristretto255.Scalar, shares *[]Share) error {
+	if g.IsLeaf() {
+		*shares = append(*shares, Share{Index: g.Server, Value: value})
+		return nil
+	}
+
+	parts, err := CreateShares(value, uint8(len(g.Children)), g.Threshold)
+	if err != nil {
+		return err
+	}
+	for j, child := range g.Children {
+		if err := child.share(parts[j].Value, shares); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Coefficients returns the path coefficient of every server that takes part
+// in an evaluation by the given servers. Servers that are not needed to
+// satisfy the structure are not included. Returns an error if the servers do
+// not satisfy the structure.
+func (g *Gate) Coefficients(servers []uint8) (map[uint8]*ristretto255.Scalar, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	if !g.Satisfied(servers) {
+		return nil, errors.New("toprf: servers do not satisfy the access structure")
+	}
+
+	coefficients := make(map[uint8]*ristretto255.Scalar)
+	g.coefficients(servers, scalarFromUint8(1), coefficients)
+	return coefficients, nil
+}
+
+// coefficients multiplies coef by the Lagrange coefficients along the paths
+// to the chosen leaves.
+func (g *Gate) coefficients(servers []uint8, coef *ristretto255.Scalar, out map[uint8]*ristretto255.Scalar) {
+	if g.IsLeaf() {
+		out[g.Server] = coef
+		return
+	}
+
+	// Use the first threshold satisfied children
+	var chosen []uint8
+	for j, child := range g.Children {
+		if len(chosen) == int(g.Threshold) {
+			break
+		}
+		if child.Satisfied(servers) {
+			chosen = append(chosen, uint8(j+1))
+		}
+	}
+
+	for _, j := range chosen {
+		c := ristretto255.NewScalar().Multiply(coef, coeff(j, chosen))
+		g.Children[j-1].coefficients(servers, c, out)
+	}
+}
+
+// EvaluateHierarchical performs a partial evaluation for a hierarchical
+// sharing. servers is the set of servers the client sent the request to; it
+// must satisfy the structure and include share.Index.
+//
+// The result is a Part with the path coefficient already applied. Combine
+// the parts of all servers with ThresholdCombine.
+func EvaluateHierarchical(share Share, blinded []byte, root *Gate, servers []uint8) ([]byte, error) {
+	coefficients, err := root.Coefficients(servers)
+	if err != nil {
+		return nil, err
+	}
+
+	c, ok := coefficients[share.Index]
+	if !ok {
+		return nil, errors.New("toprf: server does not take part in this evaluation")
+	}
+
+	// With no peers the Lagrange coefficient is 1, so only c is applied
+	beta, err := evaluate(Share16{Index: uint16(share.Index), Value: ristretto255.NewScalar().Multiply(share.Value, c)}, blinded, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	part := Part{Index: share.Index, Element: beta}
+	return part.MarshalBinary()
+}
+
+// ReconstructHierarchical recovers the secret from the shares of a set of
+// servers that satisfies the structure.
+func ReconstructHierarchical(root *Gate, shares []Share) (*ristretto255.Scalar, error) {
+	servers := make([]uint8, len(shares))
+	for i, share := range shares {
+		servers[i] = share.Index
+	}
+
+	coefficients, err := root.Coefficients(servers)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := ristretto255.NewScalar()
+	for _, share := range shares {
+		if c, ok := coefficients[share.Index]; ok {
+			secret.Add(secret, ristretto255.NewScalar().Multiply(c, share.Value))
+		}
+	}
+	return secret, nil
+}
+
+// containsIndex reports whether index is in indexes.
+func containsIndex(indexes []uint8, index uint8) bool {
+	for _, i := range indexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package toprf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// officersAndRegions is "2 of the 3 officers (1-3), plus 3 of the 5 regional
+// servers (4-8)"
+func officersAndRegions() *Gate {
+	return NewGate(2,
+		NewGate(2, NewLeaf(1), NewLeaf(2), NewLeaf(3)),
+		NewGate(3, NewLeaf(4), NewLeaf(5), NewLeaf(6), NewLeaf(7), NewLeaf(8)),
+	)
+}
+
+// TestHierarchicalSatisfied tests the access structure itself
+func TestHierarchicalSatisfied(t *testing.T) {
+	policy := officersAndRegions()
+	if err := policy.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if servers := policy.Servers(); len(servers) != 8 || servers[7] != 8 {
+		t.Errorf("Servers = %v", servers)
+	}
+
+	testCases := []struct {
+		servers   []uint8
+		satisfied bool
+	}{
+		{[]uint8{1, 2, 4, 5, 6}, true},
+		{[]uint8{3, 1, 8, 6, 4, 5}, true},
+		{[]uint8{1, 2, 3, 4, 5}, false},
+		{[]uint8{1, 4, 5, 6, 7, 8}, false},
+	}
+	for _, tc := range testCases {
+		if got := policy.Satisfied(tc.servers); got != tc.satisfied {
+			t.Errorf("Satisfied(%v) = %v, want %v", tc.servers, got, tc.satisfied)
+		}
+	}
+
+	if err := NewGate(2, NewLeaf(1), NewLeaf(1)).Validate(); err == nil {
+		t.Error("Validate accepted a duplicate server")
+	}
+	if err := NewGate(3, NewLeaf(1), NewLeaf(2)).Validate(); err == nil {
+		t.Error("Validate accepted threshold > children")
+	}
+}
+
+// TestHierarchicalEvaluate tests evaluation by authorized sets
+func TestHierarchicalEvaluate(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	policy := officersAndRegions()
+	shares, err := CreateHierarchicalShares(secret, policy)
+	if err != nil {
+		t.Fatalf("CreateHierarchicalShares failed: %v", err)
+	}
+
+	input := []byte("policy")
+	r, alpha, _ := oprf.Blind(input, nil)
+	expectedBeta, _ := oprf.Evaluate(keyBytes, alpha)
+	expectedN, _ := oprf.Unblind(r, expectedBeta)
+
+	for _, servers := range [][]uint8{{1, 2, 4, 5, 6}, {2, 3, 6, 7, 8}, {1, 2, 3, 4, 5, 6, 7, 8}} {
+		coefficients, err := policy.Coefficients(servers)
+		if err != nil {
+			t.Fatalf("Coefficients(%v) failed: %v", servers, err)
+		}
+
+		// Only the servers with a coefficient are asked
+		var parts [][]byte
+		var used []Share
+		for _, share := range shares {
+			if _, ok := coefficients[share.Index]; !ok {
+				continue
+			}
+			part, err := EvaluateHierarchical(share, alpha, policy, servers)
+			if err != nil {
+				t.Fatalf("Server %d: EvaluateHierarchical failed: %v", share.Index, err)
+			}
+			parts = append(parts, part)
+			used = append(used, share)
+		}
+		if len(parts) != 5 {
+			t.Errorf("Servers %v: expected 5 parts, got %d", servers, len(parts))
+		}
+
+		beta, _ := ThresholdCombine(parts)
+		n, _ := oprf.Unblind(r, beta)
+		if !bytes.Equal(n, expectedN) {
+			t.Errorf("Servers %v: output differs from non-threshold output", servers)
+		}
+
+		reconstructed, err := ReconstructHierarchical(policy, used)
+		if err != nil || !bytes.Equal(reconstructed.Encode(nil), secret.Encode(nil)) {
+			t.Errorf("Servers %v: ReconstructHierarchical failed: %v", servers, err)
+		}
+	}
+
+	// Three officers and two regional servers are not authorized
+	if _, err := EvaluateHierarchical(shares[0], alpha, policy, []uint8{1, 2, 3, 4, 5}); err == nil {
+		t.Error("EvaluateHierarchical accepted an unauthorized set")
+	}
+}
@@ -0,0 +1,424 @@
+package toprf
+
+// 16-bit participant indexes
+//
+// Share, Part and the functions operating on them use uint8 indexes, which
+// caps a group at 255 members like liboprf does. Share16 and Part16 carry
+// 16-bit indexes for large committees and for weighted setups, where one
+// party holds many shares. The uint8 functions are thin wrappers around the
+// 16-bit implementations in this file, so both compute identical values for
+// indexes up to 255.
+//
+// The 33-byte encodings of Share and Part have no room for a wider index, so
+// the 16-bit encodings start with a format version byte:
+//
+//	[version:1 byte][index:2 bytes big-endian][value:32 bytes] = 35 bytes
+//
+// Share16 and Part16 also accept the 33-byte encodings, so stored shares and
+// parts from servers that only speak the 8-bit format keep working.
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// FormatVersion16 is the version byte of the 16-bit index encodings
+	FormatVersion16 = 2
+
+	// Share16Bytes is the size of a serialized Share16 (1 byte version + 2 byte index + 32 byte value)
+	Share16Bytes = 35
+
+	// Part16Bytes is the size of a serialized Part16 (1 byte version + 2 byte index + 32 byte element)
+	Part16Bytes = 35
+)
+
+// Share16 is a Share with a 16-bit index (1-based, 1..65535).
+type Share16 struct {
+	Index uint16
+	Value *ristretto255.Scalar
+}
+
+// Wide returns the share with a 16-bit index.
+func (s Share) Wide() Share16 {
+	return Share16{Index: uint16(s.Index), Value: s.Value}
+}
+
+// Narrow returns the share with an 8-bit index, or an error if the index does
+// not fit.
+func (s Share16) Narrow() (Share, error) {
+	if s.Index > 255 {
+		return Share{}, errors.New("toprf: index does not fit in 8 bits")
+	}
+	return Share{Index: uint8(s.Index), Value: s.Value}, nil
+}
+
+// MarshalBinary encodes a Share16 in the versioned 16-bit format.
+// Format: [version:1 byte][index:2 bytes][value:32 bytes] = 35 bytes total
+func (s *Share16) MarshalBinary() ([]byte, error) {
+	if s.Value == nil {
+		return nil, errors.New("toprf: share value is nil")
+	}
+
+	data := make([]byte, 3, Share16Bytes)
+	data[0] = FormatVersion16
+	binary.BigEndian.PutUint16(data[1:3], s.Index)
+	return s.Value.Encode(data), nil
+}
+
+// UnmarshalBinary decodes a Share16 from either the 35-byte versioned
+// encoding or the 33-byte encoding of a Share.
+func (s *Share16) UnmarshalBinary(data []byte) error {
+	index, value, err := decodeIndexed16(data)
+	if err != nil {
+		return err
+	}
+
+	s.Index = index
+	s.Value = ristretto255.NewScalar()
+	return s.Value.Decode(value)
+}
+
+// Part16 is a Part with a 16-bit index.
+type Part16 struct {
+	Index   uint16
+	Element *ristretto255.Element
+}
+
+// Wide returns the part with a 16-bit index.
+func (p Part) Wide() Part16 {
+	return Part16{Index: uint16(p.Index), Element: p.Element}
+}
+
+// Narrow returns the part with an 8-bit index, or an error if the index does
+// not fit.
+func (p Part16) Narrow() (Part, error) {
+	if p.Index > 255 {
+		return Part{}, errors.New("toprf: index does not fit in 8 bits")
+	}
+	return Part{Index: uint8(p.Index), Element: p.Element}, nil
+}
+
+// MarshalBinary encodes a Part16 in the versioned 16-bit format.
+// Format: [version:1 byte][index:2 bytes][element:32 bytes] = 35 bytes total
+func (p *Part16) MarshalBinary() ([]byte, error) {
+	if p.Element == nil {
+		return nil, errors.New("toprf: part element is nil")
+	}
+
+	data := make([]byte, 3, Part16Bytes)
+	data[0] = FormatVersion16
+	binary.BigEndian.PutUint16(data[1:3], p.Index)
+	return p.Element.Encode(data), nil
+}
+
+// UnmarshalBinary decodes a Part16 from either the 35-byte versioned
+// encoding or the 33-byte encoding of a Part.
+func (p *Part16) UnmarshalBinary(data []byte) error {
+	index, element, err := decodeIndexed16(data)
+	if err != nil {
+		return err
+	}
+
+	p.Index = index
+	p.Element = ristretto255.NewElement()
+	return p.Element.Decode(element)
+}
+
+// decodeIndexed16 splits an encoded share or part into its index and its
+// 32-byte value, accepting both the legacy and the versioned format.
+func decodeIndexed16(data []byte) (uint16, []byte, error) {
+	switch len(data) {
+	case ShareBytes:
+		return uint16(data[0]), data[1:], nil
+	case Share16Bytes:
+		if data[0] != FormatVersion16 {
+			return 0, nil, errors.New("toprf: unsupported format version")
+		}
+		return binary.BigEndian.Uint16(data[1:3]), data[3:], nil
+	default:
+		return 0, nil, errors.New("toprf: invalid encoding length")
+	}
+}
+
+// widenIndexes converts 8-bit indexes to 16-bit indexes.
+func widenIndexes(indexes []uint8) []uint16 {
+	wide := make([]uint16, len(indexes))
+	for i, index := range indexes {
+		wide[i] = uint16(index)
+	}
+	return wide
+}
+
+// scalarFromUint16 creates a ristretto255 scalar from a uint16 value
+func scalarFromUint16(v uint16) *ristretto255.Scalar {
+	s := ristretto255.NewScalar()
+	var buf [32]byte
+	binary.LittleEndian.PutUint16(buf[:2], v)
+	s.Decode(buf[:])
+	return s
+}
+
+// lcoeff16 computes the Lagrange coefficient of index for interpolation at
+// point x: ∏(x - peers[j]) / ∏(index - peers[j]) for peers[j] != index.
+func lcoeff16(index, x uint16, peers []uint16) *ristretto255.Scalar {
+	xScalar := scalarFromUint16(x)
+	iScalar := scalarFromUint16(index)
+	dividend := scalarFromUint16(1)
+	divisor := scalarFromUint16(1)
+
+	for _, peer := range peers {
+		if peer == index {
+			continue
+		}
+
+		peerScalar := scalarFromUint16(peer)
+
+		// dividend *= (x - peer)
+		tmp := ristretto255.NewScalar().Subtract(xScalar, peerScalar)
+		dividend.Multiply(dividend, tmp)
+
+		// divisor *= (index - peer)
+		tmp = ristretto255.NewScalar().Subtract(iScalar, peerScalar)
+		divisor.Multiply(divisor, tmp)
+	}
+
+	// result = dividend / divisor = dividend * divisor^(-1)
+	divisor.Invert(divisor)
+	return ristretto255.NewScalar().Multiply(dividend, divisor)
+}
+
+// LagrangeCoefficient16 is LagrangeCoefficient for 16-bit indexes.
+func LagrangeCoefficient16(index, x uint16, peers []uint16) *ristretto255.Scalar {
+	return lcoeff16(index, x, peers)
+}
+
+// InterpolateScalar16 is InterpolateScalar for 16-bit indexes.
+func InterpolateScalar16(x uint16, shares []Share16) (*ristretto255.Scalar, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("toprf: no shares provided")
+	}
+
+	indexes := make([]uint16, len(shares))
+	for i, share := range shares {
+		indexes[i] = share.Index
+	}
+
+	// For each share, compute l_i(x) * share.value and add to result
+	result := ristretto255.NewScalar()
+	for _, share := range shares {
+		term := ristretto255.NewScalar().Multiply(lcoeff16(share.Index, x, indexes), share.Value)
+		result.Add(result, term)
+	}
+
+	return result, nil
+}
+
+// CreateShares16 is CreateShares for groups of up to 65535 shares.
+func CreateShares16(secret *ristretto255.Scalar, n, threshold uint16) ([]Share16, error) {
+	shares, _, err := createShares16(secret, n, threshold)
+	return shares, err
+}
+
+// createShares16 implements CreateShares16 and also returns the random
+// coefficients a[0], ..., a[threshold-2] of the polynomial.
+func createShares16(secret *ristretto255.Scalar, n, threshold uint16) ([]Share16, []*ristretto255.Scalar, error) {
+	if threshold < 1 || n < threshold {
+		return nil, nil, errors.New("toprf: invalid threshold parameters")
+	}
+
+	// Generate random polynomial coefficients a[0], a[1], ..., a[threshold-2]
+	// f(x) = secret + a[0]*x + a[1]*x^2 + ... + a[threshold-2]*x^(threshold-1)
+	coeffs := make([]*ristretto255.Scalar, threshold-1)
+	for i := range coeffs {
+		var randBytes [64]byte
+		if _, err := rand.Read(randBytes[:]); err != nil {
+			return nil, nil, err
+		}
+		coeffs[i] = ristretto255.NewScalar().FromUniformBytes(randBytes[:])
+	}
+
+	// Create shares f(i) for i in 1..n, evaluating with Horner's rule
+	shares := make([]Share16, n)
+	for i := 1; i <= int(n); i++ {
+		x := scalarFromUint16(uint16(i))
+		value := ristretto255.NewScalar()
+		for j := len(coeffs) - 1; j >= 0; j-- {
+			value.Add(value, coeffs[j])
+			value.Multiply(value, x)
+		}
+		value.Add(value, secret)
+
+		shares[i-1] = Share16{Index: uint16(i), Value: value}
+	}
+
+	return shares, coeffs, nil
+}
+
+// Evaluate16 is Evaluate for 16-bit indexes. It returns a marshaled Part16.
+func Evaluate16(share Share16, blinded []byte, indexes []uint16) ([]byte, error) {
+	beta, err := evaluate(share, blinded, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	part := Part16{Index: share.Index, Element: beta}
+	return part.MarshalBinary()
+}
+
+// evaluate computes alpha^(lambda * share), where lambda is the Lagrange
+// coefficient of the share for f(0) over indexes.
+func evaluate(share Share16, blinded []byte, indexes []uint16) (*ristretto255.Element, error) {
+	if len(blinded) != ElementBytes {
+		return nil, errors.New("toprf: invalid blinded element length")
+	}
+
+	alpha := ristretto255.NewElement()
+	if err := alpha.Decode(blinded); err != nil {
+		return nil, err
+	}
+
+	// Multiply share value by its Lagrange coefficient
+	adjustedKey := ristretto255.NewScalar().Multiply(share.Value, lcoeff16(share.Index, 0, indexes))
+
+	return ristretto255.NewElement().ScalarMult(adjustedKey, alpha), nil
+}
+
+// ThresholdCombine16 is ThresholdCombine for parts in either encoding.
+func ThresholdCombine16(responses [][]byte) ([]byte, error) {
+	if len(responses) == 0 {
+		return nil, errors.New("toprf: no responses to combine")
+	}
+
+	result := ristretto255.NewElement()
+	for _, resp := range responses {
+		var part Part16
+		if err := part.UnmarshalBinary(resp); err != nil {
+			return nil, err
+		}
+		result.Add(result, part.Element)
+	}
+
+	return result.Encode(nil), nil
+}
+
+// ThresholdMult16 is ThresholdMult for parts in either encoding, so 8-bit
+// and 16-bit servers can be combined.
+func ThresholdMult16(responses [][]byte) ([]byte, error) {
+	if len(responses) == 0 {
+		return nil, errors.New("toprf: no responses to combine")
+	}
+
+	parts := make([]Part16, len(responses))
+	for i, resp := range responses {
+		if err := parts[i].UnmarshalBinary(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	return thresholdMult(parts)
+}
+
+// thresholdMult combines raw parts, applying the Lagrange coefficients for
+// f(0) over the indexes of all parts.
+func thresholdMult(parts []Part16) ([]byte, error) {
+	indexes := make([]uint16, len(parts))
+	seen := make(map[uint16]bool, len(parts))
+	for i, part := range parts {
+		if part.Index == 0 {
+			return nil, errors.New("toprf: part index must be > 0")
+		}
+		if seen[part.Index] {
+			return nil, errors.New("toprf: duplicate part index")
+		}
+		seen[part.Index] = true
+		indexes[i] = part.Index
+	}
+
+	result := ristretto255.NewElement()
+	for _, part := range parts {
+		term := ristretto255.NewElement().ScalarMult(lcoeff16(part.Index, 0, indexes), part.Element)
+		result.Add(result, term)
+	}
+
+	return result.Encode(nil), nil
+}
+
+// ThreeHashTDH16 is ThreeHashTDH for 16-bit indexes. It returns a marshaled
+// Part16; combine the parts with ThresholdMult16.
+func ThreeHashTDH16(k, z Share16, alpha, ssid []byte) ([]byte, error) {
+	beta, err := threeHashTDH(k.Value, z.Value, alpha, ssid)
+	if err != nil {
+		return nil, err
+	}
+
+	part := Part16{Index: k.Index, Element: beta}
+	return part.MarshalBinary()
+}
+
+// threeHashTDH computes beta = alpha^k + H(ssid||alpha)^z.
+func threeHashTDH(k, z *ristretto255.Scalar, alpha, ssid []byte) (*ristretto255.Element, error) {
+	if len(alpha) != ElementBytes {
+		return nil, errors.New("toprf: invalid alpha length")
+	}
+
+	// Evaluate alpha with key share k: beta = alpha^k
+	alphaElement := ristretto255.NewElement()
+	if err := alphaElement.Decode(alpha); err != nil {
+		return nil, err
+	}
+	beta := ristretto255.NewElement().ScalarMult(k, alphaElement)
+
+	// Hash ssid and alpha using BLAKE2b
+	// Format: htons(len(ssid)) || ssid || alpha
+	h, err := blake2b.New512(nil)
+	if err != nil {
+		return nil, err
+	}
+	var lenBuf [2]byte
+	binary.BigEndian.PutUint16(lenBuf[:], uint16(len(ssid)))
+	h.Write(lenBuf[:])
+	h.Write(ssid)
+	h.Write(alpha)
+
+	// Hash-to-curve and evaluate with zero-share z: h2 = point^z
+	point := ristretto255.NewElement().FromUniformBytes(h.Sum(nil))
+	h2 := ristretto255.NewElement().ScalarMult(z, point)
+
+	return beta.Add(beta, h2), nil
+}
+
+// EvaluateCommitments16 is EvaluateCommitments for 16-bit indexes.
+func EvaluateCommitments16(commitments []*ristretto255.Element, x uint16) *ristretto255.Element {
+	xScalar := scalarFromUint16(x)
+
+	// Horner's rule in the exponent: v = C[t-1], v = v*x + C[k]
+	v := ristretto255.NewElement().Set(commitments[len(commitments)-1])
+	for k := len(commitments) - 2; k >= 0; k-- {
+		v.ScalarMult(xScalar, v)
+		v.Add(v, commitments[k])
+	}
+
+	return v
+}
+
+// VerifyShare16 is VerifyShare for 16-bit indexes.
+func VerifyShare16(share Share16, commitments []*ristretto255.Element) error {
+	if share.Value == nil {
+		return errors.New("toprf: share value is nil")
+	}
+	if len(commitments) == 0 {
+		return errors.New("toprf: no commitments provided")
+	}
+
+	v0 := ristretto255.NewElement().ScalarBaseMult(share.Value)
+	v1 := EvaluateCommitments16(commitments, share.Index)
+	if v0.Equal(v1) != 1 {
+		return errors.New("toprf: share does not match commitments")
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package toprf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// TestShare16Marshal tests both encodings of Share16
+func TestShare16Marshal(t *testing.T) {
+	share := Share16{Index: 300, Value: scalarFromUint8(42)}
+
+	data, err := share.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if len(data) != Share16Bytes || data[0] != FormatVersion16 {
+		t.Fatalf("Unexpected encoding: %x", data)
+	}
+
+	var decoded Share16
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.Index != 300 || !bytes.Equal(decoded.Value.Encode(nil), share.Value.Encode(nil)) {
+		t.Error("Share16 mismatch after round trip")
+	}
+
+	// A 33-byte Share encoding still parses
+	legacy := Share{Index: 7, Value: scalarFromUint8(42)}
+	legacyData, _ := legacy.MarshalBinary()
+	if err := decoded.UnmarshalBinary(legacyData); err != nil {
+		t.Fatalf("UnmarshalBinary of legacy share failed: %v", err)
+	}
+	if decoded.Index != 7 {
+		t.Errorf("Legacy index = %d, want 7", decoded.Index)
+	}
+
+	// Unknown versions are rejected
+	data[0] = 3
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Error("UnmarshalBinary accepted an unknown format version")
+	}
+
+	if _, err := share.Narrow(); err == nil {
+		t.Error("Narrow accepted index 300")
+	}
+}
+
+// TestThreshold16 tests a threshold evaluation with indexes above 255
+func TestThreshold16(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	shares, err := CreateShares16(secret, 400, 3)
+	if err != nil {
+		t.Fatalf("CreateShares16 failed: %v", err)
+	}
+
+	input := []byte("large committee")
+	r, alpha, _ := oprf.Blind(input, nil)
+	expectedBeta, _ := oprf.Evaluate(keyBytes, alpha)
+
+	// Any threshold shares reconstruct the secret
+	reconstructed, err := InterpolateScalar16(0, []Share16{shares[399], shares[1], shares[299]})
+	if err != nil {
+		t.Fatalf("InterpolateScalar16 failed: %v", err)
+	}
+	if !bytes.Equal(reconstructed.Encode(nil), secret.Encode(nil)) {
+		t.Error("Failed to reconstruct secret from 16-bit shares")
+	}
+
+	// Step 1: Coefficients applied by the servers
+	indexes := []uint16{2, 300, 400}
+	var parts [][]byte
+	for _, i := range indexes {
+		part, err := Evaluate16(shares[i-1], alpha, indexes)
+		if err != nil {
+			t.Fatalf("Evaluate16 failed: %v", err)
+		}
+		parts = append(parts, part)
+	}
+	beta, err := ThresholdCombine16(parts)
+	if err != nil {
+		t.Fatalf("ThresholdCombine16 failed: %v", err)
+	}
+	if !bytes.Equal(beta, expectedBeta) {
+		t.Error("ThresholdCombine16 result differs from non-threshold evaluation")
+	}
+
+	// Step 2: 3HashTDH with client-side coefficients
+	zero, _ := CreateShares16(ristretto255.NewScalar(), 400, 3)
+	parts = nil
+	for _, i := range indexes {
+		part, err := ThreeHashTDH16(shares[i-1], zero[i-1], alpha, []byte("ssid"))
+		if err != nil {
+			t.Fatalf("ThreeHashTDH16 failed: %v", err)
+		}
+		parts = append(parts, part)
+	}
+	beta, err = ThresholdMult16(parts)
+	if err != nil {
+		t.Fatalf("ThresholdMult16 failed: %v", err)
+	}
+	n1, _ := oprf.Unblind(r, beta)
+	n2, _ := oprf.Unblind(r, expectedBeta)
+	if !bytes.Equal(n1, n2) {
+		t.Error("ThresholdMult16 result differs from non-threshold evaluation")
+	}
+}
+
+// TestThresholdMult16MixedEncodings tests combining 8-bit and 16-bit parts
+func TestThresholdMult16MixedEncodings(t *testing.T) {
+	secret := scalarFromUint8(17)
+	shares, _ := CreateShares(secret, 3, 2)
+	alpha := ristretto255.NewElement().ScalarBaseMult(scalarFromUint8(5)).Encode(nil)
+
+	legacy, _ := Evaluate(shares[0], alpha, nil)
+	wide, _ := Evaluate16(shares[2].Wide(), alpha, nil)
+
+	beta, err := ThresholdMult16([][]byte{legacy, wide})
+	if err != nil {
+		t.Fatalf("ThresholdMult16 failed: %v", err)
+	}
+	expected := ristretto255.NewElement().ScalarBaseMult(scalarFromUint8(85)).Encode(nil)
+	if !bytes.Equal(beta, expected) {
+		t.Error("Mixed-encoding combination is wrong")
+	}
+
+	if _, err := ThresholdMult16([][]byte{legacy, legacy}); err == nil {
+		t.Error("ThresholdMult16 accepted duplicate indexes")
+	}
+}
+
+// TestVerifyShare16 tests Feldman verification with indexes above 255
+func TestVerifyShare16(t *testing.T) {
+	secret := scalarFromUint8(3)
+	shares, coeffs, err := createShares16(secret, 1000, 4)
+	if err != nil {
+		t.Fatalf("createShares16 failed: %v", err)
+	}
+
+	commitments := []*ristretto255.Element{ristretto255.NewElement().ScalarBaseMult(secret)}
+	for _, c := range coeffs {
+		commitments = append(commitments, ristretto255.NewElement().ScalarBaseMult(c))
+	}
+
+	for _, i := range []int{0, 254, 255, 999} {
+		if err := VerifyShare16(shares[i], commitments); err != nil {
+			t.Errorf("Share %d: VerifyShare16 failed: %v", shares[i].Index, err)
+		}
+	}
+
+	wrong := Share16{Index: 999, Value: shares[999].Value}
+	if err := VerifyShare16(wrong, commitments); err == nil {
+		t.Error("VerifyShare16 accepted a share under the wrong index")
+	}
+}
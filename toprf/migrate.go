@@ -0,0 +1,138 @@
+package toprf
+
+// Migrating a single-server key
+//
+// Outputs created with a single oprf.KeyGen key stay valid after moving to a
+// threshold deployment if the key itself is shared: the threshold evaluation
+// of shares of k computes exactly alpha^k. MigrateKey is the ceremony for
+// that move, run once by the holder of the old key:
+//
+//  1. The key is split into verifiable shares with CreateVerifiableShares.
+//  2. The group public key C_0 is checked to equal k*G, and against the
+//     previously published public key if there is one.
+//  3. Every share is checked against the dealing.
+//  4. Sample inputs are evaluated with the old key and, through the full
+//     client flow, with two different threshold sets of shares; all outputs
+//     must match.
+//  5. The original key is wiped.
+//
+// If any check fails nothing is returned and the key is left untouched, so
+// the ceremony can be investigated and repeated.
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// MigrateKey splits an existing OPRF key into n verifiable shares, checks
+// that the threshold deployment reproduces the old outputs, and wipes the key.
+//
+// Parameters:
+//   - key: the existing oprf.KeyGen key (32 bytes); zeroed on success
+//   - publicKey: the previously published public key k*G, or nil
+//   - n: number of servers
+//   - threshold: minimum servers needed to evaluate
+//   - samples: inputs whose outputs must not change (at least one)
+//
+// Returns the shares to distribute and the Dealing to publish.
+func MigrateKey(key, publicKey []byte, n, threshold uint8, samples [][]byte) ([]Share, *Dealing, error) {
+	if len(samples) == 0 {
+		return nil, nil, errors.New("toprf: at least one sample input is required")
+	}
+	if len(key) != ScalarBytes {
+		return nil, nil, errors.New("toprf: invalid key length")
+	}
+
+	secret := ristretto255.NewScalar()
+	if err := secret.Decode(key); err != nil {
+		return nil, nil, err
+	}
+	defer secret.Zero()
+	if secret.Equal(ristretto255.NewScalar()) == 1 {
+		return nil, nil, errors.New("toprf: key is zero")
+	}
+
+	shares, dealing, err := CreateVerifiableShares(secret, n, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The group public key must be k*G, and match the published key
+	pk := ristretto255.NewElement().ScalarBaseMult(secret).Encode(nil)
+	if subtle.ConstantTimeCompare(dealing.PublicKey().Encode(nil), pk) != 1 {
+		return nil, nil, errors.New("toprf: group public key does not match the key")
+	}
+	if publicKey != nil && !bytes.Equal(publicKey, pk) {
+		return nil, nil, errors.New("toprf: key does not match the published public key")
+	}
+
+	for _, share := range shares {
+		if err := dealing.VerifyShare(share); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Old and new outputs must match, for the first and the last threshold
+	// servers
+	sets := [][]Share{shares[:threshold], shares[n-threshold:]}
+	for i, input := range samples {
+		expected, err := migrationOutput(input, func(alpha []byte) ([]byte, error) {
+			return oprf.Evaluate(key, alpha)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, set := range sets {
+			output, err := migrationOutput(input, func(alpha []byte) ([]byte, error) {
+				return evaluateShares(set, alpha)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			if !bytes.Equal(output, expected) {
+				return nil, nil, fmt.Errorf("toprf: output for sample %d changed", i)
+			}
+		}
+	}
+
+	clear(key)
+	return shares, dealing, nil
+}
+
+// migrationOutput runs the client flow for input with the given evaluation.
+func migrationOutput(input []byte, evaluate func(alpha []byte) ([]byte, error)) ([]byte, error) {
+	r, alpha, err := oprf.Blind(input, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	beta, err := evaluate(alpha)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := oprf.Unblind(r, beta)
+	if err != nil {
+		return nil, err
+	}
+	return oprf.Finalize(input, n)
+}
+
+// evaluateShares evaluates alpha with each share and combines the raw parts.
+func evaluateShares(shares []Share, alpha []byte) ([]byte, error) {
+	parts := make([][]byte, len(shares))
+	for i, share := range shares {
+		var err error
+		parts[i], err = Evaluate(share, alpha, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ThresholdMult(parts)
+}
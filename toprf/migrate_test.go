@@ -0,0 +1,80 @@
+package toprf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// singleServerOutput computes the output of input under key without threshold
+func singleServerOutput(t *testing.T, key, input []byte) []byte {
+	t.Helper()
+
+	r, alpha, _ := oprf.Blind(input, nil)
+	beta, err := oprf.Evaluate(key, alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	n, _ := oprf.Unblind(r, beta)
+	output, _ := oprf.Finalize(input, n)
+	return output
+}
+
+// TestMigrateKey tests that migrated shares reproduce stored outputs
+func TestMigrateKey(t *testing.T) {
+	key, _ := oprf.KeyGen()
+	scalar := ristretto255.NewScalar()
+	scalar.Decode(key)
+	publicKey := ristretto255.NewElement().ScalarBaseMult(scalar).Encode(nil)
+
+	// Outputs stored over the years with the single-server key
+	input := []byte("stored user")
+	stored := singleServerOutput(t, key, input)
+
+	shares, dealing, err := MigrateKey(key, publicKey, 5, 3, [][]byte{[]byte("sample 1"), []byte("sample 2")})
+	if err != nil {
+		t.Fatalf("MigrateKey failed: %v", err)
+	}
+
+	if !bytes.Equal(key, make([]byte, ScalarBytes)) {
+		t.Error("Original key was not wiped")
+	}
+	if !bytes.Equal(dealing.PublicKey().Encode(nil), publicKey) {
+		t.Error("Dealing public key differs from the published key")
+	}
+
+	// Any threshold servers reproduce the stored output
+	r, alpha, _ := oprf.Blind(input, nil)
+	beta, err := evaluateShares([]Share{shares[1], shares[3], shares[4]}, alpha)
+	if err != nil {
+		t.Fatalf("evaluateShares failed: %v", err)
+	}
+	n, _ := oprf.Unblind(r, beta)
+	output, _ := oprf.Finalize(input, n)
+	if !bytes.Equal(output, stored) {
+		t.Error("Threshold output differs from the stored output")
+	}
+}
+
+// TestMigrateKeyRejectsWrongPublicKey tests that a failed ceremony keeps the key
+func TestMigrateKeyRejectsWrongPublicKey(t *testing.T) {
+	key, _ := oprf.KeyGen()
+	original := append([]byte(nil), key...)
+	other := ristretto255.NewElement().ScalarBaseMult(scalarFromUint8(2)).Encode(nil)
+
+	if _, _, err := MigrateKey(key, other, 3, 2, [][]byte{[]byte("sample")}); err == nil {
+		t.Error("MigrateKey accepted a wrong public key")
+	}
+	if !bytes.Equal(key, original) {
+		t.Error("Key was modified by a failed ceremony")
+	}
+
+	if _, _, err := MigrateKey(key, nil, 3, 2, nil); err == nil {
+		t.Error("MigrateKey accepted no samples")
+	}
+	if _, _, err := MigrateKey(make([]byte, ScalarBytes), nil, 3, 2, [][]byte{[]byte("sample")}); err == nil {
+		t.Error("MigrateKey accepted a zero key")
+	}
+}
@@ -0,0 +1,165 @@
+package toprf
+
+// Verifiable partial evaluations
+//
+// A server can prove that its part was computed with the share behind its
+// public verification key vk = g^k_i, without revealing the share, using a
+// Chaum-Pedersen proof of discrete log equality: log_g(vk) == log_alpha(part).
+// Clients that know the verification keys (from a Dealing or a DKG result)
+// check every part with VerifyPart before combining, so a misbehaving server
+// is identified instead of silently corrupting the output.
+//
+// Proofs cover raw parts, i.e. parts without a Lagrange coefficient, which
+// are combined with ThresholdMult.
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+)
+
+// ProofBytes is the size of a serialized part proof (32 byte challenge + 32 byte response)
+const ProofBytes = 2 * ScalarBytes
+
+// proofDST is the domain separation tag of the proof challenge.
+const proofDST = "TOPRF-DLEQ-ristretto255-SHA512"
+
+// EvaluateWithProof computes the raw partial evaluation of a blinded element
+// with a key share, together with a proof that it used the share behind
+// g^share.Value.
+//
+// Returns the marshaled Part and the proof.
+func EvaluateWithProof(share Share, blinded []byte) (part, proof []byte, err error) {
+	beta, proof, err := evaluateWithProof(share.Value, blinded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := Part{Index: share.Index, Element: beta}
+	part, err = p.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	return part, proof, nil
+}
+
+// EvaluateWithProof16 is EvaluateWithProof for 16-bit indexes. It returns a
+// marshaled Part16 and the proof.
+func EvaluateWithProof16(share Share16, blinded []byte) (part, proof []byte, err error) {
+	beta, proof, err := evaluateWithProof(share.Value, blinded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := Part16{Index: share.Index, Element: beta}
+	part, err = p.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	return part, proof, nil
+}
+
+// evaluateWithProof computes beta = alpha^k and the proof that log_g(g^k) ==
+// log_alpha(beta).
+func evaluateWithProof(k *ristretto255.Scalar, blinded []byte) (*ristretto255.Element, []byte, error) {
+	if k == nil {
+		return nil, nil, errors.New("toprf: share value is nil")
+	}
+	if len(blinded) != ElementBytes {
+		return nil, nil, errors.New("toprf: invalid blinded element length")
+	}
+
+	alpha := ristretto255.NewElement()
+	if err := alpha.Decode(blinded); err != nil {
+		return nil, nil, err
+	}
+
+	beta := ristretto255.NewElement().ScalarMult(k, alpha)
+	vk := ristretto255.NewElement().ScalarBaseMult(k)
+
+	// Commit to a random nonce r in both bases
+	var randBytes [64]byte
+	if _, err := rand.Read(randBytes[:]); err != nil {
+		return nil, nil, err
+	}
+	r := ristretto255.NewScalar().FromUniformBytes(randBytes[:])
+	a1 := ristretto255.NewElement().ScalarBaseMult(r)
+	a2 := ristretto255.NewElement().ScalarMult(r, alpha)
+
+	// s = r - c*k
+	c := proofChallenge(vk, alpha, beta, a1, a2)
+	s := ristretto255.NewScalar().Multiply(c, k)
+	s.Subtract(r, s)
+
+	proof := make([]byte, 0, ProofBytes)
+	proof = c.Encode(proof)
+	proof = s.Encode(proof)
+	return beta, proof, nil
+}
+
+// VerifyPart checks the proof of a raw part, in either encoding, against the
+// verification key of the server that produced it.
+func VerifyPart(vk *ristretto255.Element, blinded, part, proof []byte) error {
+	if len(proof) != ProofBytes {
+		return errors.New("toprf: invalid proof length")
+	}
+
+	alpha := ristretto255.NewElement()
+	if err := alpha.Decode(blinded); err != nil {
+		return err
+	}
+
+	var p Part16
+	if err := p.UnmarshalBinary(part); err != nil {
+		return err
+	}
+
+	c := ristretto255.NewScalar()
+	if err := c.Decode(proof[:ScalarBytes]); err != nil {
+		return err
+	}
+	s := ristretto255.NewScalar()
+	if err := s.Decode(proof[ScalarBytes:]); err != nil {
+		return err
+	}
+
+	// a1 = g^s * vk^c, a2 = alpha^s * beta^c
+	a1 := ristretto255.NewElement().VarTimeDoubleScalarBaseMult(c, vk, s)
+	a2 := ristretto255.NewElement().VarTimeMultiScalarMult(
+		[]*ristretto255.Scalar{s, c},
+		[]*ristretto255.Element{alpha, p.Element},
+	)
+
+	expected := proofChallenge(vk, alpha, p.Element, a1, a2)
+	if subtle.ConstantTimeCompare(expected.Encode(nil), c.Encode(nil)) != 1 {
+		return errors.New("toprf: invalid part proof")
+	}
+	return nil
+}
+
+// proofChallenge hashes the statement and commitments of a proof to a scalar.
+func proofChallenge(vk, alpha, beta, a1, a2 *ristretto255.Element) *ristretto255.Scalar {
+	h := sha512.New()
+	h.Write([]byte(proofDST))
+	for _, e := range []*ristretto255.Element{vk, alpha, beta, a1, a2} {
+		h.Write(e.Encode(nil))
+	}
+	return ristretto255.NewScalar().FromUniformBytes(h.Sum(nil))
+}
+
+// VerifyPart checks the proof of a raw part against the verification key of
+// the share index the part claims to come from.
+func (d *Dealing) VerifyPart(blinded, part, proof []byte) error {
+	if len(part) != PartBytes {
+		return errors.New("toprf: invalid part length")
+	}
+
+	vk, err := d.VerificationKey(part[0])
+	if err != nil {
+		return err
+	}
+	return VerifyPart(vk, blinded, part, proof)
+}
@@ -0,0 +1,81 @@
+package toprf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// TestPartProof tests proving and verifying raw partial evaluations
+func TestPartProof(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	shares, dealing, err := CreateVerifiableShares(secret, 3, 2)
+	if err != nil {
+		t.Fatalf("CreateVerifiableShares failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("input"), nil)
+
+	parts := make([][]byte, 2)
+	for i := range parts {
+		var proof []byte
+		parts[i], proof, err = EvaluateWithProof(shares[i+1], alpha)
+		if err != nil {
+			t.Fatalf("EvaluateWithProof failed: %v", err)
+		}
+		if err := dealing.VerifyPart(alpha, parts[i], proof); err != nil {
+			t.Errorf("Part %d: VerifyPart failed: %v", i+2, err)
+		}
+
+		// The proof does not transfer to another share's key
+		vk, _ := dealing.VerificationKey(1)
+		if err := VerifyPart(vk, alpha, parts[i], proof); err == nil {
+			t.Errorf("Part %d: proof verified under the wrong key", i+2)
+		}
+	}
+
+	// Proven parts combine to the non-threshold evaluation
+	beta, err := ThresholdMult(parts)
+	if err != nil {
+		t.Fatalf("ThresholdMult failed: %v", err)
+	}
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+	if !bytes.Equal(beta, expected) {
+		t.Error("Proven parts combine to a different result")
+	}
+}
+
+// TestPartProofRejectsWrongPart tests that a part from a wrong share fails
+func TestPartProofRejectsWrongPart(t *testing.T) {
+	shares, dealing, err := CreateVerifiableShares(scalarFromUint8(17), 3, 2)
+	if err != nil {
+		t.Fatalf("CreateVerifiableShares failed: %v", err)
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("input"), nil)
+
+	// Server 2 evaluates with a wrong share but its own index
+	wrong := Share{Index: 2, Value: scalarFromUint8(3)}
+	part, proof, err := EvaluateWithProof(wrong, alpha)
+	if err != nil {
+		t.Fatalf("EvaluateWithProof failed: %v", err)
+	}
+	if err := dealing.VerifyPart(alpha, part, proof); err == nil {
+		t.Error("VerifyPart accepted a part computed with a wrong share")
+	}
+
+	// A valid proof does not verify for a modified part
+	part, proof, _ = EvaluateWithProof(shares[0], alpha)
+	other, _, _ := EvaluateWithProof(shares[0], ristretto255.NewElement().ScalarBaseMult(scalarFromUint8(2)).Encode(nil))
+	if err := dealing.VerifyPart(alpha, other, proof); err == nil {
+		t.Error("VerifyPart accepted a proof for a different part")
+	}
+	if err := dealing.VerifyPart(alpha, part, proof[:10]); err == nil {
+		t.Error("VerifyPart accepted a truncated proof")
+	}
+}
@@ -0,0 +1,217 @@
+package toprf
+
+// Per-tenant keys
+//
+// A single threshold key can serve many tenants without a DKG per tenant. The
+// tenant key is the group key multiplied by a secret tweak, derived from the
+// tenant label and a seed that all servers of the group hold:
+//
+//	w = H(seed, label),  k_tenant = w * k
+//
+// Every server derives its tenant share as w * k_i. Multiplying all shares by
+// the same constant multiplies the shared secret by it, so the threshold
+// structure is unchanged and Evaluate, ThreeHashTDH (with tenant zero shares
+// derived the same way) and the client work as before.
+//
+// The tweak is secret, so the outputs of different tenants are unrelated to
+// anyone without the seed: H(x)^(w_A*k) and H(x)^(w_B*k) differ by the
+// unknown factor w_B/w_A, and a tenant that can query its own key learns
+// nothing about another tenant's outputs. A public tweak would not do: with
+// k_tenant = k + H(label), any tenant could convert its outputs into those of
+// every other tenant.
+//
+// The servers publish the tenant dealing with Dealing.Tenant: the group's
+// commitments multiplied by w, with a proof that all of them were multiplied
+// by the same factor. Dealing.VerifyTenant checks the proof against the group
+// dealing, so everyone can verify the tenant public key and verification keys
+// without learning w, and clients use them like those of any other key.
+//
+// What tenants share:
+//   - Anyone who compromises the group key (threshold shares) and the seed
+//     has every tenant key.
+//   - Anyone with the seed alone learns the tweaks, and with them the
+//     relation between tenant outputs, but no key.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+)
+
+// TenantSeedBytes is the minimum size of a tenant seed.
+const TenantSeedBytes = 32
+
+// tenantDST is the domain separation tag of the tenant tweak.
+const tenantDST = "TOPRF-tenant-ristretto255-SHA512"
+
+// tenantProofDST is the domain separation tag of the tenant dealing proof.
+const tenantProofDST = "TOPRF-tenant-DLEQ-ristretto255-SHA512"
+
+// TenantTweak derives the secret tweak w = H(seed, label) of a tenant.
+func TenantTweak(seed, label []byte) (*ristretto255.Scalar, error) {
+	if len(seed) < TenantSeedBytes {
+		return nil, errors.New("toprf: tenant seed too short")
+	}
+	if len(label) > 65535 {
+		return nil, errors.New("toprf: tenant label too long")
+	}
+
+	var lenBuf [2]byte
+	binary.BigEndian.PutUint16(lenBuf[:], uint16(len(label)))
+
+	h := hmac.New(sha512.New, seed)
+	h.Write([]byte(tenantDST))
+	h.Write(lenBuf[:])
+	h.Write(label)
+	w := ristretto255.NewScalar().FromUniformBytes(h.Sum(nil))
+	if w.Equal(ristretto255.NewScalar()) == 1 {
+		return nil, errors.New("toprf: tenant tweak is zero")
+	}
+	return w, nil
+}
+
+// TenantShare derives a server's share of the tenant key from its share of
+// the group key.
+func TenantShare(share Share, seed, label []byte) (Share, error) {
+	if share.Value == nil {
+		return Share{}, errors.New("toprf: share value is nil")
+	}
+
+	w, err := TenantTweak(seed, label)
+	if err != nil {
+		return Share{}, err
+	}
+
+	return Share{
+		Index: share.Index,
+		Value: ristretto255.NewScalar().Multiply(share.Value, w),
+	}, nil
+}
+
+// Tenant returns the dealing of a tenant key, with every commitment
+// multiplied by the tenant tweak, and a proof that lets anyone check it with
+// VerifyTenant. Its public key, verification keys, VerifyShare and
+// VerifyPart apply to tenant shares.
+func (d *Dealing) Tenant(seed, label []byte) (*Dealing, []byte, error) {
+	if len(d.Commitments) == 0 {
+		return nil, nil, errors.New("toprf: no commitments provided")
+	}
+
+	w, err := TenantTweak(seed, label)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	commitments := make([]*ristretto255.Element, len(d.Commitments))
+	for k, c := range d.Commitments {
+		commitments[k] = ristretto255.NewElement().ScalarMult(w, c)
+	}
+	tenant := &Dealing{N: d.N, Threshold: d.Threshold, Commitments: commitments}
+
+	// Prove log_C0(T0) == log_M(Z) for the composites of the other commitments
+	m, z := tenantComposites(label, d, tenant)
+	var randBytes [64]byte
+	if _, err := rand.Read(randBytes[:]); err != nil {
+		return nil, nil, err
+	}
+	r := ristretto255.NewScalar().FromUniformBytes(randBytes[:])
+	a1 := ristretto255.NewElement().ScalarMult(r, d.Commitments[0])
+	a2 := ristretto255.NewElement().ScalarMult(r, m)
+
+	// s = r - c*w
+	c := tenantChallenge(label, d.Commitments[0], commitments[0], m, z, a1, a2)
+	s := ristretto255.NewScalar().Multiply(c, w)
+	s.Subtract(r, s)
+
+	proof := make([]byte, 0, ProofBytes)
+	proof = c.Encode(proof)
+	proof = s.Encode(proof)
+	return tenant, proof, nil
+}
+
+// VerifyTenant checks that tenant is the dealing of the tenant key for label
+// derived from d, i.e. that all its commitments are those of d multiplied by
+// the same secret factor.
+func (d *Dealing) VerifyTenant(label []byte, tenant *Dealing, proof []byte) error {
+	if len(proof) != ProofBytes {
+		return errors.New("toprf: invalid proof length")
+	}
+	if len(label) > 65535 {
+		return errors.New("toprf: tenant label too long")
+	}
+	if tenant.N != d.N || tenant.Threshold != d.Threshold || len(d.Commitments) == 0 ||
+		len(tenant.Commitments) != len(d.Commitments) {
+		return errors.New("toprf: tenant dealing does not match the group dealing")
+	}
+
+	c := ristretto255.NewScalar()
+	if err := c.Decode(proof[:ScalarBytes]); err != nil {
+		return err
+	}
+	s := ristretto255.NewScalar()
+	if err := s.Decode(proof[ScalarBytes:]); err != nil {
+		return err
+	}
+
+	// a1 = C0^s * T0^c, a2 = M^s * Z^c
+	m, z := tenantComposites(label, d, tenant)
+	a1 := ristretto255.NewElement().VarTimeMultiScalarMult(
+		[]*ristretto255.Scalar{s, c},
+		[]*ristretto255.Element{d.Commitments[0], tenant.Commitments[0]},
+	)
+	a2 := ristretto255.NewElement().VarTimeMultiScalarMult(
+		[]*ristretto255.Scalar{s, c},
+		[]*ristretto255.Element{m, z},
+	)
+
+	expected := tenantChallenge(label, d.Commitments[0], tenant.Commitments[0], m, z, a1, a2)
+	if subtle.ConstantTimeCompare(expected.Encode(nil), c.Encode(nil)) != 1 {
+		return errors.New("toprf: invalid tenant dealing proof")
+	}
+	return nil
+}
+
+// tenantComposites combines the commitments after the constant term into
+// M = sum_k z_k*C_k and Z = sum_k z_k*T_k, with weights z_k hashed from all
+// commitments. Z = w*M then implies T_k = w*C_k for every k.
+func tenantComposites(label []byte, group, tenant *Dealing) (m, z *ristretto255.Element) {
+	seed := sha512.New()
+	seed.Write([]byte(tenantProofDST))
+	seed.Write(binary.BigEndian.AppendUint16(nil, uint16(len(label))))
+	seed.Write(label)
+	for k := range group.Commitments {
+		seed.Write(group.Commitments[k].Encode(nil))
+		seed.Write(tenant.Commitments[k].Encode(nil))
+	}
+	digest := seed.Sum(nil)
+
+	m = ristretto255.NewIdentityElement()
+	z = ristretto255.NewIdentityElement()
+	for k := 1; k < len(group.Commitments); k++ {
+		h := sha512.New()
+		h.Write(digest)
+		h.Write(binary.BigEndian.AppendUint16(nil, uint16(k)))
+		weight := ristretto255.NewScalar().FromUniformBytes(h.Sum(nil))
+		m.Add(m, ristretto255.NewElement().ScalarMult(weight, group.Commitments[k]))
+		z.Add(z, ristretto255.NewElement().ScalarMult(weight, tenant.Commitments[k]))
+	}
+	return m, z
+}
+
+// tenantChallenge hashes the statement and commitments of a tenant dealing
+// proof to a scalar.
+func tenantChallenge(label []byte, c0, t0, m, z, a1, a2 *ristretto255.Element) *ristretto255.Scalar {
+	h := sha512.New()
+	h.Write([]byte(tenantProofDST))
+	h.Write(binary.BigEndian.AppendUint16(nil, uint16(len(label))))
+	h.Write(label)
+	for _, e := range []*ristretto255.Element{c0, t0, m, z, a1, a2} {
+		h.Write(e.Encode(nil))
+	}
+	return ristretto255.NewScalar().FromUniformBytes(h.Sum(nil))
+}
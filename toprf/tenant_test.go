@@ -0,0 +1,136 @@
+package toprf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// TestTenantKeys tests that tenant shares form a threshold sharing of the
+// tenant key and verify against the tenant dealing
+func TestTenantKeys(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	shares, dealing, err := CreateVerifiableShares(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("CreateVerifiableShares failed: %v", err)
+	}
+
+	seed := bytes.Repeat([]byte{0x5e}, TenantSeedBytes)
+	label := []byte("tenant-42")
+	tenantDealing, proof, err := dealing.Tenant(seed, label)
+	if err != nil {
+		t.Fatalf("Tenant failed: %v", err)
+	}
+	if err := dealing.VerifyTenant(label, tenantDealing, proof); err != nil {
+		t.Errorf("VerifyTenant failed: %v", err)
+	}
+
+	tenantShares := make([]Share, len(shares))
+	for i, share := range shares {
+		tenantShares[i], err = TenantShare(share, seed, label)
+		if err != nil {
+			t.Fatalf("TenantShare failed: %v", err)
+		}
+		if err := tenantDealing.VerifyShare(tenantShares[i]); err != nil {
+			t.Errorf("Tenant share %d does not verify: %v", share.Index, err)
+		}
+	}
+
+	// The tenant key is w * k, and its public key matches
+	tweak, _ := TenantTweak(seed, label)
+	tenantKey := ristretto255.NewScalar().Multiply(secret, tweak)
+	if tenantDealing.PublicKey().Equal(ristretto255.NewElement().ScalarBaseMult(tenantKey)) != 1 {
+		t.Error("Tenant public key does not match the tenant key")
+	}
+
+	// Any threshold set of tenant shares evaluates with the tenant key
+	input := []byte("password")
+	r, alpha, _ := oprf.Blind(input, nil)
+	indexes := []uint8{2, 4, 5}
+	var parts [][]byte
+	for _, i := range indexes {
+		part, _ := Evaluate(tenantShares[i-1], alpha, indexes)
+		parts = append(parts, part)
+	}
+	beta, _ := ThresholdCombine(parts)
+	expectedBeta, _ := oprf.Evaluate(tenantKey.Encode(nil), alpha)
+	if !bytes.Equal(beta, expectedBeta) {
+		t.Error("Tenant evaluation differs from evaluation with the tenant key")
+	}
+
+	// Tenant parts are proven against the tenant verification keys
+	part, partProof, _ := EvaluateWithProof(tenantShares[0], alpha)
+	if err := tenantDealing.VerifyPart(alpha, part, partProof); err != nil {
+		t.Errorf("Tenant part does not verify: %v", err)
+	}
+
+	// Another tenant gets a different output
+	otherShare, _ := TenantShare(shares[0], seed, []byte("tenant-43"))
+	if bytes.Equal(otherShare.Value.Encode(nil), tenantShares[0].Value.Encode(nil)) {
+		t.Error("Different labels derived the same share")
+	}
+	n, _ := oprf.Unblind(r, beta)
+	groupBeta, _ := oprf.Evaluate(keyBytes, alpha)
+	groupN, _ := oprf.Unblind(r, groupBeta)
+	if bytes.Equal(n, groupN) {
+		t.Error("Tenant output equals the group output")
+	}
+}
+
+// TestTenantSeed tests that tweaks depend on the seed and that a short seed
+// is rejected
+func TestTenantSeed(t *testing.T) {
+	label := []byte("tenant-42")
+	a, _ := TenantTweak(bytes.Repeat([]byte{1}, TenantSeedBytes), label)
+	b, _ := TenantTweak(bytes.Repeat([]byte{2}, TenantSeedBytes), label)
+	if a.Equal(b) == 1 {
+		t.Error("Different seeds derived the same tweak")
+	}
+	if _, err := TenantTweak(make([]byte, TenantSeedBytes-1), label); err == nil {
+		t.Error("TenantTweak accepted a short seed")
+	}
+	if _, err := TenantShare(Share{Index: 1}, bytes.Repeat([]byte{1}, TenantSeedBytes), label); err == nil {
+		t.Error("TenantShare accepted a share without a value")
+	}
+}
+
+// TestVerifyTenantRejects tests that VerifyTenant rejects tenant dealings
+// that are not a uniform multiple of the group dealing
+func TestVerifyTenantRejects(t *testing.T) {
+	_, dealing, _ := CreateVerifiableShares(scalarFromUint8(3), 4, 3)
+	seed := bytes.Repeat([]byte{0x5e}, TenantSeedBytes)
+	label := []byte("tenant-42")
+	tenant, proof, _ := dealing.Tenant(seed, label)
+
+	// Step 1: The proof is bound to the label
+	if err := dealing.VerifyTenant([]byte("tenant-43"), tenant, proof); err == nil {
+		t.Error("VerifyTenant accepted another label")
+	}
+
+	// Step 2: One commitment multiplied by a different factor is caught
+	forged := &Dealing{N: tenant.N, Threshold: tenant.Threshold, Commitments: append([]*ristretto255.Element(nil), tenant.Commitments...)}
+	forged.Commitments[2] = ristretto255.NewElement().ScalarMult(scalarFromUint8(2), tenant.Commitments[2])
+	if err := dealing.VerifyTenant(label, forged, proof); err == nil {
+		t.Error("VerifyTenant accepted a modified commitment")
+	}
+
+	// Step 3: So is the dealing of another tenant
+	other, _, _ := dealing.Tenant(seed, []byte("tenant-43"))
+	if err := dealing.VerifyTenant(label, other, proof); err == nil {
+		t.Error("VerifyTenant accepted another tenant's dealing")
+	}
+
+	// Step 4: Malformed inputs
+	if err := dealing.VerifyTenant(label, tenant, proof[:10]); err == nil {
+		t.Error("VerifyTenant accepted a short proof")
+	}
+	short := &Dealing{N: tenant.N, Threshold: tenant.Threshold, Commitments: tenant.Commitments[:2]}
+	if err := dealing.VerifyTenant(label, short, proof); err == nil {
+		t.Error("VerifyTenant accepted a dealing with fewer commitments")
+	}
+}
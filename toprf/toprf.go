@@ -21,6 +21,9 @@
 //
 //  1. Setup: Generate n shares of a secret key using CreateShares(secret, n, threshold)
 //     Distribute one share to each of n servers
+//     (CreateVerifiableShares also returns a Dealing with Feldman commitments,
+//     so each server can verify its share on receipt; MigrateKey does the same
+//     for an existing oprf.KeyGen key, keeping its outputs)
 //
 //  2. Client: Blind input using oprf.Blind() (same as basic OPRF)
 //     Send blinded element alpha to threshold servers
@@ -58,6 +61,40 @@
 //	output, _ := oprf.Finalize(input, n)
 //	// output is the final threshold OPRF result
 //
+// # Threshold Client
+//
+// Client manages the server side of this flow for an application: it sends
+// the blinded element to share servers through a ShareServer transport
+// (LocalServer in process, or HTTP via NewHTTPHandler and HTTPShareServer),
+// keeps the first threshold valid parts, retries and replaces failing
+// servers, and combines the parts with ThresholdMult. See client.go.
+// Coordinator wraps a Client in an HTTP service, so clients that cannot reach
+// every share server send a single blinded element and receive a single beta.
+// See coordinator.go.
+//
+// Servers can prove their raw parts with EvaluateWithProof, and clients that
+// know the verification keys (Dealing, or a DKG result) check them with
+// VerifyPart before combining. See proof.go.
+//
+// # Large Groups
+//
+// Share and Part use 8-bit indexes, so a group has at most 255 members.
+// Share16, Part16 and the functions with a 16 suffix (CreateShares16,
+// Evaluate16, ThreeHashTDH16, ThresholdMult16, ...) support up to 65535
+// members, with a versioned 35-byte wire format that still accepts 33-byte
+// encodings. See index16.go.
+//
+// WeightedScheme gives operators several indexes each, so the threshold is a
+// total weight rather than a server count; every operator answers with one
+// combined part from EvaluateWeighted. See weighted.go. Gate expresses nested
+// thresholds such as "2 of 3 officers plus 3 of 5 regional servers"; see
+// hierarchy.go.
+//
+// TenantShare derives per-tenant shares from a server's share, a seed all
+// servers hold and a public tenant label, so one DKG serves many tenants with
+// unrelated outputs, each with its own verifiable public key (Dealing.Tenant,
+// Dealing.VerifyTenant). See tenant.go.
+//
 // # Security Model
 //
 // The 3HashTDH protocol provides security even when all threshold servers are
@@ -73,12 +110,9 @@
 package toprf
 
 import (
-	"crypto/rand"
-	"encoding/binary"
 	"errors"
 
 	"github.com/gtank/ristretto255"
-	"golang.org/x/crypto/blake2b"
 )
 
 // Constants for threshold OPRF
@@ -183,46 +217,22 @@ func (p *Part) UnmarshalBinary(data []byte) error {
 
 // scalarFromUint8 creates a ristretto255 scalar from a uint8 value
 func scalarFromUint8(v uint8) *ristretto255.Scalar {
-	s := ristretto255.NewScalar()
-	var buf [32]byte
-	buf[0] = v
-	s.Decode(buf[:])
-	return s
+	return scalarFromUint16(uint16(v))
 }
 
 // lcoeff computes the Lagrange coefficient for interpolation at point x.
 // It computes: ∏(x - peers[j]) / ∏(index - peers[j]) for j != index
 // This is used in Lagrange polynomial interpolation.
 func lcoeff(index, x uint8, peers []uint8) *ristretto255.Scalar {
-	xScalar := scalarFromUint8(x)
-	iScalar := scalarFromUint8(index)
-	dividend := scalarFromUint8(1)
-	divisor := scalarFromUint8(1)
-
-	for _, peer := range peers {
-		if peer == index {
-			continue
-		}
-
-		peerScalar := scalarFromUint8(peer)
-
-		// dividend *= (x - peer)
-		tmp := ristretto255.NewScalar()
-		tmp.Subtract(peerScalar, xScalar) // Note: Subtract(a,b) computes b-a
-		dividend.Multiply(dividend, tmp)
-
-		// divisor *= (index - peer)
-		tmp = ristretto255.NewScalar()
-		tmp.Subtract(peerScalar, iScalar) // Note: Subtract(a,b) computes b-a
-		divisor.Multiply(divisor, tmp)
-	}
-
-	// result = dividend / divisor = dividend * divisor^(-1)
-	divisor.Invert(divisor)
-	result := ristretto255.NewScalar()
-	result.Multiply(dividend, divisor)
+	return lcoeff16(uint16(index), uint16(x), widenIndexes(peers))
+}
 
-	return result
+// LagrangeCoefficient computes the Lagrange coefficient of index for
+// interpolation at point x over the given set of peer indexes.
+// This is used internally but also exported for use by the DKG package,
+// which needs to interpolate commitments "in the exponent".
+func LagrangeCoefficient(index, x uint8, peers []uint8) *ristretto255.Scalar {
+	return lcoeff(index, x, peers)
 }
 
 // coeff computes the Lagrange coefficient for f(0), which is used when
@@ -238,28 +248,11 @@ func coeff(index uint8, peers []uint8) *ristretto255.Scalar {
 // Returns the scalar value at x.
 // This is used internally but also exported for use by the DKG package.
 func InterpolateScalar(x uint8, shares []Share) (*ristretto255.Scalar, error) {
-	if len(shares) == 0 {
-		return nil, errors.New("toprf: no shares provided")
-	}
-
-	result := ristretto255.NewScalar()
-	result.Decode([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
-
-	// Extract indexes from shares
-	indexes := make([]uint8, len(shares))
+	wide := make([]Share16, len(shares))
 	for i, share := range shares {
-		indexes[i] = share.Index
+		wide[i] = share.Wide()
 	}
-
-	// For each share, compute l_i(x) * share.value and add to result
-	for _, share := range shares {
-		l := lcoeff(share.Index, x, indexes)
-		term := ristretto255.NewScalar()
-		term.Multiply(l, share.Value)
-		result.Add(result, term)
-	}
-
-	return result, nil
+	return InterpolateScalar16(uint16(x), wide)
 }
 
 // interpolate is a legacy wrapper for backward compatibility
@@ -274,54 +267,24 @@ func interpolate(x uint8, shares []Share) *ristretto255.Scalar {
 //
 // Shares are indexed from 1 to n (not 0 to n-1).
 func CreateShares(secret *ristretto255.Scalar, n, threshold uint8) ([]Share, error) {
-	if threshold < 1 || n < threshold {
-		return nil, errors.New("toprf: invalid threshold parameters")
-	}
-	if threshold > n {
-		return nil, errors.New("toprf: threshold cannot exceed n")
-	}
+	shares, _, err := createShares(secret, n, threshold)
+	return shares, err
+}
 
-	// Generate random polynomial coefficients a[0], a[1], ..., a[threshold-2]
-	// f(x) = secret + a[0]*x + a[1]*x^2 + ... + a[threshold-2]*x^(threshold-1)
-	coeffs := make([]*ristretto255.Scalar, threshold-1)
-	for i := range coeffs {
-		coeffs[i] = ristretto255.NewScalar()
-		var randBytes [64]byte
-		if _, err := rand.Read(randBytes[:]); err != nil {
-			return nil, err
-		}
-		coeffs[i].FromUniformBytes(randBytes[:])
+// createShares implements CreateShares and also returns the random
+// coefficients a[0], ..., a[threshold-2] of the polynomial, for dealers that
+// publish commitments to them.
+func createShares(secret *ristretto255.Scalar, n, threshold uint8) ([]Share, []*ristretto255.Scalar, error) {
+	wide, coeffs, err := createShares16(secret, uint16(n), uint16(threshold))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Create shares: f(i) for i in 1..n
 	shares := make([]Share, n)
-	for i := uint8(1); i <= n; i++ {
-		shares[i-1].Index = i
-		shares[i-1].Value = ristretto255.NewScalar()
-
-		// Start with f(i) = secret
-		shares[i-1].Value.Add(shares[i-1].Value, secret)
-
-		// Compute x = i as scalar
-		x := scalarFromUint8(i)
-
-		// Add terms: a[j] * x^(j+1)
-		for j := 0; j < int(threshold-1); j++ {
-			// Compute term = a[j] * x
-			term := ristretto255.NewScalar()
-			term.Multiply(coeffs[j], x)
-
-			// Multiply by x for j more times to get x^(j+1)
-			for exp := 0; exp < j; exp++ {
-				term.Multiply(term, x)
-			}
-
-			// Add to share value
-			shares[i-1].Value.Add(shares[i-1].Value, term)
-		}
+	for i := range wide {
+		shares[i] = Share{Index: uint8(wide[i].Index), Value: wide[i].Value}
 	}
-
-	return shares, nil
+	return shares, coeffs, nil
 }
 
 // Evaluate performs a threshold OPRF evaluation using a key share.
@@ -330,28 +293,11 @@ func CreateShares(secret *ristretto255.Scalar, n, threshold uint8) ([]Share, err
 //
 // The result is a Part containing the partial evaluation and the share's index.
 func Evaluate(share Share, blinded []byte, indexes []uint8) ([]byte, error) {
-	if len(blinded) != ElementBytes {
-		return nil, errors.New("toprf: invalid blinded element length")
-	}
-
-	// Compute Lagrange coefficient for this share
-	c := coeff(share.Index, indexes)
-
-	// Multiply share value by coefficient
-	adjustedKey := ristretto255.NewScalar()
-	adjustedKey.Multiply(share.Value, c)
-
-	// Use basic OPRF evaluate - need to import oprf package
-	// For now, implement directly here
-	alpha := ristretto255.NewElement()
-	if err := alpha.Decode(blinded); err != nil {
+	beta, err := evaluate(share.Wide(), blinded, widenIndexes(indexes))
+	if err != nil {
 		return nil, err
 	}
 
-	// Compute beta = alpha^adjustedKey
-	beta := ristretto255.NewElement()
-	beta.ScalarMult(adjustedKey, alpha)
-
 	// Create Part with index and element
 	part := Part{
 		Index:   share.Index,
@@ -398,6 +344,38 @@ func ThresholdCombine(responses [][]byte) ([]byte, error) {
 	return result.Encode(nil), nil
 }
 
+// ThresholdMult combines raw partial evaluations from threshold servers by
+// applying the Lagrange coefficients on the client side:
+//
+//	beta = sum_i lambda_i * part_i
+//
+// where lambda_i is the coefficient for f(0) over the indexes of all parts.
+// Use it for parts that were computed without coefficients, i.e. by
+// ThreeHashTDH or by Evaluate with only the server's own index (or nil) as
+// indexes. Since the coefficients are applied after the fact, the client can
+// combine whichever threshold servers answered first.
+//
+// Corresponds to toprf_thresholdmult() in liboprf's toprf.c
+func ThresholdMult(responses [][]byte) ([]byte, error) {
+	if len(responses) == 0 {
+		return nil, errors.New("toprf: no responses to combine")
+	}
+	if len(responses) > 255 {
+		return nil, errors.New("toprf: too many responses")
+	}
+
+	parts := make([]Part16, len(responses))
+	for i, resp := range responses {
+		var part Part
+		if err := part.UnmarshalBinary(resp); err != nil {
+			return nil, err
+		}
+		parts[i] = part.Wide()
+	}
+
+	return thresholdMult(parts)
+}
+
 // ThreeHashTDH implements the 3HashTDH protocol from Gu et al. 2024.
 // This provides threshold OPRF evaluation with security against compromise of all servers.
 //
@@ -408,47 +386,15 @@ func ThresholdCombine(responses [][]byte) ([]byte, error) {
 //   - ssid: session-specific identifier (must be same for all participants)
 //
 // The function computes: beta = alpha^k + H(ssid||alpha)^z
+//
+// The returned parts carry no Lagrange coefficient; combine them with
+// ThresholdMult, which also cancels the zero-sharing terms.
 func ThreeHashTDH(k, z Share, alpha, ssid []byte) ([]byte, error) {
-	if len(alpha) != ElementBytes {
-		return nil, errors.New("toprf: invalid alpha length")
-	}
-
-	// Evaluate alpha with key share k: beta = alpha^k
-	alphaElement := ristretto255.NewElement()
-	if err := alphaElement.Decode(alpha); err != nil {
-		return nil, err
-	}
-
-	beta := ristretto255.NewElement()
-	beta.ScalarMult(k.Value, alphaElement)
-
-	// Hash ssid and alpha using BLAKE2b
-	// Format: htons(len(ssid)) || ssid || alpha
-	h, err := blake2b.New512(nil)
+	beta, err := threeHashTDH(k.Value, z.Value, alpha, ssid)
 	if err != nil {
 		return nil, err
 	}
 
-	// Write length prefix in network byte order (big-endian)
-	lenBuf := make([]byte, 2)
-	binary.BigEndian.PutUint16(lenBuf, uint16(len(ssid)))
-	h.Write(lenBuf)
-	h.Write(ssid)
-	h.Write(alpha)
-
-	hash := h.Sum(nil) // 64 bytes
-
-	// Hash-to-curve: convert hash to ristretto255 point
-	point := ristretto255.NewElement()
-	point.FromUniformBytes(hash)
-
-	// Evaluate point with zero-share z: h2 = point^z
-	h2 := ristretto255.NewElement()
-	h2.ScalarMult(z.Value, point)
-
-	// Add both evaluations: beta = beta + h2
-	beta.Add(beta, h2)
-
 	// Return as Part (index + element)
 	part := Part{
 		Index:   k.Index,
@@ -297,6 +297,72 @@ func TestThreeHashTDH(t *testing.T) {
 	// but we can verify it doesn't crash and produces valid output
 }
 
+// TestThresholdMult tests client-side combination of raw parts, including
+// 3HashTDH parts whose zero-sharing terms must cancel out
+func TestThresholdMult(t *testing.T) {
+	keyBytes, err := oprf.KeyGen()
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	shares, err := CreateShares(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("CreateShares failed: %v", err)
+	}
+	zeroShares, err := CreateShares(ristretto255.NewScalar(), 5, 3)
+	if err != nil {
+		t.Fatalf("CreateShares for zero failed: %v", err)
+	}
+
+	_, alpha, err := oprf.Blind([]byte("password"), nil)
+	if err != nil {
+		t.Fatalf("Blind failed: %v", err)
+	}
+	expected, err := oprf.Evaluate(keyBytes, alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+
+	// Raw parts from servers 2, 4 and 5
+	raw := make([][]byte, 0, 3)
+	tdh := make([][]byte, 0, 3)
+	for _, i := range []int{4, 1, 3} {
+		part, err := Evaluate(shares[i], alpha, nil)
+		if err != nil {
+			t.Fatalf("Evaluate failed: %v", err)
+		}
+		raw = append(raw, part)
+
+		part, err = ThreeHashTDH(shares[i], zeroShares[i], alpha, []byte("ssid"))
+		if err != nil {
+			t.Fatalf("ThreeHashTDH failed: %v", err)
+		}
+		tdh = append(tdh, part)
+	}
+
+	beta, err := ThresholdMult(raw)
+	if err != nil {
+		t.Fatalf("ThresholdMult failed: %v", err)
+	}
+	if !bytes.Equal(beta, expected) {
+		t.Error("ThresholdMult of raw parts differs from non-threshold evaluation")
+	}
+
+	beta, err = ThresholdMult(tdh)
+	if err != nil {
+		t.Fatalf("ThresholdMult failed: %v", err)
+	}
+	if !bytes.Equal(beta, expected) {
+		t.Error("ThresholdMult of 3HashTDH parts differs from non-threshold evaluation")
+	}
+
+	if _, err := ThresholdMult([][]byte{raw[0], raw[0]}); err == nil {
+		t.Error("ThresholdMult should fail with duplicate indexes")
+	}
+}
+
 // TestInvalidInputs tests error handling
 func TestInvalidInputs(t *testing.T) {
 	// Test CreateShares with invalid parameters
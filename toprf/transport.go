@@ -0,0 +1,401 @@
+package toprf
+
+// Transports to share servers
+//
+// A ShareServer is the client's view of one server holding a key share. The
+// client sends it an EvalRequest and gets back a marshaled Part. LocalServer
+// evaluates in process, which is useful for tests and for embedding; the HTTP
+// transport (NewHTTPHandler on the server side, HTTPShareServer on the client
+// side) carries the same request and part encodings over HTTP.
+//
+// A request with Proof set asks the server to append a part proof (see
+// EvaluateWithProof) to its part, so that the client can check the part
+// against the server's verification key.
+//
+// Server indexes are 16-bit. A server whose index fits in 8 bits answers
+// with a 33-byte Part, and any other server with a 35-byte Part16 (see
+// index16.go); clients accept both. Requests whose indexes all fit in 8 bits
+// keep the unversioned encoding, so servers that only know it can serve
+// them. Other requests start with RequestVersion16, which is odd: a
+// canonical ristretto255 encoding always starts with an even byte (RFC 9496,
+// Section 4.3.1), so a versioned request cannot be mistaken for an
+// unversioned one, which starts with alpha.
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gtank/ristretto255"
+)
+
+// ShareServer is a transport to one server holding a key share.
+// Implementations must be safe for concurrent use.
+type ShareServer interface {
+	// Index returns the index of the share held by the server.
+	Index() uint16
+
+	// Evaluate asks the server for its partial evaluation of a blinded
+	// element and returns the marshaled Part, followed by its proof if
+	// req.Proof is set.
+	Evaluate(ctx context.Context, req *EvalRequest) ([]byte, error)
+}
+
+// EvalRequest is a request for a partial evaluation.
+//
+//   - Alpha: the blinded element from the client
+//   - Indexes: the indexes of all servers taking part, used to apply the
+//     Lagrange coefficient on the server (see Evaluate); nil asks for a raw
+//     part to be combined with ThresholdMult
+//   - SSID: session identifier for ThreeHashTDH; nil selects plain Evaluate
+//   - Proof: ask for a proof of the part; only raw plain Evaluate parts can
+//     be proven, so Indexes and SSID must be nil
+type EvalRequest struct {
+	Alpha   []byte
+	Indexes []uint16
+	SSID    []byte
+	Proof   bool
+}
+
+// RequestVersion16 is the version byte of the EvalRequest encoding with
+// 16-bit indexes.
+const RequestVersion16 = 0x03
+
+// requestProof is the flag of an EvalRequest asking for a part proof.
+const requestProof = 0x01
+
+// MarshalBinary encodes an EvalRequest for transmission. A request whose
+// indexes all fit in 8 bits is encoded without a version:
+//
+//	[alpha:32 bytes][ssid length:2 bytes][ssid][index count:1 byte][indexes:1 byte each][flags:1 byte]
+//
+// Any other request is encoded with 16-bit indexes:
+//
+//	[version:1 byte][alpha:32 bytes][ssid length:2 bytes][ssid][index count:2 bytes][indexes:2 bytes each][flags:1 byte]
+//
+// The flags byte of the unversioned encoding is only present for requests
+// with Proof set, so other requests encode as before.
+func (r *EvalRequest) MarshalBinary() ([]byte, error) {
+	if len(r.Alpha) != ElementBytes {
+		return nil, errors.New("toprf: invalid alpha length")
+	}
+	if len(r.SSID) > 0xffff {
+		return nil, errors.New("toprf: ssid too long")
+	}
+	if len(r.Indexes) > 0xffff {
+		return nil, errors.New("toprf: too many indexes")
+	}
+
+	wide := len(r.Indexes) > 255
+	for _, index := range r.Indexes {
+		wide = wide || index > 255
+	}
+	if wide {
+		return r.marshal16(), nil
+	}
+
+	data := make([]byte, 0, ElementBytes+2+len(r.SSID)+1+len(r.Indexes)+1)
+	data = append(data, r.Alpha...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(r.SSID)))
+	data = append(data, r.SSID...)
+	data = append(data, uint8(len(r.Indexes)))
+	for _, index := range r.Indexes {
+		data = append(data, uint8(index))
+	}
+	if r.Proof {
+		data = append(data, requestProof)
+	}
+	return data, nil
+}
+
+// marshal16 encodes an EvalRequest with RequestVersion16.
+func (r *EvalRequest) marshal16() []byte {
+	data := make([]byte, 0, 1+ElementBytes+2+len(r.SSID)+2+2*len(r.Indexes)+1)
+	data = append(data, RequestVersion16)
+	data = append(data, r.Alpha...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(r.SSID)))
+	data = append(data, r.SSID...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(r.Indexes)))
+	for _, index := range r.Indexes {
+		data = binary.BigEndian.AppendUint16(data, index)
+	}
+	var flags uint8
+	if r.Proof {
+		flags |= requestProof
+	}
+	return append(data, flags)
+}
+
+// UnmarshalBinary decodes an EvalRequest in either encoding.
+func (r *EvalRequest) UnmarshalBinary(data []byte) error {
+	if len(data) > 0 && data[0] == RequestVersion16 {
+		return r.unmarshal16(data[1:])
+	}
+	if len(data) < ElementBytes+2+1 {
+		return errors.New("toprf: invalid request length")
+	}
+
+	alpha := data[:ElementBytes]
+	data = data[ElementBytes:]
+
+	ssidLen := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < ssidLen+1 {
+		return errors.New("toprf: invalid request length")
+	}
+	ssid := data[:ssidLen]
+	data = data[ssidLen:]
+
+	count := int(data[0])
+	data = data[1:]
+	proof := false
+	switch {
+	case len(data) == count+1 && data[count] == requestProof:
+		proof = true
+		data = data[:count]
+	case len(data) != count:
+		return errors.New("toprf: invalid request length")
+	}
+
+	r.Alpha = append([]byte(nil), alpha...)
+	r.SSID = nil
+	if ssidLen > 0 {
+		r.SSID = append([]byte(nil), ssid...)
+	}
+	r.Indexes = nil
+	if count > 0 {
+		r.Indexes = widenIndexes(data)
+	}
+	r.Proof = proof
+	return nil
+}
+
+// unmarshal16 decodes the rest of an EvalRequest after RequestVersion16.
+func (r *EvalRequest) unmarshal16(data []byte) error {
+	if len(data) < ElementBytes+2+2+1 {
+		return errors.New("toprf: invalid request length")
+	}
+
+	alpha := data[:ElementBytes]
+	data = data[ElementBytes:]
+
+	ssidLen := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < ssidLen+2+1 {
+		return errors.New("toprf: invalid request length")
+	}
+	ssid := data[:ssidLen]
+	data = data[ssidLen:]
+
+	count := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) != 2*count+1 {
+		return errors.New("toprf: invalid request length")
+	}
+	if data[2*count]&^requestProof != 0 {
+		return errors.New("toprf: unknown request flags")
+	}
+
+	r.Alpha = append([]byte(nil), alpha...)
+	r.SSID = nil
+	if ssidLen > 0 {
+		r.SSID = append([]byte(nil), ssid...)
+	}
+	r.Indexes = nil
+	if count > 0 {
+		r.Indexes = make([]uint16, count)
+		for k := range r.Indexes {
+			r.Indexes[k] = binary.BigEndian.Uint16(data[2*k:])
+		}
+	}
+	r.Proof = data[2*count]&requestProof != 0
+	return nil
+}
+
+// LocalServer is an in-process ShareServer holding a key share and,
+// optionally, a zero share for ThreeHashTDH.
+type LocalServer struct {
+	share Share16
+	zero  *Share16
+}
+
+// NewLocalServer creates an in-process share server. zero may be nil if the
+// server does not support ThreeHashTDH requests.
+func NewLocalServer(share Share, zero *Share) (*LocalServer, error) {
+	var wide *Share16
+	if zero != nil {
+		z := zero.Wide()
+		wide = &z
+	}
+	return NewLocalServer16(share.Wide(), wide)
+}
+
+// NewLocalServer16 is NewLocalServer for a share with a 16-bit index.
+func NewLocalServer16(share Share16, zero *Share16) (*LocalServer, error) {
+	if share.Value == nil {
+		return nil, errors.New("toprf: share value is nil")
+	}
+	if share.Index == 0 {
+		return nil, errors.New("toprf: share index must be > 0")
+	}
+	if zero != nil && zero.Index != share.Index {
+		return nil, errors.New("toprf: zero share index does not match share index")
+	}
+	return &LocalServer{share: share, zero: zero}, nil
+}
+
+// Index returns the index of the share held by the server.
+func (s *LocalServer) Index() uint16 {
+	return s.share.Index
+}
+
+// Evaluate computes the partial evaluation for req with Evaluate, or with
+// ThreeHashTDH if req has an SSID, or with EvaluateWithProof if req asks for
+// a proof.
+func (s *LocalServer) Evaluate(ctx context.Context, req *EvalRequest) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if req.Proof {
+		if req.SSID != nil || req.Indexes != nil {
+			return nil, errors.New("toprf: proofs are only available for raw parts")
+		}
+		beta, proof, err := evaluateWithProof(s.share.Value, req.Alpha)
+		if err != nil {
+			return nil, err
+		}
+		part, err := marshalPart(s.share.Index, beta)
+		if err != nil {
+			return nil, err
+		}
+		return append(part, proof...), nil
+	}
+
+	var beta *ristretto255.Element
+	var err error
+	if req.SSID != nil {
+		if s.zero == nil {
+			return nil, errors.New("toprf: server does not support 3HashTDH")
+		}
+		beta, err = threeHashTDH(s.share.Value, s.zero.Value, req.Alpha, req.SSID)
+	} else {
+		beta, err = evaluate(s.share, req.Alpha, req.Indexes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return marshalPart(s.share.Index, beta)
+}
+
+// marshalPart encodes a server's part as a Part if its index fits in 8 bits,
+// so that clients that only know that encoding can use it, and as a Part16
+// otherwise.
+func marshalPart(index uint16, element *ristretto255.Element) ([]byte, error) {
+	if index <= 255 {
+		part := Part{Index: uint8(index), Element: element}
+		return part.MarshalBinary()
+	}
+	part := Part16{Index: index, Element: element}
+	return part.MarshalBinary()
+}
+
+// maxRequestBytes bounds the size of an EvalRequest accepted over HTTP.
+const maxRequestBytes = 1 + ElementBytes + 2 + 0xffff + 2 + 2*0xffff + 1
+
+// NewHTTPHandler returns an http.Handler that serves partial evaluations
+// from server. It accepts POST requests whose body is a marshaled
+// EvalRequest and responds with the marshaled Part (and proof).
+func NewHTTPHandler(server ShareServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+		if err != nil || len(body) > maxRequestBytes {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		var req EvalRequest
+		if err := req.UnmarshalBinary(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		part, err := server.Evaluate(r.Context(), &req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(part)
+	})
+}
+
+// HTTPShareServer is a ShareServer reached over HTTP, talking to a handler
+// created with NewHTTPHandler.
+type HTTPShareServer struct {
+	index  uint16
+	url    string
+	client *http.Client
+}
+
+// NewHTTPShareServer creates a transport to the share server with the given
+// index at url. If client is nil, http.DefaultClient is used.
+func NewHTTPShareServer(index uint16, url string, client *http.Client) *HTTPShareServer {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPShareServer{index: index, url: url, client: client}
+}
+
+// Index returns the index of the share held by the server.
+func (s *HTTPShareServer) Index() uint16 {
+	return s.index
+}
+
+// Evaluate posts req to the server and returns the marshaled Part (and
+// proof).
+func (s *HTTPShareServer) Evaluate(ctx context.Context, req *EvalRequest) ([]byte, error) {
+	body, err := req.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := s.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	size := Part16Bytes
+	if req.Proof {
+		size += ProofBytes
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("toprf: share server returned %s", resp.Status)
+	}
+	if len(data) != size && len(data) != size-Part16Bytes+PartBytes {
+		return nil, errors.New("toprf: invalid part length")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,197 @@
+package toprf
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// TestEvalRequestMarshal tests EvalRequest serialization/deserialization
+func TestEvalRequestMarshal(t *testing.T) {
+	alpha := ristretto255.NewElement().ScalarBaseMult(scalarFromUint8(5)).Encode(nil)
+
+	testCases := []EvalRequest{
+		{Alpha: alpha},
+		{Alpha: alpha, Indexes: []uint16{1, 3, 4}},
+		{Alpha: alpha, SSID: []byte("session")},
+		{Alpha: alpha, Proof: true},
+		{Alpha: alpha, Indexes: []uint16{1, 300, 65535}},
+		{Alpha: alpha, Indexes: []uint16{256}, SSID: []byte("session"), Proof: true},
+	}
+
+	for _, original := range testCases {
+		data, err := original.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+
+		var decoded EvalRequest
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary failed: %v", err)
+		}
+
+		if !bytes.Equal(decoded.Alpha, original.Alpha) ||
+			!slices.Equal(decoded.Indexes, original.Indexes) ||
+			!bytes.Equal(decoded.SSID, original.SSID) ||
+			decoded.Proof != original.Proof ||
+			(decoded.SSID == nil) != (original.SSID == nil) {
+			t.Errorf("Request mismatch after marshal/unmarshal: %+v", decoded)
+		}
+
+		if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil && len(original.Indexes) > 0 {
+			t.Error("UnmarshalBinary accepted a truncated request")
+		}
+	}
+
+	// Requests with 8-bit indexes keep the unversioned encoding
+	data, _ := (&EvalRequest{Alpha: alpha, Indexes: []uint16{1, 3, 4}}).MarshalBinary()
+	want := append(append(slices.Clone(alpha), 0, 0, 3), 1, 3, 4)
+	if !bytes.Equal(data, want) {
+		t.Errorf("8-bit request = %x, want %x", data, want)
+	}
+	data, _ = (&EvalRequest{Alpha: alpha, Indexes: []uint16{1, 300}}).MarshalBinary()
+	if data[0] != RequestVersion16 || len(data) != 1+ElementBytes+2+2+4+1 {
+		t.Errorf("16-bit request = %x", data)
+	}
+	var decoded EvalRequest
+	data[len(data)-1] = 0x80
+	if err := decoded.UnmarshalBinary(data); err == nil {
+		t.Error("UnmarshalBinary accepted unknown flags")
+	}
+}
+
+// TestShareServers16 evaluates with share servers whose indexes do not fit in
+// 8 bits, next to one that does, over HTTP
+func TestShareServers16(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	shares, err := CreateShares16(secret, 300, 3)
+	if err != nil {
+		t.Fatalf("CreateShares16 failed: %v", err)
+	}
+
+	keys := make([]*ristretto255.Element, len(shares))
+	var remotes []ShareServer
+	for _, index := range []uint16{1, 299, 300} {
+		share := shares[index-1]
+		keys[index-1] = ristretto255.NewElement().ScalarBaseMult(share.Value)
+		local, err := NewLocalServer16(share, nil)
+		if err != nil {
+			t.Fatalf("NewLocalServer16 failed: %v", err)
+		}
+		ts := httptest.NewServer(NewHTTPHandler(local))
+		defer ts.Close()
+		remotes = append(remotes, NewHTTPShareServer(index, ts.URL, ts.Client()))
+	}
+
+	_, alpha, _ := oprf.Blind([]byte("input"), nil)
+	expected, _ := oprf.Evaluate(keyBytes, alpha)
+
+	// Step 1: The client combines proven parts of both encodings
+	client, err := NewClient(remotes, ClientConfig{Threshold: 3, VerificationKeys: keys})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	result, err := client.Evaluate(context.Background(), alpha)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if !bytes.Equal(result.Beta, expected) {
+		t.Error("16-bit servers differ from non-threshold evaluation")
+	}
+	for _, part := range result.Parts {
+		if len(part) != PartBytes && len(part) != Part16Bytes {
+			t.Errorf("Part of %d bytes", len(part))
+		}
+	}
+
+	// Step 2: Servers apply their coefficients over 16-bit indexes
+	req := &EvalRequest{Alpha: alpha, Indexes: []uint16{1, 299, 300}}
+	parts := make([][]byte, len(remotes))
+	for i, remote := range remotes {
+		if parts[i], err = remote.Evaluate(context.Background(), req); err != nil {
+			t.Fatalf("Evaluate with indexes failed: %v", err)
+		}
+	}
+	if len(parts[0]) != PartBytes || len(parts[2]) != Part16Bytes {
+		t.Errorf("Parts of %d and %d bytes", len(parts[0]), len(parts[2]))
+	}
+	if beta, _ := ThresholdCombine16(parts); !bytes.Equal(beta, expected) {
+		t.Error("ThresholdCombine16 of 16-bit parts differs from non-threshold evaluation")
+	}
+}
+
+// TestHTTPShareServer evaluates over the HTTP transport
+func TestHTTPShareServer(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	shares, err := CreateShares(secret, 3, 2)
+	if err != nil {
+		t.Fatalf("CreateShares failed: %v", err)
+	}
+
+	local, err := NewLocalServer(shares[1], nil)
+	if err != nil {
+		t.Fatalf("NewLocalServer failed: %v", err)
+	}
+	ts := httptest.NewServer(NewHTTPHandler(local))
+	defer ts.Close()
+
+	remote := NewHTTPShareServer(2, ts.URL, ts.Client())
+	_, alpha, _ := oprf.Blind([]byte("input"), nil)
+
+	req := &EvalRequest{Alpha: alpha, Indexes: []uint16{1, 2}}
+	got, err := remote.Evaluate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Evaluate over HTTP failed: %v", err)
+	}
+	want, _ := local.Evaluate(context.Background(), req)
+	if !bytes.Equal(got, want) {
+		t.Error("HTTP transport returned a different part")
+	}
+
+	// A proven part carries its proof over HTTP
+	got, err = remote.Evaluate(context.Background(), &EvalRequest{Alpha: alpha, Proof: true})
+	if err != nil {
+		t.Fatalf("Evaluate with proof over HTTP failed: %v", err)
+	}
+	vk := ristretto255.NewElement().ScalarBaseMult(shares[1].Value)
+	if err := VerifyPart(vk, alpha, got[:PartBytes], got[PartBytes:]); err != nil {
+		t.Errorf("Part proof over HTTP does not verify: %v", err)
+	}
+	if _, err := remote.Evaluate(context.Background(), &EvalRequest{Alpha: alpha, Indexes: []uint16{1, 2}, Proof: true}); err == nil {
+		t.Error("Expected an error for a proof of a part with a coefficient")
+	}
+
+	// The local server has no zero share, so 3HashTDH is refused
+	if _, err := remote.Evaluate(context.Background(), &EvalRequest{Alpha: alpha, SSID: []byte("s")}); err == nil {
+		t.Error("Expected an error for an unsupported 3HashTDH request")
+	}
+
+	// Invalid requests are rejected by the handler
+	if _, err := remote.Evaluate(context.Background(), &EvalRequest{Alpha: alpha[:5]}); err == nil {
+		t.Error("Expected an error for an invalid request")
+	}
+}
+
+// TestNewLocalServerInvalid tests error handling of NewLocalServer
+func TestNewLocalServerInvalid(t *testing.T) {
+	if _, err := NewLocalServer(Share{Index: 1}, nil); err == nil {
+		t.Error("NewLocalServer should fail without a share value")
+	}
+
+	share := Share{Index: 1, Value: scalarFromUint8(1)}
+	zero := Share{Index: 2, Value: scalarFromUint8(1)}
+	if _, err := NewLocalServer(share, &zero); err == nil {
+		t.Error("NewLocalServer should fail with a mismatched zero share")
+	}
+}
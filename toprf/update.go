@@ -0,0 +1,88 @@
+package toprf
+
+// Client-side key update tokens
+//
+// When the servers rotate a threshold key from k to k' = delta * k, every
+// unblinded OPRF element N = H(x)^k turns into N' = H(x)^k' = N^delta. The
+// servers publish delta as an UpdateToken, and clients (or a database of
+// stored elements) can upgrade old results without knowing the inputs and
+// without contacting the servers. The final output is then recomputed with
+// oprf.Finalize(input, N') if the input is at hand, which is why stores that
+// want to be updatable keep N rather than the finalized output.
+//
+// The token only relates the old key to the new one, so it must be treated
+// like the rotation itself: anyone who holds the old key and the token also
+// holds the new key.
+
+import (
+	"errors"
+
+	"github.com/gtank/ristretto255"
+)
+
+// UpdateTokenBytes is the size of a serialized UpdateToken
+const UpdateTokenBytes = ScalarBytes
+
+// UpdateToken upgrades OPRF results from an old key to a rotated key.
+// Delta is the ratio k'/k between the new and old key.
+type UpdateToken struct {
+	Delta *ristretto255.Scalar
+}
+
+// NewUpdateToken computes the token that upgrades results of oldKey to
+// results of newKey, for a single server that rotates its own key.
+func NewUpdateToken(oldKey, newKey *ristretto255.Scalar) (*UpdateToken, error) {
+	if oldKey.Equal(ristretto255.NewScalar()) == 1 || newKey.Equal(ristretto255.NewScalar()) == 1 {
+		return nil, errors.New("toprf: key is zero")
+	}
+
+	delta := ristretto255.NewScalar().Invert(oldKey)
+	delta.Multiply(delta, newKey)
+	return &UpdateToken{Delta: delta}, nil
+}
+
+// Apply turns an unblinded element computed under the old key (the output of
+// oprf.Unblind) into the unblinded element under the new key.
+func (u *UpdateToken) Apply(n []byte) ([]byte, error) {
+	if u.Delta == nil {
+		return nil, errors.New("toprf: update token is nil")
+	}
+	if len(n) != ElementBytes {
+		return nil, errors.New("toprf: invalid element length")
+	}
+
+	element := ristretto255.NewElement()
+	if err := element.Decode(n); err != nil {
+		return nil, err
+	}
+
+	return element.ScalarMult(u.Delta, element).Encode(nil), nil
+}
+
+// MarshalBinary encodes an UpdateToken into bytes for publication.
+// Format: [delta:32 bytes]
+func (u *UpdateToken) MarshalBinary() ([]byte, error) {
+	if u.Delta == nil {
+		return nil, errors.New("toprf: update token is nil")
+	}
+	return u.Delta.Encode(nil), nil
+}
+
+// UnmarshalBinary decodes an UpdateToken from bytes.
+// Expects data to be exactly UpdateTokenBytes (32 bytes).
+func (u *UpdateToken) UnmarshalBinary(data []byte) error {
+	if len(data) != UpdateTokenBytes {
+		return errors.New("toprf: invalid update token length")
+	}
+
+	delta := ristretto255.NewScalar()
+	if err := delta.Decode(data); err != nil {
+		return err
+	}
+	if delta.Equal(ristretto255.NewScalar()) == 1 {
+		return errors.New("toprf: update token is zero")
+	}
+
+	u.Delta = delta
+	return nil
+}
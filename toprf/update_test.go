@@ -0,0 +1,94 @@
+package toprf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// TestUpdateToken tests upgrading an unblinded element to a rotated key
+func TestUpdateToken(t *testing.T) {
+	oldKey, err := oprf.KeyGen()
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	newKey, err := oprf.KeyGen()
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	oldScalar := ristretto255.NewScalar()
+	oldScalar.Decode(oldKey)
+	newScalar := ristretto255.NewScalar()
+	newScalar.Decode(newKey)
+
+	token, err := NewUpdateToken(oldScalar, newScalar)
+	if err != nil {
+		t.Fatalf("NewUpdateToken failed: %v", err)
+	}
+
+	input := []byte("stored input")
+	r, alpha, err := oprf.Blind(input, nil)
+	if err != nil {
+		t.Fatalf("Blind failed: %v", err)
+	}
+
+	oldBeta, _ := oprf.Evaluate(oldKey, alpha)
+	oldN, _ := oprf.Unblind(r, oldBeta)
+	newBeta, _ := oprf.Evaluate(newKey, alpha)
+	newN, _ := oprf.Unblind(r, newBeta)
+
+	upgraded, err := token.Apply(oldN)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !bytes.Equal(upgraded, newN) {
+		t.Error("Upgraded element differs from evaluation under the new key")
+	}
+
+	// Round trip through the wire format
+	data, err := token.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if len(data) != UpdateTokenBytes {
+		t.Errorf("Marshaled token has wrong length: got %d, want %d", len(data), UpdateTokenBytes)
+	}
+
+	var decoded UpdateToken
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	upgraded2, err := decoded.Apply(oldN)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !bytes.Equal(upgraded, upgraded2) {
+		t.Error("Decoded token gives a different result")
+	}
+}
+
+// TestUpdateTokenInvalid tests error handling of update tokens
+func TestUpdateTokenInvalid(t *testing.T) {
+	zero := ristretto255.NewScalar()
+	one := scalarFromUint8(1)
+
+	if _, err := NewUpdateToken(zero, one); err == nil {
+		t.Error("NewUpdateToken should fail for a zero key")
+	}
+
+	var token UpdateToken
+	if err := token.UnmarshalBinary(make([]byte, UpdateTokenBytes)); err == nil {
+		t.Error("UnmarshalBinary should reject a zero token")
+	}
+	if err := token.UnmarshalBinary([]byte{1, 2, 3}); err == nil {
+		t.Error("UnmarshalBinary should reject a short token")
+	}
+
+	token.Delta = one
+	if _, err := token.Apply([]byte{1, 2, 3}); err == nil {
+		t.Error("Apply should fail with invalid element length")
+	}
+}
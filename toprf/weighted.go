@@ -0,0 +1,225 @@
+package toprf
+
+// Weighted threshold OPRF
+//
+// In a weighted setup every operator holds a block of consecutive share
+// indexes, one per unit of weight, so an operator with weight 3 counts like
+// three servers. The threshold is the total weight needed to evaluate: the
+// key is shared with a polynomial of degree threshold-1 over all indexes.
+//
+// An operator answers a request with a single part: the sum of its shares'
+// partial evaluations, each already multiplied by its Lagrange coefficient
+// over the indexes of all participating operators (Peers). The client adds
+// the parts with ThresholdCombine16. Because the coefficients must be known in
+// advance, the client fixes the set of operators before sending the request,
+// as with Evaluate.
+//
+// Indexes are 16-bit, so the total weight can be up to 65535.
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/gtank/ristretto255"
+)
+
+// WeightedScheme describes a weighted sharing: the weight of each operator
+// and the threshold as a total weight. Operators are numbered from 1.
+type WeightedScheme struct {
+	Weights   []uint16
+	Threshold uint16
+}
+
+// NewWeightedScheme validates weights and threshold.
+//
+// Parameters:
+//   - weights: weight of operator o at o-1, each at least 1
+//   - threshold: total weight needed to evaluate (2 <= threshold <= total
+//     weight, the bound of the weighted DKG)
+func NewWeightedScheme(weights []uint16, threshold uint16) (*WeightedScheme, error) {
+	if len(weights) == 0 || len(weights) > 65535 {
+		return nil, errors.New("toprf: invalid number of operators")
+	}
+
+	total := 0
+	for _, w := range weights {
+		if w == 0 {
+			return nil, errors.New("toprf: operator weight must be > 0")
+		}
+		total += int(w)
+	}
+	if total > 65535 {
+		return nil, errors.New("toprf: total weight exceeds 65535")
+	}
+	if threshold < 2 || int(threshold) > total {
+		return nil, errors.New("toprf: invalid threshold parameters")
+	}
+
+	return &WeightedScheme{Weights: append([]uint16(nil), weights...), Threshold: threshold}, nil
+}
+
+// TotalWeight returns the sum of all weights, which is the number of shares.
+func (w *WeightedScheme) TotalWeight() uint16 {
+	total := 0
+	for _, weight := range w.Weights {
+		total += int(weight)
+	}
+	return uint16(total)
+}
+
+// Indexes returns the share indexes held by operator.
+func (w *WeightedScheme) Indexes(operator uint16) ([]uint16, error) {
+	if operator < 1 || int(operator) > len(w.Weights) {
+		return nil, errors.New("toprf: operator out of range")
+	}
+
+	first := 1
+	for _, weight := range w.Weights[:operator-1] {
+		first += int(weight)
+	}
+
+	indexes := make([]uint16, w.Weights[operator-1])
+	for k := range indexes {
+		indexes[k] = uint16(first + k)
+	}
+	return indexes, nil
+}
+
+// Peers returns the share indexes of all given operators, to be sent to each
+// of them with the request. It returns an error if the operators' total
+// weight is below the threshold.
+func (w *WeightedScheme) Peers(operators []uint16) ([]uint16, error) {
+	seen := make(map[uint16]bool, len(operators))
+	var peers []uint16
+	for _, operator := range operators {
+		if seen[operator] {
+			return nil, errors.New("toprf: duplicate operator")
+		}
+		seen[operator] = true
+
+		indexes, err := w.Indexes(operator)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, indexes...)
+	}
+
+	if len(peers) < int(w.Threshold) {
+		return nil, errors.New("toprf: operators do not reach the threshold weight")
+	}
+	return peers, nil
+}
+
+// WeightedShare is the key material of one operator: one share per unit of
+// weight.
+type WeightedShare struct {
+	Operator uint16
+	Shares   []Share16
+}
+
+// CreateWeightedShares splits a secret according to scheme, returning the
+// shares of operator o at o-1.
+func CreateWeightedShares(secret *ristretto255.Scalar, scheme *WeightedScheme) ([]WeightedShare, error) {
+	shares, err := CreateShares16(secret, scheme.TotalWeight(), scheme.Threshold)
+	if err != nil {
+		return nil, err
+	}
+	return GroupWeightedShares(scheme, shares)
+}
+
+// GroupWeightedShares groups shares indexed 1..TotalWeight by operator. It is
+// used by dealers that create the shares themselves, such as the DKG.
+func GroupWeightedShares(scheme *WeightedScheme, shares []Share16) ([]WeightedShare, error) {
+	if len(shares) != int(scheme.TotalWeight()) {
+		return nil, errors.New("toprf: wrong number of shares")
+	}
+
+	result := make([]WeightedShare, len(scheme.Weights))
+	offset := 0
+	for o, weight := range scheme.Weights {
+		result[o] = WeightedShare{
+			Operator: uint16(o + 1),
+			Shares:   append([]Share16(nil), shares[offset:offset+int(weight)]...),
+		}
+		offset += int(weight)
+	}
+	return result, nil
+}
+
+// EvaluateWeighted computes an operator's combined partial evaluation: the
+// sum of alpha^(lambda_i * k_i) over all of its shares, where lambda_i is the
+// Lagrange coefficient for f(0) over peers.
+//
+// Returns a marshaled Part16 with the operator number as index. Combine the
+// parts of all operators with ThresholdCombine16.
+func EvaluateWeighted(share WeightedShare, blinded []byte, peers []uint16) ([]byte, error) {
+	if len(share.Shares) == 0 {
+		return nil, errors.New("toprf: operator holds no shares")
+	}
+
+	beta := ristretto255.NewElement()
+	for _, s := range share.Shares {
+		if !containsIndex16(peers, s.Index) {
+			return nil, errors.New("toprf: share index missing from peers")
+		}
+
+		part, err := evaluate(s, blinded, peers)
+		if err != nil {
+			return nil, err
+		}
+		beta.Add(beta, part)
+	}
+
+	part := Part16{Index: share.Operator, Element: beta}
+	return part.MarshalBinary()
+}
+
+// MarshalBinary encodes a WeightedShare for storage.
+// Format: [operator:2 bytes][count:2 bytes][count * Share16Bytes]
+func (w *WeightedShare) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 4, 4+len(w.Shares)*Share16Bytes)
+	binary.BigEndian.PutUint16(data[0:2], w.Operator)
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(w.Shares)))
+	for i := range w.Shares {
+		s, err := w.Shares[i].MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, s...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a WeightedShare from bytes.
+func (w *WeightedShare) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 {
+		return errors.New("toprf: invalid weighted share length")
+	}
+
+	count := int(binary.BigEndian.Uint16(data[2:4]))
+	if len(data) != 4+count*Share16Bytes {
+		return errors.New("toprf: invalid weighted share length")
+	}
+
+	shares := make([]Share16, count)
+	for i := range shares {
+		off := 4 + i*Share16Bytes
+		if err := shares[i].UnmarshalBinary(data[off : off+Share16Bytes]); err != nil {
+			return err
+		}
+	}
+
+	w.Operator = binary.BigEndian.Uint16(data[0:2])
+	w.Shares = shares
+	return nil
+}
+
+// containsIndex16 reports whether index is in indexes.
+func containsIndex16(indexes []uint16, index uint16) bool {
+	for _, i := range indexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package toprf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/oprf"
+)
+
+// TestWeightedScheme tests index allocation and the weight threshold
+func TestWeightedScheme(t *testing.T) {
+	scheme, err := NewWeightedScheme([]uint16{3, 1, 2}, 4)
+	if err != nil {
+		t.Fatalf("NewWeightedScheme failed: %v", err)
+	}
+	if scheme.TotalWeight() != 6 {
+		t.Errorf("TotalWeight = %d, want 6", scheme.TotalWeight())
+	}
+
+	indexes, _ := scheme.Indexes(3)
+	if len(indexes) != 2 || indexes[0] != 5 || indexes[1] != 6 {
+		t.Errorf("Operator 3 indexes = %v, want [5 6]", indexes)
+	}
+
+	if _, err := scheme.Peers([]uint16{2, 3}); err == nil {
+		t.Error("Peers accepted operators with weight 3 < 4")
+	}
+	if _, err := scheme.Peers([]uint16{1, 1}); err == nil {
+		t.Error("Peers accepted a duplicate operator")
+	}
+	peers, err := scheme.Peers([]uint16{1, 2})
+	if err != nil || len(peers) != 4 {
+		t.Errorf("Peers(1, 2) = %v, %v", peers, err)
+	}
+
+	for _, tc := range []struct {
+		weights   []uint16
+		threshold uint16
+	}{
+		{[]uint16{1, 0}, 1},
+		{[]uint16{1, 2}, 4},
+		{[]uint16{1, 2}, 1},
+		{[]uint16{65535, 1}, 2},
+		{nil, 1},
+	} {
+		if _, err := NewWeightedScheme(tc.weights, tc.threshold); err == nil {
+			t.Errorf("NewWeightedScheme(%v, %d) accepted invalid parameters", tc.weights, tc.threshold)
+		}
+	}
+}
+
+// TestWeightedEvaluate tests that any operator set reaching the weight
+// threshold evaluates the OPRF correctly, with one part per operator
+func TestWeightedEvaluate(t *testing.T) {
+	keyBytes, _ := oprf.KeyGen()
+	secret := ristretto255.NewScalar()
+	secret.Decode(keyBytes)
+
+	scheme, _ := NewWeightedScheme([]uint16{3, 1, 1, 2}, 4)
+	shares, err := CreateWeightedShares(secret, scheme)
+	if err != nil {
+		t.Fatalf("CreateWeightedShares failed: %v", err)
+	}
+
+	input := []byte("weighted")
+	r, alpha, _ := oprf.Blind(input, nil)
+	expectedBeta, _ := oprf.Evaluate(keyBytes, alpha)
+	expectedN, _ := oprf.Unblind(r, expectedBeta)
+
+	for _, operators := range [][]uint16{{1, 2}, {2, 3, 4}, {1, 4}, {1, 2, 3, 4}} {
+		peers, err := scheme.Peers(operators)
+		if err != nil {
+			t.Fatalf("Peers(%v) failed: %v", operators, err)
+		}
+
+		var parts [][]byte
+		for _, o := range operators {
+			part, err := EvaluateWeighted(shares[o-1], alpha, peers)
+			if err != nil {
+				t.Fatalf("Operator %d: EvaluateWeighted failed: %v", o, err)
+			}
+			parts = append(parts, part)
+		}
+
+		beta, err := ThresholdCombine16(parts)
+		if err != nil {
+			t.Fatalf("ThresholdCombine16 failed: %v", err)
+		}
+		n, _ := oprf.Unblind(r, beta)
+		if !bytes.Equal(n, expectedN) {
+			t.Errorf("Operators %v: weighted output differs from non-threshold output", operators)
+		}
+	}
+
+	// An operator is not asked for indexes it does not hold
+	if _, err := EvaluateWeighted(shares[0], alpha, []uint16{4, 5, 6, 7}); err == nil {
+		t.Error("EvaluateWeighted accepted peers without the operator's indexes")
+	}
+}
+
+// TestWeightedShareMarshal tests WeightedShare serialization/deserialization
+func TestWeightedShareMarshal(t *testing.T) {
+	scheme, _ := NewWeightedScheme([]uint16{2, 3}, 3)
+	shares, _ := CreateWeightedShares(scalarFromUint8(8), scheme)
+
+	data, err := shares[1].MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	var decoded WeightedShare
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.Operator != 2 || len(decoded.Shares) != 3 || decoded.Shares[2].Index != 5 {
+		t.Errorf("Decoded share mismatch: operator %d, %d shares", decoded.Operator, len(decoded.Shares))
+	}
+
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("UnmarshalBinary accepted a truncated share")
+	}
+}
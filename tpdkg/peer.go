@@ -0,0 +1,396 @@
+package tpdkg
+
+// The peer
+//
+// A peer only talks to the TP, and checks every message the TP relays from
+// another peer against that peer's ephemeral signing key, so that the TP
+// cannot forge commitments, shares or complaints. The TP could still show
+// different broadcasts to different peers; every peer hashes the broadcasts
+// it sees into its transcript, and the TP reports any peer whose transcript
+// differs from its own before the peers accept their shares.
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"time"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/dkg"
+	"github.com/wurp/go-oprf/internal/wire"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// PeerConfig configures a peer.
+//
+// - Self: The peer's index, from 1 to n
+// - ProtoName: The name of the protocol instance, as given to the TP
+// - SigningKey: The peer's long-term Ed25519 key
+// - PeerKeys: All peers' long-term Ed25519 public keys, PeerKeys[i-1] for peer i
+// - TPKey: The TP's long-term Ed25519 public key, or nil to accept the key
+// announced in the TP's first message
+// - TimestampEpsilon: The maximum clock difference to the TP and other
+// peers, or 0 for none
+type PeerConfig struct {
+	Self             uint16
+	ProtoName        []byte
+	SigningKey       ed25519.PrivateKey
+	PeerKeys         []ed25519.PublicKey
+	TPKey            ed25519.PublicKey
+	TimestampEpsilon time.Duration
+}
+
+// PeerState is a peer of a tp-dkg ceremony, like liboprf's TP_DKG_PeerState.
+type PeerState struct {
+	config     PeerConfig
+	n          uint16
+	threshold  uint16
+	tpKey      ed25519.PublicKey
+	session    [SessionIDBytes]byte
+	transcript hash.Hash
+	// step is the number of the TP message Next expects
+	step uint8
+	// last is the timestamp of the latest message of the TP (index 0) and of
+	// every peer
+	last []uint64
+
+	sigKey      ed25519.PrivateKey
+	boxKey      *ecdh.PrivateKey
+	sigKeys     []ed25519.PublicKey
+	boxKeys     []*ecdh.PublicKey
+	commitments [][]*ristretto255.Element
+	shares      []toprf.Share16
+	complained  bool
+
+	share  toprf.Share16
+	result *dkg.Result
+	done   bool
+}
+
+// NewPeer joins a ceremony.
+//
+// Parameters:
+//   - config: The peer's keys and index
+//   - msg0: The TP's first message
+//
+// Returns:
+//   - The peer
+//   - The peer's first message, for the TP
+func NewPeer(config PeerConfig, msg0 []byte) (*PeerState, []byte, error) {
+	if len(config.SigningKey) != ed25519.PrivateKeySize {
+		return nil, nil, errors.New("tpdkg: invalid signing key")
+	}
+
+	m, rest, err := wire.Parse(msg0)
+	if err != nil || len(rest) != 0 || len(m.Data) != paramsBytes {
+		return nil, nil, errors.New("tpdkg: invalid parameters message")
+	}
+	n, threshold := binary.BigEndian.Uint16(m.Data), binary.BigEndian.Uint16(m.Data[2:])
+	tpKey := ed25519.PublicKey(m.Data[4 : 4+ed25519.PublicKeySize])
+	if config.TPKey != nil && !tpKey.Equal(config.TPKey) {
+		return nil, nil, errors.New("tpdkg: parameters from an unknown TP")
+	}
+	if threshold < 2 || threshold > n || n == Broadcast {
+		return nil, nil, errors.New("tpdkg: invalid threshold or number of peers")
+	}
+	if config.Self < 1 || config.Self > n || len(config.PeerKeys) != int(n) {
+		return nil, nil, errors.New("tpdkg: peer index or keys do not match the parameters")
+	}
+	for _, key := range config.PeerKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("tpdkg: invalid peer key")
+		}
+	}
+
+	p := &PeerState{
+		config:      config,
+		n:           n,
+		threshold:   threshold,
+		tpKey:       tpKey,
+		session:     wire.SessionID(config.ProtoName, m.Data[4+ed25519.PublicKeySize:]),
+		step:        msgKeyBundle,
+		last:        make([]uint64, int(n)+1),
+		sigKeys:     make([]ed25519.PublicKey, n),
+		boxKeys:     make([]*ecdh.PublicKey, n),
+		commitments: make([][]*ristretto255.Element, n),
+		shares:      make([]toprf.Share16, n),
+	}
+	if err := m.Check(tpKey, msgParams, TP, Broadcast, config.TimestampEpsilon, &p.last[TP]); err != nil {
+		return nil, nil, err
+	}
+	p.transcript = newTranscript(p.session)
+	wire.Record(p.transcript, m)
+
+	// Ephemeral keys for the session
+	sigPublic, sigKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.boxKey, err = ecdh.X25519().GenerateKey(rand.Reader); err != nil {
+		return nil, nil, err
+	}
+	p.sigKey = sigKey
+
+	data := append(append([]byte(nil), sigPublic...), p.boxKey.PublicKey().Bytes()...)
+	return p, wire.New(config.SigningKey, msgKeys, config.Self, TP, data), nil
+}
+
+// Next runs one step of the ceremony.
+//
+// Parameters:
+//   - input: The TP's message for this step
+//
+// Returns the peer's message for the TP, or nil when the peer is done. If
+// the TP aborts the ceremony, the error is a *CheatersError.
+func (p *PeerState) Next(input []byte) ([]byte, error) {
+	if p.done {
+		return nil, errors.New("tpdkg: ceremony is over")
+	}
+
+	m, rest, err := wire.Parse(input)
+	if err != nil || len(rest) != 0 {
+		return nil, errors.New("tpdkg: invalid message from the TP")
+	}
+	number, to := p.step, uint16(Broadcast)
+	if p.step == msgDeal {
+		to = p.config.Self
+	}
+	if m.Number == msgVerdict {
+		// The TP may abort the ceremony at any step
+		number, to = msgVerdict, Broadcast
+	}
+	if err := m.Check(p.tpKey, number, TP, to, p.config.TimestampEpsilon, &p.last[TP]); err != nil {
+		return nil, err
+	}
+	if number != p.step {
+		p.done = true
+		cheaters, err := decodeCheaters(m.Data)
+		if err != nil || len(cheaters) == 0 {
+			return nil, errors.New("tpdkg: the TP aborted without a verdict")
+		}
+		return nil, &CheatersError{Cheaters: cheaters}
+	}
+
+	switch p.step {
+	case msgKeyBundle:
+		return p.deal(m)
+	case msgDeal:
+		return p.verify(m)
+	case msgComplaintBundle:
+		return p.reveal(m)
+	case msgVerdict:
+		return p.confirm(m)
+	default:
+		return nil, p.finish(m)
+	}
+}
+
+// Done reports whether the ceremony is over for the peer, like
+// tpdkg_peer_not_done() negated
+func (p *PeerState) Done() bool {
+	return p.done
+}
+
+// Result returns the peer's share of the key and the public result of the
+// ceremony, once it finished without cheaters
+func (p *PeerState) Result() (toprf.Share16, *dkg.Result, error) {
+	if p.result == nil {
+		return toprf.Share16{}, nil, errors.New("tpdkg: ceremony did not finish")
+	}
+	return p.share, p.result, nil
+}
+
+// SessionID returns the ID of the ceremony
+func (p *PeerState) SessionID() [SessionIDBytes]byte {
+	return p.session
+}
+
+// deal records the peers' ephemeral keys and deals the peer's shares
+func (p *PeerState) deal(m *wire.Message) ([]byte, error) {
+	keys, err := wire.ParseAll(m.Data, int(p.n))
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		peer := uint16(i + 1)
+		if err := p.relayed(k, p.config.PeerKeys[i], msgKeys, peer, TP); err != nil {
+			return nil, err
+		}
+		if len(k.Data) != keyBytes {
+			return nil, errors.New("tpdkg: invalid peer keys")
+		}
+		if p.boxKeys[i], err = ecdh.X25519().NewPublicKey(k.Data[ed25519.PublicKeySize:]); err != nil {
+			return nil, err
+		}
+		p.sigKeys[i] = k.Data[:ed25519.PublicKeySize]
+	}
+	self := p.config.Self
+	if !p.sigKeys[self-1].Equal(p.sigKey.Public()) || !p.boxKeys[self-1].Equal(p.boxKey.PublicKey()) {
+		return nil, errors.New("tpdkg: the TP replaced the peer's keys")
+	}
+	wire.Record(p.transcript, keys...)
+
+	commitments, shares, err := dkg.Start16(p.n, p.threshold)
+	if err != nil {
+		return nil, err
+	}
+	p.commitments[self-1] = commitments
+	p.shares[self-1] = shares[self-1]
+
+	output := wire.New(p.sigKey, msgCommitments, self, Broadcast, encodeCommitments(commitments))
+	for j := range p.n {
+		recipient := j + 1
+		if recipient == self {
+			continue
+		}
+		pair, err := wire.PairKey(shareContext, p.session, p.boxKey, p.boxKeys[j], self, recipient)
+		if err != nil {
+			return nil, err
+		}
+		share, _ := shares[j].MarshalBinary()
+		sealed, err := wire.SealShare(p.session, pair, self, recipient, share)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, wire.New(p.sigKey, msgShare, self, recipient, sealed)...)
+	}
+
+	p.step = msgDeal
+	return output, nil
+}
+
+// verify checks the commitments and shares of the other dealers and
+// complains about the bad ones
+func (p *PeerState) verify(m *wire.Message) ([]byte, error) {
+	self := p.config.Self
+	messages, err := wire.ParseAll(m.Data, 2*int(p.n)-1)
+	if err != nil {
+		return nil, err
+	}
+	commitments, shares := messages[:p.n], messages[p.n:]
+	for i, c := range commitments {
+		dealer := uint16(i + 1)
+		if err := p.relayed(c, p.sigKeys[i], msgCommitments, dealer, Broadcast); err != nil {
+			return nil, err
+		}
+		if dealer == self {
+			continue
+		}
+		if p.commitments[i], err = decodeCommitments(c.Data, p.threshold); err != nil {
+			return nil, err
+		}
+	}
+	wire.Record(p.transcript, commitments...)
+
+	var complaints []uint16
+	for k, s := range shares {
+		dealer := uint16(k + 1)
+		if dealer >= self {
+			dealer++
+		}
+		if err := p.relayed(s, p.sigKeys[dealer-1], msgShare, dealer, self); err != nil {
+			return nil, err
+		}
+		if err := p.openShare(dealer, s.Data); err != nil {
+			complaints = append(complaints, dealer)
+		}
+	}
+	p.complained = len(complaints) > 0
+
+	p.step = msgComplaintBundle
+	return wire.New(p.sigKey, msgComplaints, self, Broadcast, encodeComplaints(complaints)), nil
+}
+
+// openShare decrypts the share of a dealer and checks it against the
+// dealer's commitments
+func (p *PeerState) openShare(dealer uint16, sealed []byte) error {
+	self := p.config.Self
+	pair, err := wire.PairKey(shareContext, p.session, p.boxKey, p.boxKeys[dealer-1], dealer, self)
+	if err != nil {
+		return err
+	}
+	plaintext, err := wire.OpenShare(p.session, pair, dealer, self, sealed)
+	if err != nil {
+		return err
+	}
+	var share toprf.Share16
+	if err := share.UnmarshalBinary(plaintext); err != nil {
+		return err
+	}
+	if share.Index != self {
+		return errors.New("tpdkg: share for another peer")
+	}
+	if err := dkg.VerifyCommitment16(p.n, p.threshold, self, dealer, p.commitments[dealer-1], share); err != nil {
+		return err
+	}
+	p.shares[dealer-1] = share
+	return nil
+}
+
+// reveal records the complaints and reveals the peer's ephemeral key if it
+// complained
+func (p *PeerState) reveal(m *wire.Message) ([]byte, error) {
+	complaints, err := wire.ParseAll(m.Data, int(p.n))
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range complaints {
+		if err := p.relayed(c, p.sigKeys[i], msgComplaints, uint16(i+1), Broadcast); err != nil {
+			return nil, err
+		}
+	}
+	wire.Record(p.transcript, complaints...)
+
+	var data []byte
+	if p.complained {
+		data = p.boxKey.Bytes()
+	}
+	p.step = msgVerdict
+	return wire.New(p.sigKey, msgReveal, p.config.Self, TP, data), nil
+}
+
+// confirm checks the verdict and sends the peer's transcript
+func (p *PeerState) confirm(m *wire.Message) ([]byte, error) {
+	cheaters, err := decodeCheaters(m.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(cheaters) > 0 {
+		p.done = true
+		return nil, &CheatersError{Cheaters: cheaters}
+	}
+	if p.complained {
+		return nil, errors.New("tpdkg: the TP dismissed the peer's complaints")
+	}
+	wire.Record(p.transcript, m)
+
+	p.step = msgFinal
+	return wire.New(p.sigKey, msgTranscript, p.config.Self, TP, p.transcript.Sum(nil)), nil
+}
+
+// finish checks the final verdict and computes the peer's share
+func (p *PeerState) finish(m *wire.Message) error {
+	cheaters, err := decodeCheaters(m.Data)
+	if err != nil {
+		return err
+	}
+	p.done = true
+	if len(cheaters) > 0 {
+		return &CheatersError{Cheaters: cheaters}
+	}
+
+	qual := make([]uint16, p.n)
+	for i := range qual {
+		qual[i] = uint16(i + 1)
+	}
+	p.share, p.result, err = dkg.FinishWithResult16(p.n, p.threshold, p.config.Self, qual, p.commitments, p.shares)
+	return err
+}
+
+// relayed checks a message of another peer that the TP relayed
+func (p *PeerState) relayed(m *wire.Message, key ed25519.PublicKey, number uint8, from, to uint16) error {
+	return m.Check(key, number, from, to, p.config.TimestampEpsilon, &p.last[from])
+}
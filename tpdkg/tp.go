@@ -0,0 +1,438 @@
+package tpdkg
+
+// The trusted party
+//
+// The TP relays every message between the peers and checks each one before
+// it passes it on, so that a peer only ever sees authenticated messages of
+// the current step. It keeps the encrypted shares, signed by their dealers,
+// to settle complaints: an accuser reveals its ephemeral X25519 key, which
+// the TP checks against the key the accuser published in step 1, and the TP
+// decrypts the disputed share with it. A share that does not decrypt or does
+// not match the dealer's commitments convicts the dealer; a valid one
+// convicts the accuser. Revealing the key exposes the accuser's other shares
+// to the TP, but the ceremony aborts anyway.
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"time"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/dkg"
+	"github.com/wurp/go-oprf/internal/wire"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// TPConfig configures the trusted party.
+//
+// - N: The number of peers
+// - Threshold: The number of shares needed to use the key
+// - ProtoName: The name of the protocol instance, bound to the session ID
+// - SigningKey: The TP's long-term Ed25519 key
+// - PeerKeys: The peers' long-term Ed25519 public keys, PeerKeys[i-1] for peer i
+// - TimestampEpsilon: The maximum clock difference to a peer, or 0 for none
+type TPConfig struct {
+	N                uint16
+	Threshold        uint16
+	ProtoName        []byte
+	SigningKey       ed25519.PrivateKey
+	PeerKeys         []ed25519.PublicKey
+	TimestampEpsilon time.Duration
+}
+
+// TPState is the trusted party of a tp-dkg ceremony, like liboprf's
+// TP_DKG_TPState.
+type TPState struct {
+	config     TPConfig
+	session    [SessionIDBytes]byte
+	transcript hash.Hash
+	// step is the number of the peer messages Next expects
+	step uint8
+	// last is the timestamp of every peer's latest message
+	last []uint64
+
+	sigKeys     []ed25519.PublicKey
+	boxKeys     []*ecdh.PublicKey
+	commitments [][]*ristretto255.Element
+	// shares[i][j] is the share message of dealer i+1 for peer j+1
+	shares     [][]*wire.Message
+	complaints [][]uint16
+	cheaters   []Cheater
+	done       bool
+}
+
+// NewTP starts a ceremony as the trusted party.
+//
+// Parameters:
+//   - config: The ceremony parameters
+//
+// Returns:
+//   - The TP
+//   - The first message, for all peers
+func NewTP(config TPConfig) (*TPState, []byte, error) {
+	if config.Threshold < 2 || config.Threshold > config.N || config.N == Broadcast {
+		return nil, nil, errors.New("tpdkg: invalid threshold or number of peers")
+	}
+	if len(config.PeerKeys) != int(config.N) {
+		return nil, nil, errors.New("tpdkg: need a public key for every peer")
+	}
+	for _, key := range config.PeerKeys {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("tpdkg: invalid peer key")
+		}
+	}
+	if len(config.SigningKey) != ed25519.PrivateKeySize {
+		return nil, nil, errors.New("tpdkg: invalid signing key")
+	}
+
+	var nonce [32]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, nil, err
+	}
+
+	tp := &TPState{
+		config:      config,
+		session:     wire.SessionID(config.ProtoName, nonce[:]),
+		step:        msgKeys,
+		last:        make([]uint64, config.N),
+		sigKeys:     make([]ed25519.PublicKey, config.N),
+		boxKeys:     make([]*ecdh.PublicKey, config.N),
+		commitments: make([][]*ristretto255.Element, config.N),
+		shares:      make([][]*wire.Message, config.N),
+		complaints:  make([][]uint16, config.N),
+	}
+	tp.transcript = newTranscript(tp.session)
+
+	data := binary.BigEndian.AppendUint16(nil, config.N)
+	data = binary.BigEndian.AppendUint16(data, config.Threshold)
+	data = append(data, config.SigningKey.Public().(ed25519.PublicKey)...)
+	msg0 := wire.New(config.SigningKey, msgParams, TP, Broadcast, append(data, nonce[:]...))
+	m, _, _ := wire.Parse(msg0)
+	wire.Record(tp.transcript, m)
+	return tp, msg0, nil
+}
+
+// Next runs one step of the ceremony.
+//
+// Parameters:
+//   - inputs: The message of every peer for this step, inputs[i-1] for peer i
+//
+// Returns the message for every peer, outputs[i-1] for peer i. When a peer
+// cheats, the outputs are the verdict that aborts the ceremony, and the TP is
+// done with Cheaters set.
+func (tp *TPState) Next(inputs [][]byte) ([][]byte, error) {
+	if tp.done {
+		return nil, errors.New("tpdkg: ceremony is over")
+	}
+	if len(inputs) != int(tp.config.N) {
+		return nil, errors.New("tpdkg: need one message from every peer")
+	}
+
+	var outputs [][]byte
+	switch tp.step {
+	case msgKeys:
+		outputs = tp.keys(inputs)
+	case msgCommitments:
+		outputs = tp.deal(inputs)
+	case msgComplaints:
+		outputs = tp.collectComplaints(inputs)
+	case msgReveal:
+		outputs = tp.judge(inputs)
+	case msgTranscript:
+		outputs = tp.finish(inputs)
+	}
+
+	if len(tp.cheaters) > 0 && !tp.done {
+		// A step caught cheaters: abort with the verdict
+		outputs = tp.broadcast(msgVerdict, encodeCheaters(tp.cheaters))
+		tp.done = true
+	}
+	return outputs, nil
+}
+
+// Done reports whether the ceremony is over, like tpdkg_tp_not_done() negated
+func (tp *TPState) Done() bool {
+	return tp.done
+}
+
+// Cheaters returns the peers that were caught cheating
+func (tp *TPState) Cheaters() []Cheater {
+	return tp.cheaters
+}
+
+// SessionID returns the ID of the ceremony
+func (tp *TPState) SessionID() [SessionIDBytes]byte {
+	return tp.session
+}
+
+// keys checks the peers' ephemeral keys and broadcasts them
+func (tp *TPState) keys(inputs [][]byte) [][]byte {
+	var data []byte
+	for i, input := range inputs {
+		peer := uint16(i + 1)
+		m := tp.receive(input, tp.config.PeerKeys[i], msgKeys, peer, TP)
+		if m == nil {
+			continue
+		}
+		if len(m.Data) != keyBytes {
+			tp.cheat(InvalidPayload, peer, 0)
+			continue
+		}
+		boxKey, err := ecdh.X25519().NewPublicKey(m.Data[ed25519.PublicKeySize:])
+		if err != nil {
+			tp.cheat(InvalidPayload, peer, 0)
+			continue
+		}
+		tp.sigKeys[i] = m.Data[:ed25519.PublicKeySize]
+		tp.boxKeys[i] = boxKey
+		wire.Record(tp.transcript, m)
+		data = append(data, m.Raw...)
+	}
+
+	tp.step = msgCommitments
+	return tp.broadcast(msgKeyBundle, data)
+}
+
+// deal checks the commitments and shares of every dealer and routes them
+func (tp *TPState) deal(inputs [][]byte) [][]byte {
+	n := int(tp.config.N)
+	var commitments []byte
+	for i, input := range inputs {
+		dealer := uint16(i + 1)
+		m, rest, err := wire.Parse(input)
+		if err != nil {
+			tp.cheat(InvalidMessage, dealer, 0)
+			continue
+		}
+		if m = tp.check(m, msgCommitments, dealer, Broadcast); m == nil {
+			continue
+		}
+		if tp.commitments[i], err = decodeCommitments(m.Data, tp.config.Threshold); err != nil {
+			tp.cheat(InvalidPayload, dealer, 0)
+			continue
+		}
+		wire.Record(tp.transcript, m)
+		commitments = append(commitments, m.Raw...)
+
+		shares, err := wire.ParseAll(rest, n-1)
+		if err != nil {
+			tp.cheat(InvalidMessage, dealer, 0)
+			continue
+		}
+		tp.shares[i] = make([]*wire.Message, n)
+		for _, share := range shares {
+			// The shares go to the other peers, one each, in any order
+			recipient := share.To
+			if recipient < 1 || int(recipient) > n || recipient == dealer || tp.shares[i][recipient-1] != nil {
+				tp.cheat(InvalidMessage, dealer, 0)
+				break
+			}
+			if tp.shares[i][recipient-1] = tp.check(share, msgShare, dealer, recipient); tp.shares[i][recipient-1] == nil {
+				break
+			}
+		}
+	}
+	if len(tp.cheaters) > 0 {
+		return nil
+	}
+
+	outputs := make([][]byte, n)
+	for j := range outputs {
+		data := append([]byte(nil), commitments...)
+		for i := range n {
+			if i != j {
+				data = append(data, tp.shares[i][j].Raw...)
+			}
+		}
+		outputs[j] = wire.New(tp.config.SigningKey, msgDeal, TP, uint16(j+1), data)
+	}
+	tp.step = msgComplaints
+	return outputs
+}
+
+// collectComplaints checks the complaints and broadcasts them
+func (tp *TPState) collectComplaints(inputs [][]byte) [][]byte {
+	var data []byte
+	for i, input := range inputs {
+		accuser := uint16(i + 1)
+		m := tp.receive(input, tp.sigKeys[i], msgComplaints, accuser, Broadcast)
+		if m == nil {
+			continue
+		}
+		complaints, err := decodeComplaints(m.Data, tp.config.N, accuser)
+		if err != nil {
+			tp.cheat(InvalidPayload, accuser, 0)
+			continue
+		}
+		tp.complaints[i] = complaints
+		wire.Record(tp.transcript, m)
+		data = append(data, m.Raw...)
+	}
+
+	tp.step = msgReveal
+	return tp.broadcast(msgComplaintBundle, data)
+}
+
+// judge settles the complaints with the accusers' revealed keys and
+// broadcasts the verdict
+func (tp *TPState) judge(inputs [][]byte) [][]byte {
+	for i, input := range inputs {
+		accuser := uint16(i + 1)
+		m := tp.receive(input, tp.sigKeys[i], msgReveal, accuser, TP)
+		if m == nil || len(tp.complaints[i]) == 0 {
+			continue
+		}
+
+		key, err := ecdh.X25519().NewPrivateKey(m.Data)
+		if err != nil || !key.PublicKey().Equal(tp.boxKeys[i]) {
+			tp.cheat(InvalidReveal, accuser, 0)
+			continue
+		}
+		for _, dealer := range tp.complaints[i] {
+			if tp.verifyShare(key, dealer, accuser) {
+				tp.cheat(FalseComplaint, accuser, dealer)
+			} else {
+				tp.cheat(InvalidShare, dealer, accuser)
+			}
+		}
+	}
+	if len(tp.cheaters) > 0 {
+		return nil
+	}
+
+	outputs := tp.broadcast(msgVerdict, encodeCheaters(nil))
+	m, _, _ := wire.Parse(outputs[0])
+	wire.Record(tp.transcript, m)
+	tp.step = msgTranscript
+	return outputs
+}
+
+// finish compares the peers' transcripts with the TP's and ends the ceremony
+func (tp *TPState) finish(inputs [][]byte) [][]byte {
+	transcript := tp.transcript.Sum(nil)
+	for i, input := range inputs {
+		peer := uint16(i + 1)
+		m := tp.receive(input, tp.sigKeys[i], msgTranscript, peer, TP)
+		if m != nil && !bytes.Equal(m.Data, transcript) {
+			tp.cheat(TranscriptMismatch, peer, 0)
+		}
+	}
+
+	tp.done = true
+	return tp.broadcast(msgFinal, encodeCheaters(tp.cheaters))
+}
+
+// verifyShare decrypts the share of dealer for accuser with the accuser's
+// revealed key and checks it against the dealer's commitments
+func (tp *TPState) verifyShare(key *ecdh.PrivateKey, dealer, accuser uint16) bool {
+	pair, err := wire.PairKey(shareContext, tp.session, key, tp.boxKeys[dealer-1], dealer, accuser)
+	if err != nil {
+		return false
+	}
+	plaintext, err := wire.OpenShare(tp.session, pair, dealer, accuser, tp.shares[dealer-1][accuser-1].Data)
+	if err != nil {
+		return false
+	}
+	var share toprf.Share16
+	if err := share.UnmarshalBinary(plaintext); err != nil || share.Index != accuser {
+		return false
+	}
+	return dkg.VerifyCommitment16(tp.config.N, tp.config.Threshold, accuser, dealer, tp.commitments[dealer-1], share) == nil
+}
+
+// receive parses and checks a message that must fill input, and reports the
+// sender if it fails
+func (tp *TPState) receive(input []byte, key ed25519.PublicKey, number uint8, from, to uint16) *wire.Message {
+	m, rest, err := wire.Parse(input)
+	if err != nil || len(rest) != 0 {
+		tp.cheat(InvalidMessage, from, 0)
+		return nil
+	}
+	return tp.checkWith(m, key, number, from, to)
+}
+
+// check checks a message from a peer against its ephemeral key
+func (tp *TPState) check(m *wire.Message, number uint8, from, to uint16) *wire.Message {
+	return tp.checkWith(m, tp.sigKeys[from-1], number, from, to)
+}
+
+// checkWith checks a message from a peer and reports the peer if it fails
+func (tp *TPState) checkWith(m *wire.Message, key ed25519.PublicKey, number uint8, from, to uint16) *wire.Message {
+	if err := m.Check(key, number, from, to, tp.config.TimestampEpsilon, &tp.last[from-1]); err != nil {
+		tp.cheat(offense(err), from, 0)
+		return nil
+	}
+	return m
+}
+
+// cheat records a cheater at the current step
+func (tp *TPState) cheat(offense Offense, peer, other uint16) {
+	tp.cheaters = append(tp.cheaters, Cheater{Step: tp.step, Offense: offense, Peer: peer, Other: other})
+}
+
+// broadcast signs a message for all peers
+func (tp *TPState) broadcast(number uint8, data []byte) [][]byte {
+	m := wire.New(tp.config.SigningKey, number, TP, Broadcast, data)
+	outputs := make([][]byte, tp.config.N)
+	for k := range outputs {
+		outputs[k] = m
+	}
+	return outputs
+}
+
+// decodeCommitments decodes the Feldman commitments of a dealer
+func decodeCommitments(data []byte, threshold uint16) ([]*ristretto255.Element, error) {
+	if len(data) != int(threshold)*dkg.ElementBytes {
+		return nil, errors.New("tpdkg: invalid commitments")
+	}
+	commitments := make([]*ristretto255.Element, threshold)
+	for k := range commitments {
+		commitments[k] = ristretto255.NewElement()
+		if err := commitments[k].Decode(data[k*dkg.ElementBytes : (k+1)*dkg.ElementBytes]); err != nil {
+			return nil, err
+		}
+	}
+	return commitments, nil
+}
+
+// encodeCommitments encodes the Feldman commitments of a dealer
+func encodeCommitments(commitments []*ristretto255.Element) []byte {
+	var data []byte
+	for _, c := range commitments {
+		data = c.Encode(data)
+	}
+	return data
+}
+
+// encodeComplaints encodes the dealers a peer complains about
+func encodeComplaints(dealers []uint16) []byte {
+	data := binary.BigEndian.AppendUint16(nil, uint16(len(dealers)))
+	for _, dealer := range dealers {
+		data = binary.BigEndian.AppendUint16(data, dealer)
+	}
+	return data
+}
+
+// decodeComplaints decodes the dealers a peer complains about: a 2-byte
+// count and distinct 2-byte indexes of other peers
+func decodeComplaints(data []byte, n, accuser uint16) ([]uint16, error) {
+	if len(data) < 2 || len(data) != 2+2*int(binary.BigEndian.Uint16(data)) {
+		return nil, errors.New("tpdkg: invalid complaints")
+	}
+	complaints := make([]uint16, binary.BigEndian.Uint16(data))
+	seen := make(map[uint16]bool)
+	for k := range complaints {
+		dealer := binary.BigEndian.Uint16(data[2+2*k:])
+		if dealer < 1 || dealer > n || dealer == accuser || seen[dealer] {
+			return nil, errors.New("tpdkg: invalid complaints")
+		}
+		seen[dealer] = true
+		complaints[k] = dealer
+	}
+	return complaints, nil
+}
@@ -0,0 +1,238 @@
+package tpdkg
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gtank/ristretto255"
+	"github.com/wurp/go-oprf/dkg"
+	"github.com/wurp/go-oprf/internal/wire"
+	"github.com/wurp/go-oprf/toprf"
+)
+
+// tamperFunc may replace the message a peer sends the TP at a step
+type tamperFunc func(number uint8, peer *PeerState, raw []byte) []byte
+
+// ceremony runs tp-dkg with n peers and returns the TP, the peers and the
+// error every peer ended with
+func ceremony(t *testing.T, n, threshold uint16, tamper tamperFunc) (*TPState, []*PeerState, []error) {
+	t.Helper()
+
+	tpPublic, tpKey, _ := ed25519.GenerateKey(nil)
+	keys := make([]ed25519.PrivateKey, n)
+	public := make([]ed25519.PublicKey, n)
+	for i := range keys {
+		public[i], keys[i], _ = ed25519.GenerateKey(nil)
+	}
+
+	proto := []byte("tpdkg test")
+	tp, msg0, err := NewTP(TPConfig{
+		N:                n,
+		Threshold:        threshold,
+		ProtoName:        proto,
+		SigningKey:       tpKey,
+		PeerKeys:         public,
+		TimestampEpsilon: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewTP failed: %v", err)
+	}
+
+	peers := make([]*PeerState, n)
+	inputs := make([][]byte, n)
+	for i := range peers {
+		peers[i], inputs[i], err = NewPeer(PeerConfig{
+			Self:             uint16(i + 1),
+			ProtoName:        proto,
+			SigningKey:       keys[i],
+			PeerKeys:         public,
+			TPKey:            tpPublic,
+			TimestampEpsilon: time.Minute,
+		}, msg0)
+		if err != nil {
+			t.Fatalf("NewPeer failed: %v", err)
+		}
+	}
+
+	errs := make([]error, n)
+	for !tp.Done() {
+		number := tp.step
+		if tamper != nil {
+			for i := range inputs {
+				inputs[i] = tamper(number, peers[i], inputs[i])
+			}
+		}
+		outputs, err := tp.Next(inputs)
+		if err != nil {
+			t.Fatalf("TP step %d failed: %v", number, err)
+		}
+		for i, p := range peers {
+			inputs[i], errs[i] = p.Next(outputs[i])
+			if errs[i] != nil && !tp.Done() {
+				t.Fatalf("Peer %d failed at step %d: %v", i+1, number+1, errs[i])
+			}
+		}
+	}
+	return tp, peers, errs
+}
+
+// checkAborted checks that the TP and every peer report the same cheaters
+func checkAborted(t *testing.T, tp *TPState, errs []error, want []Cheater) {
+	t.Helper()
+
+	if !slices.Equal(tp.Cheaters(), want) {
+		t.Errorf("TP cheaters = %v, want %v", tp.Cheaters(), want)
+	}
+	for i, err := range errs {
+		var cheaters *CheatersError
+		if !errors.As(err, &cheaters) || !slices.Equal(cheaters.Cheaters, want) {
+			t.Errorf("Peer %d: error = %v, want cheaters %v", i+1, err, want)
+		}
+	}
+}
+
+// TestCeremony tests a ceremony without cheaters
+func TestCeremony(t *testing.T) {
+	tp, peers, errs := ceremony(t, 5, 3, nil)
+	if len(tp.Cheaters()) != 0 {
+		t.Fatalf("Cheaters = %v", tp.Cheaters())
+	}
+
+	var shares []toprf.Share16
+	var group *dkg.Result
+	for i, p := range peers {
+		if errs[i] != nil || !p.Done() || p.SessionID() != tp.SessionID() {
+			t.Fatalf("Peer %d: error %v, done %v", i+1, errs[i], p.Done())
+		}
+		share, result, err := p.Result()
+		if err != nil {
+			t.Fatalf("Result failed: %v", err)
+		}
+		if group == nil {
+			group = result
+		} else if result.PublicKey.Equal(group.PublicKey) != 1 {
+			t.Errorf("Peer %d: different group key", i+1)
+		}
+		shares = append(shares, share)
+	}
+
+	secret, err := dkg.Reconstruct16(shares[2:])
+	if err != nil {
+		t.Fatalf("Reconstruct failed: %v", err)
+	}
+	if ristretto255.NewElement().ScalarBaseMult(secret).Equal(group.PublicKey) != 1 {
+		t.Error("Shares do not reconstruct the group key")
+	}
+}
+
+// TestCeremonyCheaters tests that the TP reports cheating peers and that
+// everyone aborts
+func TestCeremonyCheaters(t *testing.T) {
+	t.Run("bad share", func(t *testing.T) {
+		// Dealer 1 sends peer 3 a share that does not decrypt
+		tp, _, errs := ceremony(t, 4, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number != msgCommitments || p.config.Self != 1 {
+				return raw
+			}
+			messages, _ := wire.ParseAll(raw, 4)
+			for _, m := range messages[1:] {
+				if m.To == 3 {
+					m.Raw[len(m.Raw)-1] ^= 1
+					copy(m.Raw, resign(p.sigKey, m.Raw))
+				}
+			}
+			return raw
+		})
+		checkAborted(t, tp, errs, []Cheater{{Step: msgReveal, Offense: InvalidShare, Peer: 1, Other: 3}})
+	})
+
+	t.Run("false complaint", func(t *testing.T) {
+		// Peer 2 complains about the valid share of dealer 4
+		tp, _, errs := ceremony(t, 4, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if p.config.Self != 2 {
+				return raw
+			}
+			switch number {
+			case msgComplaints:
+				return wire.New(p.sigKey, msgComplaints, 2, Broadcast, encodeComplaints([]uint16{4}))
+			case msgReveal:
+				return wire.New(p.sigKey, msgReveal, 2, TP, p.boxKey.Bytes())
+			}
+			return raw
+		})
+		checkAborted(t, tp, errs, []Cheater{{Step: msgReveal, Offense: FalseComplaint, Peer: 2, Other: 4}})
+	})
+
+	t.Run("missing reveal", func(t *testing.T) {
+		// Peer 2 complains but does not reveal its key
+		tp, _, errs := ceremony(t, 3, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number == msgComplaints && p.config.Self == 2 {
+				return wire.New(p.sigKey, msgComplaints, 2, Broadcast, encodeComplaints([]uint16{1}))
+			}
+			return raw
+		})
+		checkAborted(t, tp, errs, []Cheater{{Step: msgReveal, Offense: InvalidReveal, Peer: 2}})
+	})
+
+	t.Run("stale message", func(t *testing.T) {
+		// Peer 3 replays a commitments message from an hour ago
+		tp, _, errs := ceremony(t, 3, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number != msgCommitments || p.config.Self != 3 {
+				return raw
+			}
+			m, rest, _ := wire.Parse(raw)
+			old := wire.NewAt(p.sigKey, m.Number, m.From, m.To, uint64(time.Now().Add(-time.Hour).Unix()), m.Data)
+			return append(old, rest...)
+		})
+		checkAborted(t, tp, errs, []Cheater{{Step: msgCommitments, Offense: StaleMessage, Peer: 3}})
+	})
+
+	t.Run("transcript mismatch", func(t *testing.T) {
+		// Peer 1 reports a different transcript
+		tp, peers, errs := ceremony(t, 3, 2, func(number uint8, p *PeerState, raw []byte) []byte {
+			if number == msgTranscript && p.config.Self == 1 {
+				return wire.New(p.sigKey, msgTranscript, 1, TP, make([]byte, TranscriptBytes))
+			}
+			return raw
+		})
+		checkAborted(t, tp, errs, []Cheater{{Step: msgTranscript, Offense: TranscriptMismatch, Peer: 1}})
+		if _, _, err := peers[0].Result(); err == nil {
+			t.Error("Result succeeded after an aborted ceremony")
+		}
+	})
+}
+
+// TestPeerRejectsTP tests that a peer only accepts messages of its TP
+func TestPeerRejectsTP(t *testing.T) {
+	_, tpKey, _ := ed25519.GenerateKey(nil)
+	otherPublic, _, _ := ed25519.GenerateKey(nil)
+	public, key, _ := ed25519.GenerateKey(nil)
+
+	tp, msg0, err := NewTP(TPConfig{N: 2, Threshold: 2, SigningKey: tpKey, PeerKeys: []ed25519.PublicKey{public, public}})
+	if err != nil {
+		t.Fatalf("NewTP failed: %v", err)
+	}
+	config := PeerConfig{Self: 1, SigningKey: key, PeerKeys: []ed25519.PublicKey{public, public}, TPKey: otherPublic}
+	if _, _, err := NewPeer(config, msg0); err == nil {
+		t.Error("NewPeer accepted an unknown TP")
+	}
+
+	config.TPKey = nil
+	peer, _, err := NewPeer(config, msg0)
+	if err != nil {
+		t.Fatalf("NewPeer failed: %v", err)
+	}
+	if peer.SessionID() != tp.SessionID() {
+		t.Error("Session IDs differ")
+	}
+	if _, err := peer.Next(resign(key, msg0)); err == nil {
+		t.Error("Next accepted a message signed by another key")
+	}
+
+	if _, _, err := NewTP(TPConfig{N: 2, Threshold: 3, SigningKey: tpKey, PeerKeys: []ed25519.PublicKey{public, public}}); err == nil {
+		t.Error("NewTP accepted a threshold above n")
+	}
+}
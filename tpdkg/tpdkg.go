@@ -0,0 +1,251 @@
+// Package tpdkg implements a trusted-party distributed key generation,
+// modeled on the tp-dkg of liboprf but not compatible with it (see
+// Compatibility).
+//
+// In tp-dkg the peers never talk to each other directly. A trusted party
+// (TP) orchestrates the ceremony: it knows the long-term signing keys of all
+// peers, relays every message, and decides who cheated when a peer
+// complains. The TP learns nothing about the generated key: the shares travel
+// encrypted from peer to peer. It is trusted to relay faithfully and to judge
+// complaints honestly, and a final transcript check catches a TP that shows
+// different broadcasts to different peers.
+//
+// # Protocol
+//
+// Both roles are step machines that consume and produce opaque messages, so
+// that any transport can carry them. The TP is created with NewTP, which
+// returns the first message for all peers, and then fed one message from
+// every peer per step with TP.Next. A peer is created with NewPeer from the
+// TP's first message and then fed every following TP message with Peer.Next.
+//
+//  0. TP: the parameters n and threshold, the TP's signing key and a nonce
+//     that, with the protocol name, makes the session ID.
+//  1. Peer: ephemeral Ed25519 and X25519 keys for the session, signed with
+//     the peer's long-term key.
+//  2. TP: all peers' key messages.
+//  3. Peer: Feldman commitments to a random polynomial (dkg.Start), and
+//  4. for every other peer, its share encrypted under an X25519 pair key.
+//  5. TP: to every peer, all commitments and the shares for that peer.
+//  6. Peer: the dealers whose share did not verify.
+//  7. TP: all peers' complaints.
+//  8. Peer: an accuser reveals its ephemeral X25519 key, so that the TP can
+//     decrypt the disputed shares.
+//  9. TP: the verdict, the list of cheaters. The ceremony aborts if it is
+//     not empty.
+//  10. Peer: the hash of its transcript of the broadcasts.
+//  11. TP: the final verdict, with the peers whose transcript differs from
+//     the TP's.
+//
+// A peer finishes with its share of the key and the public dkg.Result. The
+// TP sends a verdict as soon as it detects a cheater, at any step, and all
+// peers abort with a CheatersError.
+//
+// # Messages
+//
+// Every message has a header laid out like liboprf's TP_DKG_Message, with
+// big-endian integers, but with 16-bit sender and recipient indexes:
+//
+//	sig[64] | msgno[1] | len[4] | from[2] | to[2] | ts[8] | data[len-81]
+//
+// len is the length of the whole message, from and to are peer indexes with
+// 0 for the TP and 0xffff for a broadcast, and ts is the Unix time in seconds
+// at which it was sent. sig is an Ed25519 signature of everything after it:
+// by the TP's key for TP messages, by the peer's long-term key for its key
+// message, and by its ephemeral key for all others. Receivers reject
+// messages whose timestamp is more than the configured epsilon away from
+// their clock, or older than the sender's previous message.
+//
+// # Compatibility
+//
+// This package does not interoperate with liboprf. The protocol steps and
+// roles follow liboprf's tp-dkg.c, but the C version sends the shares over
+// Noise XK channels between the peers, while this package seals each share
+// with ChaCha20-Poly1305 under a pair key derived from the peers' ephemeral
+// X25519 keys, like dkg's seal.go. Its payloads from step 3 on are its own,
+// and its header and payloads carry 16-bit peer indexes and toprf.Share16
+// shares, so that a ceremony can have up to 65534 peers. A ceremony must be
+// run entirely with this package.
+package tpdkg
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/wurp/go-oprf/internal/wire"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// HeaderBytes is the size of the message header
+	HeaderBytes = wire.HeaderBytes
+
+	// TP is the index of the trusted party in message headers
+	TP = 0
+
+	// Broadcast is the recipient index of a message to all peers
+	Broadcast = 0xffff
+
+	// SessionIDBytes is the size of a session ID
+	SessionIDBytes = 32
+
+	// TranscriptBytes is the size of a transcript hash
+	TranscriptBytes = blake2b.Size256
+
+	// keyBytes is the size of an ephemeral key message payload: an Ed25519
+	// and an X25519 public key
+	keyBytes = ed25519.PublicKeySize + 32
+
+	// paramsBytes is the size of the parameters payload: n and threshold (2
+	// bytes each), the TP's public key and the session nonce
+	paramsBytes = 4 + ed25519.PublicKeySize + 32
+
+	// cheaterBytes is the size of an encoded Cheater
+	cheaterBytes = 6
+
+	// shareContext is the HKDF info prefix of pair keys
+	shareContext = "go-oprf tp-dkg share v2"
+
+	// transcriptContext starts every transcript
+	transcriptContext = "go-oprf tp-dkg transcript v2"
+)
+
+// Message numbers of the protocol steps
+const (
+	msgParams uint8 = iota
+	msgKeys
+	msgKeyBundle
+	msgCommitments
+	msgShare
+	msgDeal
+	msgComplaints
+	msgComplaintBundle
+	msgReveal
+	msgVerdict
+	msgTranscript
+	msgFinal
+)
+
+// Offense is the reason a peer was reported as a cheater.
+type Offense uint8
+
+const (
+	// InvalidMessage is a message that does not parse or authenticate, or
+	// that has the wrong number, sender or recipient
+	InvalidMessage Offense = iota + 1
+	// StaleMessage is a message whose timestamp is out of bounds
+	StaleMessage
+	// InvalidPayload is a message whose content is malformed, e.g. keys or
+	// commitments that do not decode or complaints against unknown peers
+	InvalidPayload
+	// InvalidShare is a dealer whose share for Other did not decrypt or did
+	// not match its commitments
+	InvalidShare
+	// FalseComplaint is a peer that complained about a valid share from Other
+	FalseComplaint
+	// InvalidReveal is an accuser that did not reveal its ephemeral key
+	InvalidReveal
+	// TranscriptMismatch is a peer whose transcript differs from the TP's
+	TranscriptMismatch
+)
+
+// String returns a description of the offense
+func (o Offense) String() string {
+	switch o {
+	case InvalidMessage:
+		return "invalid message"
+	case StaleMessage:
+		return "stale message"
+	case InvalidPayload:
+		return "invalid payload"
+	case InvalidShare:
+		return "invalid share"
+	case FalseComplaint:
+		return "false complaint"
+	case InvalidReveal:
+		return "invalid key reveal"
+	case TranscriptMismatch:
+		return "transcript mismatch"
+	}
+	return fmt.Sprintf("offense %d", uint8(o))
+}
+
+// Cheater is a peer the TP caught misbehaving, like liboprf's TP_DKG_Cheater.
+type Cheater struct {
+	// Step is the number of the message in which the offense was found
+	Step uint8
+	// Offense is what the peer did
+	Offense Offense
+	// Peer is the index of the cheater
+	Peer uint16
+	// Other is the index of the other peer involved, or 0
+	Other uint16
+}
+
+// String describes the cheater, like liboprf's tpdkg_cheater_msg
+func (c Cheater) String() string {
+	s := fmt.Sprintf("step %d: peer %d: %v", c.Step, c.Peer, c.Offense)
+	if c.Other != 0 {
+		s += fmt.Sprintf(" (peer %d)", c.Other)
+	}
+	return s
+}
+
+// CheatersError is returned by a peer when the TP aborts the ceremony.
+type CheatersError struct {
+	Cheaters []Cheater
+}
+
+func (e *CheatersError) Error() string {
+	descriptions := make([]string, len(e.Cheaters))
+	for k, c := range e.Cheaters {
+		descriptions[k] = c.String()
+	}
+	return "tpdkg: ceremony aborted: " + strings.Join(descriptions, "; ")
+}
+
+// offense returns the offense of a message that failed its check
+func offense(err error) Offense {
+	if errors.Is(err, wire.ErrStale) {
+		return StaleMessage
+	}
+	return InvalidMessage
+}
+
+// newTranscript starts the transcript of a session
+func newTranscript(session [SessionIDBytes]byte) hash.Hash {
+	return wire.NewTranscript(transcriptContext, session)
+}
+
+// encodeCheaters encodes a verdict: a 4-byte count, as every pair of peers
+// can be involved in an offense, and the cheaters
+func encodeCheaters(cheaters []Cheater) []byte {
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(cheaters)))
+	for _, c := range cheaters {
+		data = append(data, c.Step, uint8(c.Offense))
+		data = binary.BigEndian.AppendUint16(data, c.Peer)
+		data = binary.BigEndian.AppendUint16(data, c.Other)
+	}
+	return data
+}
+
+// decodeCheaters decodes a verdict
+func decodeCheaters(data []byte) ([]Cheater, error) {
+	if len(data) < 4 || uint64(len(data)-4) != uint64(binary.BigEndian.Uint32(data))*cheaterBytes {
+		return nil, errors.New("tpdkg: invalid verdict")
+	}
+	cheaters := make([]Cheater, binary.BigEndian.Uint32(data))
+	for k := range cheaters {
+		c := data[4+k*cheaterBytes:]
+		cheaters[k] = Cheater{
+			Step:    c[0],
+			Offense: Offense(c[1]),
+			Peer:    binary.BigEndian.Uint16(c[2:]),
+			Other:   binary.BigEndian.Uint16(c[4:]),
+		}
+	}
+	return cheaters, nil
+}
@@ -0,0 +1,52 @@
+package tpdkg
+
+import (
+	"crypto/ed25519"
+	"slices"
+	"testing"
+)
+
+// resign signs a modified message again
+func resign(key ed25519.PrivateKey, raw []byte) []byte {
+	raw = slices.Clone(raw)
+	copy(raw, ed25519.Sign(key, raw[ed25519.SignatureSize:]))
+	return raw
+}
+
+// TestCheaters tests the encoding of verdicts
+func TestCheaters(t *testing.T) {
+	cheaters := []Cheater{
+		{Step: msgReveal, Offense: InvalidShare, Peer: 1, Other: 3},
+		{Step: msgKeys, Offense: StaleMessage, Peer: 2},
+		{Step: msgReveal, Offense: FalseComplaint, Peer: 300, Other: 65534},
+	}
+	decoded, err := decodeCheaters(encodeCheaters(cheaters))
+	if err != nil || !slices.Equal(decoded, cheaters) {
+		t.Errorf("decodeCheaters = %v, %v", decoded, err)
+	}
+	if _, err := decodeCheaters([]byte{0, 0, 0, 2, 1, 2, 0, 3, 0, 4}); err == nil {
+		t.Error("decodeCheaters accepted a truncated verdict")
+	}
+
+	err = &CheatersError{Cheaters: cheaters[:2]}
+	if want := "tpdkg: ceremony aborted: step 8: peer 1: invalid share (peer 3); step 1: peer 2: stale message"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+// TestComplaints tests the encoding of complaints with 16-bit indexes
+func TestComplaints(t *testing.T) {
+	data := encodeComplaints([]uint16{1, 300})
+	if complaints, err := decodeComplaints(data, 300, 2); err != nil || !slices.Equal(complaints, []uint16{1, 300}) {
+		t.Errorf("decodeComplaints = %v, %v", complaints, err)
+	}
+	if _, err := decodeComplaints(data, 299, 2); err == nil {
+		t.Error("decodeComplaints accepted a dealer above n")
+	}
+	if _, err := decodeComplaints(data, 300, 300); err == nil {
+		t.Error("decodeComplaints accepted a complaint against the accuser itself")
+	}
+	if _, err := decodeComplaints(data[:len(data)-1], 300, 2); err == nil {
+		t.Error("decodeComplaints accepted truncated complaints")
+	}
+}